@@ -1,4 +1,4 @@
-import { DeviceStatus, DeviceType, EventType, Event, ReadyPayload, WebRTCAnswerPayload, WebRTCIceCandidatePayload } from '../types';
+import { DeviceStatus, DeviceType, EventType, Event, NegotiationSDPType, NegotiationTimeoutPayload, ReadyPayload, WebRTCAnswerPayload, WebRTCIceCandidatePayload, WebRTCNegotiationPayload } from '../types';
 import { WebSocketManager } from '../utils/websocket';
 
 export class CameraStateMachine {
@@ -9,6 +9,7 @@ export class CameraStateMachine {
   private peerConnection: RTCPeerConnection | null = null;
   private localStream: MediaStream | null = null;
   private monitorDeviceId: string | null = null;
+  private iceRestarting = false; // 是否有等待应答的ICE重启
   private iceServers: RTCIceServer[] = [
     { urls: 'stun:stun.l.google.com:19302' }
   ];
@@ -51,7 +52,14 @@ export class CameraStateMachine {
       }
 
       // 检查房间内是否有Monitor设备
-      const payload = event.payload as { devices: any[] };
+      const payload = event.payload as { devices: any[], iceServers?: RTCIceServer[], resumed?: boolean };
+      if (payload.iceServers && payload.iceServers.length > 0) {
+        this.iceServers = payload.iceServers;
+      }
+      // 服务重启后恢复了原来的状态，已建立的媒体连接不受影响
+      if (payload.resumed) {
+        return;
+      }
       const monitorDevice = payload.devices.find(device => device.type === DeviceType.Monitor);
 
       if (monitorDevice) {
@@ -115,6 +123,27 @@ export class CameraStateMachine {
       }
     });
 
+    // 重新协商和ICE重启事件，Monitor发起时回复answer，本端发起时设置远程描述
+    this.wsManager.addEventListener(EventType.Renegotiate, (event) => {
+      this.handleNegotiation(EventType.Renegotiate, event.payload as WebRTCNegotiationPayload);
+    });
+    this.wsManager.addEventListener(EventType.IceRestart, (event) => {
+      this.handleNegotiation(EventType.IceRestart, event.payload as WebRTCNegotiationPayload);
+    });
+
+    // 协商超时事件，ICE重启失败时关闭连接，等待Monitor重新就绪后建立新的连接
+    this.wsManager.addEventListener(EventType.NegotiationTimeout, (event) => {
+      const payload = event.payload as NegotiationTimeoutPayload;
+      console.warn(`${payload.kind} 超时未收到应答:`, payload.targetDeviceId);
+      if (payload.kind === EventType.IceRestart) {
+        this.iceRestarting = false;
+        if (this.status === DeviceStatus.Streaming) {
+          this.closePeerConnection();
+          this.updateStatus(DeviceStatus.Connected);
+        }
+      }
+    });
+
     // 设备离开房间事件
     this.wsManager.addEventListener(EventType.LeaveRoom, (event) => {
       if (event.deviceId === this.monitorDeviceId) {
@@ -231,10 +260,12 @@ export class CameraStateMachine {
         if (this.peerConnection?.iceConnectionState === 'disconnected' ||
           this.peerConnection?.iceConnectionState === 'failed') {
           console.warn('ICE连接断开或失败');
+          // 保留已建立的连接，通过ICE重启恢复，超时后再关闭
           if (this.status === DeviceStatus.Streaming) {
-            this.closePeerConnection();
-            this.updateStatus(DeviceStatus.Connected);
+            this.restartIce();
           }
+        } else if (this.peerConnection?.iceConnectionState === 'connected') {
+          this.iceRestarting = false;
         }
       };
     } catch (error) {
@@ -277,6 +308,70 @@ export class CameraStateMachine {
     }
   }
 
+  // 发起ICE重启，同一时间只发起一次
+  private async restartIce(): Promise<void> {
+    if (!this.peerConnection || !this.monitorDeviceId || this.iceRestarting) {
+      return;
+    }
+    this.iceRestarting = true;
+
+    try {
+      const offer = await this.peerConnection.createOffer({ iceRestart: true });
+      await this.peerConnection.setLocalDescription(offer);
+      this.sendNegotiation(EventType.IceRestart, 'offer', offer.sdp);
+    } catch (error) {
+      console.error('ICE重启失败:', error);
+      this.iceRestarting = false;
+    }
+  }
+
+  // 处理重新协商/ICE重启事件
+  private async handleNegotiation(type: EventType.Renegotiate | EventType.IceRestart, payload: WebRTCNegotiationPayload): Promise<void> {
+    if (!this.peerConnection || this.status !== DeviceStatus.Streaming) {
+      return;
+    }
+
+    try {
+      await this.peerConnection.setRemoteDescription(new RTCSessionDescription({
+        type: payload.sdpType,
+        sdp: payload.sdp
+      }));
+
+      if (payload.sdpType === 'offer') {
+        const answer = await this.peerConnection.createAnswer();
+        await this.peerConnection.setLocalDescription(answer);
+        this.sendNegotiation(type, 'answer', answer.sdp);
+      } else if (type === EventType.IceRestart) {
+        this.iceRestarting = false;
+      }
+    } catch (error) {
+      console.error(`处理${type}失败:`, error);
+    }
+  }
+
+  // 发送重新协商/ICE重启事件
+  private sendNegotiation(type: EventType.Renegotiate | EventType.IceRestart, sdpType: NegotiationSDPType, sdp: string | undefined): void {
+    if (!this.monitorDeviceId) {
+      return;
+    }
+
+    const payload: WebRTCNegotiationPayload = {
+      targetDeviceId: this.monitorDeviceId,
+      sdpType,
+      sdp: sdp || ''
+    };
+
+    const event: Event = {
+      type,
+      roomId: this.roomId,
+      deviceId: this.deviceId,
+      timestamp: Date.now(),
+      payload
+    };
+
+    this.wsManager.sendEvent(event);
+  }
+
   // 发送ICE候选者
   private sendIceCandidate(candidate: RTCIceCandidate): void {
     if (!this.monitorDeviceId) {
@@ -302,6 +397,7 @@ export class CameraStateMachine {
 
   // 关闭PeerConnection
   private closePeerConnection(): void {
+    this.iceRestarting = false;
     if (this.peerConnection) {
       this.peerConnection.close();
       this.peerConnection = null;
@@ -1,4 +1,4 @@
-import { WebRTCOfferPayload, WebRTCIceCandidatePayload, DeviceStatus, ReadyPayload, DeviceType, EventType, Event } from '../types';
+import { WebRTCOfferPayload, WebRTCIceCandidatePayload, WebRTCNegotiationPayload, NegotiationTimeoutPayload, DeviceStatus, ReadyPayload, DeviceType, EventType, Event } from '../types';
 import { WebSocketManager } from '../utils/websocket';
 
 // 单个Camera连接的状态机
@@ -16,11 +16,14 @@ class CameraConnectionStateMachine {
   private statusChangeCallback: ((status: DeviceStatus) => void) | null = null;
   private remoteStreamCallback: ((stream: MediaStream) => void) | null = null;
 
-  constructor(cameraDeviceId: string, monitorDeviceId: string, roomId: string, wsManager: WebSocketManager) {
+  constructor(cameraDeviceId: string, monitorDeviceId: string, roomId: string, wsManager: WebSocketManager, iceServers?: RTCIceServer[]) {
     this.cameraDeviceId = cameraDeviceId;
     this.monitorDeviceId = monitorDeviceId;
     this.roomId = roomId;
     this.wsManager = wsManager;
+    if (iceServers && iceServers.length > 0) {
+      this.iceServers = iceServers;
+    }
   }
 
   // 设置状态变化回调
@@ -117,6 +120,48 @@ class CameraConnectionStateMachine {
     }
   }
 
+  // 处理重新协商/ICE重启事件，Camera发起时回复answer，本端发起时设置远程描述
+  async handleNegotiation(type: EventType.Renegotiate | EventType.IceRestart, payload: WebRTCNegotiationPayload): Promise<void> {
+    if (!this.peerConnection || (this.status !== DeviceStatus.Receiving && this.status !== DeviceStatus.Error)) {
+      return;
+    }
+
+    try {
+      await this.peerConnection.setRemoteDescription(new RTCSessionDescription({
+        type: payload.sdpType,
+        sdp: payload.sdp
+      }));
+
+      if (payload.sdpType === 'offer') {
+        const answer = await this.peerConnection.createAnswer();
+        await this.peerConnection.setLocalDescription(answer);
+
+        const event: Event = {
+          type,
+          roomId: this.roomId,
+          deviceId: this.monitorDeviceId,
+          timestamp: Date.now(),
+          payload: {
+            targetDeviceId: this.cameraDeviceId,
+            sdpType: 'answer',
+            sdp: answer.sdp || ''
+          } as WebRTCNegotiationPayload
+        };
+        this.wsManager.sendEvent(event);
+      }
+    } catch (error) {
+      console.error(`处理Camera ${this.cameraDeviceId} ${type}失败:`, error);
+    }
+  }
+
+  // 处理协商超时事件，ICE重启超时说明连接无法恢复
+  handleNegotiationTimeout(payload: NegotiationTimeoutPayload): void {
+    console.warn(`Camera ${this.cameraDeviceId} ${payload.kind} 超时未收到应答`);
+    if (payload.kind === EventType.IceRestart && this.status === DeviceStatus.Receiving) {
+      this.updateStatus(DeviceStatus.Error);
+    }
+  }
+
   // 创建PeerConnection
   private createPeerConnection(): void {
     try {
@@ -151,12 +196,16 @@ class CameraConnectionStateMachine {
       this.peerConnection.oniceconnectionstatechange = () => {
         console.log(`Camera ${this.cameraDeviceId} ICE连接状态:`, this.peerConnection?.iceConnectionState);
 
-        if (this.peerConnection?.iceConnectionState === 'disconnected' ||
-          this.peerConnection?.iceConnectionState === 'failed') {
-          console.warn(`Camera ${this.cameraDeviceId} ICE连接断开或失败`);
+        // 断开时等待Camera发起ICE重启，失败后标记为错误，ICE重启成功后恢复接收
+        if (this.peerConnection?.iceConnectionState === 'disconnected') {
+          console.warn(`Camera ${this.cameraDeviceId} ICE连接断开，等待ICE重启`);
+        } else if (this.peerConnection?.iceConnectionState === 'failed') {
+          console.warn(`Camera ${this.cameraDeviceId} ICE连接失败`);
           if (this.status === DeviceStatus.Receiving) {
             this.updateStatus(DeviceStatus.Error);
           }
+        } else if (this.peerConnection?.iceConnectionState === 'connected' && this.status === DeviceStatus.Error) {
+          this.updateStatus(DeviceStatus.Receiving);
         }
       };
     } catch (error) {
@@ -229,6 +278,7 @@ export class MonitorStateMachine {
   private roomId: string;
   private wsManager: WebSocketManager;
   private cameraConnections: Map<string, CameraConnectionStateMachine> = new Map();
+  private iceServers: RTCIceServer[] | undefined; // 服务端在connect事件中下发的ICE服务器
   private statusChangeCallback: ((status: DeviceStatus) => void) | null = null;
   private cameraConnectionCallback: ((cameraId: string, status: 'added' | 'updated' | 'removed', stream?: MediaStream) => void) | null = null;
 
@@ -276,7 +326,8 @@ export class MonitorStateMachine {
         this.updateStatus(DeviceStatus.Connected);
 
         // 获取房间内所有Camera设备
-        const payload = event.payload as { devices: any[] };
+        const payload = event.payload as { devices: any[], iceServers?: RTCIceServer[] };
+        this.iceServers = payload.iceServers;
         const cameraDevices = payload.devices.filter(device => device.type === DeviceType.Camera);
 
         // 为每个Camera设备创建连接状态机
@@ -339,6 +390,22 @@ export class MonitorStateMachine {
       }
     });
 
+    // 重新协商和ICE重启事件
+    this.wsManager.addEventListener(EventType.Renegotiate, (event) => {
+      const payload = event.payload as WebRTCNegotiationPayload;
+      this.cameraConnections.get(event.deviceId)?.handleNegotiation(EventType.Renegotiate, payload);
+    });
+    this.wsManager.addEventListener(EventType.IceRestart, (event) => {
+      const payload = event.payload as WebRTCNegotiationPayload;
+      this.cameraConnections.get(event.deviceId)?.handleNegotiation(EventType.IceRestart, payload);
+    });
+
+    // 协商超时事件，由服务端发给发起协商的设备
+    this.wsManager.addEventListener(EventType.NegotiationTimeout, (event) => {
+      const payload = event.payload as NegotiationTimeoutPayload;
+      this.cameraConnections.get(payload.targetDeviceId)?.handleNegotiationTimeout(payload);
+    });
+
     // 错误事件
     this.wsManager.addEventListener(EventType.Error, (event) => {
       console.error('收到错误事件:', event.payload);
@@ -378,7 +445,8 @@ export class MonitorStateMachine {
       cameraId,
       this.deviceId,
       this.roomId,
-      this.wsManager
+      this.wsManager,
+      this.iceServers
     );
 
     // 设置状态变化回调
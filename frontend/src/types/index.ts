@@ -27,7 +27,11 @@ export enum EventType {
   Error = "error",
   Offer = "offer",
   Answer = "answer",
-  IceCandidate = "ice_candidate"
+  IceCandidate = "ice_candidate",
+  Renegotiate = "renegotiate",
+  IceRestart = "ice_restart",
+  NegotiationTimeout = "negotiation_timeout",
+  ServerShutdown = "server_shutdown"
 }
 
 // 设备信息
@@ -57,6 +61,14 @@ export interface ErrorPayload {
 export interface ConnectPayload {
   device: Device;
   devices: Device[];
+  iceServers?: RTCIceServer[]; // 服务端配置的ICE服务器，未配置时使用客户端默认值
+  resumed?: boolean; // 本次连接是否恢复了交接前的设备状态
+}
+
+export interface ServerShutdownPayload {
+  reconnectDelay: number; // 建议的重连延迟（毫秒）
+  handoff?: boolean; // 是否交接给新进程，重连后可恢复设备状态
+  resumeToken?: string; // 交接后重连时携带，用于恢复设备状态，只能使用一次
 }
 
 export interface JoinRoomPayload {
@@ -86,4 +98,18 @@ export interface WebRTCIceCandidatePayload {
   candidate: string;
   sdpMid: string;
   sdpMLineIndex: number;
-}
\ No newline at end of file
+}
+
+// 重新协商/ICE重启的SDP类型，发起方发送offer，应答方回复同类型事件的answer
+export type NegotiationSDPType = 'offer' | 'answer';
+
+export interface WebRTCNegotiationPayload {
+  targetDeviceId: string;
+  sdpType: NegotiationSDPType;
+  sdp: string;
+}
+
+export interface NegotiationTimeoutPayload {
+  targetDeviceId: string; // 未应答的设备ID
+  kind: EventType.Renegotiate | EventType.IceRestart; // 超时的协商类型
+}
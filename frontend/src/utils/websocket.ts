@@ -1,4 +1,4 @@
-import { Event } from '../types';
+import { Event, EventType, ServerShutdownPayload } from '../types';
 
 export class WebSocketManager {
   private ws: WebSocket | null = null;
@@ -6,6 +6,8 @@ export class WebSocketManager {
   private reconnectAttempts = 0;
   private maxReconnectAttempts = 3;
   private reconnectTimeout: number | null = null;
+  private resumeToken: string | null = null; // 服务交接时下发的恢复凭证，只能使用一次
+  private shutdownDelay: number | null = null; // 服务关闭时建议的重连延迟
 
   constructor(public url: string) { }
 
@@ -13,7 +15,7 @@ export class WebSocketManager {
   connect(): Promise<void> {
     return new Promise((resolve, reject) => {
       try {
-        this.ws = new WebSocket(this.url);
+        this.ws = new WebSocket(this.connectUrl());
 
         this.ws.onopen = () => {
           console.log('WebSocket连接成功');
@@ -87,10 +89,28 @@ export class WebSocketManager {
     }
   }
 
+  // 连接地址，已获得恢复凭证时附加在查询参数中
+  private connectUrl(): string {
+    if (!this.resumeToken) {
+      return this.url;
+    }
+    const separator = this.url.includes('?') ? '&' : '?';
+    return `${this.url}${separator}resumeToken=${encodeURIComponent(this.resumeToken)}`;
+  }
+
   // 处理接收到的事件
   private handleEvent(event: Event): void {
     console.log('收到事件:', event);
 
+    if (event.type === EventType.Connect) {
+      // 凭证已被使用或不再有效，之后的重连按普通加入处理
+      this.resumeToken = null;
+    } else if (event.type === EventType.ServerShutdown) {
+      const payload = event.payload as ServerShutdownPayload;
+      this.shutdownDelay = payload.reconnectDelay;
+      this.resumeToken = payload.resumeToken || null;
+    }
+
     // 调用所有注册的事件监听器
     const listeners = this.eventListeners.get(event.type) || [];
     listeners.forEach(callback => callback(event));
@@ -104,7 +124,11 @@ export class WebSocketManager {
   private attemptReconnect(): void {
     if (this.reconnectAttempts < this.maxReconnectAttempts) {
       this.reconnectAttempts++;
-      const delay = Math.min(1000 * Math.pow(2, this.reconnectAttempts), 30000);
+      // 服务关闭时使用服务端建议的延迟，避免所有设备同时重连
+      const delay = this.shutdownDelay !== null
+        ? this.shutdownDelay
+        : Math.min(1000 * Math.pow(2, this.reconnectAttempts), 30000);
+      this.shutdownDelay = null;
 
       console.log(`尝试重新连接 (${this.reconnectAttempts}/${this.maxReconnectAttempts})，延迟: ${delay}ms`);
 
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultChannel 默认的集群消息频道
+const DefaultChannel = "monitor.cluster"
+
+// Bus 节点间消息总线
+// 所有节点发布和订阅同一个频道，消息会投递给包括发布者在内的所有订阅者，
+// 同一发布者的消息按发布顺序投递
+type Bus interface {
+	// Publish 发布消息
+	Publish(ctx context.Context, data []byte) error
+
+	// Subscribe 订阅消息，handler在总线的接收协程中按顺序调用，只能订阅一次
+	Subscribe(handler func(data []byte)) error
+
+	// Close 取消订阅并关闭连接
+	Close() error
+}
+
+// Config 消息总线和租约存储配置
+type Config struct {
+	Type          string        // 总线类型：redis、nats
+	Channel       string        // 频道名称，为空时使用DefaultChannel；租约存储以此作为key前缀
+	RedisAddr     string        // Redis地址
+	RedisPassword string        // Redis密码
+	NATSURL       string        // NATS服务地址
+	LeaseTTL      time.Duration // 租约有效期，NATS租约存储创建存储桶时使用
+}
+
+// New 根据配置创建消息总线
+func New(config Config) (Bus, error) {
+	if config.Channel == "" {
+		config.Channel = DefaultChannel
+	}
+
+	switch config.Type {
+	case "redis":
+		return NewRedisBus(config.RedisAddr, config.RedisPassword, config.Channel)
+	case "nats":
+		return NewNATSBus(config.NATSURL, config.Channel)
+	default:
+		return nil, fmt.Errorf("unknown cluster bus %q", config.Type)
+	}
+}
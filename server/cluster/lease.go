@@ -0,0 +1,42 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LeaseStore 租约存储，用于保证同一个房间只由一个节点处理
+// 租约在ttl内未续约时自动过期，其他节点可以重新获取
+type LeaseStore interface {
+	// Acquire 尝试获取租约，返回当前持有者；租约空闲或已由owner持有时获取成功并返回owner
+	Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (string, error)
+
+	// Renew 续约，租约已不属于owner时返回false
+	Renew(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error)
+
+	// Release 释放owner持有的租约，租约属于其他节点时不做处理
+	Release(ctx context.Context, key string, owner string) error
+
+	// Holder 获取租约当前持有者，租约空闲时返回空字符串
+	Holder(ctx context.Context, key string) (string, error)
+
+	// Close 关闭连接
+	Close() error
+}
+
+// NewLeaseStore 根据配置创建租约存储，类型为redis或nats
+func NewLeaseStore(storeType string, config Config) (LeaseStore, error) {
+	if config.Channel == "" {
+		config.Channel = DefaultChannel
+	}
+
+	switch storeType {
+	case "redis":
+		return NewRedisLeaseStore(config.RedisAddr, config.RedisPassword, config.Channel)
+	case "nats":
+		return NewNATSLeaseStore(config.NATSURL, config.Channel, config.LeaseTTL)
+	default:
+		return nil, fmt.Errorf("unknown lease store %q", storeType)
+	}
+}
@@ -0,0 +1,206 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// memoryQueueSize 每个内存总线的待投递消息数量上限
+const memoryQueueSize = 1024
+
+// ErrMemoryQueueFull 内存总线的投递队列已满，消息没有投递给该总线
+var ErrMemoryQueueFull = errors.New("memory bus queue full")
+
+// MemoryNetwork 进程内的消息网络，用于测试和单进程内模拟多个节点
+type MemoryNetwork struct {
+	mutex sync.RWMutex
+	buses map[*MemoryBus]struct{}
+}
+
+// NewMemoryNetwork 创建进程内消息网络
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		buses: make(map[*MemoryBus]struct{}),
+	}
+}
+
+// NewBus 创建连接到该网络的消息总线，每个节点使用一个
+func (n *MemoryNetwork) NewBus() *MemoryBus {
+	bus := &MemoryBus{
+		network: n,
+		queue:   make(chan []byte, memoryQueueSize),
+		done:    make(chan struct{}),
+	}
+
+	n.mutex.Lock()
+	n.buses[bus] = struct{}{}
+	n.mutex.Unlock()
+
+	return bus
+}
+
+// MemoryBus 进程内消息总线
+type MemoryBus struct {
+	network *MemoryNetwork
+	queue   chan []byte   // 待投递的消息
+	done    chan struct{} // 关闭后停止投递
+
+	mutex      sync.Mutex
+	subscribed bool
+	closed     bool
+}
+
+// Publish 发布消息到网络内的所有总线，有总线的投递队列已满时返回ErrMemoryQueueFull，
+// 此时其他总线仍会收到消息
+func (b *MemoryBus) Publish(ctx context.Context, data []byte) error {
+	b.mutex.Lock()
+	closed := b.closed
+	b.mutex.Unlock()
+	if closed {
+		return errors.New("bus closed")
+	}
+
+	b.network.mutex.RLock()
+	defer b.network.mutex.RUnlock()
+
+	var err error
+	for bus := range b.network.buses {
+		if enqueueErr := bus.enqueue(append([]byte(nil), data...)); enqueueErr != nil {
+			err = enqueueErr
+		}
+	}
+	return err
+}
+
+// enqueue 将消息加入投递队列，队列已满时返回错误；
+// 不等待队列空闲，避免订阅方处理消息时发布消息造成死锁
+func (b *MemoryBus) enqueue(data []byte) error {
+	select {
+	case b.queue <- data:
+		return nil
+	default:
+		return ErrMemoryQueueFull
+	}
+}
+
+// Subscribe 订阅消息
+func (b *MemoryBus) Subscribe(handler func(data []byte)) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return errors.New("bus closed")
+	}
+	if b.subscribed {
+		return errors.New("already subscribed")
+	}
+	b.subscribed = true
+
+	go func() {
+		for {
+			select {
+			case data := <-b.queue:
+				handler(data)
+			case <-b.done:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close 从网络中移除总线并停止投递
+func (b *MemoryBus) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	b.network.mutex.Lock()
+	delete(b.network.buses, b)
+	b.network.mutex.Unlock()
+
+	close(b.done)
+	return nil
+}
+
+// memoryLease 内存租约
+type memoryLease struct {
+	owner   string
+	expires time.Time
+}
+
+// MemoryLeaseStore 进程内的租约存储，用于测试和单进程内模拟多个节点
+type MemoryLeaseStore struct {
+	mutex  sync.Mutex
+	leases map[string]*memoryLease
+}
+
+// NewMemoryLeaseStore 创建进程内租约存储，多个节点共享同一个实例
+func NewMemoryLeaseStore() *MemoryLeaseStore {
+	return &MemoryLeaseStore{
+		leases: make(map[string]*memoryLease),
+	}
+}
+
+// Acquire 尝试获取租约，返回当前持有者
+func (s *MemoryLeaseStore) Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if lease, exists := s.leases[key]; exists && lease.expires.After(now) {
+		return lease.owner, nil
+	}
+
+	s.leases[key] = &memoryLease{owner: owner, expires: now.Add(ttl)}
+	return owner, nil
+}
+
+// Renew 续约，租约已过期或属于其他持有者时返回false
+func (s *MemoryLeaseStore) Renew(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	lease, exists := s.leases[key]
+	if !exists || lease.owner != owner || !lease.expires.After(now) {
+		return false, nil
+	}
+
+	lease.expires = now.Add(ttl)
+	return true, nil
+}
+
+// Release 释放owner持有的租约
+func (s *MemoryLeaseStore) Release(ctx context.Context, key string, owner string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if lease, exists := s.leases[key]; exists && lease.owner == owner {
+		delete(s.leases, key)
+	}
+	return nil
+}
+
+// Holder 获取租约当前持有者
+func (s *MemoryLeaseStore) Holder(ctx context.Context, key string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if lease, exists := s.leases[key]; exists && lease.expires.After(time.Now()) {
+		return lease.owner, nil
+	}
+	return "", nil
+}
+
+// Close 内存租约存储不需要关闭
+func (s *MemoryLeaseStore) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryBusDeliversToAllBuses(t *testing.T) {
+	network := NewMemoryNetwork()
+	a, b := network.NewBus(), network.NewBus()
+	defer a.Close()
+	defer b.Close()
+
+	received := make(chan string, 2)
+	a.Subscribe(func(data []byte) { received <- "a:" + string(data) })
+	b.Subscribe(func(data []byte) { received <- "b:" + string(data) })
+
+	if err := a.Publish(context.Background(), []byte("hello")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case message := <-received:
+			got[message] = true
+		case <-time.After(time.Second):
+			t.Fatalf("received %v, want both buses", got)
+		}
+	}
+	if !got["a:hello"] || !got["b:hello"] {
+		t.Fatalf("received %v", got)
+	}
+}
+
+func TestMemoryBusQueueFullReturnsError(t *testing.T) {
+	network := NewMemoryNetwork()
+	publisher, slow := network.NewBus(), network.NewBus()
+	defer publisher.Close()
+	defer slow.Close()
+
+	// 未订阅的总线不会取出消息，队列满后发布返回错误而不是静默丢弃
+	for i := 0; i < memoryQueueSize; i++ {
+		if err := publisher.Publish(context.Background(), []byte("m")); err != nil {
+			t.Fatalf("Publish %d: %v", i, err)
+		}
+	}
+	if err := publisher.Publish(context.Background(), []byte("m")); !errors.Is(err, ErrMemoryQueueFull) {
+		t.Fatalf("Publish to a full queue returned %v, want ErrMemoryQueueFull", err)
+	}
+}
+
+func TestMemoryLeaseStore(t *testing.T) {
+	store := NewMemoryLeaseStore()
+	ctx := context.Background()
+
+	if holder, _ := store.Acquire(ctx, "room", "a", time.Minute); holder != "a" {
+		t.Fatalf("first Acquire holder = %q, want a", holder)
+	}
+	if holder, _ := store.Acquire(ctx, "room", "b", time.Minute); holder != "a" {
+		t.Fatalf("second Acquire holder = %q, want a", holder)
+	}
+	if ok, _ := store.Renew(ctx, "room", "b", time.Minute); ok {
+		t.Fatal("Renew succeeded for a node that does not hold the lease")
+	}
+
+	store.Release(ctx, "room", "b")
+	if holder, _ := store.Holder(ctx, "room"); holder != "a" {
+		t.Fatalf("Release by another node changed the holder to %q", holder)
+	}
+	store.Release(ctx, "room", "a")
+	if holder, _ := store.Acquire(ctx, "room", "b", time.Millisecond); holder != "b" {
+		t.Fatalf("Acquire after release holder = %q, want b", holder)
+	}
+
+	// 过期的租约可以被其他节点获取
+	time.Sleep(5 * time.Millisecond)
+	if holder, _ := store.Acquire(ctx, "room", "a", time.Minute); holder != "a" {
+		t.Fatalf("Acquire after expiry holder = %q, want a", holder)
+	}
+}
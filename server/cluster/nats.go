@@ -0,0 +1,231 @@
+package cluster
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"monitor/logger"
+)
+
+// NATSBus 基于NATS主题的消息总线
+type NATSBus struct {
+	conn    *nats.Conn
+	subject string
+
+	mutex        sync.Mutex
+	subscription *nats.Subscription
+}
+
+// NewNATSBus 创建NATS消息总线，断线后无限重连
+func NewNATSBus(url string, subject string) (*NATSBus, error) {
+	if url == "" {
+		url = nats.DefaultURL
+	}
+
+	conn, err := nats.Connect(url,
+		nats.Name("monitor"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			slog.Warn("nats disconnected", logger.KeyError, err)
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			slog.Info("nats reconnected", "url", conn.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NATSBus{
+		conn:    conn,
+		subject: subject,
+	}, nil
+}
+
+// Publish 发布消息
+func (b *NATSBus) Publish(ctx context.Context, data []byte) error {
+	return b.conn.Publish(b.subject, data)
+}
+
+// Subscribe 订阅消息，NATS在单独的协程中按顺序调用handler
+func (b *NATSBus) Subscribe(handler func(data []byte)) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscription != nil {
+		return errors.New("already subscribed")
+	}
+
+	subscription, err := b.conn.Subscribe(b.subject, func(message *nats.Msg) {
+		handler(message.Data)
+	})
+	if err != nil {
+		return err
+	}
+	// 确保订阅已到达服务端，保证返回后发布的消息都能收到
+	if err := b.conn.Flush(); err != nil {
+		subscription.Unsubscribe()
+		return err
+	}
+	b.subscription = subscription
+
+	return nil
+}
+
+// Close 发送缓冲中的消息并关闭连接
+func (b *NATSBus) Close() error {
+	if err := b.conn.Flush(); err != nil {
+		slog.Warn("nats flush failed", logger.KeyError, err)
+	}
+	b.conn.Close()
+	return nil
+}
+
+// NATSLeaseStore 基于NATS JetStream键值存储的租约存储
+// 租约有效期由存储桶的TTL决定，续约时写入新版本重新计时
+type NATSLeaseStore struct {
+	conn *nats.Conn
+	kv   nats.KeyValue
+}
+
+// NewNATSLeaseStore 创建NATS租约存储，存储桶不存在时以ttl创建，NATS服务需要启用JetStream
+func NewNATSLeaseStore(url string, bucket string, ttl time.Duration) (*NATSLeaseStore, error) {
+	if url == "" {
+		url = nats.DefaultURL
+	}
+
+	conn, err := nats.Connect(url, nats.Name("monitor-lease"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	bucket = natsBucketName(bucket)
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:  bucket,
+			TTL:     ttl,
+			History: 1,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &NATSLeaseStore{
+		conn: conn,
+		kv:   kv,
+	}, nil
+}
+
+// Acquire 尝试获取租约，返回当前持有者
+func (s *NATSLeaseStore) Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (string, error) {
+	key = natsKey(key)
+	for {
+		_, err := s.kv.Create(key, []byte(owner))
+		if err == nil {
+			return owner, nil
+		}
+		if !errors.Is(err, nats.ErrKeyExists) {
+			return "", err
+		}
+
+		entry, err := s.kv.Get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			// 租约在两次请求之间过期，重新尝试获取
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(entry.Value()), nil
+	}
+}
+
+// Renew 续约，租约已不属于owner时返回false
+func (s *NATSLeaseStore) Renew(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	key = natsKey(key)
+	entry, err := s.kv.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if string(entry.Value()) != owner {
+		return false, nil
+	}
+
+	// 基于读取到的版本更新，期间被其他节点获取时更新失败
+	if _, err := s.kv.Update(key, []byte(owner), entry.Revision()); err != nil {
+		var apiErr *nats.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Release 释放owner持有的租约
+func (s *NATSLeaseStore) Release(ctx context.Context, key string, owner string) error {
+	key = natsKey(key)
+	entry, err := s.kv.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(entry.Value()) != owner {
+		return nil
+	}
+	return s.kv.Delete(key, nats.LastRevision(entry.Revision()))
+}
+
+// Holder 获取租约当前持有者
+func (s *NATSLeaseStore) Holder(ctx context.Context, key string) (string, error) {
+	entry, err := s.kv.Get(natsKey(key))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(entry.Value()), nil
+}
+
+// Close 关闭连接
+func (s *NATSLeaseStore) Close() error {
+	s.conn.Close()
+	return nil
+}
+
+// natsBucketName 将名称中存储桶不允许的字符替换为下划线
+func natsBucketName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// natsKey 对key编码，房间ID可能包含键值存储不允许的字符
+func natsKey(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
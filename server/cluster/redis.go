@@ -0,0 +1,175 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBus 基于Redis发布/订阅的消息总线
+type RedisBus struct {
+	client  *redis.Client
+	channel string
+
+	mutex  sync.Mutex
+	pubsub *redis.PubSub
+}
+
+// NewRedisBus 创建Redis消息总线，连接失败时返回错误
+func NewRedisBus(addr string, password string, channel string) (*RedisBus, error) {
+	if addr == "" {
+		return nil, errors.New("redis address is required")
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisBus{
+		client:  client,
+		channel: channel,
+	}, nil
+}
+
+// Publish 发布消息
+func (b *RedisBus) Publish(ctx context.Context, data []byte) error {
+	return b.client.Publish(ctx, b.channel, data).Err()
+}
+
+// Subscribe 订阅消息，断线后由客户端自动重新订阅
+func (b *RedisBus) Subscribe(handler func(data []byte)) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.pubsub != nil {
+		return errors.New("already subscribed")
+	}
+
+	ctx := context.Background()
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	// 等待订阅确认，保证返回后发布的消息都能收到
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+	b.pubsub = pubsub
+
+	go func() {
+		for message := range pubsub.Channel() {
+			handler([]byte(message.Payload))
+		}
+	}()
+
+	return nil
+}
+
+// Close 取消订阅并关闭连接
+func (b *RedisBus) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.pubsub != nil {
+		b.pubsub.Close()
+	}
+	return b.client.Close()
+}
+
+// renewScript 租约仍属于owner时延长有效期
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript 租约仍属于owner时删除
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// RedisLeaseStore 基于Redis键过期的租约存储
+type RedisLeaseStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisLeaseStore 创建Redis租约存储，key以prefix加冒号开头
+func NewRedisLeaseStore(addr string, password string, prefix string) (*RedisLeaseStore, error) {
+	if addr == "" {
+		return nil, errors.New("redis address is required")
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisLeaseStore{
+		client: client,
+		prefix: prefix + ":",
+	}, nil
+}
+
+// Acquire 尝试获取租约，返回当前持有者
+func (s *RedisLeaseStore) Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (string, error) {
+	for {
+		acquired, err := s.client.SetNX(ctx, s.prefix+key, owner, ttl).Result()
+		if err != nil {
+			return "", err
+		}
+		if acquired {
+			return owner, nil
+		}
+
+		holder, err := s.client.Get(ctx, s.prefix+key).Result()
+		if errors.Is(err, redis.Nil) {
+			// 租约在两次请求之间过期，重新尝试获取
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return holder, nil
+	}
+}
+
+// Renew 续约，租约已不属于owner时返回false
+func (s *RedisLeaseStore) Renew(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	renewed, err := renewScript.Run(ctx, s.client, []string{s.prefix + key}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return renewed == 1, nil
+}
+
+// Release 释放owner持有的租约
+func (s *RedisLeaseStore) Release(ctx context.Context, key string, owner string) error {
+	return releaseScript.Run(ctx, s.client, []string{s.prefix + key}, owner).Err()
+}
+
+// Holder 获取租约当前持有者
+func (s *RedisLeaseStore) Holder(ctx context.Context, key string) (string, error) {
+	holder, err := s.client.Get(ctx, s.prefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return holder, err
+}
+
+// Close 关闭连接
+func (s *RedisLeaseStore) Close() error {
+	return s.client.Close()
+}
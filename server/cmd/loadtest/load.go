@@ -0,0 +1,447 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"monitor/model"
+)
+
+// 随机注入的设备变动
+const (
+	churnLeave     = "leave"     // 正常断开，稍后重新加入
+	churnJoin      = "join"      // 离开的设备重新加入
+	churnReconnect = "reconnect" // 不发送关闭帧直接断开后立即重连，模拟网络中断
+)
+
+// device 模拟的设备，每次连接使用新的generation，旧连接的读取协程据此退出
+type device struct {
+	id         string
+	roomID     string
+	deviceType model.DeviceType
+
+	mutex       sync.Mutex
+	conn        *websocket.Conn
+	generation  int
+	online      bool            // 已发起连接且未被主动断开
+	connectedAt time.Time       // 本次连接开始的时间，用于统计完整协商耗时
+	negotiated  bool            // 本次连接已完成一次协商
+	offered     map[string]bool // Camera在本次连接中已向哪些Monitor发送offer
+}
+
+// runner 执行压测
+type runner struct {
+	opts    *options
+	stats   *stats
+	dialer  *websocket.Dialer
+	devices []*device
+	wg      sync.WaitGroup
+	stopped atomic.Bool // 压测结束后不再建立新的连接
+}
+
+// run 建立初始连接，注入变动直到压测结束，返回统计结果
+func run(opts *options, stop <-chan os.Signal) *stats {
+	r := &runner{
+		opts:   opts,
+		stats:  newStats(),
+		dialer: &websocket.Dialer{HandshakeTimeout: opts.timeout},
+	}
+	if opts.encoding == model.EncodingMsgpack {
+		r.dialer.Subprotocols = []string{model.SubprotocolMsgpack}
+	}
+
+	for i := 0; i < opts.rooms; i++ {
+		roomID := fmt.Sprintf("%s%d", opts.roomPrefix, i)
+		for j := 0; j < opts.monitors; j++ {
+			r.devices = append(r.devices, newDevice(fmt.Sprintf("%s-m%d", roomID, j), roomID, model.DeviceTypeMonitor))
+		}
+		for j := 0; j < opts.cameras; j++ {
+			r.devices = append(r.devices, newDevice(fmt.Sprintf("%s-c%d", roomID, j), roomID, model.DeviceTypeCamera))
+		}
+	}
+
+	// 在ramp时间内均匀建立初始连接
+	interval := opts.ramp / time.Duration(len(r.devices))
+	for _, d := range r.devices {
+		select {
+		case <-stop:
+			return r.finish()
+		default:
+		}
+
+		r.wg.Add(1)
+		go func(d *device) {
+			defer r.wg.Done()
+			r.connect(d)
+		}(d)
+		time.Sleep(interval)
+	}
+	fmt.Printf("已发起 %d 个连接，开始压测\n", len(r.devices))
+	r.stats.markSteady()
+
+	deadline := time.NewTimer(opts.duration)
+	defer deadline.Stop()
+
+	// 未开启变动时churn为nil，不会触发
+	var churn <-chan time.Time
+	if opts.churn > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.churn))
+		defer ticker.Stop()
+		churn = ticker.C
+	}
+
+	progress := time.NewTicker(10 * time.Second)
+	defer progress.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return r.finish()
+		case <-deadline.C:
+			return r.finish()
+		case <-progress.C:
+			r.stats.printProgress()
+		case <-churn:
+			r.injectChurn()
+		}
+	}
+}
+
+// newDevice 创建模拟设备
+func newDevice(id string, roomID string, deviceType model.DeviceType) *device {
+	return &device{
+		id:         id,
+		roomID:     roomID,
+		deviceType: deviceType,
+		offered:    make(map[string]bool),
+	}
+}
+
+// finish 断开所有设备并等待读取协程退出
+func (r *runner) finish() *stats {
+	r.stopped.Store(true)
+	for _, d := range r.devices {
+		r.disconnect(d, true)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(r.opts.timeout):
+		fmt.Println("等待连接关闭超时")
+	}
+
+	r.stats.finish()
+	return r.stats
+}
+
+// injectChurn 随机选择一个设备离开或断线重连，离开的设备在rejoin-delay后重新加入
+func (r *runner) injectChurn() {
+	d := r.devices[rand.Intn(len(r.devices))]
+
+	d.mutex.Lock()
+	online := d.online
+	d.mutex.Unlock()
+	if !online {
+		return
+	}
+
+	if rand.Intn(2) == 0 {
+		r.stats.addChurn(churnReconnect)
+		r.disconnect(d, false)
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.connect(d)
+		}()
+		return
+	}
+
+	r.stats.addChurn(churnLeave)
+	r.disconnect(d, true)
+	r.wg.Add(1)
+	time.AfterFunc(r.opts.rejoinDelay, func() {
+		defer r.wg.Done()
+		r.stats.addChurn(churnJoin)
+		r.connect(d)
+	})
+}
+
+// connect 建立设备连接并开始读取事件
+func (r *runner) connect(d *device) {
+	if r.stopped.Load() {
+		return
+	}
+
+	query := url.Values{}
+	query.Set("deviceId", d.id)
+	query.Set("deviceType", string(d.deviceType))
+	address := fmt.Sprintf("%s/ws/%s?%s", strings.TrimRight(r.opts.server, "/"), url.PathEscape(d.roomID), query.Encode())
+
+	start := time.Now()
+	conn, response, err := r.dialer.Dial(address, nil)
+	if err != nil {
+		reason := err.Error()
+		if response != nil {
+			reason = fmt.Sprintf("HTTP %d", response.StatusCode)
+		}
+		r.stats.addDialFailure(reason)
+		r.logf("%s 连接失败: %v", d.id, err)
+		return
+	}
+
+	d.mutex.Lock()
+	if r.stopped.Load() {
+		d.mutex.Unlock()
+		conn.Close()
+		return
+	}
+	d.generation++
+	generation := d.generation
+	d.conn = conn
+	d.online = true
+	d.connectedAt = start
+	d.negotiated = false
+	d.offered = make(map[string]bool)
+	d.mutex.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.read(d, conn, generation)
+	}()
+}
+
+// disconnect 主动断开设备连接，graceful为false时不发送关闭帧，模拟网络中断
+func (r *runner) disconnect(d *device, graceful bool) {
+	d.mutex.Lock()
+	conn := d.conn
+	d.conn = nil
+	d.online = false
+	d.mutex.Unlock()
+
+	if conn == nil {
+		return
+	}
+	if graceful {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	}
+	conn.Close()
+}
+
+// read 读取并响应服务端事件，直到连接关闭
+func (r *runner) read(d *device, conn *websocket.Conn, generation int) {
+	// 加入房间后服务端应立即发送connect事件，拒绝加入时直接关闭连接
+	conn.SetReadDeadline(time.Now().Add(r.opts.timeout))
+	joined := false
+
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			d.mutex.Lock()
+			current := d.generation == generation && d.conn == conn
+			if current {
+				d.conn = nil
+				d.online = false
+			}
+			d.mutex.Unlock()
+
+			// 非主动断开的连接计为异常断开，收到connect事件前断开说明加入被拒绝
+			if current && !joined {
+				r.stats.addDialFailure("加入房间被拒绝或超时")
+				r.logf("%s 加入房间失败: %v", d.id, err)
+			} else if current {
+				r.stats.addUnexpectedClose()
+				r.logf("%s 连接异常断开: %v", d.id, err)
+			}
+			return
+		}
+
+		r.stats.addBytesReceived(len(message))
+		event, err := model.DecodeEvent(messageType, message)
+		if err != nil {
+			r.stats.addError("无法解析的消息")
+			continue
+		}
+
+		if event.Type == model.EventTypeConnect {
+			joined = true
+		}
+		r.stats.addReceived(event.Type, sentAt(event.Payload))
+		r.handle(d, conn, event)
+	}
+}
+
+// handle 按真实客户端的流程响应事件
+func (r *runner) handle(d *device, conn *websocket.Conn, event *model.Event) {
+	switch event.Type {
+	case model.EventTypeConnect:
+		conn.SetReadDeadline(time.Time{})
+		d.mutex.Lock()
+		r.stats.addConnect(time.Since(d.connectedAt))
+		d.mutex.Unlock()
+
+		// Camera加入后通知房间内的Monitor，Monitor加入后等待Camera的通知
+		if d.deviceType == model.DeviceTypeCamera {
+			r.send(d, conn, model.EventTypeCameraReady, map[string]interface{}{})
+		}
+
+	case model.EventTypeJoinRoom:
+		if d.deviceType == model.DeviceTypeCamera && isMonitor(event) {
+			r.send(d, conn, model.EventTypeCameraReady, map[string]interface{}{"targetDeviceId": event.DeviceID})
+		}
+
+	case model.EventTypeLeaveRoom:
+		d.mutex.Lock()
+		delete(d.offered, event.DeviceID)
+		d.mutex.Unlock()
+
+	case model.EventTypeCameraReady:
+		r.send(d, conn, model.EventTypeMonitorReady, map[string]interface{}{"targetDeviceId": event.DeviceID})
+
+	case model.EventTypeMonitorReady:
+		d.mutex.Lock()
+		offered := d.offered[event.DeviceID]
+		d.offered[event.DeviceID] = true
+		d.mutex.Unlock()
+
+		if !offered {
+			r.send(d, conn, model.EventTypeOffer, map[string]interface{}{
+				"targetDeviceId": event.DeviceID,
+				"sdp":            syntheticSDP("offer"),
+			})
+		}
+
+	case model.EventTypeOffer:
+		r.send(d, conn, model.EventTypeAnswer, map[string]interface{}{
+			"targetDeviceId": event.DeviceID,
+			"sdp":            syntheticSDP("answer"),
+		})
+		r.sendCandidates(d, conn, event.DeviceID)
+
+	case model.EventTypeAnswer:
+		d.mutex.Lock()
+		if !d.negotiated {
+			d.negotiated = true
+			r.stats.addSetup(time.Since(d.connectedAt))
+		}
+		d.mutex.Unlock()
+		r.sendCandidates(d, conn, event.DeviceID)
+
+	case model.EventTypeError:
+		var payload model.ErrorPayload
+		json.Unmarshal(event.Payload, &payload)
+		r.stats.addError(payload.Error)
+		r.logf("%s 收到错误: %s", d.id, payload.Error)
+	}
+}
+
+// sendCandidates 向对端发送合成的ICE候选
+func (r *runner) sendCandidates(d *device, conn *websocket.Conn, targetDeviceID string) {
+	for i := 0; i < r.opts.ice; i++ {
+		r.send(d, conn, model.EventTypeIceCandidate, map[string]interface{}{
+			"targetDeviceId": targetDeviceID,
+			"candidate":      fmt.Sprintf("candidate:%d 1 udp 2122260223 192.0.2.%d %d typ host", i+1, rand.Intn(254)+1, 10000+rand.Intn(50000)),
+			"sdpMid":         "0",
+			"sdpMLineIndex":  0,
+		})
+	}
+}
+
+// send 发送事件，负载中附带发送时间，接收方据此计算转发延迟
+func (r *runner) send(d *device, conn *websocket.Conn, eventType model.EventType, payload map[string]interface{}) {
+	payload["sentAt"] = time.Now().UnixNano()
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	messageType, message, err := model.EncodeEvent(r.opts.encoding, &model.Event{Type: eventType, Payload: payloadJSON})
+	if err != nil {
+		return
+	}
+
+	// 同一连接的写入需要串行
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.conn != conn {
+		return
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(r.opts.timeout))
+	if err := conn.WriteMessage(messageType, message); err != nil {
+		r.stats.addError("发送失败")
+		r.logf("%s 发送 %s 失败: %v", d.id, eventType, err)
+		return
+	}
+	r.stats.addSent(eventType, len(message))
+}
+
+// logf 输出详细日志
+func (r *runner) logf(format string, args ...interface{}) {
+	if r.opts.verbose {
+		fmt.Printf(format+"\n", args...)
+	}
+}
+
+// isMonitor 判断join_room事件中加入的设备是否为Monitor
+func isMonitor(event *model.Event) bool {
+	var payload model.JoinRoomPayload
+	if err := json.Unmarshal(event.Payload, &payload); err != nil || payload.Device == nil {
+		return false
+	}
+	return payload.Device.Type == model.DeviceTypeMonitor
+}
+
+// sentAt 读取负载中的发送时间，服务端生成的事件没有该字段
+func sentAt(payload json.RawMessage) time.Time {
+	var fields struct {
+		SentAt int64 `json:"sentAt"`
+	}
+	if err := json.Unmarshal(payload, &fields); err != nil || fields.SentAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, fields.SentAt)
+}
+
+// syntheticSDP 生成合成的SDP，大小与只有一路视频的真实SDP相近
+func syntheticSDP(sdpType string) string {
+	setup := "actpass"
+	if sdpType == "answer" {
+		setup = "active"
+	}
+
+	return strings.Join([]string{
+		"v=0",
+		fmt.Sprintf("o=- %d 2 IN IP4 127.0.0.1", rand.Int63()),
+		"s=-",
+		"t=0 0",
+		"a=group:BUNDLE 0",
+		"m=video 9 UDP/TLS/RTP/SAVPF 96 97",
+		"c=IN IP4 0.0.0.0",
+		"a=mid:0",
+		fmt.Sprintf("a=ice-ufrag:%08x", rand.Uint32()),
+		fmt.Sprintf("a=ice-pwd:%016x%08x", rand.Uint64(), rand.Uint32()),
+		"a=fingerprint:sha-256 00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF",
+		"a=setup:" + setup,
+		"a=sendrecv",
+		"a=rtcp-mux",
+		"a=rtpmap:96 VP8/90000",
+		"a=rtpmap:97 rtx/90000",
+		"a=fmtp:97 apt=96",
+		"",
+	}, "\r\n")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/handler"
+	"monitor/model"
+	"monitor/service"
+)
+
+// newSignalingServer 创建进程内的信令服务，返回ws://地址
+func newSignalingServer(t *testing.T) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	auditService, _ := service.NewAuditService(service.AuditConfig{})
+	webhookService, err := service.NewWebhookService(service.WebhookConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewWebhookService: %v", err)
+	}
+	t.Cleanup(webhookService.Close)
+
+	roomService := service.NewRoomService()
+	eventService := service.NewEventService(roomService, service.NewActivityService(), auditService,
+		service.NewQualityService(), service.NewStatusHistoryService(), webhookService)
+	handoffService, err := service.NewHandoffService(roomService, time.Minute)
+	if err != nil {
+		t.Fatalf("NewHandoffService: %v", err)
+	}
+	webSocketHandler := handler.NewWebSocketHandler(roomService, eventService, auditService, handoffService,
+		handler.NewCORS(nil, true), handler.MessageLimits{}, handler.ConnectionLimits{})
+
+	r := gin.New()
+	r.GET("/ws/:roomId", webSocketHandler.AdmitWebSocket, webSocketHandler.HandleWebSocket)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// quietStdout 在测试期间丢弃压测过程中输出的进度
+func quietStdout(t *testing.T) {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(io.Discard, reader)
+	}()
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		writer.Close()
+		<-done
+	})
+}
+
+func TestRunCompletesNegotiation(t *testing.T) {
+	quietStdout(t)
+
+	for _, encoding := range []model.Encoding{model.EncodingJSON, model.EncodingMsgpack} {
+		opts := &options{
+			server:     newSignalingServer(t),
+			rooms:      3,
+			cameras:    2,
+			monitors:   1,
+			roomPrefix: "lt",
+			encoding:   encoding,
+			ice:        2,
+			ramp:       50 * time.Millisecond,
+			duration:   500 * time.Millisecond,
+			timeout:    5 * time.Second,
+		}
+		s := run(opts, make(chan os.Signal))
+
+		if errors := report(s); errors != 0 {
+			t.Fatalf("%s: %d errors: dial %v, server %v, unexpected closes %d",
+				encoding, errors, s.dialFailures, s.serverErrors, s.unexpectedCloses)
+		}
+		if len(s.connects) != 9 || len(s.setups) != 6 {
+			t.Fatalf("%s: %d connects and %d setups, want 9 and 6", encoding, len(s.connects), len(s.setups))
+		}
+		// 每个Camera向Monitor发送一次offer，转发延迟按事件类型统计
+		for _, eventType := range []model.EventType{model.EventTypeOffer, model.EventTypeAnswer, model.EventTypeIceCandidate} {
+			event := s.events[eventType]
+			if event == nil || event.sent == 0 || event.received != event.sent || len(event.latencies) == 0 {
+				t.Fatalf("%s: %s stats = %+v", encoding, eventType, event)
+			}
+		}
+	}
+}
+
+func TestRunInjectsChurn(t *testing.T) {
+	quietStdout(t)
+
+	// 服务端在发现旧连接断开前拒绝同一房间的第二个Monitor，断线重连的Monitor可能被拒绝，这里只模拟Camera
+	opts := &options{
+		server:      newSignalingServer(t),
+		rooms:       2,
+		cameras:     3,
+		monitors:    0,
+		roomPrefix:  "lt",
+		encoding:    model.EncodingJSON,
+		ice:         1,
+		ramp:        50 * time.Millisecond,
+		duration:    time.Second,
+		churn:       50,
+		rejoinDelay: 50 * time.Millisecond,
+		timeout:     5 * time.Second,
+	}
+	s := run(opts, make(chan os.Signal))
+
+	if s.churn[churnLeave]+s.churn[churnReconnect] == 0 {
+		t.Fatalf("no churn was injected: %v", s.churn)
+	}
+	if len(s.connects) <= 6 {
+		t.Fatalf("%d connects, want reconnects after churn", len(s.connects))
+	}
+	if len(s.dialFailures) != 0 || s.unexpectedCloses != 0 {
+		t.Fatalf("dial failures %v, unexpected closes %d", s.dialFailures, s.unexpectedCloses)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	for p, want := range map[float64]time.Duration{0.5: 50 * time.Millisecond, 0.9: 90 * time.Millisecond, 0.99: 99 * time.Millisecond} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("percentile(%v) = %s, want %s", p, got, want)
+		}
+	}
+
+	if got := pad("事件", -8); got != "事件    " {
+		t.Errorf("pad = %q", got)
+	}
+}
@@ -0,0 +1,79 @@
+// loadtest 模拟大量Camera和Monitor设备对信令服务施加压力，评估单个实例能承载的房间数量
+//
+// 用法：
+//
+//	go run ./cmd/loadtest -server ws://localhost:11100 -rooms 500 -cameras 4 -monitors 1 -duration 2m
+//
+// 每个房间的设备按真实客户端的流程完成 camera_ready → monitor_ready → offer → answer → ice_candidate
+// 的协商（SDP为合成数据），期间按-churn的频率随机让设备离开、重新加入或断线重连。
+// 结束后按事件类型输出转发延迟的分位数、发送和收到的数量，以及连接和错误统计。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"monitor/model"
+)
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.server, "server", "ws://localhost:11100", "信令服务器地址")
+	flag.IntVar(&opts.rooms, "rooms", 100, "房间数量")
+	flag.IntVar(&opts.cameras, "cameras", 4, "每个房间的Camera数量")
+	flag.IntVar(&opts.monitors, "monitors", 1, "每个房间的Monitor数量，服务端只允许一个，0表示只有Camera")
+	flag.StringVar(&opts.roomPrefix, "room-prefix", "lt", "房间ID前缀，房间ID为前缀加序号")
+	flag.StringVar((*string)(&opts.encoding), "encoding", string(model.EncodingJSON), "事件编码 json/msgpack，msgpack通过子协议协商")
+	flag.IntVar(&opts.ice, "ice", 2, "每个设备在协商中发送的ICE候选数量")
+	flag.DurationVar(&opts.ramp, "ramp", 10*time.Second, "建立全部初始连接所用的时间")
+	flag.DurationVar(&opts.duration, "duration", time.Minute, "初始连接建立后的压测时长")
+	flag.Float64Var(&opts.churn, "churn", 1, "每秒随机执行的离开/加入/重连次数，0表示不注入")
+	flag.DurationVar(&opts.rejoinDelay, "rejoin-delay", 2*time.Second, "设备离开后重新加入前的等待时间")
+	flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "建立连接和等待connect事件的超时时间")
+	flag.BoolVar(&opts.verbose, "v", false, "输出每个连接和错误")
+	flag.Parse()
+
+	if opts.rooms <= 0 || opts.cameras < 0 || opts.monitors < 0 || opts.cameras+opts.monitors == 0 {
+		log.Fatal("rooms必须大于0，每个房间至少需要一个设备")
+	}
+	if opts.encoding != model.EncodingJSON && opts.encoding != model.EncodingMsgpack {
+		log.Fatal("encoding必须为json或msgpack")
+	}
+	if opts.monitors > 1 {
+		fmt.Println("注意：服务端每个房间只允许一个Monitor，多余的Monitor会被拒绝并计入错误")
+	}
+
+	fmt.Printf("压测 %s：%d 个房间，每个房间 %d 个Camera、%d 个Monitor，共 %d 个连接，持续 %s\n",
+		opts.server, opts.rooms, opts.cameras, opts.monitors, opts.rooms*(opts.cameras+opts.monitors), opts.duration)
+
+	// 收到中断信号时提前结束并输出已有结果
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	stats := run(&opts, stop)
+	if report(stats) > 0 {
+		os.Exit(1)
+	}
+}
+
+// options 命令行参数
+type options struct {
+	server      string
+	rooms       int
+	cameras     int
+	monitors    int
+	roomPrefix  string
+	encoding    model.Encoding
+	ice         int
+	ramp        time.Duration
+	duration    time.Duration
+	churn       float64
+	rejoinDelay time.Duration
+	timeout     time.Duration
+	verbose     bool
+}
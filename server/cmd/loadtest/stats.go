@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"monitor/model"
+)
+
+// eventStats 单个事件类型的统计
+type eventStats struct {
+	sent      int
+	received  int
+	latencies []time.Duration // 负载中带有发送时间的事件从发送到收到的耗时
+}
+
+// stats 压测统计，所有方法并发安全
+type stats struct {
+	mutex    sync.Mutex
+	start    time.Time
+	steady   time.Time // 初始连接全部发起的时间
+	end      time.Time
+	events   map[model.EventType]*eventStats
+	connects []time.Duration // 从发起连接到收到connect事件的耗时
+	setups   []time.Duration // Camera从发起连接到收到answer的耗时
+
+	dialFailures     map[string]int // 按原因统计的连接失败
+	serverErrors     map[string]int // 按错误信息统计的服务端error事件
+	unexpectedCloses int
+	churn            map[string]int
+
+	bytesSent     int64 // 发送的消息字节数，不含WebSocket帧头
+	bytesReceived int64 // 收到的消息字节数
+}
+
+// newStats 创建统计
+func newStats() *stats {
+	return &stats{
+		start:        time.Now(),
+		events:       make(map[model.EventType]*eventStats),
+		dialFailures: make(map[string]int),
+		serverErrors: make(map[string]int),
+		churn:        make(map[string]int),
+	}
+}
+
+// event 获取事件类型的统计，调用方需持有锁
+func (s *stats) event(eventType model.EventType) *eventStats {
+	event, exists := s.events[eventType]
+	if !exists {
+		event = &eventStats{}
+		s.events[eventType] = event
+	}
+	return event
+}
+
+// addSent 记录发送的事件
+func (s *stats) addSent(eventType model.EventType, size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.event(eventType).sent++
+	s.bytesSent += int64(size)
+}
+
+// addBytesReceived 记录收到的消息大小
+func (s *stats) addBytesReceived(size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.bytesReceived += int64(size)
+}
+
+// addReceived 记录收到的事件，sentAt为零值时只计数
+func (s *stats) addReceived(eventType model.EventType, sentAt time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	event := s.event(eventType)
+	event.received++
+	if !sentAt.IsZero() {
+		event.latencies = append(event.latencies, time.Since(sentAt))
+	}
+}
+
+// addConnect 记录加入房间耗时
+func (s *stats) addConnect(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.connects = append(s.connects, latency)
+}
+
+// addSetup 记录完整协商耗时
+func (s *stats) addSetup(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.setups = append(s.setups, latency)
+}
+
+// addDialFailure 记录连接失败
+func (s *stats) addDialFailure(reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.dialFailures[reason]++
+}
+
+// addError 记录错误
+func (s *stats) addError(message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.serverErrors[message]++
+}
+
+// addUnexpectedClose 记录异常断开
+func (s *stats) addUnexpectedClose() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unexpectedCloses++
+}
+
+// addChurn 记录注入的变动
+func (s *stats) addChurn(kind string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.churn[kind]++
+}
+
+// markSteady 记录初始连接全部发起的时间
+func (s *stats) markSteady() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.steady = time.Now()
+}
+
+// finish 记录压测结束时间
+func (s *stats) finish() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.end = time.Now()
+}
+
+// printProgress 输出压测进度
+func (s *stats) printProgress() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sent, received, errors := 0, 0, s.unexpectedCloses
+	for _, event := range s.events {
+		sent += event.sent
+		received += event.received
+	}
+	for _, count := range s.dialFailures {
+		errors += count
+	}
+	for _, count := range s.serverErrors {
+		errors += count
+	}
+
+	fmt.Printf("[%s] 已连接 %d 次，发送 %d，收到 %d，错误 %d\n",
+		time.Since(s.start).Truncate(time.Second), len(s.connects), sent, received, errors)
+}
+
+// report 输出压测结果，返回错误总数
+func report(s *stats) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fmt.Printf("\n压测结束，总时长 %s（建立初始连接 %s）\n",
+		s.end.Sub(s.start).Truncate(time.Millisecond), s.steady.Sub(s.start).Truncate(time.Millisecond))
+
+	fmt.Printf("\n%s %s %s %10s %10s %10s %10s\n", pad("事件", -20), pad("发送", 8), pad("收到", 8), "p50", "p90", "p99", "max")
+	eventTypes := make([]string, 0, len(s.events))
+	for eventType := range s.events {
+		eventTypes = append(eventTypes, string(eventType))
+	}
+	sort.Strings(eventTypes)
+	for _, eventType := range eventTypes {
+		event := s.events[model.EventType(eventType)]
+		fmt.Printf("%-20s %8d %8d %s\n", eventType, event.sent, event.received, formatPercentiles(event.latencies))
+	}
+	fmt.Printf("%s %8s %8d %s\n", pad("加入房间", -20), "-", len(s.connects), formatPercentiles(s.connects))
+	fmt.Printf("%s %8s %8d %s\n", pad("完整协商", -20), "-", len(s.setups), formatPercentiles(s.setups))
+
+	fmt.Printf("\n消息大小：发送 %.1f KB，收到 %.1f KB\n", float64(s.bytesSent)/1024, float64(s.bytesReceived)/1024)
+
+	if len(s.churn) > 0 {
+		fmt.Printf("\n注入变动：离开 %d，重新加入 %d，断线重连 %d\n",
+			s.churn[churnLeave], s.churn[churnJoin], s.churn[churnReconnect])
+	}
+
+	total := s.unexpectedCloses
+	total += printCounts("连接失败", s.dialFailures)
+	total += printCounts("错误", s.serverErrors)
+	if s.unexpectedCloses > 0 {
+		fmt.Printf("\n异常断开：%d\n", s.unexpectedCloses)
+	}
+
+	if total == 0 {
+		fmt.Println("\n没有错误")
+	} else {
+		fmt.Printf("\n共 %d 个错误\n", total)
+	}
+	return total
+}
+
+// printCounts 按数量从多到少输出分类统计，返回总数
+func printCounts(title string, counts map[string]int) int {
+	if len(counts) == 0 {
+		return 0
+	}
+
+	keys := make([]string, 0, len(counts))
+	total := 0
+	for key, count := range counts {
+		keys = append(keys, key)
+		total += count
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Printf("\n%s：%d\n", title, total)
+	for _, key := range keys {
+		fmt.Printf("  %6d  %s\n", counts[key], key)
+	}
+	return total
+}
+
+// pad 按终端显示宽度补齐空格，中文字符占两列；width为负数时左对齐
+func pad(text string, width int) string {
+	left := width < 0
+	if left {
+		width = -width
+	}
+
+	display := 0
+	for _, r := range text {
+		if r >= 0x1100 {
+			display += 2
+		} else {
+			display++
+		}
+	}
+	if display >= width {
+		return text
+	}
+
+	spaces := strings.Repeat(" ", width-display)
+	if left {
+		return text + spaces
+	}
+	return spaces + text
+}
+
+// formatPercentiles 格式化延迟分位数，没有样本时输出占位符
+func formatPercentiles(latencies []time.Duration) string {
+	if len(latencies) == 0 {
+		return fmt.Sprintf("%10s %10s %10s %10s", "-", "-", "-", "-")
+	}
+
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return fmt.Sprintf("%10s %10s %10s %10s",
+		formatDuration(percentile(sorted, 0.5)), formatDuration(percentile(sorted, 0.9)),
+		formatDuration(percentile(sorted, 0.99)), formatDuration(sorted[len(sorted)-1]))
+}
+
+// percentile 获取已排序样本的分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	index := int(float64(len(sorted)-1) * p)
+	return sorted[index]
+}
+
+// formatDuration 以毫秒输出时长，保留两位小数
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
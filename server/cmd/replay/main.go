@@ -0,0 +1,74 @@
+// replay 根据事件审计记录重放一个房间的信令会话，用于复现前端状态机问题
+//
+// 用法：
+//
+//	go run ./cmd/replay -input audit-2026-01-02.jsonl -room 123456 -server ws://localhost:11100
+//
+// 输入可以是审计文件（每行一条记录），也可以是 /api/rooms/:roomId/audit 接口返回的JSON数组。
+// 工具为记录中的每个设备建立一个合成连接，按原始的相对时间（可通过-speed加速）发送设备当时发出的事件，
+// 最后把每个设备实际收到的事件序列与记录中的序列对比并输出差异。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.server, "server", "ws://localhost:11100", "信令服务器地址")
+	flag.StringVar(&opts.input, "input", "-", "审计记录文件，-表示标准输入")
+	flag.StringVar(&opts.room, "room", "", "要重放的房间ID，记录中只有一个房间时可省略")
+	flag.StringVar(&opts.targetRoom, "target-room", "", "重放到的房间ID，默认与原房间相同")
+	flag.StringVar(&opts.prefix, "prefix", "", "合成设备ID前缀，用于避免与在线设备冲突")
+	flag.Float64Var(&opts.speed, "speed", 1, "重放速度倍数，大于1表示加速")
+	flag.DurationVar(&opts.maxGap, "max-gap", 0, "相邻事件之间的最大等待时间，0表示不限制")
+	flag.DurationVar(&opts.settle, "settle", 2*time.Second, "重放结束后等待服务端响应的时间")
+	flag.BoolVar(&opts.verbose, "v", false, "输出每个发送和收到的事件")
+	flag.Parse()
+
+	if opts.speed <= 0 {
+		log.Fatal("speed必须大于0")
+	}
+
+	records, err := loadRecords(opts.input)
+	if err != nil {
+		log.Fatalf("读取审计记录失败: %v", err)
+	}
+
+	script, err := buildScript(records, opts.room)
+	if err != nil {
+		log.Fatalf("解析审计记录失败: %v", err)
+	}
+	if opts.targetRoom == "" {
+		opts.targetRoom = script.roomID
+	}
+
+	fmt.Printf("重放房间 %s -> %s：%d 个设备，%d 个动作，时长 %s\n",
+		script.roomID, opts.targetRoom, len(script.devices), len(script.steps), script.duration())
+
+	result, err := replay(script, &opts)
+	if err != nil {
+		log.Fatalf("重放失败: %v", err)
+	}
+
+	if report(script, result) > 0 {
+		os.Exit(1)
+	}
+}
+
+// options 命令行参数
+type options struct {
+	server     string
+	input      string
+	room       string
+	targetRoom string
+	prefix     string
+	speed      float64
+	maxGap     time.Duration
+	settle     time.Duration
+	verbose    bool
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"monitor/model"
+)
+
+// result 重放结果
+type result struct {
+	mutex    sync.Mutex
+	received map[string][]signature // 每个设备实际收到的事件序列
+	failures []string               // 连接或发送失败
+}
+
+// addReceived 记录设备收到的事件
+func (r *result) addReceived(deviceID string, sig signature) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.received[deviceID] = append(r.received[deviceID], sig)
+}
+
+// addFailure 记录失败信息
+func (r *result) addFailure(format string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+// player 执行重放脚本
+type player struct {
+	script *script
+	opts   *options
+	result *result
+	conns  map[string]*websocket.Conn
+	wg     sync.WaitGroup
+}
+
+// replay 按脚本重放会话
+func replay(s *script, opts *options) (*result, error) {
+	if _, err := url.Parse(opts.server); err != nil {
+		return nil, err
+	}
+
+	p := &player{
+		script: s,
+		opts:   opts,
+		result: &result{received: make(map[string][]signature)},
+		conns:  make(map[string]*websocket.Conn),
+	}
+
+	start := time.Now()
+	var last time.Duration
+	var scheduled time.Duration
+	for _, st := range s.steps {
+		gap := time.Duration(float64(st.at-last) / opts.speed)
+		if opts.maxGap > 0 && gap > opts.maxGap {
+			gap = opts.maxGap
+		}
+		last = st.at
+		scheduled += gap
+
+		if wait := time.Until(start.Add(scheduled)); wait > 0 {
+			time.Sleep(wait)
+		}
+
+		switch st.kind {
+		case stepConnect:
+			p.connect(st.deviceID)
+		case stepSend:
+			p.send(st.deviceID, st.event)
+		case stepDisconnect:
+			p.disconnect(st.deviceID)
+		}
+	}
+
+	time.Sleep(opts.settle)
+	for deviceID := range p.conns {
+		p.disconnect(deviceID)
+	}
+	p.wg.Wait()
+
+	return p.result, nil
+}
+
+// connect 为设备建立WebSocket连接并开始读取事件
+func (p *player) connect(deviceID string) {
+	device := p.script.devices[deviceID]
+	query := url.Values{}
+	query.Set("deviceId", p.opts.prefix+deviceID)
+	query.Set("deviceType", string(device.deviceType))
+	address := fmt.Sprintf("%s/ws/%s?%s", strings.TrimRight(p.opts.server, "/"), url.PathEscape(p.opts.targetRoom), query.Encode())
+
+	conn, _, err := websocket.DefaultDialer.Dial(address, nil)
+	if err != nil {
+		p.result.addFailure("设备 %s 连接失败: %v", deviceID, err)
+		return
+	}
+	p.conns[deviceID] = conn
+	p.logf("%s 已连接", deviceID)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var event model.Event
+			if err := json.Unmarshal(message, &event); err != nil {
+				p.result.addFailure("设备 %s 收到无法解析的消息: %v", deviceID, err)
+				continue
+			}
+
+			event.DeviceID = strings.TrimPrefix(event.DeviceID, p.opts.prefix)
+			if isOwnLeave(deviceID, &event) {
+				continue
+			}
+
+			sig := signature{Type: event.Type, From: event.DeviceID}
+			p.result.addReceived(deviceID, sig)
+			p.logf("%s <- %s", deviceID, sig)
+		}
+	}()
+}
+
+// send 以设备身份发送事件
+func (p *player) send(deviceID string, event *model.Event) {
+	conn, exists := p.conns[deviceID]
+	if !exists {
+		return
+	}
+
+	message, err := json.Marshal(map[string]interface{}{
+		"type":    event.Type,
+		"payload": p.rewritePayload(event.Payload),
+	})
+	if err != nil {
+		p.result.addFailure("设备 %s 序列化事件失败: %v", deviceID, err)
+		return
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		p.result.addFailure("设备 %s 发送 %s 失败: %v", deviceID, event.Type, err)
+		return
+	}
+	p.logf("%s -> %s", deviceID, event.Type)
+}
+
+// disconnect 断开设备连接
+func (p *player) disconnect(deviceID string) {
+	conn, exists := p.conns[deviceID]
+	if !exists {
+		return
+	}
+	delete(p.conns, deviceID)
+
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	conn.Close()
+	p.logf("%s 已断开", deviceID)
+}
+
+// rewritePayload 为负载中的目标设备ID添加前缀
+func (p *player) rewritePayload(payload json.RawMessage) json.RawMessage {
+	if p.opts.prefix == "" {
+		return payload
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return payload
+	}
+	if target, ok := fields["targetDeviceId"].(string); ok && target != "" {
+		fields["targetDeviceId"] = p.opts.prefix + target
+	}
+
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return payload
+	}
+	return rewritten
+}
+
+// logf 输出详细日志
+func (p *player) logf(format string, args ...interface{}) {
+	if p.opts.verbose {
+		fmt.Printf(format+"\n", args...)
+	}
+}
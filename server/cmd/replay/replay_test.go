@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"monitor/handler"
+	"monitor/model"
+	"monitor/service"
+)
+
+// newSignalingServer 创建进程内的信令服务，auditDir不为空时记录审计，返回ws://地址和审计服务
+func newSignalingServer(t *testing.T, auditDir string) (string, service.AuditService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	auditService, err := service.NewAuditService(service.AuditConfig{Dir: auditDir})
+	if err != nil {
+		t.Fatalf("NewAuditService: %v", err)
+	}
+	webhookService, err := service.NewWebhookService(service.WebhookConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewWebhookService: %v", err)
+	}
+	t.Cleanup(webhookService.Close)
+
+	roomService := service.NewRoomService()
+	eventService := service.NewEventService(roomService, service.NewActivityService(), auditService,
+		service.NewQualityService(), service.NewStatusHistoryService(), webhookService)
+	handoffService, err := service.NewHandoffService(roomService, time.Minute)
+	if err != nil {
+		t.Fatalf("NewHandoffService: %v", err)
+	}
+	webSocketHandler := handler.NewWebSocketHandler(roomService, eventService, auditService, handoffService,
+		handler.NewCORS(nil, true), handler.MessageLimits{}, handler.ConnectionLimits{})
+
+	r := gin.New()
+	r.GET("/ws/:roomId", webSocketHandler.AdmitWebSocket, webSocketHandler.HandleWebSocket)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http"), auditService
+}
+
+// sessionDevice 录制会话时使用的设备连接
+type sessionDevice struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+// dialSession 以设备身份连接房间并等待connect事件
+func dialSession(t *testing.T, server string, deviceID string, deviceType model.DeviceType) *sessionDevice {
+	t.Helper()
+
+	query := url.Values{"deviceId": {deviceID}, "deviceType": {string(deviceType)}}
+	conn, _, err := websocket.DefaultDialer.Dial(server+"/ws/room?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", deviceID, err)
+	}
+	device := &sessionDevice{t: t, conn: conn}
+	device.await(model.EventTypeConnect)
+	return device
+}
+
+// send 发送事件
+func (d *sessionDevice) send(eventType model.EventType, payload interface{}) {
+	d.t.Helper()
+
+	data, _ := json.Marshal(payload)
+	if err := d.conn.WriteJSON(&model.Event{Type: eventType, Payload: data}); err != nil {
+		d.t.Fatalf("send %s: %v", eventType, err)
+	}
+}
+
+// await 读取直到收到指定类型的事件
+func (d *sessionDevice) await(eventType model.EventType) {
+	d.t.Helper()
+
+	d.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var event model.Event
+		if err := d.conn.ReadJSON(&event); err != nil {
+			d.t.Fatalf("read %s: %v", eventType, err)
+		}
+		if event.Type == eventType {
+			return
+		}
+	}
+}
+
+// close 正常关闭连接
+func (d *sessionDevice) close() {
+	d.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	d.conn.Close()
+}
+
+// quietStdout 在测试期间丢弃重放过程中输出的报告
+func quietStdout(t *testing.T) {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(io.Discard, reader)
+	}()
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		writer.Close()
+		<-done
+	})
+}
+
+func TestReplayReproducesRecordedSession(t *testing.T) {
+	quietStdout(t)
+
+	// 在开启审计的服务上录制一次协商会话，动作之间留出间隔，重放时按相对时间保持顺序
+	const gap = 50 * time.Millisecond
+	recorder, auditService := newSignalingServer(t, t.TempDir())
+	camera := dialSession(t, recorder, "camera-1", model.DeviceTypeCamera)
+	time.Sleep(gap)
+	monitor := dialSession(t, recorder, "monitor-1", model.DeviceTypeMonitor)
+	camera.await(model.EventTypeJoinRoom)
+	time.Sleep(gap)
+
+	camera.send(model.EventTypeCameraReady, &model.ReadyPayload{TargetDeviceID: "monitor-1"})
+	monitor.await(model.EventTypeCameraReady)
+	time.Sleep(gap)
+	camera.send(model.EventTypeOffer, &model.WebRTCOfferPayload{TargetDeviceID: "monitor-1", SDP: "v=0"})
+	monitor.await(model.EventTypeOffer)
+	time.Sleep(gap)
+	monitor.send(model.EventTypeAnswer, &model.WebRTCAnswerPayload{TargetDeviceID: "camera-1", SDP: "v=0"})
+	camera.await(model.EventTypeAnswer)
+	time.Sleep(gap)
+
+	camera.close()
+	monitor.await(model.EventTypeLeaveRoom)
+	monitor.close()
+	time.Sleep(100 * time.Millisecond)
+	auditService.Close()
+
+	records, err := auditService.Query(&model.AuditQuery{RoomID: "room"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	s, err := buildScript(records, "")
+	if err != nil {
+		t.Fatalf("buildScript: %v", err)
+	}
+	if len(s.devices) != 2 {
+		t.Fatalf("script devices = %d, want 2", len(s.devices))
+	}
+
+	// 在另一个服务上加速重放，设备收到的事件序列与记录一致
+	target, _ := newSignalingServer(t, "")
+	opts := &options{server: target, targetRoom: "room", prefix: "replay-", speed: 2, settle: 300 * time.Millisecond}
+	result, err := replay(s, opts)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if differences := report(s, result); differences != 0 {
+		t.Fatalf("replay differs from the recording: failures %v, received %v", result.failures, result.received)
+	}
+	if len(result.received["monitor-1"]) == 0 {
+		t.Fatal("monitor received nothing during the replay")
+	}
+}
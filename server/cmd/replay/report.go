@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// maxDiffLength 超过该长度的序列不做逐条对齐，只比较数量
+const maxDiffLength = 5000
+
+// report 输出每个设备的差异，返回差异条数
+func report(s *script, r *result) int {
+	total := 0
+
+	for _, failure := range r.failures {
+		fmt.Printf("失败: %s\n", failure)
+		total++
+	}
+
+	deviceIDs := make([]string, 0, len(s.devices))
+	for id := range s.devices {
+		deviceIDs = append(deviceIDs, id)
+	}
+	sort.Strings(deviceIDs)
+
+	for _, id := range deviceIDs {
+		expected := s.devices[id].expected
+		received := r.received[id]
+
+		lines := diff(expected, received)
+		if len(lines) == 0 {
+			fmt.Printf("设备 %s：一致（%d 个事件）\n", id, len(expected))
+			continue
+		}
+
+		fmt.Printf("设备 %s：记录 %d 个事件，实际收到 %d 个，%d 处差异\n", id, len(expected), len(received), len(lines))
+		for _, line := range lines {
+			fmt.Printf("  %s\n", line)
+		}
+		total += len(lines)
+	}
+
+	if total == 0 {
+		fmt.Println("重放结果与记录一致")
+	} else {
+		fmt.Printf("共 %d 处差异\n", total)
+	}
+	return total
+}
+
+// diff 基于最长公共子序列对齐两个事件序列，
+// 返回以"-"开头的缺失事件（记录中有、实际没有）和以"+"开头的多余事件
+func diff(expected []signature, received []signature) []string {
+	if len(expected) > maxDiffLength || len(received) > maxDiffLength {
+		if len(expected) == len(received) {
+			return nil
+		}
+		return []string{fmt.Sprintf("序列过长，未逐条对齐：记录 %d 个，实际 %d 个", len(expected), len(received))}
+	}
+
+	// lcs[i][j] 表示expected[i:]与received[j:]的最长公共子序列长度
+	lcs := make([][]int, len(expected)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(received)+1)
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(received) - 1; j >= 0; j-- {
+			if expected[i] == received[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]string, 0)
+	i, j := 0, 0
+	for i < len(expected) || j < len(received) {
+		switch {
+		case i < len(expected) && j < len(received) && expected[i] == received[j]:
+			i++
+			j++
+		case j >= len(received) || (i < len(expected) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, fmt.Sprintf("- #%d %s", i+1, expected[i]))
+			i++
+		default:
+			lines = append(lines, fmt.Sprintf("+ #%d %s", j+1, received[j]))
+			j++
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"monitor/model"
+)
+
+// stepKind 重放动作类型
+type stepKind int
+
+const (
+	stepConnect    stepKind = iota // 设备建立连接
+	stepSend                       // 设备发送事件
+	stepDisconnect                 // 设备断开连接
+)
+
+// step 重放动作
+type step struct {
+	at       time.Duration // 相对会话开始的时间
+	kind     stepKind
+	deviceID string
+	event    *model.Event // 发送的事件，仅stepSend使用
+}
+
+// signature 用于比较的事件特征，不包含时间戳和负载
+type signature struct {
+	Type model.EventType
+	From string // 事件的发送设备ID
+}
+
+func (s signature) String() string {
+	if s.From == "" {
+		return string(s.Type)
+	}
+	return fmt.Sprintf("%s from %s", s.Type, s.From)
+}
+
+// scriptDevice 重放中的合成设备
+type scriptDevice struct {
+	id         string
+	deviceType model.DeviceType
+	expected   []signature // 记录中该设备收到的事件序列
+}
+
+// script 根据审计记录整理出的重放脚本
+type script struct {
+	roomID  string
+	devices map[string]*scriptDevice
+	steps   []step
+}
+
+// duration 脚本的原始时长
+func (s *script) duration() time.Duration {
+	if len(s.steps) == 0 {
+		return 0
+	}
+	return s.steps[len(s.steps)-1].at
+}
+
+// loadRecords 读取审计记录，支持JSONL和JSON数组两种格式
+func loadRecords(path string) ([]*model.AuditRecord, error) {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var records []*model.AuditRecord
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+
+	records := make([]*model.AuditRecord, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var record model.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("第%d行: %w", line, err)
+		}
+		records = append(records, &record)
+	}
+
+	return records, scanner.Err()
+}
+
+// buildScript 把审计记录整理为按时间排序的重放动作
+func buildScript(records []*model.AuditRecord, roomID string) (*script, error) {
+	if roomID == "" {
+		rooms := make(map[string]bool)
+		for _, record := range records {
+			rooms[record.RoomID] = true
+		}
+		if len(rooms) != 1 {
+			return nil, fmt.Errorf("记录中包含%d个房间，请通过-room指定", len(rooms))
+		}
+		for id := range rooms {
+			roomID = id
+		}
+	}
+
+	filtered := make([]*model.AuditRecord, 0, len(records))
+	for _, record := range records {
+		if record.RoomID == roomID && record.Event != nil {
+			filtered = append(filtered, record)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("房间 %s 没有审计记录", roomID)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].Time < filtered[j].Time
+	})
+
+	s := &script{
+		roomID:  roomID,
+		devices: make(map[string]*scriptDevice),
+	}
+	start := filtered[0].Time
+	connected := make(map[string]bool)
+	skipped := make(map[string]bool)
+
+	for _, record := range filtered {
+		at := time.Duration(record.Time-start) * time.Millisecond
+		event := record.Event
+
+		switch record.Direction {
+		case model.AuditDirectionOutbound:
+			if event.Type == model.EventTypeConnect {
+				deviceType, err := connectDeviceType(event)
+				if err != nil {
+					return nil, fmt.Errorf("设备 %s 的connect事件: %w", record.DeviceID, err)
+				}
+
+				device, exists := s.devices[record.DeviceID]
+				if !exists {
+					device = &scriptDevice{id: record.DeviceID, deviceType: deviceType}
+					s.devices[record.DeviceID] = device
+				}
+
+				// 记录中的重连：先断开旧连接
+				if connected[record.DeviceID] {
+					s.steps = append(s.steps, step{at: at, kind: stepDisconnect, deviceID: record.DeviceID})
+				}
+				s.steps = append(s.steps, step{at: at, kind: stepConnect, deviceID: record.DeviceID})
+				connected[record.DeviceID] = true
+			}
+
+			// 其他设备收到的leave_room说明发送方已断开
+			if event.Type == model.EventTypeLeaveRoom && connected[event.DeviceID] {
+				s.steps = append(s.steps, step{at: at, kind: stepDisconnect, deviceID: event.DeviceID})
+				connected[event.DeviceID] = false
+			}
+
+			if device, exists := s.devices[record.DeviceID]; exists && !isOwnLeave(record.DeviceID, event) {
+				device.expected = append(device.expected, signature{Type: event.Type, From: event.DeviceID})
+			}
+
+		case model.AuditDirectionInbound:
+			if !connected[record.DeviceID] {
+				if !skipped[record.DeviceID] {
+					log.Printf("设备 %s 在记录中没有connect事件，跳过其发送的事件", record.DeviceID)
+					skipped[record.DeviceID] = true
+				}
+				continue
+			}
+			s.steps = append(s.steps, step{at: at, kind: stepSend, deviceID: record.DeviceID, event: event})
+		}
+	}
+
+	return s, nil
+}
+
+// connectDeviceType 从connect事件中读取设备类型
+func connectDeviceType(event *model.Event) (model.DeviceType, error) {
+	var payload model.ConnectPayload
+	if err := event.ParsePayload(&payload); err != nil {
+		return "", err
+	}
+	if payload.Device == nil || payload.Device.Type == "" {
+		return "", fmt.Errorf("缺少设备类型")
+	}
+	return payload.Device.Type, nil
+}
+
+// isOwnLeave 判断是否为设备自己的leave_room事件
+// 服务端在连接断开后仍会尝试向离开的设备广播该事件，能否写入取决于时序，不参与比较
+func isOwnLeave(deviceID string, event *model.Event) bool {
+	return event.Type == model.EventTypeLeaveRoom && event.DeviceID == deviceID
+}
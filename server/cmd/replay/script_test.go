@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"monitor/model"
+)
+
+// auditEvent 创建审计记录中的事件
+func auditEvent(t *testing.T, eventType model.EventType, deviceID string, payload interface{}) *model.Event {
+	t.Helper()
+
+	event := &model.Event{Type: eventType, RoomID: "room", DeviceID: deviceID}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("marshal payload: %v", err)
+		}
+		event.Payload = data
+	}
+	return event
+}
+
+// connectRecord 服务端发给设备的connect事件记录
+func connectRecord(t *testing.T, at int64, deviceID string, deviceType model.DeviceType) *model.AuditRecord {
+	t.Helper()
+
+	payload := &model.ConnectPayload{Device: &model.Device{ID: deviceID, Type: deviceType}}
+	return &model.AuditRecord{Time: at, Direction: model.AuditDirectionOutbound, RoomID: "room", DeviceID: deviceID,
+		Event: auditEvent(t, model.EventTypeConnect, deviceID, payload)}
+}
+
+func TestBuildScript(t *testing.T) {
+	offer := auditEvent(t, model.EventTypeOffer, "camera-1", &model.WebRTCOfferPayload{TargetDeviceID: "monitor-1", SDP: "v=0"})
+	records := []*model.AuditRecord{
+		// 记录按时间排序后处理
+		{Time: 1300, Direction: model.AuditDirectionInbound, RoomID: "room", DeviceID: "camera-1", Event: offer},
+		connectRecord(t, 1000, "camera-1", model.DeviceTypeCamera),
+		// 没有connect记录的设备发送的事件被跳过
+		{Time: 1100, Direction: model.AuditDirectionInbound, RoomID: "room", DeviceID: "monitor-1", Event: offer},
+		connectRecord(t, 1200, "monitor-1", model.DeviceTypeMonitor),
+		{Time: 1200, Direction: model.AuditDirectionOutbound, RoomID: "room", DeviceID: "camera-1",
+			Event: auditEvent(t, model.EventTypeJoinRoom, "monitor-1", nil)},
+		{Time: 1300, Direction: model.AuditDirectionOutbound, RoomID: "room", DeviceID: "monitor-1", Event: offer},
+		// Camera重连，之前的连接先断开
+		connectRecord(t, 1500, "camera-1", model.DeviceTypeCamera),
+		// 其他设备收到的leave_room说明Monitor已断开，Monitor自己的leave_room不参与比较
+		{Time: 1600, Direction: model.AuditDirectionOutbound, RoomID: "room", DeviceID: "monitor-1",
+			Event: auditEvent(t, model.EventTypeLeaveRoom, "monitor-1", nil)},
+		{Time: 1600, Direction: model.AuditDirectionOutbound, RoomID: "room", DeviceID: "camera-1",
+			Event: auditEvent(t, model.EventTypeLeaveRoom, "monitor-1", nil)},
+		// 其他房间的记录被忽略
+		{Time: 1700, Direction: model.AuditDirectionInbound, RoomID: "other", DeviceID: "camera-1", Event: offer},
+	}
+
+	if _, err := buildScript(records, ""); err == nil {
+		t.Fatal("buildScript accepted records of two rooms without -room")
+	}
+	s, err := buildScript(records, "room")
+	if err != nil {
+		t.Fatalf("buildScript: %v", err)
+	}
+
+	type action struct {
+		at       int64
+		kind     stepKind
+		deviceID string
+	}
+	steps := make([]action, 0, len(s.steps))
+	for _, st := range s.steps {
+		steps = append(steps, action{st.at.Milliseconds(), st.kind, st.deviceID})
+	}
+	wantSteps := []action{
+		{0, stepConnect, "camera-1"},
+		{200, stepConnect, "monitor-1"},
+		{300, stepSend, "camera-1"},
+		{500, stepDisconnect, "camera-1"},
+		{500, stepConnect, "camera-1"},
+		{600, stepDisconnect, "monitor-1"},
+	}
+	if !reflect.DeepEqual(steps, wantSteps) {
+		t.Fatalf("steps = %v, want %v", steps, wantSteps)
+	}
+	if s.duration().Milliseconds() != 600 {
+		t.Fatalf("duration = %s, want 600ms", s.duration())
+	}
+
+	wantExpected := map[string][]signature{
+		"camera-1": {
+			{model.EventTypeConnect, "camera-1"}, {model.EventTypeJoinRoom, "monitor-1"},
+			{model.EventTypeConnect, "camera-1"}, {model.EventTypeLeaveRoom, "monitor-1"},
+		},
+		"monitor-1": {{model.EventTypeConnect, "monitor-1"}, {model.EventTypeOffer, "camera-1"}},
+	}
+	for deviceID, want := range wantExpected {
+		if got := s.devices[deviceID].expected; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s expected = %v, want %v", deviceID, got, want)
+		}
+	}
+	if s.devices["monitor-1"].deviceType != model.DeviceTypeMonitor {
+		t.Errorf("monitor-1 type = %s", s.devices["monitor-1"].deviceType)
+	}
+}
+
+func TestLoadRecordsAcceptsJSONLAndArray(t *testing.T) {
+	records := []*model.AuditRecord{
+		connectRecord(t, 1000, "camera-1", model.DeviceTypeCamera),
+		connectRecord(t, 1100, "monitor-1", model.DeviceTypeMonitor),
+	}
+	dir := t.TempDir()
+
+	var lines []byte
+	for _, record := range records {
+		line, _ := json.Marshal(record)
+		lines = append(append(lines, line...), '\n', '\n')
+	}
+	array, _ := json.Marshal(records)
+
+	for name, data := range map[string][]byte{"audit.jsonl": lines, "audit.json": array} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		loaded, err := loadRecords(path)
+		if err != nil {
+			t.Fatalf("loadRecords %s: %v", name, err)
+		}
+		if len(loaded) != 2 || loaded[1].DeviceID != "monitor-1" || loaded[1].Event.Type != model.EventTypeConnect {
+			t.Fatalf("loadRecords %s = %+v", name, loaded)
+		}
+	}
+
+	path := filepath.Join(dir, "broken.jsonl")
+	os.WriteFile(path, append(lines, []byte("{broken\n")...), 0o644)
+	if _, err := loadRecords(path); err == nil {
+		t.Fatal("loadRecords accepted a broken line")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	expected := []signature{{model.EventTypeConnect, "a"}, {model.EventTypeJoinRoom, "b"}, {model.EventTypeOffer, "b"}}
+	received := []signature{{model.EventTypeConnect, "a"}, {model.EventTypeOffer, "b"}, {model.EventTypeLeaveRoom, "b"}}
+
+	if lines := diff(expected, expected); len(lines) != 0 {
+		t.Fatalf("diff of equal sequences = %v", lines)
+	}
+	want := []string{"- #2 join_room from b", "+ #3 leave_room from b"}
+	if lines := diff(expected, received); !reflect.DeepEqual(lines, want) {
+		t.Fatalf("diff = %v, want %v", lines, want)
+	}
+}
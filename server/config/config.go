@@ -0,0 +1,359 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"monitor/model"
+)
+
+// Config 服务配置，从YAML文件加载，环境变量优先于文件中的值
+type Config struct {
+	Server     ServerConfig      `yaml:"server"`
+	Log        LogConfig         `yaml:"log"`
+	Tracing    TracingConfig     `yaml:"tracing"`
+	Audit      AuditConfig       `yaml:"audit"`
+	Shutdown   ShutdownConfig    `yaml:"shutdown"`
+	Alert      AlertConfig       `yaml:"alert"`
+	Webhook    WebhookConfig     `yaml:"webhook"`
+	Cluster    ClusterConfig     `yaml:"cluster"`
+	Limits     LimitsConfig      `yaml:"limits"`
+	ICEServers []model.ICEServer `yaml:"iceServers"` // 下发给设备的ICE服务器，可热加载
+
+	WatchInterval time.Duration `yaml:"watchInterval"` // 检查配置文件是否修改的间隔，0表示只在收到SIGHUP时重新加载
+}
+
+// ServerConfig HTTP服务配置
+type ServerConfig struct {
+	Port           string   `yaml:"port"`
+	AllowOrigins   []string `yaml:"allowOrigins"`   // 允许的跨域和WebSocket来源，*表示任意来源，*.example.com匹配任意子域名，可热加载
+	StrictOrigins  bool     `yaml:"strictOrigins"`  // 严格模式，只通过*允许的来源不能建立WebSocket连接，可热加载
+	TrustedProxies []string `yaml:"trustedProxies"` // 可信代理的IP或CIDR
+	DataDir        string   `yaml:"dataDir"`
+	AdminToken     string   `yaml:"adminToken"`
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level      string `yaml:"level"` // 可热加载
+	Format     string `yaml:"format"`
+	Dir        string `yaml:"dir"`
+	MaxSizeMB  int    `yaml:"maxSizeMB"`
+	MaxBackups int    `yaml:"maxBackups"`
+}
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"`
+	OTLPEndpoint string  `yaml:"otlpEndpoint"`
+	OTLPInsecure bool    `yaml:"otlpInsecure"`
+	ServiceName  string  `yaml:"serviceName"`
+	SampleRatio  float64 `yaml:"sampleRatio"`
+}
+
+// AuditConfig 事件审计配置
+type AuditConfig struct {
+	Enabled       bool `yaml:"enabled"`
+	RetentionDays int  `yaml:"retentionDays"`
+	RedactSDP     bool `yaml:"redactSDP"`
+}
+
+// ShutdownConfig 优雅关闭配置
+type ShutdownConfig struct {
+	DrainTimeout    time.Duration `yaml:"drainTimeout"`
+	ReconnectSpread time.Duration `yaml:"reconnectSpread"`
+	ResumeWindow    time.Duration `yaml:"resumeWindow"` // 进程交接后等待设备重连的时间
+}
+
+// AlertConfig 离线告警配置
+type AlertConfig struct {
+	CheckInterval time.Duration      `yaml:"checkInterval"`
+	SMTP          SMTPConfig         `yaml:"smtp"`
+	Webhook       AlertWebhookConfig `yaml:"webhook"`
+}
+
+// SMTPConfig 告警邮件配置，Host为空时不发送邮件
+type SMTPConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// AlertWebhookConfig 告警回调配置，URL为空时不回调
+type AlertWebhookConfig struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+}
+
+// WebhookConfig 事件回调重试配置
+type WebhookConfig struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+}
+
+// ClusterConfig 多节点部署配置，Bus为none时单节点运行
+type ClusterConfig struct {
+	Bus               string        `yaml:"bus"`
+	Channel           string        `yaml:"channel"`
+	RedisAddr         string        `yaml:"redisAddr"`
+	RedisPassword     string        `yaml:"redisPassword"`
+	NATSURL           string        `yaml:"natsURL"`
+	NodeID            string        `yaml:"nodeId"`       // 为空时使用主机名-进程号
+	AdvertiseURL      string        `yaml:"advertiseURL"` // 为空时使用http://主机名:端口
+	HeartbeatInterval time.Duration `yaml:"heartbeatInterval"`
+	NodeTimeout       time.Duration `yaml:"nodeTimeout"`
+	LeaseStore        string        `yaml:"leaseStore"` // 为空时与Bus相同
+	LeaseTTL          time.Duration `yaml:"leaseTTL"`
+	JoinMode          string        `yaml:"joinMode"`
+	Secret            string        `yaml:"secret"` // 节点之间的共享密钥，用于验证代理的连接
+}
+
+// LimitsConfig WebSocket连接和消息限制，可热加载，0表示不限制
+type LimitsConfig struct {
+	MaxConnections      int                  `yaml:"maxConnections"`
+	MaxConnectionsPerIP int                  `yaml:"maxConnectionsPerIP"`
+	MaxRoomsPerIP       int                  `yaml:"maxRoomsPerIP"`
+	MaxAutoRooms        int                  `yaml:"maxAutoRooms"`
+	MaxMessageSize      int64                `yaml:"maxMessageSize"`
+	MaxSDPLength        int                  `yaml:"maxSDPLength"`
+	RateLimits          map[string]RateLimit `yaml:"rateLimits"` // 按事件类型的令牌桶，*用于其他事件类型，与默认配置合并
+	MaxViolations       int                  `yaml:"maxViolations"`
+	ViolationWindow     time.Duration        `yaml:"violationWindow"`
+}
+
+// RateLimit 令牌桶配置
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`  // 每秒补充的令牌数
+	Burst int     `yaml:"burst"` // 允许的突发数量
+}
+
+// Default 默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:          "11100",
+			AllowOrigins:  []string{"*"},
+			StrictOrigins: true,
+			DataDir:       "./data",
+		},
+		Log: LogConfig{
+			Level:      "info",
+			Format:     "text",
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+		Audit: AuditConfig{
+			Enabled:       true,
+			RetentionDays: 30,
+			RedactSDP:     true,
+		},
+		Shutdown: ShutdownConfig{
+			DrainTimeout:    30 * time.Second,
+			ReconnectSpread: 10 * time.Second,
+			ResumeWindow:    30 * time.Second,
+		},
+		Alert: AlertConfig{
+			CheckInterval: 30 * time.Second,
+			SMTP:          SMTPConfig{Port: 587},
+		},
+		Webhook: WebhookConfig{
+			MaxAttempts:    6,
+			InitialBackoff: 2 * time.Second,
+			MaxBackoff:     5 * time.Minute,
+		},
+		Cluster: ClusterConfig{
+			Bus:               "none",
+			HeartbeatInterval: 2 * time.Second,
+			NodeTimeout:       10 * time.Second,
+			LeaseTTL:          15 * time.Second,
+			JoinMode:          "proxy",
+		},
+		Limits: LimitsConfig{
+			MaxConnections:      10000,
+			MaxConnectionsPerIP: 100,
+			MaxRoomsPerIP:       20,
+			MaxAutoRooms:        1000,
+			MaxMessageSize:      64 * 1024,
+			MaxSDPLength:        32 * 1024,
+			RateLimits: map[string]RateLimit{
+				string(model.EventTypeIceCandidate): {Rate: 50, Burst: 200},
+				string(model.EventTypeStatsReport):  {Rate: 10, Burst: 20},
+				string(model.EventTypeChatMessage):  {Rate: 0.5, Burst: 5},
+				"*":                                 {Rate: 20, Burst: 50},
+			},
+			MaxViolations:   20,
+			ViolationWindow: 10 * time.Second,
+		},
+	}
+}
+
+// Load 加载配置：先使用默认值，再读取配置文件（path为空时跳过），最后应用环境变量并校验
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+
+		// 未知字段视为错误，避免拼写错误的配置项被静默忽略
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate 校验配置，返回所有不合法的配置项
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port <= 65535, "server.port: invalid port %q", c.Server.Port)
+	check(len(c.Server.AllowOrigins) > 0, "server.allowOrigins: at least one origin is required")
+	for _, origin := range c.Server.AllowOrigins {
+		check(validOrigin(origin), "server.allowOrigins: invalid origin %q", origin)
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		check(validIPOrCIDR(proxy), "server.trustedProxies: invalid IP or CIDR %q", proxy)
+	}
+	check(c.Server.DataDir != "", "server.dataDir: must not be empty")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level: invalid level %q", c.Log.Level)
+	check(oneOf(c.Log.Format, "text", "json"), "log.format: must be text or json, got %q", c.Log.Format)
+	check(c.Log.MaxSizeMB >= 0 && c.Log.MaxBackups >= 0, "log.maxSizeMB/maxBackups: must not be negative")
+
+	check(oneOf(c.Tracing.Exporter, "none", "otlp", "stdout"), "tracing.exporter: must be none, otlp or stdout, got %q", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio: must be between 0 and 1")
+
+	check(c.Audit.RetentionDays >= 0, "audit.retentionDays: must not be negative")
+	check(c.Shutdown.DrainTimeout > 0, "shutdown.drainTimeout: must be positive")
+	check(c.Shutdown.ReconnectSpread >= 0, "shutdown.reconnectSpread: must not be negative")
+	check(c.Shutdown.ResumeWindow > c.Shutdown.ReconnectSpread, "shutdown.resumeWindow: must be greater than shutdown.reconnectSpread")
+
+	check(c.Alert.CheckInterval > 0, "alert.checkInterval: must be positive")
+	check(c.Alert.SMTP.Host == "" || len(c.Alert.SMTP.To) > 0, "alert.smtp.to: required when alert.smtp.host is set")
+
+	check(c.Webhook.MaxAttempts > 0, "webhook.maxAttempts: must be positive")
+	check(c.Webhook.InitialBackoff > 0 && c.Webhook.MaxBackoff >= c.Webhook.InitialBackoff,
+		"webhook.initialBackoff/maxBackoff: must be positive and maxBackoff must not be less than initialBackoff")
+
+	check(oneOf(c.Cluster.Bus, "none", "redis", "nats"), "cluster.bus: must be none, redis or nats, got %q", c.Cluster.Bus)
+	check(oneOf(c.Cluster.LeaseStore, "", "none", "redis", "nats"), "cluster.leaseStore: must be none, redis or nats, got %q", c.Cluster.LeaseStore)
+	check(oneOf(c.Cluster.JoinMode, "proxy", "redirect"), "cluster.joinMode: must be proxy or redirect, got %q", c.Cluster.JoinMode)
+	check(c.Cluster.Bus != "redis" || c.Cluster.RedisAddr != "", "cluster.redisAddr: required when cluster.bus is redis")
+	check(c.Cluster.HeartbeatInterval > 0 && c.Cluster.NodeTimeout > c.Cluster.HeartbeatInterval,
+		"cluster.heartbeatInterval/nodeTimeout: must be positive and nodeTimeout must be greater than heartbeatInterval")
+	check(c.Cluster.LeaseTTL > 0, "cluster.leaseTTL: must be positive")
+	check(c.Cluster.Bus == "none" || c.Cluster.JoinMode != "proxy" || c.Cluster.Secret != "",
+		"cluster.secret: required when cluster.joinMode is proxy")
+
+	errs = append(errs, c.Limits.validate()...)
+
+	for i, server := range c.ICEServers {
+		check(len(server.URLs) > 0, "iceServers[%d].urls: at least one URL is required", i)
+		for _, url := range server.URLs {
+			check(strings.HasPrefix(url, "stun:") || strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:"),
+				"iceServers[%d].urls: %q must start with stun:, turn: or turns:", i, url)
+		}
+	}
+
+	check(c.WatchInterval >= 0, "watchInterval: must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// validate 校验连接和消息限制
+func (l *LimitsConfig) validate() []error {
+	var errs []error
+	if l.MaxConnections < 0 || l.MaxConnectionsPerIP < 0 || l.MaxRoomsPerIP < 0 || l.MaxAutoRooms < 0 ||
+		l.MaxMessageSize < 0 || l.MaxSDPLength < 0 || l.MaxViolations < 0 {
+		errs = append(errs, errors.New("limits: values must not be negative"))
+	}
+	if l.MaxViolations > 0 && l.ViolationWindow <= 0 {
+		errs = append(errs, errors.New("limits.violationWindow: must be positive when limits.maxViolations is set"))
+	}
+	for eventType, limit := range l.RateLimits {
+		if limit.Rate <= 0 || limit.Burst <= 0 {
+			errs = append(errs, fmt.Errorf("limits.rateLimits.%s: rate and burst must be positive", eventType))
+		}
+	}
+	return errs
+}
+
+// validIPOrCIDR 检查是否为IP地址或CIDR
+func validIPOrCIDR(value string) bool {
+	if net.ParseIP(value) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(value)
+	return err == nil
+}
+
+// validOrigin 检查允许的来源：*，或可省略协议的主机名和端口，主机名可以以*.开头匹配任意子域名
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	hostPort := origin
+	if scheme, rest, found := strings.Cut(origin, "://"); found {
+		if scheme == "" {
+			return false
+		}
+		hostPort = rest
+	}
+	hostPort = strings.TrimPrefix(hostPort, "*.")
+	if hostPort == "" || strings.ContainsAny(hostPort, "*/?#@ ") {
+		return false
+	}
+	if host, port, err := net.SplitHostPort(hostPort); err == nil {
+		if _, err := strconv.Atoi(port); err != nil || host == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// oneOf 检查值是否为允许的取值之一
+func oneOf(value string, allowed ...string) bool {
+	for _, item := range allowed {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"monitor/model"
+)
+
+// writeConfig 把YAML写入临时目录中的配置文件并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Fatalf("Load without a file = %+v, want defaults", cfg)
+	}
+}
+
+func TestLoadFileAndEnv(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  port: "12000"
+  allowOrigins: ["https://app.example.com"]
+log:
+  level: debug
+limits:
+  maxConnections: 50
+  rateLimits:
+    offer: {rate: 1, burst: 2}
+`)
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("WS_MAX_CONNECTIONS_PER_IP", "7")
+	t.Setenv("ALLOW_ORIGIN", "")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != "12000" || cfg.Limits.MaxConnections != 50 {
+		t.Fatalf("file values not applied: port %s, maxConnections %d", cfg.Server.Port, cfg.Limits.MaxConnections)
+	}
+	if cfg.Log.Level != "warn" || cfg.Limits.MaxConnectionsPerIP != 7 {
+		t.Fatalf("env values not applied: level %s, maxConnectionsPerIP %d", cfg.Log.Level, cfg.Limits.MaxConnectionsPerIP)
+	}
+	// 空环境变量不覆盖文件中的值
+	if !reflect.DeepEqual(cfg.Server.AllowOrigins, []string{"https://app.example.com"}) {
+		t.Fatalf("allowOrigins = %v", cfg.Server.AllowOrigins)
+	}
+	// 未在文件中设置的配置项保持默认值
+	if cfg.Shutdown.DrainTimeout != 30*time.Second {
+		t.Fatalf("drainTimeout = %s, want default 30s", cfg.Shutdown.DrainTimeout)
+	}
+	if limit := cfg.Limits.RateLimits["offer"]; limit.Rate != 1 || limit.Burst != 2 {
+		t.Fatalf("rateLimits.offer = %+v", limit)
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	tests := map[string]string{
+		"unknown field": "server:\n  prot: \"11100\"\n",
+		"invalid yaml":  "server: [\n",
+		"invalid value": "server:\n  port: \"0\"\n",
+	}
+	for name, content := range tests {
+		if _, err := Load(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: Load succeeded", name)
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load succeeded for a missing file")
+	}
+
+	t.Setenv("WS_MAX_CONNECTIONS", "many")
+	if _, err := Load(""); err == nil {
+		t.Error("Load succeeded with an invalid environment variable")
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = "70000"
+	cfg.Server.AllowOrigins = []string{"https://*.*.example.com"}
+	cfg.Log.Format = "xml"
+	cfg.Shutdown.ResumeWindow = cfg.Shutdown.ReconnectSpread
+	cfg.Webhook.MaxBackoff = time.Millisecond
+	cfg.Cluster.Bus = "kafka"
+	cfg.Limits.RateLimits = map[string]RateLimit{"offer": {Rate: 0, Burst: 1}}
+	cfg.ICEServers = []model.ICEServer{{URLs: []string{"http://stun.example.com"}}}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted an invalid config")
+	}
+	for _, field := range []string{
+		"server.port", "server.allowOrigins", "log.format", "shutdown.resumeWindow",
+		"webhook.initialBackoff/maxBackoff", "cluster.bus", "limits.rateLimits.offer", "iceServers[0].urls",
+	} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Validate error does not mention %s:\n%v", field, err)
+		}
+	}
+}
+
+func TestValidOrigin(t *testing.T) {
+	tests := map[string]bool{
+		"*":                            true,
+		"https://app.example.com":      true,
+		"https://*.example.com":        true,
+		"*.example.com":                true,
+		"localhost:5173":               true,
+		"http://localhost:abc":         false,
+		"https://app.example.com/path": false,
+		"://example.com":               false,
+		"https://*.*.example.com":      false,
+		"":                             false,
+	}
+	for origin, want := range tests {
+		if got := validOrigin(origin); got != want {
+			t.Errorf("validOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	rates, err := ParseRateLimits("offer=1:2, *=20.5:50")
+	if err != nil {
+		t.Fatalf("ParseRateLimits: %v", err)
+	}
+	want := map[string]RateLimit{"offer": {Rate: 1, Burst: 2}, "*": {Rate: 20.5, Burst: 50}}
+	if !reflect.DeepEqual(rates, want) {
+		t.Fatalf("ParseRateLimits = %v, want %v", rates, want)
+	}
+
+	for _, invalid := range []string{"offer", "offer=1", "offer=0:1", "offer=1:x"} {
+		if _, err := ParseRateLimits(invalid); err == nil {
+			t.Errorf("ParseRateLimits(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestValidateClusterSecret(t *testing.T) {
+	cfg := Default()
+	cfg.Cluster.Bus = "nats"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "cluster.secret") {
+		t.Fatalf("Validate without a cluster secret in proxy mode returned %v", err)
+	}
+
+	cfg.Cluster.JoinMode = "redirect"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate in redirect mode: %v", err)
+	}
+
+	cfg.Cluster.JoinMode = "proxy"
+	cfg.Cluster.Secret = "change-me"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate with a cluster secret: %v", err)
+	}
+}
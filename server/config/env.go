@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv 使用环境变量覆盖配置，未设置或为空的环境变量不覆盖
+func (c *Config) applyEnv() error {
+	overrides := []struct {
+		key    string
+		target interface{}
+	}{
+		{"PORT", &c.Server.Port},
+		{"ALLOW_ORIGIN", &c.Server.AllowOrigins},
+		{"ALLOW_ORIGIN_STRICT", &c.Server.StrictOrigins},
+		{"TRUSTED_PROXIES", &c.Server.TrustedProxies},
+		{"DATA_DIR", &c.Server.DataDir},
+		{"ADMIN_TOKEN", &c.Server.AdminToken},
+
+		{"LOG_LEVEL", &c.Log.Level},
+		{"LOG_FORMAT", &c.Log.Format},
+		{"LOG_DIR", &c.Log.Dir},
+		{"LOG_MAX_SIZE_MB", &c.Log.MaxSizeMB},
+		{"LOG_MAX_BACKUPS", &c.Log.MaxBackups},
+
+		{"TRACING_EXPORTER", &c.Tracing.Exporter},
+		{"TRACING_OTLP_ENDPOINT", &c.Tracing.OTLPEndpoint},
+		{"TRACING_OTLP_INSECURE", &c.Tracing.OTLPInsecure},
+		{"TRACING_SERVICE_NAME", &c.Tracing.ServiceName},
+		{"TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio},
+
+		{"AUDIT_ENABLED", &c.Audit.Enabled},
+		{"AUDIT_RETENTION_DAYS", &c.Audit.RetentionDays},
+		{"AUDIT_REDACT_SDP", &c.Audit.RedactSDP},
+
+		{"SHUTDOWN_DRAIN_TIMEOUT", &c.Shutdown.DrainTimeout},
+		{"SHUTDOWN_RECONNECT_SPREAD", &c.Shutdown.ReconnectSpread},
+		{"SHUTDOWN_RESUME_WINDOW", &c.Shutdown.ResumeWindow},
+
+		{"ALERT_CHECK_INTERVAL", &c.Alert.CheckInterval},
+		{"ALERT_SMTP_HOST", &c.Alert.SMTP.Host},
+		{"ALERT_SMTP_PORT", &c.Alert.SMTP.Port},
+		{"ALERT_SMTP_USERNAME", &c.Alert.SMTP.Username},
+		{"ALERT_SMTP_PASSWORD", &c.Alert.SMTP.Password},
+		{"ALERT_SMTP_FROM", &c.Alert.SMTP.From},
+		{"ALERT_SMTP_TO", &c.Alert.SMTP.To},
+		{"ALERT_WEBHOOK_URL", &c.Alert.Webhook.URL},
+		{"ALERT_WEBHOOK_TOKEN", &c.Alert.Webhook.Token},
+
+		{"WEBHOOK_MAX_ATTEMPTS", &c.Webhook.MaxAttempts},
+		{"WEBHOOK_INITIAL_BACKOFF", &c.Webhook.InitialBackoff},
+		{"WEBHOOK_MAX_BACKOFF", &c.Webhook.MaxBackoff},
+
+		{"CLUSTER_BUS", &c.Cluster.Bus},
+		{"CLUSTER_CHANNEL", &c.Cluster.Channel},
+		{"CLUSTER_REDIS_ADDR", &c.Cluster.RedisAddr},
+		{"CLUSTER_REDIS_PASSWORD", &c.Cluster.RedisPassword},
+		{"CLUSTER_NATS_URL", &c.Cluster.NATSURL},
+		{"CLUSTER_NODE_ID", &c.Cluster.NodeID},
+		{"CLUSTER_ADVERTISE_URL", &c.Cluster.AdvertiseURL},
+		{"CLUSTER_HEARTBEAT_INTERVAL", &c.Cluster.HeartbeatInterval},
+		{"CLUSTER_NODE_TIMEOUT", &c.Cluster.NodeTimeout},
+		{"CLUSTER_LEASE_STORE", &c.Cluster.LeaseStore},
+		{"CLUSTER_LEASE_TTL", &c.Cluster.LeaseTTL},
+		{"CLUSTER_JOIN_MODE", &c.Cluster.JoinMode},
+		{"CLUSTER_SECRET", &c.Cluster.Secret},
+
+		{"WS_MAX_CONNECTIONS", &c.Limits.MaxConnections},
+		{"WS_MAX_CONNECTIONS_PER_IP", &c.Limits.MaxConnectionsPerIP},
+		{"WS_MAX_ROOMS_PER_IP", &c.Limits.MaxRoomsPerIP},
+		{"WS_MAX_AUTO_ROOMS", &c.Limits.MaxAutoRooms},
+		{"WS_MAX_MESSAGE_SIZE", &c.Limits.MaxMessageSize},
+		{"WS_MAX_SDP_LENGTH", &c.Limits.MaxSDPLength},
+		{"WS_RATE_LIMITS", &c.Limits.RateLimits},
+		{"WS_MAX_VIOLATIONS", &c.Limits.MaxViolations},
+		{"WS_VIOLATION_WINDOW", &c.Limits.ViolationWindow},
+
+		{"CONFIG_WATCH_INTERVAL", &c.WatchInterval},
+	}
+
+	for _, override := range overrides {
+		value := strings.TrimSpace(os.Getenv(override.key))
+		if value == "" {
+			continue
+		}
+		if err := setValue(override.target, value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", override.key, err)
+		}
+	}
+	return nil
+}
+
+// setValue 解析环境变量的值并写入配置项
+func setValue(target interface{}, value string) error {
+	var err error
+	switch target := target.(type) {
+	case *string:
+		*target = value
+	case *[]string:
+		*target = splitList(value)
+	case *int:
+		*target, err = strconv.Atoi(value)
+	case *int64:
+		*target, err = strconv.ParseInt(value, 10, 64)
+	case *float64:
+		*target, err = strconv.ParseFloat(value, 64)
+	case *bool:
+		*target, err = strconv.ParseBool(value)
+	case *time.Duration:
+		*target, err = time.ParseDuration(value)
+	case *map[string]RateLimit:
+		*target, err = ParseRateLimits(value)
+	default:
+		err = fmt.Errorf("unsupported type %T", target)
+	}
+	return err
+}
+
+// ParseRateLimits 解析限流配置，格式为"事件类型=每秒数量:突发数量"，多项以逗号分隔
+func ParseRateLimits(value string) (map[string]RateLimit, error) {
+	rates := make(map[string]RateLimit)
+	for _, item := range splitList(value) {
+		eventType, limit, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid rate limit %q", item)
+		}
+		rate, burst, found := strings.Cut(limit, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid rate limit %q", item)
+		}
+
+		rateValue, err := strconv.ParseFloat(rate, 64)
+		if err != nil || rateValue <= 0 {
+			return nil, fmt.Errorf("invalid rate in %q", item)
+		}
+		burstValue, err := strconv.Atoi(burst)
+		if err != nil || burstValue <= 0 {
+			return nil, fmt.Errorf("invalid burst in %q", item)
+		}
+
+		rates[strings.TrimSpace(eventType)] = RateLimit{Rate: rateValue, Burst: burstValue}
+	}
+	return rates, nil
+}
+
+// splitList 解析逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
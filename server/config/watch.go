@@ -0,0 +1,103 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"monitor/logger"
+)
+
+// Watch 在收到SIGHUP或配置文件修改时重新加载配置，直到ctx取消。
+// 加载失败时保留当前配置；加载成功时调用apply应用可热加载的配置项，需要重启才能生效的配置项只记录警告
+func Watch(ctx context.Context, path string, current *Config, apply func(cfg *Config)) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	// 未配置检查间隔时只响应SIGHUP
+	var tick <-chan time.Time
+	if path != "" && current.WatchInterval > 0 {
+		ticker := time.NewTicker(current.WatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	modTime := fileModTime(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			slog.Info("received SIGHUP, reloading config", "path", path)
+		case <-tick:
+			latest := fileModTime(path)
+			if latest.Equal(modTime) {
+				continue
+			}
+			slog.Info("config file changed, reloading", "path", path)
+		}
+		modTime = fileModTime(path)
+
+		cfg, err := Load(path)
+		if err != nil {
+			slog.Error("reload config failed, keeping current config", "path", path, logger.KeyError, err)
+			continue
+		}
+
+		if changed := RestartRequired(current, cfg); len(changed) > 0 {
+			slog.Warn("config changes require restart and were not applied", "sections", changed)
+		}
+		apply(cfg)
+		current = cfg
+		slog.Info("config reloaded")
+	}
+}
+
+// RestartRequired 返回两份配置之间需要重启才能生效的差异所在的配置项
+func RestartRequired(old *Config, cfg *Config) []string {
+	oldServer, newServer := old.Server, cfg.Server
+	oldServer.AllowOrigins, newServer.AllowOrigins = nil, nil
+	oldServer.StrictOrigins, newServer.StrictOrigins = false, false
+	oldLog, newLog := old.Log, cfg.Log
+	oldLog.Level, newLog.Level = "", ""
+
+	sections := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"server", oldServer, newServer},
+		{"log", oldLog, newLog},
+		{"tracing", old.Tracing, cfg.Tracing},
+		{"audit", old.Audit, cfg.Audit},
+		{"shutdown", old.Shutdown, cfg.Shutdown},
+		{"alert", old.Alert, cfg.Alert},
+		{"webhook", old.Webhook, cfg.Webhook},
+		{"cluster", old.Cluster, cfg.Cluster},
+		{"watchInterval", old.WatchInterval, cfg.WatchInterval},
+	}
+
+	changed := make([]string, 0)
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.old, section.new) {
+			changed = append(changed, section.name)
+		}
+	}
+	return changed
+}
+
+// fileModTime 获取配置文件的修改时间，文件不存在时返回零值
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// rewriteConfig 覆盖配置文件并推后修改时间，避免文件系统的时间精度导致修改未被发现
+func rewriteConfig(t *testing.T, path string, content string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+func TestWatchReloadsChangedFile(t *testing.T) {
+	path := writeConfig(t, "watchInterval: 10ms\nlog:\n  level: info\n")
+	current, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	applied := make(chan *Config, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Watch(ctx, path, current, func(cfg *Config) { applied <- cfg })
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// 等待Watch记录文件的初始修改时间
+	time.Sleep(50 * time.Millisecond)
+
+	now := time.Now()
+	rewriteConfig(t, path, "watchInterval: 10ms\nlog:\n  level: debug\nserver:\n  allowOrigins: [\"https://app.example.com\"]\n", now.Add(time.Second))
+	select {
+	case cfg := <-applied:
+		if cfg.Log.Level != "debug" || !reflect.DeepEqual(cfg.Server.AllowOrigins, []string{"https://app.example.com"}) {
+			t.Fatalf("applied config has level %s and origins %v", cfg.Log.Level, cfg.Server.AllowOrigins)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("changed config was not applied")
+	}
+
+	// 不合法的配置不会被应用
+	rewriteConfig(t, path, "watchInterval: 10ms\nlog:\n  level: loud\n", now.Add(2*time.Second))
+	select {
+	case cfg := <-applied:
+		t.Fatalf("invalid config was applied with level %s", cfg.Log.Level)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// 修正后再次应用
+	rewriteConfig(t, path, "watchInterval: 10ms\nlog:\n  level: warn\n", now.Add(3*time.Second))
+	select {
+	case cfg := <-applied:
+		if cfg.Log.Level != "warn" {
+			t.Fatalf("applied config has level %s, want warn", cfg.Log.Level)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fixed config was not applied")
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := Default()
+
+	hot := Default()
+	hot.Server.AllowOrigins = []string{"https://app.example.com"}
+	hot.Server.StrictOrigins = !old.Server.StrictOrigins
+	hot.Log.Level = "debug"
+	hot.Limits.MaxConnections = 1
+	hot.ICEServers = nil
+	if changed := RestartRequired(old, hot); len(changed) != 0 {
+		t.Fatalf("hot reloadable changes reported as requiring restart: %v", changed)
+	}
+
+	cold := Default()
+	cold.Server.Port = "12000"
+	cold.Log.Format = "json"
+	cold.Cluster.Bus = "nats"
+	changed := RestartRequired(old, cold)
+	if !reflect.DeepEqual(changed, []string{"server", "log", "cluster"}) {
+		t.Fatalf("RestartRequired = %v, want [server log cluster]", changed)
+	}
+}
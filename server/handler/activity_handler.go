@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/model"
+	"monitor/service"
+)
+
+// activityHeartbeatInterval SSE心跳间隔，防止代理断开空闲连接
+const activityHeartbeatInterval = 15 * time.Second
+
+// ActivityHandler 房间活动SSE处理器
+type ActivityHandler struct {
+	activityService service.ActivityService
+	adminToken      string // 全局活动流的访问令牌，为空时不校验
+}
+
+// NewActivityHandler 创建房间活动SSE处理器
+func NewActivityHandler(activityService service.ActivityService, adminToken string) *ActivityHandler {
+	return &ActivityHandler{
+		activityService: activityService,
+		adminToken:      adminToken,
+	}
+}
+
+// StreamRoomEvents 推送指定房间的活动
+func (h *ActivityHandler) StreamRoomEvents(c *gin.Context) {
+	roomID := c.Param("roomId")
+	if roomID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "房间ID不能为空"})
+		return
+	}
+
+	h.stream(c, roomID)
+}
+
+// StreamAllEvents 推送所有房间的活动，仅供管理员使用
+func (h *ActivityHandler) StreamAllEvents(c *gin.Context) {
+	if !h.isAdmin(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无权访问"})
+		return
+	}
+
+	h.stream(c, "")
+}
+
+// stream 以Server-Sent Events格式推送活动
+func (h *ActivityHandler) stream(c *gin.Context, roomID string) {
+	lastID := parseLastEventID(c)
+	backlog, sub := h.activityService.Subscribe(roomID, lastID)
+	defer sub.Close()
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, activity := range backlog {
+		if err := writeActivity(c, activity); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(activityHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case activity, ok := <-sub.Events():
+			if !ok {
+				// 订阅被服务端关闭，客户端会携带Last-Event-ID自动重连
+				return
+			}
+			if err := writeActivity(c, activity); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// isAdmin 校验管理员令牌
+func (h *ActivityHandler) isAdmin(c *gin.Context) bool {
+	return isAdminRequest(c, h.adminToken)
+}
+
+// parseLastEventID 读取续传位置，EventSource重连时通过Last-Event-ID头携带
+func parseLastEventID(c *gin.Context) int64 {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
+// writeActivity 写入一条SSE消息
+func writeActivity(c *gin.Context, activity *model.Activity) error {
+	data, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", activity.ID, activity.Type, data)
+	return err
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/model"
+	"monitor/service"
+)
+
+// newActivityTestServer 创建只注册活动流路由的服务
+func newActivityTestServer(t *testing.T, adminToken string) (*httptest.Server, service.ActivityService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	activityService := service.NewActivityService()
+	activityHandler := NewActivityHandler(activityService, adminToken)
+
+	r := gin.New()
+	r.GET("/api/rooms/:roomId/events", activityHandler.StreamRoomEvents)
+	r.GET("/api/events", activityHandler.StreamAllEvents)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server, activityService
+}
+
+// openActivityStream 打开SSE流，lastEventID不为空时携带Last-Event-ID头
+func openActivityStream(t *testing.T, url string, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	return response, bufio.NewReader(response.Body)
+}
+
+// readActivityID 读取下一条SSE消息的id字段
+func readActivityID(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		if id, found := strings.CutPrefix(line, "id: "); found {
+			return strings.TrimSpace(id)
+		}
+	}
+}
+
+func TestActivityStreamResumesFromLastEventID(t *testing.T) {
+	server, activityService := newActivityTestServer(t, "")
+
+	for _, roomID := range []string{"room-a", "room-b", "room-a"} {
+		activityService.Publish(&model.Activity{Type: model.ActivityTypeJoin, RoomID: roomID, DeviceID: "camera-1"})
+	}
+
+	response, reader := openActivityStream(t, server.URL+"/api/rooms/room-a/events", "1")
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	// 只续传该房间中ID大于Last-Event-ID的活动
+	if id := readActivityID(t, reader); id != "3" {
+		t.Fatalf("first resumed activity id = %s, want 3", id)
+	}
+
+	activityService.Publish(&model.Activity{Type: model.ActivityTypeLeave, RoomID: "room-b", DeviceID: "camera-1"})
+	activityService.Publish(&model.Activity{Type: model.ActivityTypeLeave, RoomID: "room-a", DeviceID: "camera-1"})
+	if id := readActivityID(t, reader); id != "5" {
+		t.Fatalf("live activity id = %s, want 5", id)
+	}
+}
+
+func TestActivityStreamAllRoomsRequiresAdmin(t *testing.T) {
+	server, activityService := newActivityTestServer(t, "secret")
+	activityService.Publish(&model.Activity{Type: model.ActivityTypeJoin, RoomID: "room-a", DeviceID: "camera-1"})
+	activityService.Publish(&model.Activity{Type: model.ActivityTypeJoin, RoomID: "room-b", DeviceID: "camera-1"})
+
+	response, err := http.Get(server.URL + "/api/events")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status without token = %d, want 401", response.StatusCode)
+	}
+
+	// 全局流包含所有房间的活动，也可以通过查询参数续传
+	_, reader := openActivityStream(t, server.URL+"/api/events?token=secret&lastEventId=1", "")
+	if id := readActivityID(t, reader); id != "2" {
+		t.Fatalf("resumed activity id = %s, want 2", id)
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth 管理员接口中间件，adminToken为空时拒绝所有请求，避免未配置令牌时接口对外开放
+func AdminAuth(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "未配置管理员令牌，接口已禁用"})
+			return
+		}
+		if !isAdminRequest(c, adminToken) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "无权访问"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// isAdminRequest 校验管理员令牌，支持Authorization头或token查询参数，adminToken为空时不校验
+func isAdminRequest(c *gin.Context, adminToken string) bool {
+	if adminToken == "" {
+		return true
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		token = c.Query("token")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
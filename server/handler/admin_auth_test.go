@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(adminToken string) *gin.Engine {
+		r := gin.New()
+		r.GET("/api/webhooks", AdminAuth(adminToken), func(c *gin.Context) { c.Status(http.StatusOK) })
+		return r
+	}
+
+	tests := []struct {
+		adminToken string
+		path       string
+		header     string
+		want       int
+	}{
+		// 未配置令牌时接口禁用，不对外开放
+		{"", "/api/webhooks", "", http.StatusForbidden},
+		{"", "/api/webhooks", "Bearer anything", http.StatusForbidden},
+		{"s3cret", "/api/webhooks", "", http.StatusUnauthorized},
+		{"s3cret", "/api/webhooks", "Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", "/api/webhooks", "Bearer s3cret", http.StatusOK},
+		{"s3cret", "/api/webhooks?token=s3cret", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.header != "" {
+			request.Header.Set("Authorization", test.header)
+		}
+		w := httptest.NewRecorder()
+		newRouter(test.adminToken).ServeHTTP(w, request)
+		if w.Code != test.want {
+			t.Errorf("token %q, request %s with %q: status %d, want %d", test.adminToken, test.path, test.header, w.Code, test.want)
+		}
+	}
+}
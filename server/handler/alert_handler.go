@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/model"
+	"monitor/service"
+)
+
+// AlertHandler 告警接口处理器
+type AlertHandler struct {
+	alertService service.AlertService
+}
+
+// NewAlertHandler 创建告警接口处理器
+func NewAlertHandler(alertService service.AlertService) *AlertHandler {
+	return &AlertHandler{
+		alertService: alertService,
+	}
+}
+
+// alertRuleRequest 创建/更新告警规则请求
+type alertRuleRequest struct {
+	Type      model.AlertRuleType `json:"type"`
+	DeviceID  string              `json:"deviceId"`
+	Duration  int64               `json:"duration"`
+	Notifiers []string            `json:"notifiers"`
+}
+
+// toRule 转换为告警规则对象
+func (r *alertRuleRequest) toRule() *model.AlertRule {
+	return &model.AlertRule{
+		Type:      r.Type,
+		DeviceID:  r.DeviceID,
+		Duration:  r.Duration,
+		Notifiers: r.Notifiers,
+	}
+}
+
+// ListRules 获取房间内所有告警规则
+func (h *AlertHandler) ListRules(c *gin.Context) {
+	rules, err := h.alertService.GetRules(c.Param("roomId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateRule 在房间中创建告警规则
+func (h *AlertHandler) CreateRule(c *gin.Context) {
+	var req alertRuleRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	rule, err := h.alertService.CreateRule(c.Param("roomId"), req.toRule())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateRule 更新房间内指定告警规则
+func (h *AlertHandler) UpdateRule(c *gin.Context) {
+	var req alertRuleRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	rule, err := h.alertService.UpdateRule(c.Param("roomId"), c.Param("ruleId"), req.toRule())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule 删除房间内指定告警规则
+func (h *AlertHandler) DeleteRule(c *gin.Context) {
+	rule, err := h.alertService.DeleteRule(c.Param("roomId"), c.Param("ruleId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// ListAlerts 获取房间内正在告警的告警
+func (h *AlertHandler) ListAlerts(c *gin.Context) {
+	c.JSON(http.StatusOK, h.alertService.GetAlerts(c.Param("roomId")))
+}
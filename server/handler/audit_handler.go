@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/model"
+	"monitor/service"
+)
+
+const (
+	// defaultAuditLimit 默认返回的审计记录数量
+	defaultAuditLimit = 1000
+	// maxAuditLimit 单次最多返回的审计记录数量
+	maxAuditLimit = 10000
+	// defaultAuditWindow 未指定起始时间时查询的时间范围，避免读取全部审计文件
+	defaultAuditWindow = 24 * time.Hour
+)
+
+// AuditHandler 审计查询接口处理器
+type AuditHandler struct {
+	auditService service.AuditService
+}
+
+// NewAuditHandler 创建审计查询接口处理器
+func NewAuditHandler(auditService service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// QueryRoomAudit 查询房间的事件审计记录
+// 查询参数：deviceId、type（可逗号分隔或重复）、from、to（毫秒时间戳或RFC3339）、limit，
+// 未指定from时只查询to（默认当前时间）之前24小时内的记录。
+// 响应头X-Audit-Dropped为服务启动以来因写入队列已满而丢弃的记录数量
+func (h *AuditHandler) QueryRoomAudit(c *gin.Context) {
+	query := &model.AuditQuery{
+		RoomID:   c.Param("roomId"),
+		DeviceID: c.Query("deviceId"),
+		Limit:    defaultAuditLimit,
+	}
+
+	for _, value := range c.QueryArray("type") {
+		for _, eventType := range strings.Split(value, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				query.Types = append(query.Types, model.EventType(eventType))
+			}
+		}
+	}
+
+	var err error
+	if query.StartTime, err = parseTimeQuery(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.EndTime, err = parseTimeQuery(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.StartTime == 0 {
+		end := query.EndTime
+		if end == 0 {
+			end = time.Now().UnixNano() / int64(time.Millisecond)
+		}
+		query.StartTime = end - defaultAuditWindow.Milliseconds()
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的limit参数"})
+			return
+		}
+		if query.Limit > maxAuditLimit {
+			query.Limit = maxAuditLimit
+		}
+	}
+
+	records, err := h.auditService.Query(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 丢弃过记录时查询结果可能不完整
+	c.Header("X-Audit-Dropped", strconv.FormatInt(h.auditService.Dropped(), 10))
+	c.JSON(http.StatusOK, records)
+}
+
+// parseTimeQuery 解析毫秒时间戳或RFC3339时间，为空时返回0
+func parseTimeQuery(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return millis, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间参数: %s", value)
+	}
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/logger"
+	"monitor/service"
+)
+
+const (
+	// JoinModeProxy 由收到连接的节点代理到房间所属节点
+	JoinModeProxy = "proxy"
+	// JoinModeRedirect 返回307，由客户端重新连接到房间所属节点
+	JoinModeRedirect = "redirect"
+
+	// headerForwardedBy 代理连接时携带的来源节点ID，用于避免节点之间循环代理
+	headerForwardedBy = "X-Monitor-Forwarded-By"
+	// headerForwardedSignature 代理连接时携带的签名，格式为 Unix秒.HMAC-SHA256十六进制，
+	// 所属节点验证通过后不再重复检查来源
+	headerForwardedSignature = "X-Monitor-Forwarded-Signature"
+	// forwardedSignatureMaxAge 代理签名的有效时间，允许节点之间存在少量时钟偏差
+	forwardedSignatureMaxAge = 30 * time.Second
+	// headerOwnerNode 重定向时返回的房间所属节点ID
+	headerOwnerNode = "X-Monitor-Owner-Node"
+)
+
+// ClusterHandler 集群接口处理器
+type ClusterHandler struct {
+	clusterService service.ClusterService
+	joinMode       string
+	secret         []byte // 集群共享密钥，用于签名代理的连接
+}
+
+// NewClusterHandler 创建集群接口处理器，joinMode为空时代理非本节点房间的连接，
+// secret为集群共享密钥，为空时代理的连接在所属节点按普通跨域请求检查来源
+func NewClusterHandler(clusterService service.ClusterService, joinMode string, secret string) *ClusterHandler {
+	if joinMode != JoinModeRedirect {
+		joinMode = JoinModeProxy
+	}
+
+	return &ClusterHandler{
+		clusterService: clusterService,
+		joinMode:       joinMode,
+		secret:         []byte(secret),
+	}
+}
+
+// ListNodes 获取当前可见的集群节点
+func (h *ClusterHandler) ListNodes(c *gin.Context) {
+	c.JSON(http.StatusOK, h.clusterService.GetNodes())
+}
+
+// GetRoomOwner 获取房间所属节点
+func (h *ClusterHandler) GetRoomOwner(c *gin.Context) {
+	owner, err := h.clusterService.GetRoomOwner(c.Param("roomId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, owner)
+}
+
+// RouteWebSocket WebSocket连接的路由中间件：房间由本节点持有时继续处理，
+// 否则按配置代理到所属节点，或返回307告知客户端重新连接的地址。
+// 需要在WebSocketHandler.AdmitWebSocket之后执行，参数无效或超出连接数限制的请求不会获取房间所有权
+func (h *ClusterHandler) RouteWebSocket(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	owner, err := h.clusterService.AcquireRoom(roomID)
+	if err != nil {
+		slog.Warn("acquire room failed", logger.KeyRoomID, roomID, logger.KeyError, err)
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "房间暂时不可用"})
+		return
+	}
+	if owner.Self {
+		c.Next()
+		return
+	}
+
+	// 已经被代理过一次仍不属于本节点，说明节点之间对所属节点的判断不一致，交给客户端重试
+	if c.GetHeader(headerForwardedBy) != "" || owner.URL == "" {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "房间所属节点不可用"})
+		return
+	}
+
+	target, err := url.Parse(owner.URL)
+	if err != nil {
+		slog.Warn("invalid node url", "node", owner.NodeID, "url", owner.URL, logger.KeyError, err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "房间所属节点不可用"})
+		return
+	}
+
+	if h.joinMode == JoinModeRedirect {
+		location := *target
+		switch location.Scheme {
+		case "https":
+			location.Scheme = "wss"
+		default:
+			location.Scheme = "ws"
+		}
+		location.Path = strings.TrimSuffix(location.Path, "/") + c.Request.URL.Path
+		location.RawQuery = c.Request.URL.RawQuery
+
+		c.Header("Location", location.String())
+		c.Header(headerOwnerNode, owner.NodeID)
+		c.AbortWithStatusJSON(http.StatusTemporaryRedirect, gin.H{
+			"error":    "房间由其他节点处理",
+			"nodeId":   owner.NodeID,
+			"location": location.String(),
+		})
+		return
+	}
+
+	nodeID := h.clusterService.NodeID()
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(request *httputil.ProxyRequest) {
+			request.SetURL(target)
+			request.SetXForwarded()
+			request.Out.Header.Set(headerForwardedBy, nodeID)
+			request.Out.Header.Del(headerForwardedSignature)
+			if len(h.secret) > 0 {
+				request.Out.Header.Set(headerForwardedSignature, signForwarded(h.secret, nodeID, request.Out.URL.Query().Get("deviceId"), time.Now()))
+			}
+		},
+		ErrorHandler: func(writer http.ResponseWriter, request *http.Request, err error) {
+			slog.Warn("proxy websocket failed", logger.KeyRoomID, roomID, "node", owner.NodeID, logger.KeyError, err)
+			writer.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	slog.Debug("proxy websocket", logger.KeyRoomID, roomID, "node", owner.NodeID)
+	proxy.ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+}
+
+// signForwarded 计算代理连接的签名，签名覆盖来源节点、设备ID和时间
+func signForwarded(secret []byte, nodeID string, deviceID string, now time.Time) string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	return timestamp + "." + forwardedMAC(secret, nodeID, deviceID, timestamp)
+}
+
+// verifyForwarded 验证代理连接的签名，密钥为空、签名不匹配或已过期时返回false
+func verifyForwarded(secret []byte, r *http.Request, now time.Time) bool {
+	if len(secret) == 0 {
+		return false
+	}
+
+	timestamp, mac, found := strings.Cut(r.Header.Get(headerForwardedSignature), ".")
+	if !found {
+		return false
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > forwardedSignatureMaxAge || age < -forwardedSignatureMaxAge {
+		return false
+	}
+
+	expected := forwardedMAC(secret, r.Header.Get(headerForwardedBy), r.URL.Query().Get("deviceId"), timestamp)
+	return hmac.Equal([]byte(mac), []byte(expected))
+}
+
+// forwardedMAC 计算HMAC-SHA256并返回十六进制字符串
+func forwardedMAC(secret []byte, nodeID string, deviceID string, timestamp string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(nodeID + "\n" + deviceID + "\n" + timestamp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
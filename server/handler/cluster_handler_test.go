@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/cluster"
+	"monitor/service"
+)
+
+// newRoutingTestServer 创建只注册WebSocket准入和集群路由的服务，房间由本节点持有时返回204
+func newRoutingTestServer(t *testing.T, limits ConnectionLimits) (*gin.Engine, *WebSocketHandler, cluster.LeaseStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	leases := cluster.NewMemoryLeaseStore()
+	clusterService := service.NewClusterService(service.ClusterConfig{NodeID: "a", Leases: leases},
+		service.NewRoomService(), cluster.NewMemoryNetwork().NewBus())
+	webSocketHandler := NewWebSocketHandler(clusterService, nil, nil, nil, NewCORS(nil, true), MessageLimits{}, limits)
+	clusterHandler := NewClusterHandler(clusterService, JoinModeProxy, "")
+
+	r := gin.New()
+	r.GET("/ws/:roomId", webSocketHandler.AdmitWebSocket, clusterHandler.RouteWebSocket, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return r, webSocketHandler, leases
+}
+
+// leaseHolder 获取房间租约的持有者
+func leaseHolder(t *testing.T, leases cluster.LeaseStore, roomID string) string {
+	t.Helper()
+
+	holder, err := leases.Holder(context.Background(), "room/"+roomID)
+	if err != nil {
+		t.Fatalf("Holder: %v", err)
+	}
+	return holder
+}
+
+func TestRouteWebSocketValidatesBeforeAcquiring(t *testing.T) {
+	r, _, leases := newRoutingTestServer(t, ConnectionLimits{})
+
+	longID := strings.Repeat("a", 65)
+	for _, target := range []string{
+		"/ws/" + longID + "?deviceId=camera-1&deviceType=camera",
+		"/ws/room?deviceType=camera",
+		"/ws/room?deviceId=camera-1",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("GET %s = %d, want 400", target, w.Code)
+		}
+	}
+
+	if holder := leaseHolder(t, leases, "room"); holder != "" {
+		t.Fatalf("invalid request acquired the room lease for %q", holder)
+	}
+	if holder := leaseHolder(t, leases, longID); holder != "" {
+		t.Fatalf("invalid room ID acquired a lease for %q", holder)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ws/room?deviceId=camera-1&deviceType=camera", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("valid request = %d, want 204", w.Code)
+	}
+	if holder := leaseHolder(t, leases, "room"); holder != "a" {
+		t.Fatalf("valid request lease holder = %q, want a", holder)
+	}
+}
+
+func TestRouteWebSocketLimitsBeforeAcquiring(t *testing.T) {
+	r, webSocketHandler, leases := newRoutingTestServer(t, ConnectionLimits{MaxConnectionsPerIP: 1})
+
+	// 同一来源IP已有一个连接
+	if reason := webSocketHandler.tracker.acquire("192.0.2.1", "other", true); reason != "" {
+		t.Fatalf("acquire: %s", reason)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/ws/room?deviceId=camera-1&deviceType=camera", nil)
+	request.RemoteAddr = "192.0.2.1:40000"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the per-IP limit = %d, want 429", w.Code)
+	}
+	if holder := leaseHolder(t, leases, "room"); holder != "" {
+		t.Fatalf("rejected request acquired the room lease for %q", holder)
+	}
+
+	// 未建立连接的请求结束后释放名额
+	webSocketHandler.tracker.release("192.0.2.1", "other")
+	request = httptest.NewRequest(http.MethodGet, "/ws/room?deviceId=camera-1&deviceType=camera", nil)
+	request.RemoteAddr = "192.0.2.1:40001"
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("request within the limit = %d, want 204", w.Code)
+	}
+	if webSocketHandler.tracker.total != 0 {
+		t.Fatalf("tracker still counts %d connections after the request ended", webSocketHandler.tracker.total)
+	}
+}
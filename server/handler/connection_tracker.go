@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"sync"
+)
+
+// ConnectionLimits WebSocket升级前检查的连接数限制，0表示不限制
+type ConnectionLimits struct {
+	MaxConnections      int // 本节点的WebSocket连接总数
+	MaxConnectionsPerIP int // 单个来源IP的连接数
+	MaxRoomsPerIP       int // 单个来源IP同时连接的房间数
+	MaxAutoRooms        int // 设备加入时自动创建、仍有连接的房间数
+}
+
+// 连接被拒绝的原因，用于指标和日志
+const (
+	rejectTotal     = "total"
+	rejectIP        = "ip"
+	rejectIPRooms   = "ip_rooms"
+	rejectAutoRooms = "auto_rooms"
+)
+
+// connectionRejectMessages 拒绝原因对应的错误信息
+var connectionRejectMessages = map[string]string{
+	rejectTotal:     "服务器连接数已达上限",
+	rejectIP:        "来源IP的连接数已达上限",
+	rejectIPRooms:   "来源IP连接的房间数已达上限",
+	rejectAutoRooms: "自动创建的房间数已达上限",
+}
+
+// ipUsage 单个来源IP的连接情况
+type ipUsage struct {
+	connections int
+	rooms       map[string]int // 房间ID -> 该IP在房间内的连接数
+}
+
+// connectionTracker 统计连接数，在WebSocket升级前预留名额，连接结束后释放
+type connectionTracker struct {
+	mutex     sync.Mutex
+	limits    ConnectionLimits
+	total     int
+	ips       map[string]*ipUsage
+	autoRooms map[string]int // 自动创建的房间ID -> 房间内经本节点建立的连接数
+}
+
+// newConnectionTracker 创建连接统计
+func newConnectionTracker(limits ConnectionLimits) *connectionTracker {
+	return &connectionTracker{
+		limits:    limits,
+		ips:       make(map[string]*ipUsage),
+		autoRooms: make(map[string]int),
+	}
+}
+
+// setLimits 修改连接数限制，已建立的连接不受影响
+func (t *connectionTracker) setLimits(limits ConnectionLimits) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.limits = limits
+}
+
+// acquire 为连接预留名额，roomExists表示房间是否已存在，不存在时加入会自动创建房间。
+// 超出限制时返回拒绝原因，否则返回空字符串，调用方需在连接结束后调用release
+func (t *connectionTracker) acquire(ip string, roomID string, roomExists bool) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.limits.MaxConnections > 0 && t.total >= t.limits.MaxConnections {
+		return rejectTotal
+	}
+
+	usage := t.ips[ip]
+	if usage != nil {
+		if t.limits.MaxConnectionsPerIP > 0 && usage.connections >= t.limits.MaxConnectionsPerIP {
+			return rejectIP
+		}
+		if _, joined := usage.rooms[roomID]; !joined && t.limits.MaxRoomsPerIP > 0 && len(usage.rooms) >= t.limits.MaxRoomsPerIP {
+			return rejectIPRooms
+		}
+	}
+
+	// 其他连接自动创建的房间继续计入，直到房间内的连接全部结束
+	_, autoRoom := t.autoRooms[roomID]
+	if !autoRoom && !roomExists {
+		if t.limits.MaxAutoRooms > 0 && len(t.autoRooms) >= t.limits.MaxAutoRooms {
+			return rejectAutoRooms
+		}
+		autoRoom = true
+	}
+
+	if usage == nil {
+		usage = &ipUsage{rooms: make(map[string]int)}
+		t.ips[ip] = usage
+	}
+	usage.connections++
+	usage.rooms[roomID]++
+	if autoRoom {
+		t.autoRooms[roomID]++
+	}
+	t.total++
+	return ""
+}
+
+// release 释放acquire预留的名额
+func (t *connectionTracker) release(ip string, roomID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.total--
+
+	if usage, exists := t.ips[ip]; exists {
+		usage.connections--
+		if usage.rooms[roomID]--; usage.rooms[roomID] <= 0 {
+			delete(usage.rooms, roomID)
+		}
+		if usage.connections <= 0 {
+			delete(t.ips, ip)
+		}
+	}
+
+	if count, exists := t.autoRooms[roomID]; exists {
+		if count <= 1 {
+			delete(t.autoRooms, roomID)
+		} else {
+			t.autoRooms[roomID] = count - 1
+		}
+	}
+}
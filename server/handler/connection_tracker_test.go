@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/service"
+)
+
+func TestConnectionTrackerLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   ConnectionLimits
+		acquired [][2]string // 已建立的连接：来源IP和房间ID
+		ip       string
+		roomID   string
+		exists   bool
+		want     string
+	}{
+		{"total", ConnectionLimits{MaxConnections: 2}, [][2]string{{"a", "r1"}, {"b", "r1"}}, "c", "r1", true, rejectTotal},
+		{"per ip", ConnectionLimits{MaxConnectionsPerIP: 2}, [][2]string{{"a", "r1"}, {"a", "r2"}}, "a", "r1", true, rejectIP},
+		{"other ip", ConnectionLimits{MaxConnectionsPerIP: 2}, [][2]string{{"a", "r1"}, {"a", "r2"}}, "b", "r1", true, ""},
+		{"ip rooms", ConnectionLimits{MaxRoomsPerIP: 2}, [][2]string{{"a", "r1"}, {"a", "r2"}}, "a", "r3", true, rejectIPRooms},
+		// 已连接的房间不计为新房间
+		{"ip joined room", ConnectionLimits{MaxRoomsPerIP: 2}, [][2]string{{"a", "r1"}, {"a", "r2"}}, "a", "r2", true, ""},
+		{"auto rooms", ConnectionLimits{MaxAutoRooms: 1}, [][2]string{{"a", "r1"}}, "b", "r2", false, rejectAutoRooms},
+		// 加入其他连接自动创建的房间不再计数
+		{"existing auto room", ConnectionLimits{MaxAutoRooms: 1}, [][2]string{{"a", "r1"}}, "b", "r1", false, ""},
+		{"existing room", ConnectionLimits{MaxAutoRooms: 1}, [][2]string{{"a", "r1"}}, "b", "r2", true, ""},
+	}
+
+	for _, test := range tests {
+		tracker := newConnectionTracker(test.limits)
+		for _, connection := range test.acquired {
+			if reason := tracker.acquire(connection[0], connection[1], false); reason != "" {
+				t.Fatalf("%s: acquire %v: %s", test.name, connection, reason)
+			}
+		}
+		if got := tracker.acquire(test.ip, test.roomID, test.exists); got != test.want {
+			t.Errorf("%s: acquire = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestConnectionTrackerRelease(t *testing.T) {
+	tracker := newConnectionTracker(ConnectionLimits{MaxConnectionsPerIP: 1, MaxAutoRooms: 1})
+	if reason := tracker.acquire("a", "r1", false); reason != "" {
+		t.Fatalf("acquire: %s", reason)
+	}
+	tracker.release("a", "r1")
+
+	// 连接结束后名额和自动创建的房间都被释放
+	if tracker.total != 0 || len(tracker.ips) != 0 || len(tracker.autoRooms) != 0 {
+		t.Fatalf("tracker after release: total %d, ips %v, autoRooms %v", tracker.total, tracker.ips, tracker.autoRooms)
+	}
+	if reason := tracker.acquire("a", "r2", false); reason != "" {
+		t.Fatalf("acquire after release: %s", reason)
+	}
+}
+
+func TestAdmitWebSocketTrustsOnlyConfiguredProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	webSocketHandler := NewWebSocketHandler(service.NewRoomService(), nil, nil, nil, NewCORS(nil, true),
+		MessageLimits{}, ConnectionLimits{MaxConnectionsPerIP: 1})
+
+	r := gin.New()
+	if err := r.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	r.GET("/ws/:roomId", webSocketHandler.AdmitWebSocket, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	// 来源IP已有一个连接
+	if reason := webSocketHandler.tracker.acquire("203.0.113.7", "room", true); reason != "" {
+		t.Fatalf("acquire: %s", reason)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		// 可信代理转发的请求按X-Forwarded-For中的客户端IP计数
+		{"10.0.0.1:40000", http.StatusTooManyRequests},
+		// 其他来源伪造的X-Forwarded-For被忽略
+		{"192.0.2.9:40000", http.StatusNoContent},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/ws/room?deviceId=camera-1&deviceType=camera", nil)
+		request.RemoteAddr = test.remoteAddr
+		request.Header.Set("X-Forwarded-For", "203.0.113.7")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		if w.Code != test.want {
+			t.Errorf("request from %s = %d, want %d", test.remoteAddr, w.Code, test.want)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("request from %s rejected without Retry-After", test.remoteAddr)
+		}
+	}
+}
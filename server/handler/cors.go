@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"monitor/metrics"
+)
+
+// CORS 跨域中间件，同时用于WebSocket升级时的来源检查，允许的来源可在运行时修改
+type CORS struct {
+	mutex         sync.RWMutex
+	any           bool            // 是否允许任意来源，只通过*允许的来源总是返回*且不携带凭证
+	strict        bool            // 严格模式，只通过*允许的来源不能建立WebSocket连接
+	patterns      []originPattern // 允许的来源
+	clusterSecret []byte          // 集群共享密钥，用于验证其他节点代理的请求，为空时不信任代理请求
+}
+
+// originPattern 允许的来源，如 https://app.example.com、https://*.example.com 或 *.example.com
+type originPattern struct {
+	scheme   string // 协议，为空时匹配任意协议
+	host     string // 主机名，通配时为去掉*的后缀，如 .example.com
+	port     string // 端口，为空时只匹配省略端口的来源
+	wildcard bool   // 是否匹配任意子域名
+}
+
+// NewCORS 创建跨域中间件，origins中的*表示允许任意来源
+func NewCORS(origins []string, strict bool) *CORS {
+	cors := &CORS{}
+	cors.SetAllowedOrigins(origins, strict)
+	return cors
+}
+
+// SetAllowedOrigins 修改允许的跨域来源和严格模式，无法解析的来源被忽略
+func (m *CORS) SetAllowedOrigins(origins []string, strict bool) {
+	patterns := make([]originPattern, 0, len(origins))
+	any := false
+	for _, origin := range origins {
+		if origin == "*" {
+			any = true
+			continue
+		}
+		pattern, ok := parseOriginPattern(origin)
+		if !ok {
+			slog.Warn("ignore invalid allowed origin", "origin", origin)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.any = any
+	m.strict = strict
+	m.patterns = patterns
+}
+
+// parseOriginPattern 解析允许的来源，协议可以省略，主机名可以以*.开头表示任意子域名
+func parseOriginPattern(origin string) (originPattern, bool) {
+	var pattern originPattern
+	hostPort := strings.ToLower(origin)
+	if scheme, rest, found := strings.Cut(hostPort, "://"); found {
+		pattern.scheme = scheme
+		hostPort = rest
+	}
+	if hostPort == "" || strings.ContainsAny(hostPort, "/?#@") {
+		return pattern, false
+	}
+
+	host, port := splitHostPort(hostPort)
+	if strings.HasPrefix(host, "*.") {
+		pattern.wildcard = true
+		host = host[1:]
+	}
+	if host == "" || host == "." || strings.Contains(host, "*") {
+		return pattern, false
+	}
+	pattern.host = host
+	pattern.port = port
+	return pattern, true
+}
+
+// match 来源是否匹配
+func (p originPattern) match(scheme string, host string, port string) bool {
+	if p.scheme != "" && p.scheme != scheme {
+		return false
+	}
+	if p.port != port {
+		return false
+	}
+	if p.wildcard {
+		return len(host) > len(p.host) && strings.HasSuffix(host, p.host)
+	}
+	return host == p.host
+}
+
+// splitHostPort 拆分主机名和端口，没有端口时端口为空
+func splitHostPort(hostPort string) (string, string) {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return hostPort, ""
+	}
+	return host, port
+}
+
+// SetClusterSecret 设置集群共享密钥，携带有效签名的代理请求不再检查来源
+func (m *CORS) SetClusterSecret(secret string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.clusterSecret = []byte(secret)
+}
+
+// allowOrigin 检查跨域请求的来源，返回响应的Access-Control-Allow-Origin和是否允许携带凭证，
+// 来源不被允许时返回空字符串。只有明确配置的来源返回该来源并允许携带凭证，
+// 只通过*允许的来源返回*且不携带凭证，避免任意网站以用户身份访问接口
+func (m *CORS) allowOrigin(origin string) (string, bool) {
+	if origin == "" {
+		return "", false
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.matchPattern(origin) {
+		return origin, true
+	}
+	if !m.any {
+		return "", false
+	}
+	return "*", false
+}
+
+// allowWebSocket 检查WebSocket升级请求的来源，来源匹配配置的来源，或关闭严格模式且允许任意来源时允许
+func (m *CORS) allowWebSocket(origin string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.matchPattern(origin) || (m.any && !m.strict)
+}
+
+// matchPattern 来源是否匹配配置的来源，调用方需持有锁
+func (m *CORS) matchPattern(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	host, port := splitHostPort(u.Host)
+	for _, pattern := range m.patterns {
+		if pattern.match(u.Scheme, host, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin 检查WebSocket升级请求的来源。没有Origin的非浏览器客户端、同源请求和
+// 携带有效集群签名的代理请求（已由代理节点检查）总是允许；严格模式下只通过*允许的来源被拒绝，
+// 因为浏览器建立WebSocket连接时总会携带Cookie
+func (m *CORS) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || sameOrigin(origin, r.Host) {
+		return true
+	}
+	if r.Header.Get(headerForwardedBy) != "" && m.verifyForwarded(r) {
+		return true
+	}
+	return m.allowWebSocket(origin)
+}
+
+// verifyForwarded 使用集群共享密钥验证代理请求的签名
+func (m *CORS) verifyForwarded(r *http.Request) bool {
+	m.mutex.RLock()
+	secret := m.clusterSecret
+	m.mutex.RUnlock()
+
+	return verifyForwarded(secret, r, time.Now())
+}
+
+// CheckWebSocketOrigin 在升级和集群路由之前拒绝来源不被允许的WebSocket请求
+func (m *CORS) CheckWebSocketOrigin(c *gin.Context) {
+	if m.CheckOrigin(c.Request) {
+		c.Next()
+		return
+	}
+
+	metrics.OriginRejections.WithLabelValues("websocket").Inc()
+	slog.Warn("websocket origin rejected",
+		"origin", c.GetHeader("Origin"), "clientIp", c.ClientIP(), "path", c.Request.URL.Path)
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "不允许的来源"})
+}
+
+// Handle 设置跨域响应头，并直接响应预检请求
+func (m *CORS) Handle(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	allowOrigin, credentials := m.allowOrigin(origin)
+	if allowOrigin != "" {
+		c.Writer.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if credentials {
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Last-Event-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+	} else if origin != "" && !sameOrigin(origin, c.Request.Host) && !websocket.IsWebSocketUpgrade(c.Request) {
+		// WebSocket请求由CheckWebSocketOrigin检查和记录
+		metrics.OriginRejections.WithLabelValues("http").Inc()
+		slog.Warn("cors origin rejected", "origin", origin, "clientIp", c.ClientIP(), "path", c.Request.URL.Path)
+	}
+	// 响应头随请求来源变化，避免缓存返回其他来源的响应
+	c.Writer.Header().Add("Vary", "Origin")
+
+	if c.Request.Method == http.MethodOptions {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	c.Next()
+}
+
+// sameOrigin 来源的主机是否与请求的Host相同
+func sameOrigin(origin string, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, host)
+}
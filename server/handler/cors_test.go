@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSOriginMatching(t *testing.T) {
+	cors := NewCORS([]string{"https://app.example.com", "*.example.org", "http://localhost:5173"}, true)
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com:8443", false},
+		{"https://evil-app.example.com", false},
+		{"https://a.example.org", true},
+		{"http://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://example.org.evil.com", false},
+		{"http://localhost:5173", true},
+		{"http://localhost:5174", false},
+		{"null", false},
+	}
+	for _, test := range tests {
+		allowOrigin, credentials := cors.allowOrigin(test.origin)
+		if got := allowOrigin != ""; got != test.want {
+			t.Errorf("allowOrigin(%q) = %q, want allowed %v", test.origin, allowOrigin, test.want)
+		}
+		if test.want && (allowOrigin != test.origin || !credentials) {
+			t.Errorf("allowOrigin(%q) = %q, %v, want the origin with credentials", test.origin, allowOrigin, credentials)
+		}
+		if got := cors.allowWebSocket(test.origin); got != test.want {
+			t.Errorf("allowWebSocket(%q) = %v, want %v", test.origin, got, test.want)
+		}
+	}
+}
+
+func TestCORSWildcardNeverSendsCredentials(t *testing.T) {
+	for _, strict := range []bool{true, false} {
+		cors := NewCORS([]string{"*", "https://app.example.com"}, strict)
+
+		allowOrigin, credentials := cors.allowOrigin("https://evil.example.net")
+		if allowOrigin != "*" || credentials {
+			t.Fatalf("strict=%v: wildcard origin got %q, credentials %v, want * without credentials", strict, allowOrigin, credentials)
+		}
+		allowOrigin, credentials = cors.allowOrigin("https://app.example.com")
+		if allowOrigin != "https://app.example.com" || !credentials {
+			t.Fatalf("strict=%v: listed origin got %q, credentials %v", strict, allowOrigin, credentials)
+		}
+
+		// 只有关闭严格模式时*才允许任意来源建立WebSocket连接
+		if got := cors.allowWebSocket("https://evil.example.net"); got == strict {
+			t.Fatalf("strict=%v: allowWebSocket for a wildcard origin = %v", strict, got)
+		}
+	}
+
+	// 默认配置下的响应头
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewCORS([]string{"*"}, true).Handle)
+	r.GET("/api/rooms", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+	request.Header.Set("Origin", "https://evil.example.net")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Fatalf("Access-Control-Allow-Credentials = %q, want none", got)
+	}
+}
+
+func TestCORSCheckOrigin(t *testing.T) {
+	cors := NewCORS([]string{"*", "https://app.example.com"}, true)
+
+	newRequest := func(origin string) *http.Request {
+		request := httptest.NewRequest(http.MethodGet, "http://monitor.example.com/ws/room?deviceId=camera-1", nil)
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		return request
+	}
+
+	if !cors.CheckOrigin(newRequest("")) {
+		t.Fatal("request without Origin was rejected")
+	}
+	if !cors.CheckOrigin(newRequest("http://monitor.example.com")) {
+		t.Fatal("same-origin request was rejected")
+	}
+	if !cors.CheckOrigin(newRequest("https://app.example.com")) {
+		t.Fatal("listed origin was rejected")
+	}
+	if cors.CheckOrigin(newRequest("https://evil.example.net")) {
+		t.Fatal("origin only allowed by * was accepted in strict mode")
+	}
+
+	// 只带来源节点ID的请求不能跳过检查
+	forged := newRequest("https://evil.example.net")
+	forged.Header.Set(headerForwardedBy, "node-a")
+	if cors.CheckOrigin(forged) {
+		t.Fatal("request with an unsigned forwarded header skipped the origin check")
+	}
+}
+
+func TestCORSForwardedSignature(t *testing.T) {
+	secret := []byte("cluster-secret")
+	cors := NewCORS([]string{"https://app.example.com"}, true)
+	cors.SetClusterSecret(string(secret))
+
+	newForwarded := func(signature string) *http.Request {
+		request := httptest.NewRequest(http.MethodGet, "http://node-b:11100/ws/room?deviceId=camera-1", nil)
+		request.Header.Set("Origin", "http://node-a:11100")
+		request.Header.Set(headerForwardedBy, "node-a")
+		request.Header.Set(headerForwardedSignature, signature)
+		return request
+	}
+
+	now := time.Now()
+	if !cors.CheckOrigin(newForwarded(signForwarded(secret, "node-a", "camera-1", now))) {
+		t.Fatal("request with a valid signature was rejected")
+	}
+
+	for name, signature := range map[string]string{
+		"wrong secret": signForwarded([]byte("other"), "node-a", "camera-1", now),
+		"wrong node":   signForwarded(secret, "node-c", "camera-1", now),
+		"wrong device": signForwarded(secret, "node-a", "camera-2", now),
+		"expired":      signForwarded(secret, "node-a", "camera-1", now.Add(-2*forwardedSignatureMaxAge)),
+		"malformed":    "not-a-signature",
+	} {
+		if cors.CheckOrigin(newForwarded(signature)) {
+			t.Fatalf("request with a %s signature was accepted", name)
+		}
+	}
+
+	// 未配置密钥时不信任任何签名
+	cors.SetClusterSecret("")
+	if cors.CheckOrigin(newForwarded(signForwarded(nil, "node-a", "camera-1", now))) {
+		t.Fatal("request was accepted without a cluster secret")
+	}
+}
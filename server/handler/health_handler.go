@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Drainer 可排空连接的组件
+type Drainer interface {
+	IsDraining() bool
+}
+
+// HealthHandler 健康检查处理器
+type HealthHandler struct {
+	drainer Drainer
+}
+
+// NewHealthHandler 创建健康检查处理器
+func NewHealthHandler(drainer Drainer) *HealthHandler {
+	return &HealthHandler{
+		drainer: drainer,
+	}
+}
+
+// Healthz 存活探针，进程能处理请求即返回成功
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz 就绪探针，排空连接期间返回503，负载均衡应停止转发新请求
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	if h.drainer.IsDraining() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/logger"
+	"monitor/model"
+	"monitor/service"
+)
+
+// LayoutHandler 布局接口处理器
+type LayoutHandler struct {
+	layoutService service.LayoutService
+	eventService  service.EventService
+}
+
+// NewLayoutHandler 创建布局接口处理器
+func NewLayoutHandler(layoutService service.LayoutService, eventService service.EventService) *LayoutHandler {
+	return &LayoutHandler{
+		layoutService: layoutService,
+		eventService:  eventService,
+	}
+}
+
+// layoutRequest 创建/更新布局请求
+type layoutRequest struct {
+	Name  string             `json:"name"`
+	Grid  model.LayoutGrid   `json:"grid"`
+	Cells []model.LayoutCell `json:"cells"`
+}
+
+// toLayout 转换为布局对象
+func (r *layoutRequest) toLayout() *model.Layout {
+	return &model.Layout{
+		Name:  r.Name,
+		Grid:  r.Grid,
+		Cells: r.Cells,
+	}
+}
+
+// ListLayouts 获取房间内所有布局
+func (h *LayoutHandler) ListLayouts(c *gin.Context) {
+	roomID := c.Param("roomId")
+	layouts, err := h.layoutService.GetLayouts(roomID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, layouts)
+}
+
+// GetLayout 获取房间内指定布局
+func (h *LayoutHandler) GetLayout(c *gin.Context) {
+	roomID := c.Param("roomId")
+	layoutID := c.Param("layoutId")
+	layout, err := h.layoutService.GetLayout(roomID, layoutID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, layout)
+}
+
+// CreateLayout 在房间中创建布局
+func (h *LayoutHandler) CreateLayout(c *gin.Context) {
+	roomID := c.Param("roomId")
+
+	var req layoutRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	layout, err := h.layoutService.CreateLayout(roomID, req.toLayout())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.broadcastLayoutChanged(roomID, model.LayoutActionCreated, layout)
+	c.JSON(http.StatusOK, layout)
+}
+
+// UpdateLayout 更新房间内指定布局
+func (h *LayoutHandler) UpdateLayout(c *gin.Context) {
+	roomID := c.Param("roomId")
+	layoutID := c.Param("layoutId")
+
+	var req layoutRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if _, err := h.layoutService.GetLayout(roomID, layoutID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	layout, err := h.layoutService.UpdateLayout(roomID, layoutID, req.toLayout())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.broadcastLayoutChanged(roomID, model.LayoutActionUpdated, layout)
+	c.JSON(http.StatusOK, layout)
+}
+
+// DeleteLayout 删除房间内指定布局
+func (h *LayoutHandler) DeleteLayout(c *gin.Context) {
+	roomID := c.Param("roomId")
+	layoutID := c.Param("layoutId")
+
+	layout, err := h.layoutService.DeleteLayout(roomID, layoutID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.broadcastLayoutChanged(roomID, model.LayoutActionDeleted, layout)
+	c.JSON(http.StatusOK, layout)
+}
+
+// broadcastLayoutChanged 向房间内所有设备广播布局变更事件
+func (h *LayoutHandler) broadcastLayoutChanged(roomID string, action model.LayoutAction, layout *model.Layout) {
+	payload := model.LayoutChangedPayload{
+		Action: action,
+		Layout: layout,
+	}
+	payloadJSON, _ := json.Marshal(payload)
+
+	event := model.Event{
+		Type:      model.EventTypeLayoutChanged,
+		RoomID:    roomID,
+		Timestamp: getCurrentTimestamp(),
+		Payload:   payloadJSON,
+	}
+
+	// 房间内暂无设备时广播会失败，布局已保存，新设备可通过接口获取
+	if err := h.eventService.BroadcastEvent(roomID, &event); err != nil {
+		slog.Debug("broadcast layout_changed failed",
+			logger.KeyRoomID, roomID, logger.KeyEventType, event.Type, logger.KeyError, err)
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"math"
+	"time"
+
+	"monitor/model"
+)
+
+// defaultRateKey 未单独配置的事件类型共用的令牌桶
+const defaultRateKey = "*"
+
+// RateLimit 令牌桶配置
+type RateLimit struct {
+	Rate  float64 // 每秒补充的令牌数
+	Burst int     // 令牌桶容量，即允许的突发数量
+}
+
+// MessageLimits 每个连接的入站消息限制
+type MessageLimits struct {
+	MaxMessageSize  int64                         // 单条消息的最大字节数，超过时以1009关闭连接，0表示不限制，修改后对新连接生效
+	MaxSDPLength    int                           // offer/answer/renegotiate/ice_restart中SDP的最大长度，0表示不限制
+	Rates           map[model.EventType]RateLimit // 按事件类型的令牌桶，key为*的配置用于其他事件类型，未配置时不限流
+	MaxViolations   int                           // ViolationWindow内违规达到该次数时以1008断开连接，0表示不断开
+	ViolationWindow time.Duration                 // 统计违规次数的时间窗口
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// take 取出一个令牌，令牌不足时返回需要等待的时间
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// connectionLimiter 单个连接的限流状态，只在连接的读循环中使用，不需要加锁
+type connectionLimiter struct {
+	limits     func() *MessageLimits // 获取当前的限制，配置重新加载后对已有连接立即生效
+	buckets    map[model.EventType]*tokenBucket
+	violations []time.Time // 时间窗口内的违规时间
+}
+
+// newConnectionLimiter 创建连接的限流状态
+func newConnectionLimiter(limits func() *MessageLimits) *connectionLimiter {
+	return &connectionLimiter{
+		limits:  limits,
+		buckets: make(map[model.EventType]*tokenBucket),
+	}
+}
+
+// allow 检查事件是否在限流范围内，超出时返回建议的重试等待时间
+func (l *connectionLimiter) allow(eventType model.EventType, now time.Time) (bool, time.Duration) {
+	// 未单独配置的事件类型共用一个令牌桶，避免客户端构造大量事件类型
+	limits := l.limits()
+	key := eventType
+	limit, exists := limits.Rates[key]
+	if !exists {
+		key = defaultRateKey
+		limit, exists = limits.Rates[key]
+	}
+	if !exists {
+		return true, 0
+	}
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	// 限流配置修改后沿用已有的令牌，超出新容量的部分在下次补充时被截断
+	bucket.limit = limit
+	return bucket.take(now)
+}
+
+// sdpTooLong 检查携带SDP的事件是否超过长度限制
+func (l *connectionLimiter) sdpTooLong(event *model.Event) bool {
+	maxLength := l.limits().MaxSDPLength
+	if maxLength <= 0 {
+		return false
+	}
+
+	switch event.Type {
+	case model.EventTypeOffer, model.EventTypeAnswer, model.EventTypeRenegotiate, model.EventTypeIceRestart:
+	default:
+		return false
+	}
+
+	var payload struct {
+		SDP string `json:"sdp"`
+	}
+	if err := event.ParsePayload(&payload); err != nil {
+		return false
+	}
+	return len(payload.SDP) > maxLength
+}
+
+// violate 记录一次违规，返回是否应断开连接
+func (l *connectionLimiter) violate(now time.Time) bool {
+	limits := l.limits()
+	if limits.MaxViolations <= 0 {
+		return false
+	}
+
+	// 移除时间窗口之外的记录
+	valid := l.violations[:0]
+	for _, t := range l.violations {
+		if now.Sub(t) < limits.ViolationWindow {
+			valid = append(valid, t)
+		}
+	}
+	l.violations = append(valid, now)
+
+	return len(l.violations) >= limits.MaxViolations
+}
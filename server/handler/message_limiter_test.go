@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"monitor/model"
+)
+
+func TestConnectionLimiterRates(t *testing.T) {
+	limits := &MessageLimits{Rates: map[model.EventType]RateLimit{
+		model.EventTypeIceCandidate: {Rate: 10, Burst: 2},
+		defaultRateKey:              {Rate: 1, Burst: 1},
+	}}
+	limiter := newConnectionLimiter(func() *MessageLimits { return limits })
+	now := time.Unix(0, 0)
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.allow(model.EventTypeIceCandidate, now); !allowed {
+			t.Fatalf("ice_candidate %d rejected within burst", i)
+		}
+	}
+	allowed, retryAfter := limiter.allow(model.EventTypeIceCandidate, now)
+	if allowed || retryAfter != 100*time.Millisecond {
+		t.Fatalf("third ice_candidate = %v, retry after %s, want rejected with 100ms", allowed, retryAfter)
+	}
+	// 令牌按速率补充
+	if allowed, _ := limiter.allow(model.EventTypeIceCandidate, now.Add(100*time.Millisecond)); !allowed {
+		t.Fatal("ice_candidate rejected after a token was refilled")
+	}
+
+	// 未单独配置的事件类型共用默认令牌桶
+	if allowed, _ := limiter.allow(model.EventTypeChatMessage, now); !allowed {
+		t.Fatal("chat_message rejected")
+	}
+	if allowed, _ := limiter.allow(model.EventTypeStatsReport, now); allowed {
+		t.Fatal("stats_report did not share the default bucket")
+	}
+
+	// 未配置限流时不限制
+	limits = &MessageLimits{}
+	if allowed, _ := limiter.allow(model.EventTypeStatsReport, now); !allowed {
+		t.Fatal("stats_report rejected after rates were removed")
+	}
+}
+
+func TestConnectionLimiterViolationWindow(t *testing.T) {
+	limits := &MessageLimits{MaxViolations: 3, ViolationWindow: time.Second}
+	limiter := newConnectionLimiter(func() *MessageLimits { return limits })
+	now := time.Unix(0, 0)
+
+	if limiter.violate(now) || limiter.violate(now.Add(500*time.Millisecond)) {
+		t.Fatal("disconnected before reaching MaxViolations")
+	}
+	// 第一次违规已移出时间窗口
+	if limiter.violate(now.Add(1200 * time.Millisecond)) {
+		t.Fatal("violation outside the window was counted")
+	}
+	if !limiter.violate(now.Add(1300 * time.Millisecond)) {
+		t.Fatal("not disconnected after MaxViolations within the window")
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/service"
+)
+
+// QualityHandler 连接质量接口处理器
+type QualityHandler struct {
+	roomService    service.RoomService
+	qualityService service.QualityService
+}
+
+// NewQualityHandler 创建连接质量接口处理器
+func NewQualityHandler(roomService service.RoomService, qualityService service.QualityService) *QualityHandler {
+	return &QualityHandler{
+		roomService:    roomService,
+		qualityService: qualityService,
+	}
+}
+
+// GetDeviceQuality 获取设备参与的所有连接的质量及最近的统计记录
+func (h *QualityHandler) GetDeviceQuality(c *gin.Context) {
+	roomID := c.Param("roomId")
+	deviceID := c.Param("deviceId")
+
+	if _, err := h.roomService.GetDeviceById(roomID, deviceID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.qualityService.GetDeviceQuality(roomID, deviceID))
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/model"
+	"monitor/service"
+)
+
+func TestGetDeviceQuality(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	rooms := service.NewRoomService()
+	if err := rooms.JoinRoom("room", &model.Device{ID: "camera-1", Type: model.DeviceTypeCamera}, nil); err != nil {
+		t.Fatalf("JoinRoom: %v", err)
+	}
+	quality := service.NewQualityService()
+	quality.Report("room", "camera-1", "monitor-1", &model.StatsReport{ReporterID: "camera-1", RTT: 50})
+	quality.Report("room", "camera-1", "monitor-1", &model.StatsReport{ReporterID: "monitor-1", RTT: 60})
+
+	r := gin.New()
+	r.GET("/api/rooms/:roomId/devices/:deviceId/quality", NewQualityHandler(rooms, quality).GetDeviceQuality)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/rooms/room/devices/camera-1/quality", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var pairs []*model.PairQuality
+	if err := json.Unmarshal(w.Body.Bytes(), &pairs); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	// 接口返回包含历史记录的连接质量
+	if len(pairs) != 1 || pairs[0].Level != model.QualityLevelGood || len(pairs[0].History) != 2 {
+		t.Fatalf("quality = %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/rooms/room/devices/camera-9/quality", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status for a missing device = %d, want 404", w.Code)
+	}
+}
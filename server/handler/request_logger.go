@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/logger"
+)
+
+// RequestLogger 使用slog记录HTTP请求日志
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		level := slog.LevelInfo
+		status := c.Writer.Status()
+		if status >= 500 {
+			level = slog.LevelError
+		} else if status >= 400 {
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("clientIp", c.ClientIP()),
+		}
+		if roomID := c.Param("roomId"); roomID != "" {
+			attrs = append(attrs, slog.String(logger.KeyRoomID, roomID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String(logger.KeyError, c.Errors.String()))
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "http request", attrs...)
+	}
+}
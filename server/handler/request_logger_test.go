@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestLoggerLevels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var out bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&out, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	r := gin.New()
+	r.Use(RequestLogger())
+	r.GET("/api/rooms/:roomId", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/missing", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	r.GET("/broken", func(c *gin.Context) {
+		c.AbortWithError(http.StatusInternalServerError, http.ErrAbortHandler)
+	})
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/api/rooms/123", []string{"level=INFO", "status=200", "roomId=123", "path=/api/rooms/123"}},
+		{"/missing", []string{"level=WARN", "status=404"}},
+		{"/broken", []string{"level=ERROR", "status=500", "error="}},
+	}
+	for _, test := range tests {
+		out.Reset()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil))
+		for _, want := range test.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s logged %q, want %s", test.path, out.String(), want)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/service"
+)
+
+// StatusHistoryHandler 设备状态历史接口处理器
+type StatusHistoryHandler struct {
+	historyService service.StatusHistoryService
+}
+
+// NewStatusHistoryHandler 创建设备状态历史接口处理器
+func NewStatusHistoryHandler(historyService service.StatusHistoryService) *StatusHistoryHandler {
+	return &StatusHistoryHandler{
+		historyService: historyService,
+	}
+}
+
+// GetDeviceHistory 获取设备的状态时间线及各状态累计时长
+// 查询参数：from、to（毫秒时间戳或RFC3339），设备离开房间后仍可查询
+func (h *StatusHistoryHandler) GetDeviceHistory(c *gin.Context) {
+	from, err := parseTimeQuery(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeQuery(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if from > 0 && to > 0 && from > to {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开始时间不能晚于结束时间"})
+		return
+	}
+
+	history, err := h.historyService.GetHistory(c.Param("roomId"), c.Param("deviceId"), from, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
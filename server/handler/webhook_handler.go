@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"monitor/model"
+	"monitor/service"
+)
+
+// WebhookHandler 事件回调订阅接口处理器
+type WebhookHandler struct {
+	webhookService service.WebhookService
+}
+
+// NewWebhookHandler 创建事件回调订阅接口处理器
+func NewWebhookHandler(webhookService service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// webhookRequest 创建/更新回调订阅请求
+type webhookRequest struct {
+	URL     string            `json:"url"`
+	Events  []model.EventType `json:"events"`
+	RoomIDs []string          `json:"roomIds"`
+	Secret  string            `json:"secret"`
+}
+
+// toWebhook 转换为回调订阅对象
+func (r *webhookRequest) toWebhook() *model.Webhook {
+	return &model.Webhook{
+		URL:     r.URL,
+		Events:  r.Events,
+		RoomIDs: r.RoomIDs,
+		Secret:  r.Secret,
+	}
+}
+
+// ListWebhooks 获取所有回调订阅
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	c.JSON(http.StatusOK, h.webhookService.GetWebhooks())
+}
+
+// GetWebhook 获取指定回调订阅
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhook, err := h.webhookService.GetWebhook(c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// CreateWebhook 创建回调订阅
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(req.toWebhook())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook 更新指定回调订阅，secret为空时保留原密钥
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	webhookID := c.Param("webhookId")
+
+	var req webhookRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if _, err := h.webhookService.GetWebhook(webhookID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, err := h.webhookService.UpdateWebhook(webhookID, req.toWebhook())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook 删除指定回调订阅
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	webhook, err := h.webhookService.DeleteWebhook(c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// ListDeliveries 获取订阅最近的投递记录
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	deliveries, err := h.webhookService.GetDeliveries(c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
@@ -2,22 +2,44 @@ package handler
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
+	"monitor/logger"
+	"monitor/metrics"
 	"monitor/model"
 	"monitor/service"
+	"monitor/tracing"
 )
 
 // WebSocketHandler WebSocket处理器
 type WebSocketHandler struct {
-	roomService  service.RoomService
-	eventService service.EventService
-	upgrader     websocket.Upgrader
+	roomService    service.RoomService
+	eventService   service.EventService
+	auditService   service.AuditService
+	handoffService service.HandoffService
+	upgrader       websocket.Upgrader
+	tracker        *connectionTracker // 升级前检查的连接数限制
+
+	settingsMutex sync.RWMutex      // 保护可在运行时修改的配置
+	limits        *MessageLimits    // 每个连接的入站消息限制
+	iceServers    []model.ICEServer // connect事件中下发给设备的ICE服务器
+
+	drainMutex  sync.Mutex     // 保护draining和handingOff，保证排空开始后不再新增连接
+	draining    bool           // 是否正在排空连接
+	handingOff  bool           // 是否正在交接给新进程，此时断开的设备保留在房间中
+	connections sync.WaitGroup // 活跃的WebSocket连接
 }
 
 // getCurrentTimestamp 获取当前时间戳（毫秒）
@@ -26,47 +48,129 @@ func getCurrentTimestamp() int64 {
 }
 
 // NewWebSocketHandler 创建WebSocket处理器
-func NewWebSocketHandler(roomService service.RoomService, eventService service.EventService) *WebSocketHandler {
+func NewWebSocketHandler(roomService service.RoomService, eventService service.EventService, auditService service.AuditService,
+	handoffService service.HandoffService, origins *CORS, limits MessageLimits, connectionLimits ConnectionLimits) *WebSocketHandler {
 	return &WebSocketHandler{
-		roomService:  roomService,
-		eventService: eventService,
+		roomService:    roomService,
+		eventService:   eventService,
+		auditService:   auditService,
+		handoffService: handoffService,
+		tracker:        newConnectionTracker(connectionLimits),
+		limits:         &limits,
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // 允许所有跨域请求
-			},
+			// 客户端通过Sec-WebSocket-Protocol选择事件编码，未指定时使用JSON
+			Subprotocols: model.Subprotocols,
+			// 与跨域配置使用相同的允许来源
+			CheckOrigin: origins.CheckOrigin,
 		},
 	}
 }
 
-// HandleWebSocket 处理WebSocket连接
-func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
+// wsAdmissionKey gin上下文中保存连接准入信息的key
+const wsAdmissionKey = "monitor.wsAdmission"
+
+// wsAdmission 通过参数检查并预留了连接名额的WebSocket请求
+type wsAdmission struct {
+	deviceID   string
+	deviceType string
+	clientIP   string
+	accepted   bool // 连接已建立，名额在连接结束后释放
+}
+
+// AdmitWebSocket WebSocket连接的准入中间件：检查参数、排空状态和连接数限制并预留名额。
+// 需要在集群路由和HandleWebSocket之前执行，代理到其他节点的连接同样占用本节点的名额，
+// 请求结束时连接未在本节点建立则释放名额
+func (h *WebSocketHandler) AdmitWebSocket(c *gin.Context) {
 	roomID := c.Param("roomId")
 	deviceID := c.Query("deviceId")
 	deviceType := c.Query("deviceType")
 
 	// 参数检查
 	if roomID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "房间ID不能为空"})
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "房间ID不能为空"})
+		return
+	}
+
+	if !model.ValidRoomID(roomID) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
 		return
 	}
 
 	if deviceID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "设备ID不能为空"})
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "设备ID不能为空"})
 		return
 	}
 
 	if deviceType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "设备类型不能为空"})
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "设备类型不能为空"})
 		return
 	}
 
+	// 服务排空期间拒绝新连接
+	if h.IsDraining() {
+		c.Header("Retry-After", "5")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "服务正在关闭"})
+		return
+	}
+
+	// 升级前检查连接数限制，来源IP按可信代理配置从X-Forwarded-For中获取
+	clientIP := c.ClientIP()
+	_, roomErr := h.roomService.GetRoom(roomID)
+	if reason := h.tracker.acquire(clientIP, roomID, roomErr == nil); reason != "" {
+		metrics.ConnectionRejections.WithLabelValues(reason).Inc()
+		slog.Warn("websocket connection rejected by limits",
+			logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, "clientIp", clientIP, "reason", reason)
+		c.Header("Retry-After", "10")
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": connectionRejectMessages[reason]})
+		return
+	}
+
+	admission := &wsAdmission{
+		deviceID:   deviceID,
+		deviceType: deviceType,
+		clientIP:   clientIP,
+	}
+	c.Set(wsAdmissionKey, admission)
+	c.Next()
+
+	if !admission.accepted {
+		h.tracker.release(clientIP, roomID)
+	}
+}
+
+// HandleWebSocket 处理WebSocket连接，需要在AdmitWebSocket之后执行
+func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
+	roomID := c.Param("roomId")
+	admission := c.MustGet(wsAdmissionKey).(*wsAdmission)
+	deviceID := admission.deviceID
+	deviceType := admission.deviceType
+	clientIP := admission.clientIP
+
+	// 连接建立的链路，客户端可通过traceparent请求头关联到自己的链路
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	ctx, span := tracing.Tracer().Start(ctx, "websocket.upgrade",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			tracing.AttrRoomID.String(roomID),
+			tracing.AttrDeviceID.String(deviceID),
+			tracing.AttrDeviceType.String(deviceType),
+		))
+	defer span.End()
+
 	// 升级HTTP连接为WebSocket连接
 	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		metrics.WebSocketUpgrades.WithLabelValues("failed").Inc()
+		slog.Warn("websocket upgrade failed",
+			logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, logger.KeyError, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade to websocket"})
 		return
 	}
 
+	metrics.WebSocketUpgrades.WithLabelValues("ok").Inc()
+
 	// 创建设备对象
 	device := &model.Device{
 		ID:         deviceID,
@@ -77,32 +181,346 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 		UpdateTime: 0, // 将在服务层设置
 	}
 
+	// 携带恢复凭证时优先恢复交接前的设备状态，没有等待恢复的设备时按普通加入处理
+	resumed := false
+	if resumeToken := c.Query("resumeToken"); resumeToken != "" {
+		if restored, err := h.handoffService.ResumeDevice(roomID, deviceID, resumeToken, conn); err == nil {
+			device = restored
+			resumed = true
+		} else {
+			slog.Debug("resume device skipped", logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, logger.KeyError, err)
+		}
+	}
+
 	// 加入房间
-	err = h.roomService.JoinRoom(roomID, device, conn)
+	if !resumed {
+		_, joinSpan := tracing.Tracer().Start(ctx, "RoomService.JoinRoom")
+		err = h.roomService.JoinRoom(roomID, device, conn)
+		if err != nil {
+			joinSpan.RecordError(err)
+			joinSpan.SetStatus(codes.Error, err.Error())
+		}
+		joinSpan.End()
+	}
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.Warn("join room rejected",
+			logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, "deviceType", deviceType, logger.KeyError, err)
 		conn.Close()
 		return
 	}
 
-	// 处理WebSocket消息
-	go h.handleMessages(conn, roomID, deviceID)
+	// 升级期间可能已开始排空
+	h.drainMutex.Lock()
+	if h.draining {
+		h.drainMutex.Unlock()
+		h.roomService.LeaveRoom(roomID, deviceID, conn)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server shutting down"), time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+	h.connections.Add(1)
+	h.drainMutex.Unlock()
+
+	slog.Info("device joined room",
+		logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, "deviceType", deviceType,
+		"encoding", model.EncodingForSubprotocol(conn.Subprotocol()), "resumed", resumed)
+
+	// 处理WebSocket消息，名额在连接结束后释放
+	admission.accepted = true
+	go h.handleMessages(conn, roomID, deviceID, clientIP, resumed, tracing.Inject(ctx))
+}
+
+// SetLimits 修改连接数和入站消息限制，限流和违规次数对已有连接立即生效，单条消息大小限制对新连接生效
+func (h *WebSocketHandler) SetLimits(limits MessageLimits, connectionLimits ConnectionLimits) {
+	h.tracker.setLimits(connectionLimits)
+
+	h.settingsMutex.Lock()
+	defer h.settingsMutex.Unlock()
+	h.limits = &limits
+}
+
+// SetICEServers 修改connect事件中下发的ICE服务器，对之后加入的设备生效
+func (h *WebSocketHandler) SetICEServers(iceServers []model.ICEServer) {
+	h.settingsMutex.Lock()
+	defer h.settingsMutex.Unlock()
+	h.iceServers = iceServers
+}
+
+// messageLimits 获取当前的入站消息限制，返回的值不会被修改
+func (h *WebSocketHandler) messageLimits() *MessageLimits {
+	h.settingsMutex.RLock()
+	defer h.settingsMutex.RUnlock()
+	return h.limits
+}
+
+// currentICEServers 获取当前的ICE服务器
+func (h *WebSocketHandler) currentICEServers() []model.ICEServer {
+	h.settingsMutex.RLock()
+	defer h.settingsMutex.RUnlock()
+	return h.iceServers
+}
+
+// checkLimits 检查事件是否超出连接的入站限制，返回错误码和建议的重试等待时间，未超出时错误码为空
+func (h *WebSocketHandler) checkLimits(limiter *connectionLimiter, event *model.Event) (string, time.Duration) {
+	if allowed, retryAfter := limiter.allow(event.Type, time.Now()); !allowed {
+		return model.ErrorCodeRateLimited, retryAfter
+	}
+	if limiter.sdpTooLong(event) {
+		return model.ErrorCodeMessageTooLarge, 0
+	}
+	return "", 0
+}
+
+// rejectEvent 通知设备事件因超出限制被丢弃
+func (h *WebSocketHandler) rejectEvent(roomID string, deviceID string, event *model.Event, code string, retryAfter time.Duration) {
+	metrics.MessageLimitViolations.WithLabelValues(code).Inc()
+	slog.Debug("event rejected by limits",
+		logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, logger.KeyEventType, event.Type, "code", code)
+
+	message := "事件发送过于频繁"
+	if code == model.ErrorCodeMessageTooLarge {
+		message = "SDP超过长度限制"
+	}
+	payloadJSON, _ := json.Marshal(model.ErrorPayload{
+		Error:      message,
+		Code:       code,
+		EventType:  event.Type,
+		RetryAfter: retryAfter.Milliseconds(),
+	})
+
+	h.eventService.SendEventToDevice(roomID, deviceID, &model.Event{
+		Type:      model.EventTypeError,
+		RoomID:    roomID,
+		DeviceID:  deviceID,
+		Timestamp: getCurrentTimestamp(),
+		Payload:   payloadJSON,
+		Trace:     event.Trace,
+	})
+}
+
+// closeForViolations 以1008关闭多次超出入站限制的连接
+func (h *WebSocketHandler) closeForViolations(conn *websocket.Conn, roomID string, deviceID string) {
+	metrics.LimitDisconnects.Inc()
+	limits := h.messageLimits()
+	slog.Warn("connection closed for repeated limit violations",
+		logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID,
+		"violations", limits.MaxViolations, "window", limits.ViolationWindow)
+
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too many limit violations"), time.Now().Add(time.Second))
+}
+
+// IsDraining 是否正在排空连接
+func (h *WebSocketHandler) IsDraining() bool {
+	h.drainMutex.Lock()
+	defer h.drainMutex.Unlock()
+	return h.draining
+}
+
+// Drain 停止接受新连接，通知所有设备服务即将关闭，并等待连接在timeout内断开；
+// 每个设备的建议重连延迟在[0, reconnectSpread)内随机，避免重启后同时重连。
+// 超时后仍未断开的连接被强制关闭
+func (h *WebSocketHandler) Drain(timeout time.Duration, reconnectSpread time.Duration) {
+	h.drainMutex.Lock()
+	h.draining = true
+	h.drainMutex.Unlock()
+
+	notified := h.notifyShutdown(reconnectSpread, false)
+	slog.Info("draining connections", "devices", notified, "timeout", timeout)
+
+	done := h.connectionsDone()
+	select {
+	case <-done:
+		slog.Info("all connections drained")
+		return
+	case <-time.After(timeout):
+	}
+
+	// 强制关闭剩余连接，读循环退出后会完成离开房间的清理
+	remaining := h.closeConnections("server shutting down")
+	slog.Warn("drain timeout, closed remaining connections", "devices", remaining)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// Handoff 停止接受新连接，通知所有设备服务正在交接并关闭连接。
+// 与Drain不同，断开的设备保留在房间中，由新进程通过快照恢复，设备携带恢复凭证重连后继续使用原来的状态
+func (h *WebSocketHandler) Handoff(reconnectSpread time.Duration) {
+	h.drainMutex.Lock()
+	h.draining = true
+	h.handingOff = true
+	h.drainMutex.Unlock()
+
+	notified := h.notifyShutdown(reconnectSpread, true)
+	closed := h.closeConnections("server restarting")
+	slog.Info("handing off connections", "devices", notified, "closed", closed)
+
+	select {
+	case <-h.connectionsDone():
+	case <-time.After(5 * time.Second):
+		slog.Warn("handoff timeout waiting for connections to close")
+	}
+}
+
+// RestoreState 恢复上一个进程交接的房间和设备，window内没有重连的设备视为离开房间
+func (h *WebSocketHandler) RestoreState(state *model.HandoffState, window time.Duration) error {
+	rooms, devices, err := h.handoffService.Restore(state)
+	if err != nil {
+		return err
+	}
+	slog.Info("handoff state restored", "rooms", rooms, "devices", devices, "resumeWindow", window)
+
+	time.AfterFunc(window, h.expirePendingDevices)
+	return nil
+}
+
+// expirePendingDevices 移除交接后未在恢复窗口内重连的设备，并通知房间内的其他设备
+func (h *WebSocketHandler) expirePendingDevices() {
+	expired := h.handoffService.RemovePendingDevices()
+	count := 0
+	for roomID, devices := range expired {
+		for _, device := range devices {
+			h.eventService.HandleDeviceLeave(roomID, device.ID)
+			h.eventService.BroadcastEvent(roomID, &model.Event{
+				Type:      model.EventTypeLeaveRoom,
+				RoomID:    roomID,
+				DeviceID:  device.ID,
+				Timestamp: getCurrentTimestamp(),
+				Payload:   json.RawMessage("{}"),
+			})
+			count++
+		}
+	}
+	if count > 0 {
+		slog.Info("removed devices not resumed after handoff", "devices", count)
+	}
+}
+
+// isHandingOff 是否正在交接给新进程
+func (h *WebSocketHandler) isHandingOff() bool {
+	h.drainMutex.Lock()
+	defer h.drainMutex.Unlock()
+	return h.handingOff
+}
+
+// notifyShutdown 向连接在本节点的设备发送server_shutdown事件，返回通知的设备数
+func (h *WebSocketHandler) notifyShutdown(reconnectSpread time.Duration, handoff bool) int {
+	rooms, _ := h.roomService.GetRooms()
+	notified := 0
+	for _, room := range rooms {
+		devices, err := h.roomService.GetDevicesInRoom(room.ID)
+		if err != nil {
+			continue
+		}
+
+		for _, device := range devices {
+			// 集群部署时只通知连接在本节点的设备
+			if _, err := h.roomService.GetDeviceConnection(room.ID, device.ID); err != nil {
+				continue
+			}
+
+			var delay time.Duration
+			if reconnectSpread > 0 {
+				delay = time.Duration(rand.Int63n(int64(reconnectSpread)))
+			}
+			payload := model.ServerShutdownPayload{
+				ReconnectDelay: delay.Milliseconds(),
+				Handoff:        handoff,
+			}
+			if handoff {
+				payload.ResumeToken = h.handoffService.ResumeToken(room.ID, device.ID)
+			}
+			payloadJSON, _ := json.Marshal(payload)
+
+			event := &model.Event{
+				Type:      model.EventTypeServerShutdown,
+				RoomID:    room.ID,
+				DeviceID:  device.ID,
+				Timestamp: getCurrentTimestamp(),
+				Payload:   payloadJSON,
+			}
+			if err := h.eventService.SendEventToDevice(room.ID, device.ID, event); err != nil {
+				slog.Warn("send server_shutdown failed",
+					logger.KeyRoomID, room.ID, logger.KeyDeviceID, device.ID, logger.KeyError, err)
+				continue
+			}
+			notified++
+		}
+	}
+	return notified
+}
+
+// closeConnections 以1012关闭连接在本节点的所有设备，返回关闭的连接数
+func (h *WebSocketHandler) closeConnections(reason string) int {
+	closed := 0
+	rooms, _ := h.roomService.GetRooms()
+	for _, room := range rooms {
+		devices, err := h.roomService.GetDevicesInRoom(room.ID)
+		if err != nil {
+			continue
+		}
+		for _, device := range devices {
+			conn, err := h.roomService.GetDeviceConnection(room.ID, device.ID)
+			if err != nil {
+				continue
+			}
+			conn.GetConn().WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseServiceRestart, reason), time.Now().Add(time.Second))
+			conn.GetConn().Close()
+			closed++
+		}
+	}
+	return closed
+}
+
+// connectionsDone 返回所有连接的读循环退出后关闭的通道
+func (h *WebSocketHandler) connectionsDone() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		h.connections.Wait()
+		close(done)
+	}()
+	return done
 }
 
-// handleMessages 处理WebSocket消息
-func (h *WebSocketHandler) handleMessages(conn *websocket.Conn, roomID string, deviceID string) {
+// handleMessages 处理WebSocket消息，joinTrace为连接建立的链路，加入房间的广播沿用该链路
+func (h *WebSocketHandler) handleMessages(conn *websocket.Conn, roomID string, deviceID string, clientIP string, resumed bool, joinTrace map[string]string) {
 	defer func() {
+		defer h.connections.Done()
 		conn.Close()
-		h.roomService.LeaveRoom(roomID, deviceID)
+		h.tracker.release(clientIP, roomID)
+		// 交接时设备保留在房间中，由新进程恢复，不通知其他设备离开
+		if h.isHandingOff() {
+			slog.Info("device disconnected for handoff", logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID)
+			return
+		}
+		// 同ID的设备已重新加入时，设备仍在房间中，不清理其状态
+		if err := h.roomService.LeaveRoom(roomID, deviceID, conn); errors.Is(err, model.ErrDeviceReplaced) {
+			slog.Info("device connection replaced", logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID)
+			return
+		}
+		h.eventService.HandleDeviceLeave(roomID, deviceID)
+		slog.Info("device left room", logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID)
 	}()
 
 	// 发送连接成功事件
 	device, err := h.roomService.GetDeviceById(roomID, deviceID)
 	if err == nil {
 		devices, _ := h.roomService.GetDevicesInRoom(roomID)
+		messages, _ := h.roomService.GetChatMessages(roomID, deviceID)
 
 		payload := model.ConnectPayload{
-			Device:  device,
-			Devices: devices,
+			Device:     device,
+			Devices:    devices,
+			Messages:   messages,
+			ICEServers: h.currentICEServers(),
+			Resumed:    resumed,
 		}
 		payloadJSON, _ := json.Marshal(payload)
 
@@ -114,39 +532,64 @@ func (h *WebSocketHandler) handleMessages(conn *websocket.Conn, roomID string, d
 			Payload:   payloadJSON,
 		}
 
-		eventJSON, _ := json.Marshal(connectEvent)
-		conn.WriteMessage(websocket.TextMessage, eventJSON)
-
-		// 广播设备加入房间事件
-		joinPayload := model.JoinRoomPayload{
-			Device: device,
+		if safeConn, err := h.roomService.GetDeviceConnection(roomID, deviceID); err == nil {
+			if err := safeConn.WriteEvent(&connectEvent); err == nil {
+				h.auditService.Record(model.AuditDirectionOutbound, deviceID, &connectEvent)
+			}
 		}
-		joinPayloadJSON, _ := json.Marshal(joinPayload)
 
-		joinRoomEvent := model.Event{
-			Type:      model.EventTypeJoinRoom,
-			RoomID:    roomID,
-			DeviceID:  deviceID,
-			Timestamp: getCurrentTimestamp(),
-			Payload:   joinPayloadJSON,
+		// 广播设备加入房间事件，恢复的设备在其他设备看来从未离开，不需要广播
+		if !resumed {
+			joinPayload := model.JoinRoomPayload{
+				Device: device,
+			}
+			joinPayloadJSON, _ := json.Marshal(joinPayload)
+
+			joinRoomEvent := model.Event{
+				Type:      model.EventTypeJoinRoom,
+				RoomID:    roomID,
+				DeviceID:  deviceID,
+				Timestamp: getCurrentTimestamp(),
+				Payload:   joinPayloadJSON,
+				Trace:     joinTrace,
+			}
+
+			h.eventService.BroadcastEvent(roomID, &joinRoomEvent)
 		}
+	}
 
-		h.eventService.BroadcastEvent(roomID, &joinRoomEvent)
+	// 超过大小限制的消息由websocket库以1009关闭连接
+	maxMessageSize := h.messageLimits().MaxMessageSize
+	if maxMessageSize > 0 {
+		conn.SetReadLimit(maxMessageSize)
 	}
+	limiter := newConnectionLimiter(h.messageLimits)
 
 	for {
 		// 读取消息
-		_, message, err := conn.ReadMessage()
+		messageType, message, err := conn.ReadMessage()
 		if err != nil {
-			log.Printf("读取消息错误: %v", err)
+			if errors.Is(err, websocket.ErrReadLimit) {
+				metrics.MessageLimitViolations.WithLabelValues("frame_too_large").Inc()
+				slog.Warn("message exceeds size limit, connection closed",
+					logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, "limit", maxMessageSize)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Warn("read message failed",
+					logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, logger.KeyError, err)
+			} else {
+				slog.Debug("connection closed",
+					logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, logger.KeyError, err)
+			}
 			break
 		}
 
-		// 解析事件
-		var event model.Event
-		err = json.Unmarshal(message, &event)
+		// 解析事件，文本帧为JSON，二进制帧为MessagePack
+		event, err := model.DecodeEvent(messageType, message)
 		if err != nil {
-			log.Printf("解析事件错误: %v", err)
+			slog.Warn("parse event failed",
+				logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, logger.KeyError, err)
+			metrics.ParseErrors.Inc()
+			h.auditService.RecordInvalid(roomID, deviceID, messageType == websocket.BinaryMessage, message, err)
 			errorPayload := model.ErrorPayload{
 				Error: "无效的事件格式",
 			}
@@ -160,8 +603,21 @@ func (h *WebSocketHandler) handleMessages(conn *websocket.Conn, roomID string, d
 				Payload:   errorPayloadJSON,
 			}
 
-			eventJSON, _ := json.Marshal(errorEvent)
-			conn.WriteMessage(websocket.TextMessage, eventJSON)
+			h.eventService.SendEventToDevice(roomID, deviceID, &errorEvent)
+			if limiter.violate(time.Now()) {
+				h.closeForViolations(conn, roomID, deviceID)
+				break
+			}
+			continue
+		}
+
+		// 超出限流或长度限制的事件直接丢弃，多次违规后断开连接
+		if code, retryAfter := h.checkLimits(limiter, event); code != "" {
+			h.rejectEvent(roomID, deviceID, event, code, retryAfter)
+			if limiter.violate(time.Now()) {
+				h.closeForViolations(conn, roomID, deviceID)
+				break
+			}
 			continue
 		}
 
@@ -169,17 +625,29 @@ func (h *WebSocketHandler) handleMessages(conn *websocket.Conn, roomID string, d
 		event.RoomID = roomID
 		event.DeviceID = deviceID
 		event.Timestamp = getCurrentTimestamp()
+		event.Trace = tracing.Sanitize(event.Trace)
+		h.auditService.Record(model.AuditDirectionInbound, deviceID, event)
 
 		// 处理事件
-		err = h.eventService.ProcessEvent(&event)
+		err = h.eventService.ProcessEvent(event)
 		if err != nil {
-			log.Printf("处理事件错误: %v", err)
+			slog.Warn("process event failed",
+				logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID,
+				logger.KeyEventType, event.Type, logger.KeyError, err)
 			errorEvent := model.NewErrorEvent(event.RoomID, event.DeviceID, err)
-			eventJSON, _ := json.Marshal(errorEvent)
-			conn.WriteMessage(websocket.TextMessage, eventJSON)
+			errorEvent.Trace = event.Trace
+			h.eventService.SendEventToDevice(roomID, deviceID, errorEvent)
 		}
 	}
 
+	if h.isHandingOff() {
+		return
+	}
+	// 同ID的设备已重新加入时不广播离开
+	if current, err := h.roomService.GetDeviceConnection(roomID, deviceID); err == nil && current.GetConn() != conn {
+		return
+	}
+
 	// 广播设备离开房间事件
 	leaveRoomEvent := model.Event{
 		Type:      model.EventTypeLeaveRoom,
@@ -0,0 +1,358 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"monitor/model"
+	"monitor/service"
+)
+
+// newWebSocketTestServer 创建注册了WebSocket和就绪探针路由的服务
+func newWebSocketTestServer(t *testing.T, limits MessageLimits, connectionLimits ConnectionLimits) (*httptest.Server, *WebSocketHandler) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	auditService, _ := service.NewAuditService(service.AuditConfig{})
+	webhookService, err := service.NewWebhookService(service.WebhookConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewWebhookService: %v", err)
+	}
+	t.Cleanup(webhookService.Close)
+
+	roomService := service.NewRoomService()
+	eventService := service.NewEventService(roomService, service.NewActivityService(), auditService,
+		service.NewQualityService(), service.NewStatusHistoryService(), webhookService)
+	handoffService, err := service.NewHandoffService(roomService, time.Minute)
+	if err != nil {
+		t.Fatalf("NewHandoffService: %v", err)
+	}
+	webSocketHandler := NewWebSocketHandler(roomService, eventService, auditService, handoffService,
+		NewCORS(nil, true), limits, connectionLimits)
+
+	r := gin.New()
+	r.GET("/ws/:roomId", webSocketHandler.AdmitWebSocket, webSocketHandler.HandleWebSocket)
+	r.GET("/readyz", NewHealthHandler(webSocketHandler).Readyz)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server, webSocketHandler
+}
+
+// dialDevice 以指定设备身份连接房间，subprotocols为客户端请求的子协议
+func dialDevice(server *httptest.Server, roomID string, deviceID string, deviceType model.DeviceType, subprotocols ...string) (*websocket.Conn, *http.Response, error) {
+	query := url.Values{"deviceId": {deviceID}, "deviceType": {string(deviceType)}}
+	target := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/" + roomID + "?" + query.Encode()
+
+	dialer := websocket.Dialer{Subprotocols: subprotocols}
+	return dialer.Dial(target, nil)
+}
+
+// mustDialDevice 连接房间并等待connect事件，连接失败时测试失败
+func mustDialDevice(t *testing.T, server *httptest.Server, roomID string, deviceID string, deviceType model.DeviceType) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := dialDevice(server, roomID, deviceID, deviceType)
+	if err != nil {
+		t.Fatalf("dial %s: %v", deviceID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	readDeviceEvent(t, conn, model.EventTypeConnect)
+	return conn
+}
+
+// readDeviceEvent 从JSON编码的连接读取下一个指定类型的事件
+func readDeviceEvent(t *testing.T, conn *websocket.Conn, eventType model.EventType) *model.Event {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read %s: %v", eventType, err)
+		}
+		var event model.Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatalf("parse event: %v", err)
+		}
+		if event.Type == eventType {
+			return &event
+		}
+	}
+}
+
+// readCloseCode 读取直到连接被关闭，返回关闭码
+func readCloseCode(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("connection ended without a close frame: %v", err)
+		}
+		return closeErr.Code
+	}
+}
+
+func TestDrainNotifiesDevicesAndRejectsNewConnections(t *testing.T) {
+	server, webSocketHandler := newWebSocketTestServer(t, MessageLimits{}, ConnectionLimits{})
+	camera := mustDialDevice(t, server, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := mustDialDevice(t, server, "room", "monitor-1", model.DeviceTypeMonitor)
+
+	const reconnectSpread = 100 * time.Millisecond
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		webSocketHandler.Drain(5*time.Second, reconnectSpread)
+	}()
+
+	for _, conn := range []*websocket.Conn{camera, monitor} {
+		var payload model.ServerShutdownPayload
+		if err := readDeviceEvent(t, conn, model.EventTypeServerShutdown).ParsePayload(&payload); err != nil {
+			t.Fatalf("parse server_shutdown: %v", err)
+		}
+		if payload.ReconnectDelay < 0 || payload.ReconnectDelay >= reconnectSpread.Milliseconds() || payload.Handoff {
+			t.Fatalf("server_shutdown payload = %+v", payload)
+		}
+	}
+
+	// 排空期间就绪探针返回503，新连接在升级前被拒绝
+	response, err := http.Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("GET /readyz: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz status = %d, want 503", response.StatusCode)
+	}
+	if _, response, err := dialDevice(server, "room", "camera-2", model.DeviceTypeCamera); err == nil || response == nil ||
+		response.StatusCode != http.StatusServiceUnavailable || response.Header.Get("Retry-After") == "" {
+		t.Fatalf("dial while draining returned %v", err)
+	}
+
+	// 所有设备断开后排空立即结束，不等待超时
+	camera.Close()
+	monitor.Close()
+	select {
+	case <-drained:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Drain did not return after all devices disconnected")
+	}
+}
+
+func TestDrainClosesRemainingConnectionsAfterTimeout(t *testing.T) {
+	server, webSocketHandler := newWebSocketTestServer(t, MessageLimits{}, ConnectionLimits{})
+	camera := mustDialDevice(t, server, "room", "camera-1", model.DeviceTypeCamera)
+
+	response, err := http.Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("GET /readyz: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("/readyz status before draining = %d, want 200", response.StatusCode)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		webSocketHandler.Drain(100*time.Millisecond, 0)
+	}()
+
+	if code := readCloseCode(t, camera); code != websocket.CloseServiceRestart {
+		t.Fatalf("close code = %d, want %d", code, websocket.CloseServiceRestart)
+	}
+	select {
+	case <-drained:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Drain did not return after closing the remaining connections")
+	}
+}
+
+// readEncodedEvent 读取下一个指定类型的事件，按帧类型解码，返回事件和帧类型
+func readEncodedEvent(t *testing.T, conn *websocket.Conn, eventType model.EventType) (*model.Event, int) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read %s: %v", eventType, err)
+		}
+		event, err := model.DecodeEvent(messageType, data)
+		if err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		if event.Type == eventType {
+			return event, messageType
+		}
+	}
+}
+
+// writeEncodedEvent 按编码方式发送事件
+func writeEncodedEvent(t *testing.T, conn *websocket.Conn, encoding model.Encoding, event *model.Event) {
+	t.Helper()
+
+	messageType, data, err := model.EncodeEvent(encoding, event)
+	if err != nil {
+		t.Fatalf("encode %s: %v", event.Type, err)
+	}
+	if err := conn.WriteMessage(messageType, data); err != nil {
+		t.Fatalf("write %s: %v", event.Type, err)
+	}
+}
+
+func TestMsgpackAndJSONDevicesShareRoom(t *testing.T) {
+	server, _ := newWebSocketTestServer(t, MessageLimits{}, ConnectionLimits{})
+
+	camera, _, err := dialDevice(server, "room", "camera-1", model.DeviceTypeCamera, model.SubprotocolMsgpack, model.SubprotocolJSON)
+	if err != nil {
+		t.Fatalf("dial camera: %v", err)
+	}
+	defer camera.Close()
+	if camera.Subprotocol() != model.SubprotocolMsgpack {
+		t.Fatalf("negotiated subprotocol = %q, want %s", camera.Subprotocol(), model.SubprotocolMsgpack)
+	}
+	if _, messageType := readEncodedEvent(t, camera, model.EventTypeConnect); messageType != websocket.BinaryMessage {
+		t.Fatalf("connect frame type = %d, want binary", messageType)
+	}
+
+	// 未请求子协议的客户端继续使用JSON文本帧
+	monitor := mustDialDevice(t, server, "room", "monitor-1", model.DeviceTypeMonitor)
+	if monitor.Subprotocol() != "" {
+		t.Fatalf("monitor subprotocol = %q, want none", monitor.Subprotocol())
+	}
+
+	offer, _ := json.Marshal(&model.WebRTCOfferPayload{TargetDeviceID: "monitor-1", SDP: "v=0"})
+	writeEncodedEvent(t, camera, model.EncodingMsgpack, &model.Event{
+		Type: model.EventTypeOffer, RoomID: "room", DeviceID: "camera-1", Payload: offer,
+	})
+	var offerPayload model.WebRTCOfferPayload
+	if err := readDeviceEvent(t, monitor, model.EventTypeOffer).ParsePayload(&offerPayload); err != nil || offerPayload.SDP != "v=0" {
+		t.Fatalf("monitor received offer %+v, %v", offerPayload, err)
+	}
+
+	candidate, _ := json.Marshal(&model.WebRTCIceCandidatePayload{TargetDeviceID: "camera-1", Candidate: "candidate:1", SdpMid: "0", SdpMLineIndex: 2})
+	writeEncodedEvent(t, monitor, model.EncodingJSON, &model.Event{
+		Type: model.EventTypeIceCandidate, RoomID: "room", DeviceID: "monitor-1", Payload: candidate,
+	})
+	event, messageType := readEncodedEvent(t, camera, model.EventTypeIceCandidate)
+	var candidatePayload model.WebRTCIceCandidatePayload
+	if err := event.ParsePayload(&candidatePayload); err != nil || messageType != websocket.BinaryMessage ||
+		event.DeviceID != "monitor-1" || candidatePayload.Candidate != "candidate:1" || candidatePayload.SdpMLineIndex != 2 {
+		t.Fatalf("camera received %+v (frame %d), payload %+v, %v", event, messageType, candidatePayload, err)
+	}
+}
+
+// readErrorPayload 读取下一个错误事件的负载
+func readErrorPayload(t *testing.T, conn *websocket.Conn) *model.ErrorPayload {
+	t.Helper()
+
+	var payload model.ErrorPayload
+	if err := readDeviceEvent(t, conn, model.EventTypeError).ParsePayload(&payload); err != nil {
+		t.Fatalf("parse error payload: %v", err)
+	}
+	return &payload
+}
+
+func TestMessageLimitsRejectEvents(t *testing.T) {
+	limits := MessageLimits{
+		MaxSDPLength: 16,
+		Rates:        map[model.EventType]RateLimit{model.EventTypeIceCandidate: {Rate: 1, Burst: 2}},
+	}
+	server, _ := newWebSocketTestServer(t, limits, ConnectionLimits{})
+	camera := mustDialDevice(t, server, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := mustDialDevice(t, server, "room", "monitor-1", model.DeviceTypeMonitor)
+
+	candidate, _ := json.Marshal(&model.WebRTCIceCandidatePayload{TargetDeviceID: "monitor-1", Candidate: "candidate:1"})
+	for i := 0; i < 3; i++ {
+		writeEncodedEvent(t, camera, model.EncodingJSON, &model.Event{Type: model.EventTypeIceCandidate, Payload: candidate})
+	}
+	for i := 0; i < 2; i++ {
+		readDeviceEvent(t, monitor, model.EventTypeIceCandidate)
+	}
+	if payload := readErrorPayload(t, camera); payload.Code != model.ErrorCodeRateLimited ||
+		payload.EventType != model.EventTypeIceCandidate || payload.RetryAfter <= 0 {
+		t.Fatalf("rate limit error = %+v", payload)
+	}
+
+	offer, _ := json.Marshal(&model.WebRTCOfferPayload{TargetDeviceID: "monitor-1", SDP: strings.Repeat("a", 17)})
+	writeEncodedEvent(t, camera, model.EncodingJSON, &model.Event{Type: model.EventTypeOffer, Payload: offer})
+	if payload := readErrorPayload(t, camera); payload.Code != model.ErrorCodeMessageTooLarge || payload.EventType != model.EventTypeOffer {
+		t.Fatalf("SDP length error = %+v", payload)
+	}
+
+	// 被丢弃的事件不转发给目标设备
+	offer, _ = json.Marshal(&model.WebRTCOfferPayload{TargetDeviceID: "monitor-1", SDP: "v=0"})
+	writeEncodedEvent(t, camera, model.EncodingJSON, &model.Event{Type: model.EventTypeOffer, Payload: offer})
+	var offerPayload model.WebRTCOfferPayload
+	if err := readDeviceEvent(t, monitor, model.EventTypeOffer).ParsePayload(&offerPayload); err != nil || offerPayload.SDP != "v=0" {
+		t.Fatalf("monitor received offer %+v, %v", offerPayload, err)
+	}
+}
+
+func TestOversizedMessageClosesConnection(t *testing.T) {
+	server, _ := newWebSocketTestServer(t, MessageLimits{MaxMessageSize: 1024}, ConnectionLimits{})
+	camera := mustDialDevice(t, server, "room", "camera-1", model.DeviceTypeCamera)
+
+	if err := camera.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("a", 2048))); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if code := readCloseCode(t, camera); code != websocket.CloseMessageTooBig {
+		t.Fatalf("close code = %d, want %d", code, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestRepeatedViolationsCloseConnection(t *testing.T) {
+	server, _ := newWebSocketTestServer(t, MessageLimits{MaxViolations: 2, ViolationWindow: time.Minute}, ConnectionLimits{})
+	camera := mustDialDevice(t, server, "room", "camera-1", model.DeviceTypeCamera)
+
+	// 无法解析的消息同样计入违规次数
+	for i := 0; i < 2; i++ {
+		if err := camera.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if code := readCloseCode(t, camera); code != websocket.ClosePolicyViolation {
+		t.Fatalf("close code = %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+}
+
+func TestConnectionLimitsRejectBeforeUpgrade(t *testing.T) {
+	server, webSocketHandler := newWebSocketTestServer(t, MessageLimits{}, ConnectionLimits{MaxConnectionsPerIP: 1})
+	camera := mustDialDevice(t, server, "room", "camera-1", model.DeviceTypeCamera)
+
+	_, response, err := dialDevice(server, "room", "camera-2", model.DeviceTypeCamera)
+	if err == nil || response == nil || response.StatusCode != http.StatusTooManyRequests || response.Header.Get("Retry-After") == "" {
+		t.Fatalf("dial over the per-IP limit returned %v", err)
+	}
+
+	// 连接断开后释放名额
+	camera.Close()
+	for deadline := time.Now().Add(3 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		webSocketHandler.tracker.mutex.Lock()
+		total := webSocketHandler.tracker.total
+		webSocketHandler.tracker.mutex.Unlock()
+		if total == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tracker still counts %d connections after the device disconnected", total)
+		}
+	}
+	mustDialDevice(t, server, "room", "camera-2", model.DeviceTypeCamera)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"monitor/model"
+)
+
+// handoffEnv 标记进程由旧进程启动并需要接收交接，继承的文件描述符依次为：
+// 3 监听套接字，4 旧进程写入状态快照的管道，5 新进程通知就绪的管道
+const handoffEnv = "MONITOR_HANDOFF"
+
+const (
+	// handoffReadyTimeout 等待新进程完成初始化的时间，超时后放弃交接并继续服务
+	handoffReadyTimeout = 30 * time.Second
+	// handoffStateTimeout 新进程等待状态快照的时间，超时后以空状态启动
+	handoffStateTimeout = 30 * time.Second
+)
+
+// successor 由本进程启动、等待接收交接状态的新进程
+type successor struct {
+	cmd   *exec.Cmd
+	state *os.File // 写入状态快照的管道
+}
+
+// startSuccessor 以相同的参数启动新进程并传递监听套接字，等待新进程初始化完成。
+// 新进程启动失败或超时未就绪时终止新进程并返回错误，本进程继续服务
+func startSuccessor(listener net.Listener, timeout time.Duration) (*successor, error) {
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("unsupported listener type %T", listener)
+	}
+	listenerFile, err := tcpListener.File()
+	if err != nil {
+		return nil, fmt.Errorf("get listener file: %w", err)
+	}
+	defer listenerFile.Close()
+
+	// 重新查找可执行文件，升级时使用替换后的新版本
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("find executable: %w", err)
+	}
+
+	stateReader, stateWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		stateReader.Close()
+		stateWriter.Close()
+		return nil, err
+	}
+	defer readyReader.Close()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), handoffEnv+"=1")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{listenerFile, stateReader, readyWriter}
+	err = cmd.Start()
+	// 子进程已持有管道的另一端
+	stateReader.Close()
+	readyWriter.Close()
+	if err != nil {
+		stateWriter.Close()
+		return nil, fmt.Errorf("start successor: %w", err)
+	}
+
+	// 新进程初始化完成后写入一个字节，提前退出时读到EOF
+	readyReader.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := readyReader.Read(make([]byte, 1)); err != nil {
+		stateWriter.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("successor not ready: %w", err)
+	}
+	return &successor{cmd: cmd, state: stateWriter}, nil
+}
+
+// sendState 把状态快照写入新进程并关闭管道
+func (s *successor) sendState(state *model.HandoffState) error {
+	defer s.state.Close()
+	return json.NewEncoder(s.state).Encode(state)
+}
+
+// pid 新进程的进程号
+func (s *successor) pid() int {
+	return s.cmd.Process.Pid
+}
+
+// predecessor 启动本进程并等待交接的旧进程
+type predecessor struct {
+	listener net.Listener
+	state    *os.File // 读取状态快照的管道
+	ready    *os.File // 通知就绪的管道
+}
+
+// inheritHandoff 获取旧进程传递的监听套接字和管道，不是由旧进程启动时返回nil
+func inheritHandoff() (*predecessor, error) {
+	if os.Getenv(handoffEnv) != "1" {
+		return nil, nil
+	}
+	// 避免之后启动的新进程误认为继承了本进程的文件描述符
+	os.Unsetenv(handoffEnv)
+
+	listenerFile := os.NewFile(3, "listener")
+	defer listenerFile.Close()
+	listener, err := net.FileListener(listenerFile)
+	if err != nil {
+		return nil, fmt.Errorf("inherit listener: %w", err)
+	}
+
+	// 继承的管道处于阻塞模式，设置为非阻塞后才能使用读取超时
+	if err := syscall.SetNonblock(4, true); err != nil {
+		return nil, fmt.Errorf("inherit state pipe: %w", err)
+	}
+
+	return &predecessor{
+		listener: listener,
+		state:    os.NewFile(4, "handoff-state"),
+		ready:    os.NewFile(5, "handoff-ready"),
+	}, nil
+}
+
+// receiveState 通知旧进程本进程已就绪，并等待旧进程写入状态快照。
+// 旧进程停止接受连接后才写入快照，期间新连接在监听队列中等待
+func (p *predecessor) receiveState(timeout time.Duration) (*model.HandoffState, error) {
+	defer p.state.Close()
+
+	_, err := p.ready.Write([]byte{1})
+	p.ready.Close()
+	if err != nil {
+		return nil, fmt.Errorf("notify ready: %w", err)
+	}
+
+	p.state.SetReadDeadline(time.Now().Add(timeout))
+	var state model.HandoffState
+	if err := json.NewDecoder(p.state).Decode(&state); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, errors.New("timeout waiting for handoff state")
+		}
+		return nil, fmt.Errorf("decode handoff state: %w", err)
+	}
+	return &state, nil
+}
@@ -0,0 +1,98 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 日志字段名称，所有模块统一使用
+const (
+	KeyRoomID    = "roomId"
+	KeyDeviceID  = "deviceId"
+	KeyEventType = "eventType"
+	KeyError     = "error"
+)
+
+// Config 日志配置
+type Config struct {
+	Level      string // 日志级别：debug、info、warn、error
+	Format     string // 输出格式：text、json
+	Dir        string // 日志文件目录，为空时只输出到标准输出
+	MaxSizeMB  int    // 单个日志文件的最大大小（MB）
+	MaxBackups int    // 保留的历史日志文件数量
+}
+
+// Logger 包装slog.Logger，持有需要关闭的日志文件
+type Logger struct {
+	*slog.Logger
+	level  *slog.LevelVar
+	closer io.Closer
+}
+
+// New 根据配置创建日志
+func New(cfg Config) (*Logger, error) {
+	level := new(slog.LevelVar)
+	if err := SetLevel(level, cfg.Level); err != nil {
+		return nil, err
+	}
+
+	var out io.Writer = os.Stdout
+	var closer io.Closer
+	if cfg.Dir != "" {
+		file, err := NewRotatingFile(filepath.Join(cfg.Dir, "monitor.log"), int64(cfg.MaxSizeMB)*1024*1024, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = io.MultiWriter(os.Stdout, file)
+		closer = file
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, options)
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", cfg.Format)
+	}
+
+	return &Logger{
+		Logger: slog.New(handler),
+		level:  level,
+		closer: closer,
+	}, nil
+}
+
+// SetLevel 修改日志级别，可在运行时调用
+func (l *Logger) SetLevel(level string) error {
+	return SetLevel(l.level, level)
+}
+
+// Close 关闭日志文件
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// SetLevel 解析日志级别并写入levelVar
+func SetLevel(levelVar *slog.LevelVar, level string) error {
+	if level == "" {
+		levelVar.Set(slog.LevelInfo)
+		return nil
+	}
+
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	levelVar.Set(parsed)
+	return nil
+}
@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	if _, err := New(Config{Level: "verbose"}); err == nil {
+		t.Fatal("New accepted an invalid level")
+	}
+	if _, err := New(Config{Format: "xml"}); err == nil {
+		t.Fatal("New accepted an invalid format")
+	}
+}
+
+func TestLoggerWritesJSONAndChangesLevel(t *testing.T) {
+	dir := t.TempDir()
+	log, err := New(Config{Level: "warn", Format: "json", Dir: dir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	log.Info("hidden")
+	log.Warn("shown", KeyRoomID, "room")
+	// 运行时修改的级别立即生效
+	if err := log.SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel: %v", err)
+	}
+	if !log.Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("debug not enabled after SetLevel")
+	}
+	log.Debug("debug")
+	if err := log.SetLevel("loud"); err == nil {
+		t.Fatal("SetLevel accepted an invalid level")
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(readLog(t, filepath.Join(dir, "monitor.log"))), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"shown"`) || !strings.Contains(lines[0], `"roomId":"room"`) ||
+		!strings.Contains(lines[1], `"msg":"debug"`) {
+		t.Fatalf("log file = %q", lines)
+	}
+}
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readLog 读取日志文件内容，文件不存在时返回空字符串
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "monitor.log")
+	file, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingFile: %v", err)
+	}
+
+	// 每次写入都会使文件超过10字节，写入前滚动
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n", path + ".3": ""}
+	for name, content := range want {
+		if got := readLog(t, name); got != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, content)
+		}
+	}
+
+	if _, err := file.Write([]byte("closed\n")); err == nil {
+		t.Fatal("Write succeeded after Close")
+	}
+}
+
+func TestRotatingFileAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monitor.log")
+	if err := os.WriteFile(path, []byte("12345678"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// 已有内容计入大小，没有历史文件时滚动直接丢弃旧内容
+	file, err := NewRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatalf("NewRotatingFile: %v", err)
+	}
+	defer file.Close()
+	file.Write([]byte("9\n"))
+	file.Write([]byte("next\n"))
+
+	if got := readLog(t, path); got != "next\n" {
+		t.Fatalf("log = %q, want %q", got, "next\n")
+	}
+	if got := readLog(t, path+".1"); got != "" {
+		t.Fatalf("backup written with maxBackups 0: %q", got)
+	}
+}
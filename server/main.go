@@ -1,55 +1,248 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"monitor/cluster"
+	"monitor/config"
 	"monitor/handler"
+	"monitor/logger"
+	"monitor/metrics"
+	"monitor/model"
 	"monitor/service"
+	"monitor/tracing"
 )
 
 func main() {
-	// 获取环境变量或使用默认值
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "11100"
+	// 加载配置文件，未指定时只使用默认值和环境变量
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML配置文件路径")
+	flag.Parse()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		slog.Error("load config failed", "path", *configPath, logger.KeyError, err)
+		os.Exit(1)
 	}
 
-	// 允许的跨域来源
-	allowOrigin := os.Getenv("ALLOW_ORIGIN")
-	if allowOrigin == "" {
-		allowOrigin = "*"
+	// 初始化日志
+	appLogger, err := logger.New(logger.Config{
+		Level:      cfg.Log.Level,
+		Format:     cfg.Log.Format,
+		Dir:        cfg.Log.Dir,
+		MaxSizeMB:  cfg.Log.MaxSizeMB,
+		MaxBackups: cfg.Log.MaxBackups,
+	})
+	if err != nil {
+		slog.Error("init logger failed", logger.KeyError, err)
+		os.Exit(1)
+	}
+	defer appLogger.Close()
+	slog.SetDefault(appLogger.Logger)
+
+	// 初始化链路追踪，默认不导出
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		Exporter:     cfg.Tracing.Exporter,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		OTLPInsecure: cfg.Tracing.OTLPInsecure,
+		ServiceName:  cfg.Tracing.ServiceName,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		slog.Error("init tracing failed", logger.KeyError, err)
+		os.Exit(1)
+	}
+
+	port := cfg.Server.Port
+	dataDir := cfg.Server.DataDir
+
+	// 由旧进程交接启动时继承监听套接字，否则新建监听
+	parent, err := inheritHandoff()
+	if err != nil {
+		slog.Error("inherit handoff failed", logger.KeyError, err)
+		os.Exit(1)
+	}
+	var listener net.Listener
+	if parent != nil {
+		listener = parent.listener
+	} else {
+		listener, err = net.Listen("tcp", ":"+port)
+		if err != nil {
+			slog.Error("listen failed", "port", port, logger.KeyError, err)
+			os.Exit(1)
+		}
+	}
+
+	// 全局活动流的管理员令牌，为空时不校验
+	adminToken := cfg.Server.AdminToken
+
+	// 事件审计配置，审计文件保存在数据目录的audit子目录
+	auditConfig := service.AuditConfig{
+		RetentionDays: cfg.Audit.RetentionDays,
+		RedactSDP:     cfg.Audit.RedactSDP,
+	}
+	if cfg.Audit.Enabled {
+		auditConfig.Dir = filepath.Join(dataDir, "audit")
 	}
 
 	// 创建服务实例
-	roomService := service.NewRoomService()
-	eventService := service.NewEventService(roomService)
-	webSocketHandler := handler.NewWebSocketHandler(roomService, eventService)
+	auditService, err := service.NewAuditService(auditConfig)
+	if err != nil {
+		slog.Error("init audit service failed", logger.KeyError, err)
+		os.Exit(1)
+	}
+	defer auditService.Close()
 
-	// 创建Gin路由
-	r := gin.Default()
+	localRoomService := service.NewRoomService()
+	var roomService service.RoomService = localRoomService
 
-	// 设置CORS
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", allowOrigin)
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	// 集群部署时通过消息总线同步各节点的设备，并把发往其他节点设备的事件转发给对应节点
+	// 每个房间通过共享存储中的租约由一个节点持有，其他节点收到的连接代理或重定向到该节点
+	var clusterService service.ClusterService
+	var clusterHandler *handler.ClusterHandler
+	if busType := cfg.Cluster.Bus; busType != "none" {
+		busConfig := cluster.Config{
+			Type:          busType,
+			Channel:       cfg.Cluster.Channel,
+			RedisAddr:     cfg.Cluster.RedisAddr,
+			RedisPassword: cfg.Cluster.RedisPassword,
+			NATSURL:       cfg.Cluster.NATSURL,
+			LeaseTTL:      cfg.Cluster.LeaseTTL,
+		}
+		bus, err := cluster.New(busConfig)
+		if err != nil {
+			slog.Error("init cluster bus failed", "bus", busType, logger.KeyError, err)
+			os.Exit(1)
+		}
+
+		var leases cluster.LeaseStore
+		leaseStore := cfg.Cluster.LeaseStore
+		if leaseStore == "" {
+			leaseStore = busType
 		}
+		if leaseStore != "none" {
+			leases, err = cluster.NewLeaseStore(leaseStore, busConfig)
+			if err != nil {
+				slog.Error("init cluster lease store failed", "store", leaseStore, logger.KeyError, err)
+				os.Exit(1)
+			}
+		}
+
+		clusterService = service.NewClusterService(service.ClusterConfig{
+			NodeID:            clusterNodeID(cfg.Cluster.NodeID),
+			HeartbeatInterval: cfg.Cluster.HeartbeatInterval,
+			NodeTimeout:       cfg.Cluster.NodeTimeout,
+			AdvertiseURL:      clusterAdvertiseURL(cfg.Cluster.AdvertiseURL, port),
+			Leases:            leases,
+			LeaseTTL:          busConfig.LeaseTTL,
+		}, localRoomService, bus)
+		clusterHandler = handler.NewClusterHandler(clusterService, cfg.Cluster.JoinMode, cfg.Cluster.Secret)
+		roomService = clusterService
+		// 房间归属由租约决定，交接给新进程会与其他节点的接管冲突
+		slog.Warn("handoff is disabled in cluster mode, SIGUSR2 will be ignored; drain the node to restart it")
+	}
+
+	activityService := service.NewActivityService()
+	qualityService := service.NewQualityService()
+	historyService := service.NewStatusHistoryService()
 
-		c.Next()
+	// 告警服务，规则保存在数据目录的alerts子目录
+	alertService, err := service.NewAlertService(service.AlertConfig{
+		Dir:           filepath.Join(dataDir, "alerts"),
+		CheckInterval: cfg.Alert.CheckInterval,
+		Notifiers:     alertNotifiers(cfg.Alert),
+	}, roomService, historyService)
+	if err != nil {
+		slog.Error("init alert service failed", logger.KeyError, err)
+		os.Exit(1)
+	}
+	defer alertService.Close()
+
+	// 事件回调服务，订阅保存在数据目录的webhooks子目录
+	webhookService, err := service.NewWebhookService(service.WebhookConfig{
+		Dir:            filepath.Join(dataDir, "webhooks"),
+		MaxAttempts:    cfg.Webhook.MaxAttempts,
+		InitialBackoff: cfg.Webhook.InitialBackoff,
+		MaxBackoff:     cfg.Webhook.MaxBackoff,
 	})
+	if err != nil {
+		slog.Error("init webhook service failed", logger.KeyError, err)
+		os.Exit(1)
+	}
+	defer webhookService.Close()
+
+	eventService := service.NewEventService(roomService, activityService, auditService, qualityService, historyService, webhookService)
+	if clusterService != nil {
+		clusterService.SetEventHandler(eventService)
+		if err := clusterService.Start(); err != nil {
+			slog.Error("start cluster failed", logger.KeyError, err)
+			os.Exit(1)
+		}
+		defer clusterService.Close()
+	}
+
+	layoutService := service.NewLayoutService(dataDir, roomService)
+	handoffService, err := service.NewHandoffService(localRoomService, cfg.Shutdown.ResumeWindow)
+	if err != nil {
+		slog.Error("init handoff service failed", logger.KeyError, err)
+		os.Exit(1)
+	}
+	// 跨域请求和WebSocket连接使用相同的允许来源
+	cors := handler.NewCORS(cfg.Server.AllowOrigins, cfg.Server.StrictOrigins)
+	cors.SetClusterSecret(cfg.Cluster.Secret)
+	webSocketHandler := handler.NewWebSocketHandler(roomService, eventService, auditService, handoffService, cors, messageLimits(cfg.Limits), connectionLimits(cfg.Limits))
+	webSocketHandler.SetICEServers(cfg.ICEServers)
+	layoutHandler := handler.NewLayoutHandler(layoutService, eventService)
+	activityHandler := handler.NewActivityHandler(activityService, adminToken)
+	auditHandler := handler.NewAuditHandler(auditService)
+	qualityHandler := handler.NewQualityHandler(roomService, qualityService)
+	historyHandler := handler.NewStatusHistoryHandler(historyService)
+	alertHandler := handler.NewAlertHandler(alertService)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+	healthHandler := handler.NewHealthHandler(webSocketHandler)
+
+	// 注册房间与设备数量指标，只统计本节点
+	prometheus.MustRegister(metrics.NewRoomCollector(localRoomService))
+
+	// 创建Gin路由
+	r := gin.New()
+	r.Use(handler.RequestLogger(), gin.Recovery())
+
+	// 只信任配置的代理转发的X-Forwarded-For，未配置时使用连接的来源地址
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		slog.Error("invalid TRUSTED_PROXIES", logger.KeyError, err)
+		os.Exit(1)
+	}
 
-	// 注册WebSocket路由
-	r.GET("/ws/:roomId", webSocketHandler.HandleWebSocket)
+	// 设置CORS
+	r.Use(cors.Handle)
+
+	// 注册健康检查路由
+	r.GET("/healthz", healthHandler.Healthz)
+	r.GET("/readyz", healthHandler.Readyz)
+
+	// 注册Prometheus指标路由
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// 注册WebSocket路由，参数检查和连接数限制在获取房间所有权之前执行
+	if clusterHandler != nil {
+		r.GET("/ws/:roomId", cors.CheckWebSocketOrigin, webSocketHandler.AdmitWebSocket, clusterHandler.RouteWebSocket, webSocketHandler.HandleWebSocket)
+	} else {
+		r.GET("/ws/:roomId", cors.CheckWebSocketOrigin, webSocketHandler.AdmitWebSocket, webSocketHandler.HandleWebSocket)
+	}
 
 	// 注册API路由
 	api := r.Group("/api")
@@ -108,6 +301,49 @@ func main() {
 
 			c.JSON(http.StatusOK, devices)
 		})
+
+		// 房间活动流（Server-Sent Events）
+		api.GET("/rooms/:roomId/events", activityHandler.StreamRoomEvents)
+		api.GET("/events", activityHandler.StreamAllEvents)
+
+		// 设备连接质量
+		api.GET("/rooms/:roomId/devices/:deviceId/quality", qualityHandler.GetDeviceQuality)
+
+		// 设备状态历史
+		api.GET("/rooms/:roomId/devices/:deviceId/history", historyHandler.GetDeviceHistory)
+
+		// 房间事件审计查询
+		// 审计记录包含设备收发的信令内容，需要管理员令牌
+		api.GET("/rooms/:roomId/audit", handler.AdminAuth(adminToken), auditHandler.QueryRoomAudit)
+
+		// 房间布局管理
+		api.GET("/rooms/:roomId/layouts", layoutHandler.ListLayouts)
+		api.POST("/rooms/:roomId/layouts", layoutHandler.CreateLayout)
+		api.GET("/rooms/:roomId/layouts/:layoutId", layoutHandler.GetLayout)
+		api.PUT("/rooms/:roomId/layouts/:layoutId", layoutHandler.UpdateLayout)
+		api.DELETE("/rooms/:roomId/layouts/:layoutId", layoutHandler.DeleteLayout)
+
+		// 告警规则与当前告警
+		api.GET("/rooms/:roomId/alert-rules", alertHandler.ListRules)
+		api.POST("/rooms/:roomId/alert-rules", alertHandler.CreateRule)
+		api.PUT("/rooms/:roomId/alert-rules/:ruleId", alertHandler.UpdateRule)
+		api.DELETE("/rooms/:roomId/alert-rules/:ruleId", alertHandler.DeleteRule)
+		api.GET("/rooms/:roomId/alerts", alertHandler.ListAlerts)
+
+		// 事件回调订阅，仅供管理员使用
+		webhooks := api.Group("/webhooks", handler.AdminAuth(adminToken))
+		webhooks.GET("", webhookHandler.ListWebhooks)
+		webhooks.POST("", webhookHandler.CreateWebhook)
+		webhooks.GET("/:webhookId", webhookHandler.GetWebhook)
+		webhooks.PUT("/:webhookId", webhookHandler.UpdateWebhook)
+		webhooks.DELETE("/:webhookId", webhookHandler.DeleteWebhook)
+		webhooks.GET("/:webhookId/deliveries", webhookHandler.ListDeliveries)
+
+		// 集群节点
+		if clusterHandler != nil {
+			api.GET("/cluster/nodes", clusterHandler.ListNodes)
+			api.GET("/rooms/:roomId/owner", clusterHandler.GetRoomOwner)
+		}
 	}
 
 	// 提供前端静态文件
@@ -126,9 +362,185 @@ func main() {
 		c.File(filePath)
 	})
 
+	// 请求上下文在关闭时取消，使SSE等长连接请求及时退出
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+	}
+
+	// 交接启动时先等待旧进程的状态快照，恢复房间后再开始接受连接，期间的新连接在监听队列中等待
+	if parent != nil {
+		state, err := parent.receiveState(handoffStateTimeout)
+		if err == nil {
+			err = webSocketHandler.RestoreState(state, cfg.Shutdown.ResumeWindow)
+		}
+		if err != nil {
+			slog.Warn("restore handoff state failed, starting with empty state", logger.KeyError, err)
+		}
+	}
+
 	// 启动服务器
-	log.Printf("Server started on :%s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("server started", "port", port, "handoff", parent != nil)
+		serverErr <- server.Serve(listener)
+	}()
+
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	// 收到SIGHUP或配置文件修改时重新加载可以在运行时修改的配置，不影响已建立的连接
+	go config.Watch(signalCtx, *configPath, cfg, func(reloaded *config.Config) {
+		if err := appLogger.SetLevel(reloaded.Log.Level); err != nil {
+			slog.Warn("apply log level failed", logger.KeyError, err)
+		}
+		cors.SetAllowedOrigins(reloaded.Server.AllowOrigins, reloaded.Server.StrictOrigins)
+		webSocketHandler.SetLimits(messageLimits(reloaded.Limits), connectionLimits(reloaded.Limits))
+		webSocketHandler.SetICEServers(reloaded.ICEServers)
+	})
+
+	// 收到SIGUSR2时启动新进程并把监听套接字和房间状态交接给它，用于不中断服务的重启和升级
+	upgrade := make(chan os.Signal, 1)
+	signal.Notify(upgrade, syscall.SIGUSR2)
+	defer signal.Stop(upgrade)
+
+	var next *successor
+wait:
+	for {
+		select {
+		case err := <-serverErr:
+			slog.Error("server stopped", logger.KeyError, err)
+			os.Exit(1)
+		case <-signalCtx.Done():
+			break wait
+		case <-upgrade:
+			// 集群部署时房间由租约决定归属，重启节点应使用排空让其他节点接管
+			if clusterService != nil {
+				slog.Warn("handoff is not supported in cluster mode, ignoring SIGUSR2")
+				continue
+			}
+			slog.Info("received SIGUSR2, starting successor")
+			successor, err := startSuccessor(listener, handoffReadyTimeout)
+			if err != nil {
+				slog.Error("handoff aborted, continuing to serve", logger.KeyError, err)
+				continue
+			}
+			next = successor
+			break wait
+		}
+	}
+
+	drainTimeout := cfg.Shutdown.DrainTimeout
+	reconnectSpread := cfg.Shutdown.ReconnectSpread
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if next != nil {
+		// 交接：新进程已就绪，停止接受连接后断开所有设备，再把房间状态交给新进程
+		slog.Info("handing off to successor", "pid", next.pid(), "reconnectSpread", reconnectSpread)
+		cancelRequests()
+		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("http server shutdown failed", logger.KeyError, err)
+		}
+		webSocketHandler.Handoff(reconnectSpread)
+		if err := next.sendState(handoffService.Snapshot()); err != nil {
+			slog.Error("send handoff state failed", logger.KeyError, err)
+		}
+	} else {
+		// 优雅关闭：先排空WebSocket连接，再关闭HTTP服务
+		slog.Info("shutting down", "drainTimeout", drainTimeout, "reconnectSpread", reconnectSpread)
+		// 先释放房间租约，被断开的设备重连时由其他节点接管房间
+		if clusterService != nil {
+			clusterService.ReleaseRooms()
+		}
+		webSocketHandler.Drain(drainTimeout, reconnectSpread)
+
+		cancelRequests()
+		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("http server shutdown failed", logger.KeyError, err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("tracing shutdown failed", logger.KeyError, err)
+	}
+	slog.Info("server stopped")
+}
+
+// messageLimits 根据配置创建每个连接的入站消息限制
+func messageLimits(limits config.LimitsConfig) handler.MessageLimits {
+	rates := make(map[model.EventType]handler.RateLimit, len(limits.RateLimits))
+	for eventType, limit := range limits.RateLimits {
+		rates[model.EventType(eventType)] = handler.RateLimit{Rate: limit.Rate, Burst: limit.Burst}
+	}
+
+	return handler.MessageLimits{
+		MaxMessageSize:  limits.MaxMessageSize,
+		MaxSDPLength:    limits.MaxSDPLength,
+		Rates:           rates,
+		MaxViolations:   limits.MaxViolations,
+		ViolationWindow: limits.ViolationWindow,
+	}
+}
+
+// connectionLimits 根据配置创建升级前检查的连接数限制
+func connectionLimits(limits config.LimitsConfig) handler.ConnectionLimits {
+	return handler.ConnectionLimits{
+		MaxConnections:      limits.MaxConnections,
+		MaxConnectionsPerIP: limits.MaxConnectionsPerIP,
+		MaxRoomsPerIP:       limits.MaxRoomsPerIP,
+		MaxAutoRooms:        limits.MaxAutoRooms,
+	}
+}
+
+// alertNotifiers 根据配置创建告警通知方式
+func alertNotifiers(cfg config.AlertConfig) []service.AlertNotifier {
+	notifiers := make([]service.AlertNotifier, 0)
+
+	if cfg.SMTP.Host != "" {
+		notifiers = append(notifiers, service.NewSMTPNotifier(service.SMTPConfig{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+			To:       cfg.SMTP.To,
+		}))
+	}
+
+	if cfg.Webhook.URL != "" {
+		notifiers = append(notifiers, service.NewWebhookNotifier(cfg.Webhook.URL, cfg.Webhook.Token))
+	}
+
+	return notifiers
+}
+
+// clusterNodeID 集群节点ID，未配置时使用主机名和进程号
+func clusterNodeID(nodeID string) string {
+	if nodeID != "" {
+		return nodeID
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "node"
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid())
+}
+
+// clusterAdvertiseURL 本节点对外地址，未配置时使用主机名和监听端口
+func clusterAdvertiseURL(advertiseURL string, port string) string {
+	if advertiseURL != "" {
+		return advertiseURL
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
 	}
+	return "http://" + hostname + ":" + port
 }
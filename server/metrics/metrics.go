@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 指标名称前缀
+const namespace = "monitor"
+
+// UnknownLabel 未知事件类型/设备类型的标签值，避免客户端随意构造标签
+const UnknownLabel = "unknown"
+
+var (
+	// EventsProcessed 经ProcessEvent处理的事件数量
+	EventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_processed_total",
+		Help:      "Number of events processed through ProcessEvent, by event type and result.",
+	}, []string{"type", "result"})
+
+	// EventHandlingDuration 事件处理耗时
+	EventHandlingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "event_handling_duration_seconds",
+		Help:      "Time spent handling an inbound event in ProcessEvent.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 14),
+	}, []string{"type"})
+
+	// RoutingFailures 发送事件到设备失败的数量
+	RoutingFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_routing_failures_total",
+		Help:      "Number of events that could not be delivered by SendEventToDevice, by event type.",
+	}, []string{"type"})
+
+	// WriteDuration WebSocket写入耗时
+	WriteDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "websocket_write_duration_seconds",
+		Help:      "Time spent writing a single event to a WebSocket connection.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 14),
+	})
+
+	// ParseErrors 无法解析的WebSocket消息数量
+	ParseErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "message_parse_errors_total",
+		Help:      "Number of inbound WebSocket messages that could not be parsed as events.",
+	})
+
+	// AuditDropped 因写入队列已满被丢弃的审计记录数量
+	AuditDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_dropped_total",
+		Help:      "Number of audit records dropped because the write queue was full.",
+	})
+
+	// WebSocketUpgrades WebSocket升级请求数量
+	WebSocketUpgrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_upgrades_total",
+		Help:      "Number of WebSocket upgrade attempts, by result.",
+	}, []string{"result"})
+
+	// ConnectionRejections 因超出连接数限制在升级前被拒绝的WebSocket请求数量
+	ConnectionRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connection_rejections_total",
+		Help:      "Number of WebSocket upgrades rejected with 429 for exceeding connection limits, by reason.",
+	}, []string{"reason"})
+
+	// OriginRejections 来源不被允许的跨域请求和WebSocket连接数量
+	OriginRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "origin_rejections_total",
+		Help:      "Number of requests from origins not allowed by the CORS settings, by transport (http or websocket).",
+	}, []string{"transport"})
+
+	// MessageLimitViolations 超出连接入站限制的消息数量
+	MessageLimitViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "message_limit_violations_total",
+		Help:      "Number of inbound WebSocket messages rejected by per-connection limits, by reason (rate_limited, message_too_large, frame_too_large).",
+	}, []string{"reason"})
+
+	// LimitDisconnects 因多次超出入站限制被断开的连接数量
+	LimitDisconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "limit_disconnects_total",
+		Help:      "Number of WebSocket connections closed for repeatedly violating inbound limits.",
+	})
+
+	// AlertNotifications 告警通知发送数量
+	AlertNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alert_notifications_total",
+		Help:      "Number of alert and recovery notifications sent, by notifier and result.",
+	}, []string{"notifier", "result"})
+
+	// WebhookDeliveries 事件回调投递次数
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of webhook delivery attempts, by result (ok, retry, failed, dropped).",
+	}, []string{"result"})
+
+	// ClusterMessages 集群消息数量
+	ClusterMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cluster_messages_total",
+		Help:      "Number of cluster bus messages published and received, by direction and message type.",
+	}, []string{"direction", "type"})
+)
+
+// ObserveEvent 记录一次事件处理结果和耗时
+func ObserveEvent(eventType string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+
+	EventsProcessed.WithLabelValues(eventType, result).Inc()
+	EventHandlingDuration.WithLabelValues(eventType).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"monitor/model"
+)
+
+// RoomSource 房间与设备数据来源
+type RoomSource interface {
+	GetRooms() ([]*model.Room, error)
+}
+
+// RoomCollector 在抓取时统计房间和设备数量
+type RoomCollector struct {
+	source  RoomSource
+	rooms   *prometheus.Desc
+	devices *prometheus.Desc
+}
+
+// NewRoomCollector 创建房间指标采集器
+func NewRoomCollector(source RoomSource) *RoomCollector {
+	return &RoomCollector{
+		source: source,
+		rooms: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "rooms"),
+			"Number of rooms currently held by this instance.",
+			nil, nil,
+		),
+		devices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "devices"),
+			"Number of connected devices, by device type and status.",
+			[]string{"type", "status"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector
+func (c *RoomCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.rooms
+	ch <- c.devices
+}
+
+// Collect 实现prometheus.Collector
+func (c *RoomCollector) Collect(ch chan<- prometheus.Metric) {
+	rooms, err := c.source.GetRooms()
+	if err != nil {
+		return
+	}
+
+	type deviceKey struct {
+		deviceType model.DeviceType
+		status     model.DeviceStatus
+	}
+	counts := make(map[deviceKey]int)
+
+	// 使用房间维护的类型和状态索引统计，不需要复制设备列表
+	for _, room := range rooms {
+		for deviceType, byStatus := range room.CountDevices() {
+			if deviceType != model.DeviceTypeCamera && deviceType != model.DeviceTypeMonitor {
+				deviceType = UnknownLabel
+			}
+			for status, count := range byStatus {
+				counts[deviceKey{deviceType, status}] += count
+			}
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.rooms, prometheus.GaugeValue, float64(len(rooms)))
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.devices, prometheus.GaugeValue, float64(count),
+			string(key.deviceType), string(key.status))
+	}
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"monitor/model"
+)
+
+// staticRooms 返回固定房间列表的数据来源
+type staticRooms []*model.Room
+
+// GetRooms 返回房间列表
+func (r staticRooms) GetRooms() ([]*model.Room, error) {
+	return r, nil
+}
+
+// newTestRoom 创建包含指定设备的房间
+func newTestRoom(t *testing.T, id string, devices ...*model.Device) *model.Room {
+	t.Helper()
+
+	room := model.NewRoom(id, id, 0)
+	for _, device := range devices {
+		status := device.Status
+		if err := room.JoinDevice(device, nil, 0); err != nil {
+			t.Fatalf("JoinDevice %s: %v", device.ID, err)
+		}
+		room.SetDeviceStatus(device.ID, status, 0)
+	}
+	return room
+}
+
+// gatherValue 从采集器中读取指定名称和标签的指标值，不存在时返回-1
+func gatherValue(t *testing.T, collector prometheus.Collector, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if value, exists := labels[label.GetName()]; exists {
+					if value != label.GetValue() {
+						continue metrics
+					}
+					matched++
+				}
+			}
+			if matched != len(labels) {
+				continue
+			}
+			if gauge := metric.GetGauge(); gauge != nil {
+				return gauge.GetValue()
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return -1
+}
+
+func TestRoomCollector(t *testing.T) {
+	rooms := staticRooms{
+		newTestRoom(t, "room-a",
+			&model.Device{ID: "camera-1", Type: model.DeviceTypeCamera, Status: model.DeviceStatusStreaming},
+			&model.Device{ID: "camera-2", Type: model.DeviceTypeCamera, Status: model.DeviceStatusStreaming},
+			&model.Device{ID: "monitor-1", Type: model.DeviceTypeMonitor, Status: model.DeviceStatusReceiving},
+		),
+		newTestRoom(t, "room-b",
+			&model.Device{ID: "camera-1", Type: model.DeviceTypeCamera, Status: model.DeviceStatusReady},
+			&model.Device{ID: "speaker-1", Type: "speaker", Status: model.DeviceStatusConnected},
+		),
+	}
+	collector := NewRoomCollector(rooms)
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"monitor_rooms", nil, 2},
+		{"monitor_devices", map[string]string{"type": "camera", "status": "streaming"}, 2},
+		{"monitor_devices", map[string]string{"type": "camera", "status": "ready"}, 1},
+		{"monitor_devices", map[string]string{"type": "monitor", "status": "receiving"}, 1},
+		// 未知设备类型归入unknown，避免客户端随意构造标签
+		{"monitor_devices", map[string]string{"type": UnknownLabel, "status": "connected"}, 1},
+		{"monitor_devices", map[string]string{"type": "speaker"}, -1},
+	}
+	for _, test := range tests {
+		if got := gatherValue(t, collector, test.name, test.labels); got != test.want {
+			t.Errorf("%s%v = %v, want %v", test.name, test.labels, got, test.want)
+		}
+	}
+}
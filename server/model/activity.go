@@ -0,0 +1,23 @@
+package model
+
+// ActivityType 房间活动类型
+type ActivityType string
+
+const (
+	ActivityTypeJoin   ActivityType = "join"   // 设备加入房间
+	ActivityTypeLeave  ActivityType = "leave"  // 设备离开房间
+	ActivityTypeStatus ActivityType = "status" // 设备状态变化
+	ActivityTypeError  ActivityType = "error"  // 向设备发送了错误事件
+)
+
+// Activity 房间活动记录，供仪表盘等只读订阅者使用
+type Activity struct {
+	ID        int64        `json:"id"`               // 全局递增的活动ID，用于断线续传
+	Type      ActivityType `json:"type"`             // 活动类型
+	RoomID    string       `json:"roomId"`           // 房间ID
+	DeviceID  string       `json:"deviceId"`         // 设备ID
+	Timestamp int64        `json:"timestamp"`        // 发生时间
+	Device    *Device      `json:"device,omitempty"` // 设备信息快照，加入房间时携带
+	Status    DeviceStatus `json:"status,omitempty"` // 新状态，状态变化时携带
+	Error     string       `json:"error,omitempty"`  // 错误信息，错误活动携带
+}
@@ -0,0 +1,44 @@
+package model
+
+// AlertRuleType 告警规则类型
+type AlertRuleType string
+
+const (
+	AlertRuleCameraAbsent     AlertRuleType = "camera_absent"     // Camera离开房间超过指定时长
+	AlertRuleErrorStuck       AlertRuleType = "error_stuck"       // Camera处于错误状态超过指定时长
+	AlertRuleStreamingDropped AlertRuleType = "streaming_dropped" // Camera从传输中回落到就绪状态超过指定时长
+)
+
+// AlertRule 房间告警规则
+type AlertRule struct {
+	ID         string        `json:"id"`                  // 规则唯一标识
+	RoomID     string        `json:"roomId"`              // 所属房间ID
+	Type       AlertRuleType `json:"type"`                // 规则类型
+	DeviceID   string        `json:"deviceId,omitempty"`  // 监控的Camera设备ID，为空时对房间内出现过的所有Camera生效
+	Duration   int64         `json:"duration"`            // 条件持续多久后告警（秒）
+	Notifiers  []string      `json:"notifiers,omitempty"` // 使用的通知方式，如email、webhook，为空时使用所有已配置的通知方式
+	CreateTime int64         `json:"createTime"`          // 创建时间
+	UpdateTime int64         `json:"updateTime"`          // 更新时间
+}
+
+// AlertState 告警状态
+type AlertState string
+
+const (
+	AlertStateFiring   AlertState = "firing"   // 告警中
+	AlertStateResolved AlertState = "resolved" // 已恢复
+)
+
+// Alert 告警，同一规则和设备在恢复前只产生一条告警
+type Alert struct {
+	ID          string        `json:"id"`                    // 告警唯一标识
+	RuleID      string        `json:"ruleId"`                // 触发的规则ID
+	RoomID      string        `json:"roomId"`                // 房间ID
+	DeviceID    string        `json:"deviceId"`              // 设备ID
+	Type        AlertRuleType `json:"type"`                  // 规则类型
+	State       AlertState    `json:"state"`                 // 告警状态
+	Message     string        `json:"message"`               // 告警说明
+	Since       int64         `json:"since"`                 // 条件开始成立的时间
+	FireTime    int64         `json:"fireTime"`              // 告警触发时间
+	ResolveTime int64         `json:"resolveTime,omitempty"` // 告警恢复时间
+}
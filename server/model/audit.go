@@ -0,0 +1,37 @@
+package model
+
+// AuditDirection 审计记录的事件方向
+type AuditDirection string
+
+const (
+	AuditDirectionInbound  AuditDirection = "in"  // 设备发送给服务端的事件
+	AuditDirectionOutbound AuditDirection = "out" // 服务端发送给设备的事件
+)
+
+// AuditRecord 事件审计记录
+type AuditRecord struct {
+	Time      int64          `json:"time"`              // 记录时间（毫秒）
+	Direction AuditDirection `json:"direction"`         // 事件方向
+	RoomID    string         `json:"roomId"`            // 房间ID
+	DeviceID  string         `json:"deviceId"`          // 连接对应的设备ID：入站为发送方，出站为接收方
+	Event     *Event         `json:"event"`             // 事件内容，无法解析的入站消息为nil
+	Invalid   *AuditInvalid  `json:"invalid,omitempty"` // 无法解析的入站消息
+}
+
+// AuditInvalid 无法解析为事件的入站消息
+type AuditInvalid struct {
+	Error  string `json:"error"`  // 解析错误
+	Size   int    `json:"size"`   // 消息原始长度
+	Binary bool   `json:"binary"` // 是否为二进制帧，二进制帧的Raw为base64编码
+	Raw    string `json:"raw"`    // 消息内容，超出长度限制时截断
+}
+
+// AuditQuery 审计记录查询条件
+type AuditQuery struct {
+	RoomID    string      // 房间ID，必填
+	DeviceID  string      // 设备ID，为空表示不过滤
+	Types     []EventType // 事件类型，为空表示不过滤
+	StartTime int64       // 起始时间（毫秒，包含），为0表示不限制
+	EndTime   int64       // 结束时间（毫秒，不包含），为0表示不限制
+	Limit     int         // 最多返回的记录数量
+}
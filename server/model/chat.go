@@ -0,0 +1,76 @@
+package model
+
+import (
+	"sync"
+)
+
+// ChatHistorySize 每个房间保留的聊天消息数量
+const ChatHistorySize = 100
+
+// ChatMessage 聊天消息
+type ChatMessage struct {
+	ID             string `json:"id"`                       // 消息唯一标识
+	RoomID         string `json:"roomId"`                   // 所在房间ID
+	FromDeviceID   string `json:"fromDeviceId"`             // 发送设备ID
+	FromDeviceName string `json:"fromDeviceName,omitempty"` // 发送设备名称
+	TargetDeviceID string `json:"targetDeviceId,omitempty"` // 接收设备ID，为空表示发送给整个房间
+	Text           string `json:"text"`                     // 消息内容
+	Timestamp      int64  `json:"timestamp"`                // 服务端时间戳
+}
+
+// VisibleTo 判断消息对指定设备是否可见
+func (m *ChatMessage) VisibleTo(deviceID string) bool {
+	return m.TargetDeviceID == "" || m.TargetDeviceID == deviceID || m.FromDeviceID == deviceID
+}
+
+// ChatHistory 有界的房间聊天记录
+type ChatHistory struct {
+	mutex    sync.Mutex
+	capacity int            // 最多保留的消息数量
+	messages []*ChatMessage // 按时间顺序排列的消息
+}
+
+// NewChatHistory 创建聊天记录
+func NewChatHistory(capacity int) *ChatHistory {
+	return &ChatHistory{
+		capacity: capacity,
+		messages: make([]*ChatMessage, 0, capacity),
+	}
+}
+
+// Add 追加消息，超出容量时丢弃最早的消息
+func (h *ChatHistory) Add(message *ChatMessage) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// 超出容量时复制到新的切片，Messages返回的快照与之前的底层数组互不影响
+	if len(h.messages) >= h.capacity {
+		kept := make([]*ChatMessage, h.capacity-1, h.capacity)
+		copy(kept, h.messages[len(h.messages)-h.capacity+1:])
+		h.messages = kept
+	}
+	h.messages = append(h.messages, message)
+}
+
+// Messages 获取全部消息
+func (h *ChatHistory) Messages() []*ChatMessage {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return append([]*ChatMessage(nil), h.messages...)
+}
+
+// MessagesFor 获取对指定设备可见的消息
+func (h *ChatHistory) MessagesFor(deviceID string) []*ChatMessage {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	messages := make([]*ChatMessage, 0, len(h.messages))
+	for _, message := range h.messages {
+		if message.VisibleTo(deviceID) {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChatHistoryKeepsLatestMessages(t *testing.T) {
+	history := NewChatHistory(3)
+	for i := 0; i < 5; i++ {
+		history.Add(&ChatMessage{ID: fmt.Sprint(i)})
+	}
+
+	messages := history.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+	for i, message := range messages {
+		if want := fmt.Sprint(i + 2); message.ID != want {
+			t.Fatalf("messages[%d] = %s, want %s", i, message.ID, want)
+		}
+	}
+}
+
+// TestChatHistorySnapshotUnchanged 之后追加和裁剪消息不影响已返回的快照
+func TestChatHistorySnapshotUnchanged(t *testing.T) {
+	history := NewChatHistory(3)
+	for i := 0; i < 3; i++ {
+		history.Add(&ChatMessage{ID: fmt.Sprint(i)})
+	}
+	snapshot := history.Messages()
+	visible := history.MessagesFor("camera")
+
+	for i := 3; i < 6; i++ {
+		history.Add(&ChatMessage{ID: fmt.Sprint(i)})
+	}
+
+	for i, messages := range [][]*ChatMessage{snapshot, visible} {
+		for j, message := range messages {
+			if want := fmt.Sprint(j); message.ID != want {
+				t.Fatalf("snapshot %d: messages[%d] = %s, want %s", i, j, message.ID, want)
+			}
+		}
+	}
+}
+
+func TestChatMessageVisibleTo(t *testing.T) {
+	broadcast := &ChatMessage{FromDeviceID: "monitor"}
+	private := &ChatMessage{FromDeviceID: "monitor", TargetDeviceID: "camera-1"}
+
+	tests := []struct {
+		message  *ChatMessage
+		deviceID string
+		want     bool
+	}{
+		{broadcast, "camera-2", true},
+		{private, "camera-1", true},
+		{private, "monitor", true},
+		{private, "camera-2", false},
+	}
+	for _, tt := range tests {
+		if got := tt.message.VisibleTo(tt.deviceID); got != tt.want {
+			t.Errorf("VisibleTo(%s) on message to %q = %v, want %v", tt.deviceID, tt.message.TargetDeviceID, got, tt.want)
+		}
+	}
+}
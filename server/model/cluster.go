@@ -0,0 +1,19 @@
+package model
+
+// ClusterNode 集群节点信息
+type ClusterNode struct {
+	ID        string `json:"id"`            // 节点唯一标识
+	URL       string `json:"url,omitempty"` // 节点对外地址
+	Self      bool   `json:"self"`          // 是否为处理请求的节点
+	Devices   int    `json:"devices"`       // 节点上连接的设备数量
+	StartTime int64  `json:"startTime"`     // 节点启动时间
+	LastSeen  int64  `json:"lastSeen"`      // 最近一次收到该节点消息的时间
+}
+
+// RoomOwner 房间所属节点，集群部署时房间内的设备都连接到该节点
+type RoomOwner struct {
+	RoomID string `json:"roomId"`        // 房间ID
+	NodeID string `json:"nodeId"`        // 持有房间租约的节点ID
+	URL    string `json:"url,omitempty"` // 节点对外地址
+	Self   bool   `json:"self"`          // 是否为处理请求的节点
+}
@@ -25,6 +25,9 @@ const (
 
 	// Monitor 特有状态
 	DeviceStatusReceiving DeviceStatus = "receiving" // 接收中状态
+
+	// DeviceStatusLeft 已离开房间，仅出现在状态历史中
+	DeviceStatusLeft DeviceStatus = "left"
 )
 
 // Device 设备信息
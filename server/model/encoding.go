@@ -0,0 +1,151 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// WebSocket子协议，客户端通过Sec-WebSocket-Protocol选择事件编码，未指定时使用JSON
+const (
+	SubprotocolJSON    = "monitor.json"    // JSON文本帧
+	SubprotocolMsgpack = "monitor.msgpack" // MessagePack二进制帧
+)
+
+// Subprotocols 服务端支持的子协议，按优先级排列
+var Subprotocols = []string{SubprotocolMsgpack, SubprotocolJSON}
+
+// Encoding 事件在连接上的编码方式
+type Encoding string
+
+const (
+	EncodingJSON    Encoding = "json"    // JSON文本帧
+	EncodingMsgpack Encoding = "msgpack" // MessagePack二进制帧，负载为原生的map
+)
+
+// EncodingForSubprotocol 根据协商的子协议获取编码方式
+func EncodingForSubprotocol(subprotocol string) Encoding {
+	if subprotocol == SubprotocolMsgpack {
+		return EncodingMsgpack
+	}
+	return EncodingJSON
+}
+
+// msgpackEvent 事件的MessagePack结构，字段名与JSON一致，负载为原生值而不是JSON字符串
+type msgpackEvent struct {
+	Type      EventType         `msgpack:"type"`
+	RoomID    string            `msgpack:"roomId"`
+	DeviceID  string            `msgpack:"deviceId"`
+	Timestamp int64             `msgpack:"timestamp"`
+	Payload   interface{}       `msgpack:"payload"`
+	Trace     map[string]string `msgpack:"trace,omitempty"`
+}
+
+// EncodeEvent 按编码方式序列化事件，返回WebSocket帧类型和数据
+func EncodeEvent(encoding Encoding, event *Event) (int, []byte, error) {
+	if encoding != EncodingMsgpack {
+		data, err := json.Marshal(event)
+		return websocket.TextMessage, data, err
+	}
+
+	var payload interface{}
+	if len(event.Payload) > 0 {
+		// 整数保持为整数，避免时间戳等字段被编码为浮点数
+		decoder := json.NewDecoder(bytes.NewReader(event.Payload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&payload); err != nil {
+			return 0, nil, err
+		}
+		payload = fromJSONNumbers(payload)
+	}
+
+	data, err := msgpack.Marshal(&msgpackEvent{
+		Type:      event.Type,
+		RoomID:    event.RoomID,
+		DeviceID:  event.DeviceID,
+		Timestamp: event.Timestamp,
+		Payload:   payload,
+		Trace:     event.Trace,
+	})
+	return websocket.BinaryMessage, data, err
+}
+
+// DecodeEvent 按帧类型解析客户端发送的事件：文本帧为JSON，二进制帧为MessagePack，
+// 负载统一转换为JSON，服务内部的处理与编码无关
+func DecodeEvent(messageType int, data []byte) (*Event, error) {
+	var event Event
+	if messageType != websocket.BinaryMessage {
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, err
+		}
+		return &event, nil
+	}
+
+	var decoded msgpackEvent
+	if err := msgpack.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+
+	event = Event{
+		Type:      decoded.Type,
+		RoomID:    decoded.RoomID,
+		DeviceID:  decoded.DeviceID,
+		Timestamp: decoded.Timestamp,
+		Trace:     decoded.Trace,
+	}
+	if decoded.Payload != nil {
+		payload, err := json.Marshal(toJSONValue(decoded.Payload))
+		if err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+	}
+
+	return &event, nil
+}
+
+// fromJSONNumbers 将json.Number转换为int64或float64
+func fromJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = fromJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromJSONNumbers(item)
+		}
+	}
+	return value
+}
+
+// toJSONValue 将MessagePack解析出的值转换为可以序列化为JSON的值，非字符串的map键不被支持
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = toJSONValue(item)
+		}
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if name, ok := key.(string); ok {
+				converted[name] = toJSONValue(item)
+			}
+		}
+		return converted
+	case []interface{}:
+		for i, item := range v {
+			v[i] = toJSONValue(item)
+		}
+	}
+	return value
+}
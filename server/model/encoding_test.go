@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestEncodingForSubprotocol(t *testing.T) {
+	tests := map[string]Encoding{
+		SubprotocolMsgpack: EncodingMsgpack,
+		SubprotocolJSON:    EncodingJSON,
+		"":                 EncodingJSON,
+		"unknown":          EncodingJSON,
+	}
+	for subprotocol, want := range tests {
+		if got := EncodingForSubprotocol(subprotocol); got != want {
+			t.Errorf("EncodingForSubprotocol(%q) = %s, want %s", subprotocol, got, want)
+		}
+	}
+}
+
+func TestMsgpackEventRoundTrip(t *testing.T) {
+	payload, _ := json.Marshal(&WebRTCIceCandidatePayload{
+		TargetDeviceID: "monitor-1",
+		Candidate:      "candidate:1 1 udp 2122260223 10.0.0.1 54321 typ host",
+		SdpMid:         "0",
+		SdpMLineIndex:  1,
+	})
+	event := &Event{
+		Type:      EventTypeIceCandidate,
+		RoomID:    "room",
+		DeviceID:  "camera-1",
+		Timestamp: 1700000000123,
+		Payload:   payload,
+		Trace:     map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}
+
+	messageType, data, err := EncodeEvent(EncodingMsgpack, event)
+	if err != nil {
+		t.Fatalf("EncodeEvent: %v", err)
+	}
+	if messageType != websocket.BinaryMessage {
+		t.Fatalf("message type = %d, want binary", messageType)
+	}
+
+	// 负载是原生的map，整数不被编码为浮点数
+	var raw map[string]interface{}
+	if err := msgpack.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("msgpack.Unmarshal: %v", err)
+	}
+	index := raw["payload"].(map[string]interface{})["sdpMLineIndex"]
+	if _, isFloat := index.(float64); isFloat {
+		t.Fatalf("sdpMLineIndex encoded as float: %v", index)
+	}
+
+	decoded, err := DecodeEvent(messageType, data)
+	if err != nil {
+		t.Fatalf("DecodeEvent: %v", err)
+	}
+	if decoded.Type != event.Type || decoded.RoomID != event.RoomID || decoded.DeviceID != event.DeviceID ||
+		decoded.Timestamp != event.Timestamp || decoded.Trace["traceparent"] != event.Trace["traceparent"] {
+		t.Fatalf("decoded event = %+v, want %+v", decoded, event)
+	}
+	var candidate WebRTCIceCandidatePayload
+	if err := decoded.ParsePayload(&candidate); err != nil {
+		t.Fatalf("ParsePayload: %v", err)
+	}
+	if candidate.TargetDeviceID != "monitor-1" || candidate.SdpMLineIndex != 1 || candidate.SdpMid != "0" {
+		t.Fatalf("decoded payload = %+v", candidate)
+	}
+}
+
+func TestDecodeEventTextFrameIsJSON(t *testing.T) {
+	event, err := DecodeEvent(websocket.TextMessage, []byte(`{"type":"camera_ready","roomId":"room","deviceId":"camera-1","payload":{"targetDeviceId":"monitor-1"}}`))
+	if err != nil {
+		t.Fatalf("DecodeEvent: %v", err)
+	}
+	var payload ReadyPayload
+	if err := event.ParsePayload(&payload); err != nil || event.Type != EventTypeCameraReady || payload.TargetDeviceID != "monitor-1" {
+		t.Fatalf("decoded event = %+v, payload %+v, %v", event, payload, err)
+	}
+
+	if _, err := DecodeEvent(websocket.BinaryMessage, []byte("not msgpack")); err == nil {
+		t.Fatal("DecodeEvent accepted an invalid MessagePack frame")
+	}
+}
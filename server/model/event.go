@@ -18,10 +18,33 @@ const (
 	EventTypeMonitorReady EventType = "monitor_ready" // Monitor设备准备就绪
 	EventTypeError        EventType = "error"         // 错误事件
 
+	EventTypeServerShutdown EventType = "server_shutdown" // 服务即将关闭，设备应在建议的延迟后重连
+
 	// WebRTC相关事件
 	EventTypeOffer        EventType = "offer"         // Offer
 	EventTypeAnswer       EventType = "answer"        // Answer
 	EventTypeIceCandidate EventType = "ice_candidate" // ICE Candidate
+	EventTypeRenegotiate  EventType = "renegotiate"   // 在已建立的连接上重新协商（增减轨道等）
+	EventTypeIceRestart   EventType = "ice_restart"   // ICE重启（网络切换后恢复连接）
+
+	EventTypeNegotiationTimeout EventType = "negotiation_timeout" // 重新协商/ICE重启超时未收到应答
+
+	// 质量统计相关事件
+	EventTypeStatsReport EventType = "stats_report" // 设备定期上报WebRTC统计数据
+	EventTypeQuality     EventType = "quality"      // 服务端向Monitor推送连接质量
+
+	// 布局相关事件
+	EventTypeLayoutChanged EventType = "layout_changed" // 房间布局变更
+
+	// 聊天相关事件
+	EventTypeChatMessage EventType = "chat_message" // 文字聊天消息
+
+	// 对讲相关事件
+	EventTypeTalkbackRequest EventType = "talkback_request" // Monitor请求对某个Camera讲话
+	EventTypeTalkbackStart   EventType = "talkback_start"   // 对讲开始，Monitor需发起renegotiate添加音频
+	EventTypeTalkbackActive  EventType = "talkback_active"  // 音频重新协商完成，对讲生效
+	EventTypeTalkbackStop    EventType = "talkback_stop"    // Monitor结束对讲
+	EventTypeTalkbackEnd     EventType = "talkback_end"     // 对讲已结束
 )
 
 // Event 事件基础结构
@@ -31,13 +54,24 @@ type Event struct {
 	DeviceID  string          `json:"deviceId"`  // 发送事件的设备ID
 	Timestamp int64           `json:"timestamp"` // 事件时间戳
 	Payload   json.RawMessage `json:"payload"`   // 事件负载数据，根据事件类型不同而不同
+
+	Trace map[string]string `json:"trace,omitempty"` // 链路追踪上下文（W3C Trace Context），应答事件原样带回即可关联到同一条链路
 }
 
 // 各种事件的Payload结构定义
 
+// 错误码，客户端可据此区分需要特殊处理的错误
+const (
+	ErrorCodeRateLimited     = "rate_limited"      // 事件发送过于频繁，已被丢弃
+	ErrorCodeMessageTooLarge = "message_too_large" // 事件内容超过长度限制，已被丢弃
+)
+
 // ErrorPayload 错误事件负载
 type ErrorPayload struct {
-	Error string `json:"error"` // 错误信息
+	Error      string    `json:"error"`                // 错误信息
+	Code       string    `json:"code,omitempty"`       // 错误码
+	EventType  EventType `json:"eventType,omitempty"`  // 被拒绝的事件类型
+	RetryAfter int64     `json:"retryAfter,omitempty"` // 建议的重试等待时间（毫秒），仅rate_limited携带
 }
 
 // NewErrorEvent 创建一个错误事件
@@ -56,10 +90,27 @@ func NewErrorEvent(roomID, deviceID string, err error) *Event {
 	}
 }
 
+// ServerShutdownPayload 服务关闭事件负载
+type ServerShutdownPayload struct {
+	ReconnectDelay int64  `json:"reconnectDelay"`        // 建议的重连延迟（毫秒），每个设备随机错开
+	Handoff        bool   `json:"handoff,omitempty"`     // 服务正在交接给新进程，携带resumeToken重连可恢复设备状态
+	ResumeToken    string `json:"resumeToken,omitempty"` // 交接后重连时携带的恢复凭证，只能使用一次，恢复窗口结束后过期
+}
+
 // ConnectPayload 连接事件负载
 type ConnectPayload struct {
-	Device  *Device   `json:"device"`  // 设备信息
-	Devices []*Device `json:"devices"` // 房间设备信息
+	Device     *Device        `json:"device"`               // 设备信息
+	Devices    []*Device      `json:"devices"`              // 房间设备信息
+	Messages   []*ChatMessage `json:"messages"`             // 对该设备可见的聊天记录
+	ICEServers []ICEServer    `json:"iceServers,omitempty"` // 建立WebRTC连接使用的ICE服务器，未配置时由客户端决定
+	Resumed    bool           `json:"resumed,omitempty"`    // 是否恢复了交接前的设备状态，此时不会广播join_room
+}
+
+// ICEServer WebRTC的ICE服务器，字段与浏览器的RTCIceServer一致
+type ICEServer struct {
+	URLs       []string `json:"urls" yaml:"urls"`
+	Username   string   `json:"username,omitempty" yaml:"username"`
+	Credential string   `json:"credential,omitempty" yaml:"credential"`
 }
 
 // JoinRoomPayload 加入房间事件负载
@@ -97,6 +148,76 @@ type WebRTCIceCandidatePayload struct {
 	SdpMLineIndex  int    `json:"sdpMLineIndex"`  // SDP媒体行索引
 }
 
+// LayoutAction 布局变更类型
+type LayoutAction string
+
+const (
+	LayoutActionCreated LayoutAction = "created" // 新建布局
+	LayoutActionUpdated LayoutAction = "updated" // 更新布局
+	LayoutActionDeleted LayoutAction = "deleted" // 删除布局
+)
+
+// LayoutChangedPayload 布局变更事件负载
+type LayoutChangedPayload struct {
+	Action LayoutAction `json:"action"` // 变更类型
+	Layout *Layout      `json:"layout"` // 变更后的布局，删除时为被删除的布局
+}
+
+// ChatMessagePayload 聊天消息事件负载
+// 客户端发送时只需填写TargetDeviceID和Text，服务端转发时补全Message
+type ChatMessagePayload struct {
+	TargetDeviceID string       `json:"targetDeviceId,omitempty"` // 目标设备ID，为空表示发送给整个房间
+	Text           string       `json:"text,omitempty"`           // 消息内容
+	Message        *ChatMessage `json:"message,omitempty"`        // 服务端生成的完整消息
+}
+
+// TalkbackRequestPayload 对讲请求/结束事件负载
+type TalkbackRequestPayload struct {
+	TargetDeviceID string `json:"targetDeviceId"` // 对讲的Camera设备ID
+}
+
+// TalkbackSessionPayload 对讲开始/生效/结束事件负载
+type TalkbackSessionPayload struct {
+	Session *TalkbackSession `json:"session"`          // 对讲会话
+	Reason  string           `json:"reason,omitempty"` // 结束原因，仅talkback_end事件携带
+}
+
+// StatsReportPayload 统计上报事件负载
+type StatsReportPayload struct {
+	TargetDeviceID    string  `json:"targetDeviceId"`              // 对端设备ID
+	Bitrate           int64   `json:"bitrate"`                     // 码率（bps）
+	PacketLoss        float64 `json:"packetLoss"`                  // 丢包率，0-1
+	RTT               float64 `json:"rtt"`                         // 往返时延（毫秒）
+	FramesDecoded     int64   `json:"framesDecoded,omitempty"`     // 已解码帧数
+	CandidatePairType string  `json:"candidatePairType,omitempty"` // 当前候选对类型
+}
+
+// QualityPayload 连接质量事件负载
+type QualityPayload struct {
+	Quality *PairQuality `json:"quality"` // 连接质量，不包含历史记录
+}
+
+// NegotiationSDPType 重新协商消息中的SDP类型
+type NegotiationSDPType string
+
+const (
+	NegotiationSDPOffer  NegotiationSDPType = "offer"  // 发起方的Offer
+	NegotiationSDPAnswer NegotiationSDPType = "answer" // 应答方的Answer
+)
+
+// WebRTCNegotiationPayload 重新协商/ICE重启事件负载
+type WebRTCNegotiationPayload struct {
+	TargetDeviceID string             `json:"targetDeviceId"` // 目标设备ID
+	SDPType        NegotiationSDPType `json:"sdpType"`        // SDP类型
+	SDP            string             `json:"sdp"`            // SDP描述
+}
+
+// NegotiationTimeoutPayload 协商超时事件负载
+type NegotiationTimeoutPayload struct {
+	TargetDeviceID string    `json:"targetDeviceId"` // 未应答的设备ID
+	Kind           EventType `json:"kind"`           // 超时的协商类型：renegotiate或ice_restart
+}
+
 // 辅助方法：根据事件类型解析Payload
 func (e *Event) ParsePayload(v interface{}) error {
 	return json.Unmarshal(e.Payload, v)
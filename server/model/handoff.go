@@ -0,0 +1,22 @@
+package model
+
+// HandoffStateVersion 交接状态的格式版本，新进程不认识的版本不会被恢复
+const HandoffStateVersion = 1
+
+// HandoffState 交接给新进程的状态
+type HandoffState struct {
+	Version      int             `json:"version"`
+	ResumeSecret []byte          `json:"resumeSecret"` // 签发恢复凭证的密钥，新进程沿用以校验旧进程签发的凭证
+	Rooms        []*RoomSnapshot `json:"rooms"`
+	CreateTime   int64           `json:"createTime"`
+}
+
+// RoomSnapshot 房间快照
+type RoomSnapshot struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	CreateTime int64          `json:"createTime"`
+	UpdateTime int64          `json:"updateTime"`
+	Devices    []*Device      `json:"devices"`
+	Messages   []*ChatMessage `json:"messages"`
+}
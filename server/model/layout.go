@@ -0,0 +1,42 @@
+package model
+
+// LayoutGrid 布局网格类型
+type LayoutGrid string
+
+const (
+	LayoutGrid1x1 LayoutGrid = "1x1" // 单画面
+	LayoutGrid2x2 LayoutGrid = "2x2" // 四宫格
+	LayoutGrid3x3 LayoutGrid = "3x3" // 九宫格
+)
+
+// CellCount 返回网格的格子数量，未知网格返回0
+func (g LayoutGrid) CellCount() int {
+	switch g {
+	case LayoutGrid1x1:
+		return 1
+	case LayoutGrid2x2:
+		return 4
+	case LayoutGrid3x3:
+		return 9
+	default:
+		return 0
+	}
+}
+
+// LayoutCell 布局中的一个格子
+type LayoutCell struct {
+	Index      int    `json:"index"`                // 格子序号，从0开始，按行优先排列
+	DeviceID   string `json:"deviceId,omitempty"`   // 绑定的设备ID
+	DeviceName string `json:"deviceName,omitempty"` // 绑定的设备名称，设备ID为空时按名称匹配
+}
+
+// Layout 监控端布局
+type Layout struct {
+	ID         string       `json:"id"`         // 布局唯一标识
+	RoomID     string       `json:"roomId"`     // 所属房间ID
+	Name       string       `json:"name"`       // 布局名称
+	Grid       LayoutGrid   `json:"grid"`       // 网格类型
+	Cells      []LayoutCell `json:"cells"`      // 格子与设备的映射
+	CreateTime int64        `json:"createTime"` // 创建时间
+	UpdateTime int64        `json:"updateTime"` // 更新时间
+}
@@ -0,0 +1,34 @@
+package model
+
+// QualityLevel 连接质量等级
+type QualityLevel string
+
+const (
+	QualityLevelGood    QualityLevel = "good"    // 良好
+	QualityLevelFair    QualityLevel = "fair"    // 一般
+	QualityLevelPoor    QualityLevel = "poor"    // 较差
+	QualityLevelUnknown QualityLevel = "unknown" // 尚无统计数据
+)
+
+// StatsReport 设备上报的WebRTC统计数据
+type StatsReport struct {
+	ReporterID        string  `json:"reporterId"`                  // 上报设备ID
+	Bitrate           int64   `json:"bitrate"`                     // 码率（bps），Camera为发送码率，Monitor为接收码率
+	PacketLoss        float64 `json:"packetLoss"`                  // 丢包率，0-1
+	RTT               float64 `json:"rtt"`                         // 往返时延（毫秒）
+	FramesDecoded     int64   `json:"framesDecoded,omitempty"`     // 已解码帧数，Monitor上报
+	CandidatePairType string  `json:"candidatePairType,omitempty"` // 当前候选对类型：host、srflx、prflx、relay
+	Timestamp         int64   `json:"timestamp"`                   // 服务端接收时间
+}
+
+// PairQuality 一对Camera与Monitor之间的连接质量
+type PairQuality struct {
+	RoomID     string         `json:"roomId"`            // 房间ID
+	CameraID   string         `json:"cameraId"`          // Camera设备ID
+	MonitorID  string         `json:"monitorId"`         // Monitor设备ID
+	Level      QualityLevel   `json:"level"`             // 综合质量等级
+	Camera     *StatsReport   `json:"camera,omitempty"`  // Camera最近一次上报
+	Monitor    *StatsReport   `json:"monitor,omitempty"` // Monitor最近一次上报
+	History    []*StatsReport `json:"history,omitempty"` // 最近的上报记录，按时间顺序
+	UpdateTime int64          `json:"updateTime"`        // 更新时间
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"encoding/json"
+	"errors"
 	"sync"
 
 	"github.com/gorilla/websocket"
@@ -9,18 +11,36 @@ import (
 // DeviceConnection 设备连接信息
 type DeviceConnection struct {
 	Device *Device   // 设备信息
-	Conn   *SafeConn // 安全的WebSocket连接
+	Conn   *SafeConn // 安全的WebSocket连接，从交接状态恢复、等待重新连接的设备为nil
 }
 
-// Room 房间信息
+// ErrRoomClosed 房间已因设备全部离开而关闭，需要重新获取房间
+var ErrRoomClosed = errors.New("房间已关闭")
+
+// ErrRoomHasMonitor 房间已有Monitor设备
+var ErrRoomHasMonitor = errors.New("房间已有Monitor设备")
+
+// ErrDeviceNotPending 设备不在等待恢复连接的状态
+var ErrDeviceNotPending = errors.New("设备不在等待恢复连接")
+
+// ErrDeviceReplaced 设备已由同ID的新连接替换，旧连接不能再移除设备
+var ErrDeviceReplaced = errors.New("设备已由新的连接替换")
+
+// Room 房间信息。房间内的设备信息发布后不再修改，更新时替换为新的副本，
+// 因此返回的设备可以在不持有房间锁的情况下读取和序列化
 type Room struct {
 	ID         string `json:"id"`         // 房间唯一标识
 	Name       string `json:"name"`       // 房间名称
 	CreateTime int64  `json:"createTime"` // 创建时间
-	UpdateTime int64  `json:"updateTime"` // 更新时间
+	UpdateTime int64  `json:"updateTime"` // 更新时间，房间创建后由mutex保护
 
-	// 新增字段
-	deviceConns sync.Map // 设备连接映射表，key为deviceID，value为DeviceConnection
+	// 设备连接及其索引，均由mutex保护，按类型和状态查询时不需要遍历全部设备
+	mutex       sync.RWMutex
+	deviceConns map[string]*DeviceConnection                  // 设备连接映射表，key为deviceID
+	byType      map[DeviceType]map[string]*DeviceConnection   // 按设备类型索引
+	byStatus    map[DeviceStatus]map[string]*DeviceConnection // 按设备状态索引
+	closed      bool                                          // 设备全部离开后关闭，不再接受加入
+	chatHistory *ChatHistory                                  // 房间聊天记录
 }
 
 // NewRoom 创建新房间
@@ -30,109 +50,351 @@ func NewRoom(id string, name string, createTime int64) *Room {
 		Name:        name,
 		CreateTime:  createTime,
 		UpdateTime:  createTime,
-		deviceConns: sync.Map{},
+		deviceConns: make(map[string]*DeviceConnection),
+		byType:      make(map[DeviceType]map[string]*DeviceConnection),
+		byStatus:    make(map[DeviceStatus]map[string]*DeviceConnection),
+		chatHistory: NewChatHistory(ChatHistorySize),
 	}
 }
 
-// AddDevice 添加设备到房间
-func (r *Room) AddDevice(device *Device, conn *websocket.Conn) {
-	// 存储设备连接信息
-	r.deviceConns.Store(device.ID, &DeviceConnection{
-		Device: device,
+// MarshalJSON 在读锁内序列化房间信息，UpdateTime随设备加入和离开并发修改
+func (r *Room) MarshalJSON() ([]byte, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return json.Marshal(struct {
+		ID         string `json:"id"`
+		Name       string `json:"name"`
+		CreateTime int64  `json:"createTime"`
+		UpdateTime int64  `json:"updateTime"`
+	}{r.ID, r.Name, r.CreateTime, r.UpdateTime})
+}
+
+// LastUpdateTime 获取房间的更新时间
+func (r *Room) LastUpdateTime() int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.UpdateTime
+}
+
+// JoinDevice 设备加入房间，Monitor唯一性检查和加入在同一把锁内完成，
+// 同时加入的两个Monitor只有一个成功；同ID的设备重新加入时替换原有连接
+func (r *Room) JoinDevice(device *Device, conn *websocket.Conn, now int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return ErrRoomClosed
+	}
+	// 交接后等待恢复的设备没有携带凭证重新加入时，按新设备替换原来的记录
+	existing, exists := r.deviceConns[device.ID]
+	pending := exists && existing.Conn == nil
+	if device.Type == DeviceTypeMonitor && len(r.byType[DeviceTypeMonitor]) > 0 && !pending {
+		return ErrRoomHasMonitor
+	}
+
+	device.Status = DeviceStatusConnected
+	device.RoomID = r.ID
+	device.CreateTime = now
+	device.UpdateTime = now
+
+	// 关闭被替换的连接，其读循环退出后不会再以该设备的身份发送事件
+	if exists && existing.Conn != nil && existing.Conn.GetConn() != nil && existing.Conn.GetConn() != conn {
+		existing.Conn.GetConn().Close()
+	}
+	r.removeLocked(device.ID)
+	stored := *device
+	deviceConn := &DeviceConnection{
+		Device: &stored,
 		Conn:   NewSafeConn(conn),
-	})
+	}
+	r.deviceConns[device.ID] = deviceConn
+	addIndex(r.byType, device.Type, deviceConn)
+	addIndex(r.byStatus, device.Status, deviceConn)
+	r.UpdateTime = now
+
+	return nil
 }
 
 // GetConnection 获取设备连接
 func (r *Room) GetConnection(deviceID string) (*SafeConn, bool) {
-	value, exists := r.deviceConns.Load(deviceID)
-	if !exists {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	deviceConn, exists := r.deviceConns[deviceID]
+	if !exists || deviceConn.Conn == nil {
 		return nil, false
 	}
-
-	deviceConn := value.(*DeviceConnection)
 	return deviceConn.Conn, true
 }
 
-// RemoveDevice 从房间移除设备
-func (r *Room) RemoveDevice(deviceID string) {
-	// 从设备连接映射表中删除
-	r.deviceConns.Delete(deviceID)
+// RestoreDevice 恢复交接前的设备，设备保留原有状态，在ResumeDevice之前没有连接
+func (r *Room) RestoreDevice(device *Device) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.removeLocked(device.ID)
+	stored := *device
+	deviceConn := &DeviceConnection{Device: &stored}
+	r.deviceConns[device.ID] = deviceConn
+	addIndex(r.byType, device.Type, deviceConn)
+	addIndex(r.byStatus, device.Status, deviceConn)
+}
+
+// ResumeDevice 为等待恢复的设备绑定新的连接，设备状态保持不变
+func (r *Room) ResumeDevice(deviceID string, conn *websocket.Conn, now int64) (*Device, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return nil, ErrRoomClosed
+	}
+	deviceConn, exists := r.deviceConns[deviceID]
+	if !exists || deviceConn.Conn != nil {
+		return nil, ErrDeviceNotPending
+	}
+
+	device := deviceConn.copyDevice()
+	device.UpdateTime = now
+	deviceConn.Device = device
+	deviceConn.Conn = NewSafeConn(conn)
+	r.UpdateTime = now
+	return device, nil
+}
+
+// RemovePendingDevices 移除仍在等待恢复连接的设备，返回被移除的设备，以及房间是否因此关闭
+func (r *Room) RemovePendingDevices(now int64) ([]*Device, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	removed := make([]*Device, 0)
+	for deviceID, deviceConn := range r.deviceConns {
+		if deviceConn.Conn == nil {
+			removed = append(removed, deviceConn.Device)
+			r.removeLocked(deviceID)
+		}
+	}
+
+	if len(removed) > 0 {
+		r.UpdateTime = now
+		if len(r.deviceConns) == 0 {
+			r.closed = true
+		}
+	}
+	return removed, r.closed
+}
+
+// Snapshot 导出房间、设备和聊天记录，用于交接给新进程
+func (r *Room) Snapshot() *RoomSnapshot {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	devices := make([]*Device, 0, len(r.deviceConns))
+	for _, deviceConn := range r.deviceConns {
+		devices = append(devices, deviceConn.copyDevice())
+	}
+
+	return &RoomSnapshot{
+		ID:         r.ID,
+		Name:       r.Name,
+		CreateTime: r.CreateTime,
+		UpdateTime: r.UpdateTime,
+		Devices:    devices,
+		Messages:   r.chatHistory.Messages(),
+	}
+}
+
+// IsClosed 房间是否已关闭
+func (r *Room) IsClosed() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.closed
+}
+
+// RemoveDevice 从房间移除设备，房间内已没有设备时关闭房间并返回true。
+// conn不为nil时只移除使用该连接的设备，同ID的设备已重新加入时返回ErrDeviceReplaced
+func (r *Room) RemoveDevice(deviceID string, conn *websocket.Conn, now int64) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if deviceConn, exists := r.deviceConns[deviceID]; exists && conn != nil &&
+		(deviceConn.Conn == nil || deviceConn.Conn.GetConn() != conn) {
+		return r.closed, ErrDeviceReplaced
+	}
+
+	r.removeLocked(deviceID)
+	r.UpdateTime = now
+
+	if len(r.deviceConns) == 0 {
+		r.closed = true
+	}
+	return r.closed, nil
+}
+
+// removeLocked 从映射表和索引中删除设备，调用方需持有写锁
+func (r *Room) removeLocked(deviceID string) {
+	deviceConn, exists := r.deviceConns[deviceID]
+	if !exists {
+		return
+	}
+
+	delete(r.deviceConns, deviceID)
+	removeIndex(r.byType, deviceConn.Device.Type, deviceID)
+	removeIndex(r.byStatus, deviceConn.Device.Status, deviceID)
+}
+
+// SetDeviceStatus 更新设备状态并维护状态索引
+func (r *Room) SetDeviceStatus(deviceID string, status DeviceStatus, now int64) (*Device, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deviceConn, exists := r.deviceConns[deviceID]
+	if !exists {
+		return nil, false
+	}
+
+	removeIndex(r.byStatus, deviceConn.Device.Status, deviceID)
+	device := deviceConn.copyDevice()
+	device.Status = status
+	device.UpdateTime = now
+	deviceConn.Device = device
+	addIndex(r.byStatus, status, deviceConn)
+
+	return device, true
 }
 
 // GetDevice 获取设备信息
 func (r *Room) GetDevice(deviceID string) (*Device, bool) {
-	value, exists := r.deviceConns.Load(deviceID)
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	deviceConn, exists := r.deviceConns[deviceID]
 	if !exists {
 		return nil, false
 	}
-
-	deviceConn := value.(*DeviceConnection)
 	return deviceConn.Device, true
 }
 
 // GetAllDevices 获取所有设备
 func (r *Room) GetAllDevices() []*Device {
-	devices := make([]*Device, 0)
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return indexDevices(r.deviceConns)
+}
 
-	// 遍历所有设备连接，提取设备信息
-	r.deviceConns.Range(func(key, value interface{}) bool {
-		deviceConn := value.(*DeviceConnection)
-		devices = append(devices, deviceConn.Device)
-		return true
-	})
+// DeviceCount 获取设备数量
+func (r *Room) DeviceCount() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 
-	return devices
+	return len(r.deviceConns)
 }
 
 // GetCameras 获取所有Camera设备
 func (r *Room) GetCameras() []*Device {
-	cameras := make([]*Device, 0)
+	return r.GetDevicesByType(DeviceTypeCamera)
+}
 
-	// 遍历所有设备连接，筛选Camera类型设备
-	r.deviceConns.Range(func(key, value interface{}) bool {
-		deviceConn := value.(*DeviceConnection)
-		if deviceConn.Device.Type == DeviceTypeCamera {
-			cameras = append(cameras, deviceConn.Device)
-		}
-		return true
-	})
+// GetDevicesByType 获取指定类型的设备
+func (r *Room) GetDevicesByType(deviceType DeviceType) []*Device {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return indexDevices(r.byType[deviceType])
+}
+
+// GetDevicesByStatus 获取指定状态的设备
+func (r *Room) GetDevicesByStatus(status DeviceStatus) []*Device {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return indexDevices(r.byStatus[status])
+}
+
+// CountDevices 按设备类型和状态统计设备数量
+func (r *Room) CountDevices() map[DeviceType]map[DeviceStatus]int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 
-	return cameras
+	counts := make(map[DeviceType]map[DeviceStatus]int, len(r.byType))
+	for status, index := range r.byStatus {
+		for _, deviceConn := range index {
+			byStatus, exists := counts[deviceConn.Device.Type]
+			if !exists {
+				byStatus = make(map[DeviceStatus]int)
+				counts[deviceConn.Device.Type] = byStatus
+			}
+			byStatus[status]++
+		}
+	}
+	return counts
 }
 
 // GetMonitor 获取Monitor设备
 func (r *Room) GetMonitor() (*Device, bool) {
-	var monitor *Device
-	found := false
-
-	// 遍历所有设备连接，查找Monitor类型设备
-	r.deviceConns.Range(func(key, value interface{}) bool {
-		deviceConn := value.(*DeviceConnection)
-		if deviceConn.Device.Type == DeviceTypeMonitor {
-			monitor = deviceConn.Device
-			found = true
-			return false // 找到后停止遍历
-		}
-		return true
-	})
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 
-	return monitor, found
+	for _, deviceConn := range r.byType[DeviceTypeMonitor] {
+		return deviceConn.Device, true
+	}
+	return nil, false
 }
 
 // HasMonitor 检查是否有Monitor设备
 func (r *Room) HasMonitor() bool {
-	hasMonitor := false
-
-	// 遍历所有设备连接，检查是否有Monitor类型设备
-	r.deviceConns.Range(func(key, value interface{}) bool {
-		deviceConn := value.(*DeviceConnection)
-		if deviceConn.Device.Type == DeviceTypeMonitor {
-			hasMonitor = true
-			return false // 找到后停止遍历
-		}
-		return true
-	})
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.byType[DeviceTypeMonitor]) > 0
+}
+
+// addIndex 将设备加入索引
+func addIndex[K comparable](index map[K]map[string]*DeviceConnection, key K, deviceConn *DeviceConnection) {
+	devices, exists := index[key]
+	if !exists {
+		devices = make(map[string]*DeviceConnection)
+		index[key] = devices
+	}
+	devices[deviceConn.Device.ID] = deviceConn
+}
+
+// removeIndex 从索引中删除设备，分组为空时删除分组
+func removeIndex[K comparable](index map[K]map[string]*DeviceConnection, key K, deviceID string) {
+	devices, exists := index[key]
+	if !exists {
+		return
+	}
+	delete(devices, deviceID)
+	if len(devices) == 0 {
+		delete(index, key)
+	}
+}
+
+// indexDevices 提取索引分组中的设备
+func indexDevices(devices map[string]*DeviceConnection) []*Device {
+	result := make([]*Device, 0, len(devices))
+	for _, deviceConn := range devices {
+		result = append(result, deviceConn.Device)
+	}
+	return result
+}
+
+// copyDevice 复制设备信息用于修改，调用方需持有房间的写锁
+func (c *DeviceConnection) copyDevice() *Device {
+	device := *c.Device
+	return &device
+}
+
+// AddChatMessage 记录聊天消息
+func (r *Room) AddChatMessage(message *ChatMessage) {
+	r.chatHistory.Add(message)
+}
 
-	return hasMonitor
+// GetChatMessages 获取对指定设备可见的聊天记录
+func (r *Room) GetChatMessages(deviceID string) []*ChatMessage {
+	return r.chatHistory.MessagesFor(deviceID)
 }
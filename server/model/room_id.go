@@ -0,0 +1,24 @@
+package model
+
+import (
+	"unicode/utf8"
+)
+
+// MaxRoomIDLength 房间ID的最大长度
+const MaxRoomIDLength = 64
+
+// ValidRoomID 检查房间ID是否有效。WebSocket连接和各房间接口使用相同的规则：
+// 长度不超过MaxRoomIDLength，不含路径分隔符和控制字符，且不能是"."或".."
+func ValidRoomID(roomID string) bool {
+	if roomID == "" || len(roomID) > MaxRoomIDLength || roomID == "." || roomID == ".." {
+		return false
+	}
+
+	for _, r := range roomID {
+		if r == '/' || r == '\\' || r < 0x20 || r == 0x7f || r == utf8.RuneError {
+			return false
+		}
+	}
+
+	return true
+}
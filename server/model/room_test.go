@@ -0,0 +1,315 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// benchmarkDevices 基准测试中每个房间的设备数量
+const benchmarkDevices = 5000
+
+// newBenchmarkRoom 创建包含一个Monitor和指定数量Camera的房间
+func newBenchmarkRoom(b *testing.B, cameras int) *Room {
+	b.Helper()
+
+	room := NewRoom("bench", "bench", 0)
+	if err := room.JoinDevice(&Device{ID: "monitor", Type: DeviceTypeMonitor}, nil, 0); err != nil {
+		b.Fatalf("join monitor: %v", err)
+	}
+	for i := 0; i < cameras; i++ {
+		device := &Device{ID: fmt.Sprintf("camera-%d", i), Type: DeviceTypeCamera}
+		if err := room.JoinDevice(device, nil, 0); err != nil {
+			b.Fatalf("join camera: %v", err)
+		}
+	}
+	return room
+}
+
+// baselineRoom 按设备索引之前的实现遍历sync.Map查询设备，作为基准测试的对照
+type baselineRoom struct {
+	deviceConns sync.Map
+}
+
+// newBaselineRoom 创建与newBenchmarkRoom设备相同的对照房间
+func newBaselineRoom(cameras int) *baselineRoom {
+	room := &baselineRoom{}
+	room.add(&Device{ID: "monitor", Type: DeviceTypeMonitor})
+	for i := 0; i < cameras; i++ {
+		room.add(&Device{ID: fmt.Sprintf("camera-%d", i), Type: DeviceTypeCamera})
+	}
+	return room
+}
+
+func (r *baselineRoom) add(device *Device) {
+	r.deviceConns.Store(device.ID, &DeviceConnection{Device: device, Conn: NewSafeConn(nil)})
+}
+
+func (r *baselineRoom) cameras() []*Device {
+	cameras := make([]*Device, 0)
+	r.deviceConns.Range(func(key, value interface{}) bool {
+		if device := value.(*DeviceConnection).Device; device.Type == DeviceTypeCamera {
+			cameras = append(cameras, device)
+		}
+		return true
+	})
+	return cameras
+}
+
+func (r *baselineRoom) monitor() (*Device, bool) {
+	var monitor *Device
+	r.deviceConns.Range(func(key, value interface{}) bool {
+		if device := value.(*DeviceConnection).Device; device.Type == DeviceTypeMonitor {
+			monitor = device
+			return false
+		}
+		return true
+	})
+	return monitor, monitor != nil
+}
+
+func BenchmarkJoinDevice(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		room := newBenchmarkRoom(b, benchmarkDevices)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			// 同ID重新加入替换原有连接，房间大小保持不变
+			device := &Device{ID: fmt.Sprintf("camera-%d", i%benchmarkDevices), Type: DeviceTypeCamera}
+			if err := room.JoinDevice(device, nil, int64(i)); err != nil {
+				b.Fatalf("join camera: %v", err)
+			}
+		}
+	})
+
+	b.Run("baseline", func(b *testing.B) {
+		room := newBaselineRoom(benchmarkDevices)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			// 原实现加入Monitor前需要遍历检查房间内是否已有Monitor
+			room.monitor()
+			room.add(&Device{ID: fmt.Sprintf("camera-%d", i%benchmarkDevices), Type: DeviceTypeCamera})
+		}
+	})
+}
+
+func BenchmarkGetCameras(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		room := newBenchmarkRoom(b, benchmarkDevices)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if cameras := room.GetCameras(); len(cameras) != benchmarkDevices {
+				b.Fatalf("got %d cameras, want %d", len(cameras), benchmarkDevices)
+			}
+		}
+	})
+
+	b.Run("baseline", func(b *testing.B) {
+		room := newBaselineRoom(benchmarkDevices)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if cameras := room.cameras(); len(cameras) != benchmarkDevices {
+				b.Fatalf("got %d cameras, want %d", len(cameras), benchmarkDevices)
+			}
+		}
+	})
+}
+
+func BenchmarkHasMonitor(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		room := newBenchmarkRoom(b, benchmarkDevices)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if !room.HasMonitor() {
+				b.Fatal("monitor not found")
+			}
+		}
+	})
+
+	b.Run("baseline", func(b *testing.B) {
+		room := newBaselineRoom(benchmarkDevices)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, ok := room.monitor(); !ok {
+				b.Fatal("monitor not found")
+			}
+		}
+	})
+}
+
+func BenchmarkGetMonitor(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		room := newBenchmarkRoom(b, benchmarkDevices)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, ok := room.GetMonitor(); !ok {
+				b.Fatal("monitor not found")
+			}
+		}
+	})
+
+	b.Run("baseline", func(b *testing.B) {
+		room := newBaselineRoom(benchmarkDevices)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, ok := room.monitor(); !ok {
+				b.Fatal("monitor not found")
+			}
+		}
+	})
+}
+
+// TestJoinDeviceConcurrentMonitors 两个Monitor同时加入时只有一个成功
+func TestJoinDeviceConcurrentMonitors(t *testing.T) {
+	for attempt := 0; attempt < 100; attempt++ {
+		room := NewRoom("room", "room", 0)
+		for i := 0; i < 10; i++ {
+			room.JoinDevice(&Device{ID: fmt.Sprintf("camera-%d", i), Type: DeviceTypeCamera}, nil, 0)
+		}
+
+		start := make(chan struct{})
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				errs[i] = room.JoinDevice(&Device{ID: fmt.Sprintf("monitor-%d", i), Type: DeviceTypeMonitor}, nil, 0)
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		joined, rejected := 0, 0
+		for _, err := range errs {
+			switch err {
+			case nil:
+				joined++
+			case ErrRoomHasMonitor:
+				rejected++
+			default:
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if joined != 1 || rejected != 1 {
+			t.Fatalf("attempt %d: %d joined, %d rejected, want exactly one of each", attempt, joined, rejected)
+		}
+		if monitors := room.GetDevicesByType(DeviceTypeMonitor); len(monitors) != 1 {
+			t.Fatalf("attempt %d: room has %d monitors", attempt, len(monitors))
+		}
+	}
+}
+
+// TestDevicesAreSnapshots 状态更新替换设备信息，之前返回的设备保持不变
+func TestDevicesAreSnapshots(t *testing.T) {
+	room := NewRoom("room", "room", 0)
+	room.JoinDevice(&Device{ID: "camera", Type: DeviceTypeCamera}, nil, 0)
+
+	before, _ := room.GetDevice("camera")
+	all := room.GetAllDevices()
+
+	updated, ok := room.SetDeviceStatus("camera", DeviceStatusReady, 1)
+	if !ok {
+		t.Fatal("camera not found")
+	}
+	if updated.Status != DeviceStatusReady || updated.UpdateTime != 1 {
+		t.Fatalf("updated device = %+v", updated)
+	}
+	if before.Status != DeviceStatusConnected || all[0].Status != DeviceStatusConnected {
+		t.Fatalf("earlier snapshots changed: %s, %s", before.Status, all[0].Status)
+	}
+	if ready := room.GetDevicesByStatus(DeviceStatusReady); len(ready) != 1 || ready[0].Status != DeviceStatusReady {
+		t.Fatalf("ready devices = %v", ready)
+	}
+}
+
+// TestDevicesConcurrentStatusAndRead 并发更新状态和读取设备时没有数据竞争，需配合-race运行
+func TestDevicesConcurrentStatusAndRead(t *testing.T) {
+	room := NewRoom("room", "room", 0)
+	room.JoinDevice(&Device{ID: "camera", Type: DeviceTypeCamera}, nil, 0)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			status := DeviceStatusReady
+			if i%2 == 0 {
+				status = DeviceStatusStreaming
+			}
+			room.SetDeviceStatus("camera", status, int64(i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			for _, device := range room.GetAllDevices() {
+				_ = device.Status
+				_ = device.UpdateTime
+			}
+			_ = room.LastUpdateTime()
+		}
+	}()
+	wg.Wait()
+}
+
+// dialPair 建立一对WebSocket连接，返回服务端一侧的连接
+func dialPair(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	conn := <-conns
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestRemoveDeviceReplacedConnection 同ID的设备重新加入后，旧连接退出时不移除新连接
+func TestRemoveDeviceReplacedConnection(t *testing.T) {
+	oldConn, newConn := dialPair(t), dialPair(t)
+
+	room := NewRoom("room", "room", 0)
+	room.JoinDevice(&Device{ID: "camera", Type: DeviceTypeCamera}, oldConn, 0)
+	room.JoinDevice(&Device{ID: "camera", Type: DeviceTypeCamera}, newConn, 1)
+
+	if _, err := room.RemoveDevice("camera", oldConn, 2); err != ErrDeviceReplaced {
+		t.Fatalf("remove with old connection: err = %v, want ErrDeviceReplaced", err)
+	}
+	if conn, ok := room.GetConnection("camera"); !ok || conn.GetConn() != newConn {
+		t.Fatal("new connection was removed")
+	}
+
+	closed, err := room.RemoveDevice("camera", newConn, 3)
+	if err != nil || !closed {
+		t.Fatalf("remove with current connection: closed = %v, err = %v", closed, err)
+	}
+}
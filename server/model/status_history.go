@@ -0,0 +1,21 @@
+package model
+
+// StatusTransition 设备状态变化记录
+type StatusTransition struct {
+	From  DeviceStatus `json:"from"`  // 变化前状态
+	To    DeviceStatus `json:"to"`    // 变化后状态
+	Cause EventType    `json:"cause"` // 引起变化的事件类型
+	Time  int64        `json:"time"`  // 变化时间
+}
+
+// StatusHistory 设备在一段时间内的状态时间线
+type StatusHistory struct {
+	RoomID      string                 `json:"roomId"`      // 房间ID
+	DeviceID    string                 `json:"deviceId"`    // 设备ID
+	Status      DeviceStatus           `json:"status"`      // 当前状态
+	From        int64                  `json:"from"`        // 统计开始时间
+	To          int64                  `json:"to"`          // 统计结束时间
+	Transitions []*StatusTransition    `json:"transitions"` // 统计范围内的状态变化，按时间排序
+	Durations   map[DeviceStatus]int64 `json:"durations"`   // 统计范围内各状态的累计时长（毫秒）
+	Counts      map[DeviceStatus]int   `json:"counts"`      // 统计范围内进入各状态的次数
+}
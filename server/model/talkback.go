@@ -0,0 +1,19 @@
+package model
+
+// 对讲结束原因
+const (
+	TalkbackEndReasonStopped    = "stopped"     // Monitor主动结束
+	TalkbackEndReasonDeviceLeft = "device_left" // 对讲一方离开房间
+	// TalkbackEndReasonNegotiationFailed Monitor未在限定时间内完成音频重新协商
+	TalkbackEndReasonNegotiationFailed = "negotiation_failed"
+)
+
+// TalkbackSession 对讲会话，每个Camera同一时间只允许一个讲话方
+type TalkbackSession struct {
+	RoomID    string `json:"roomId"`    // 所在房间ID
+	CameraID  string `json:"cameraId"`  // 收听的Camera设备ID
+	MonitorID string `json:"monitorId"` // 持有话权的Monitor设备ID
+	StartTime int64  `json:"startTime"` // 开始时间
+
+	Negotiated bool `json:"negotiated"` // 添加音频轨道的重新协商是否已完成
+}
@@ -0,0 +1,72 @@
+package model
+
+// Webhook 事件回调订阅
+type Webhook struct {
+	ID         string      `json:"id"`                // 订阅唯一标识
+	URL        string      `json:"url"`               // 回调地址
+	Events     []EventType `json:"events,omitempty"`  // 订阅的事件类型，为空时订阅所有房间广播事件
+	RoomIDs    []string    `json:"roomIds,omitempty"` // 订阅的房间，为空时订阅所有房间
+	Secret     string      `json:"secret,omitempty"`  // 签名密钥，接口返回时不包含
+	HasSecret  bool        `json:"hasSecret"`         // 是否配置了签名密钥
+	CreateTime int64       `json:"createTime"`        // 创建时间
+	UpdateTime int64       `json:"updateTime"`        // 更新时间
+}
+
+// Matches 判断事件是否符合订阅条件
+func (w *Webhook) Matches(event *Event) bool {
+	if len(w.Events) > 0 {
+		matched := false
+		for _, eventType := range w.Events {
+			if eventType == event.Type {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(w.RoomIDs) > 0 {
+		for _, roomID := range w.RoomIDs {
+			if roomID == event.RoomID {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// WebhookDeliveryStatus 回调投递状态
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"   // 等待投递或重试
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded" // 投递成功
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"    // 重试次数用尽
+)
+
+// WebhookDelivery 回调投递记录
+type WebhookDelivery struct {
+	ID              string                `json:"id"`                        // 投递唯一标识，重试时保持不变
+	WebhookID       string                `json:"webhookId"`                 // 订阅ID
+	EventType       EventType             `json:"eventType"`                 // 事件类型
+	RoomID          string                `json:"roomId"`                    // 房间ID
+	DeviceID        string                `json:"deviceId"`                  // 事件的发送设备ID
+	Status          WebhookDeliveryStatus `json:"status"`                    // 投递状态
+	Attempts        int                   `json:"attempts"`                  // 已尝试次数
+	StatusCode      int                   `json:"statusCode,omitempty"`      // 最近一次响应状态码
+	Error           string                `json:"error,omitempty"`           // 最近一次失败原因
+	CreateTime      int64                 `json:"createTime"`                // 创建时间
+	LastAttemptTime int64                 `json:"lastAttemptTime,omitempty"` // 最近一次尝试时间
+	NextAttemptTime int64                 `json:"nextAttemptTime,omitempty"` // 下一次重试时间
+}
+
+// WebhookPayload 回调请求体
+type WebhookPayload struct {
+	DeliveryID string `json:"deliveryId"` // 投递ID，接收方可据此去重
+	WebhookID  string `json:"webhookId"`  // 订阅ID
+	Event      *Event `json:"event"`      // 触发回调的事件
+}
@@ -8,15 +8,22 @@ import (
 
 // SafeConn 安全的WebSocket连接
 type SafeConn struct {
-	conn  *websocket.Conn
-	mutex sync.Mutex // 写锁，防止并发写入
+	conn     *websocket.Conn
+	encoding Encoding   // 升级时协商的事件编码
+	mutex    sync.Mutex // 写锁，防止并发写入
 }
 
-// NewSafeConn 创建安全的WebSocket连接
+// NewSafeConn 创建安全的WebSocket连接，事件编码由连接协商的子协议决定
 func NewSafeConn(conn *websocket.Conn) *SafeConn {
+	encoding := EncodingJSON
+	if conn != nil {
+		encoding = EncodingForSubprotocol(conn.Subprotocol())
+	}
+
 	return &SafeConn{
-		conn:  conn,
-		mutex: sync.Mutex{},
+		conn:     conn,
+		encoding: encoding,
+		mutex:    sync.Mutex{},
 	}
 }
 
@@ -27,6 +34,20 @@ func (s *SafeConn) WriteMessage(messageType int, data []byte) error {
 	return s.conn.WriteMessage(messageType, data)
 }
 
+// WriteEvent 按连接的编码方式序列化并写入事件
+func (s *SafeConn) WriteEvent(event *Event) error {
+	messageType, data, err := EncodeEvent(s.encoding, event)
+	if err != nil {
+		return err
+	}
+	return s.WriteMessage(messageType, data)
+}
+
+// Encoding 获取连接的事件编码
+func (s *SafeConn) Encoding() Encoding {
+	return s.encoding
+}
+
 // GetConn 获取原始连接
 func (s *SafeConn) GetConn() *websocket.Conn {
 	return s.conn
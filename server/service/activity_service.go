@@ -0,0 +1,24 @@
+package service
+
+import (
+	"monitor/model"
+)
+
+// ActivitySubscription 房间活动订阅
+type ActivitySubscription interface {
+	// Events 活动通道，订阅被取消或消费过慢时关闭
+	Events() <-chan *model.Activity
+
+	// Close 取消订阅
+	Close()
+}
+
+// ActivityService 房间活动服务接口
+type ActivityService interface {
+	// Publish 发布活动，服务端为其分配ID
+	Publish(activity *model.Activity)
+
+	// Subscribe 订阅活动，roomID为空时订阅所有房间；
+	// lastID大于0时先返回缓存中ID大于lastID的历史活动
+	Subscribe(roomID string, lastID int64) ([]*model.Activity, ActivitySubscription)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"monitor/model"
+)
+
+const (
+	// activityHistorySize 缓存的最近活动数量，用于Last-Event-ID续传
+	activityHistorySize = 1000
+	// activitySubscriberBuffer 每个订阅者的活动缓冲区大小
+	activitySubscriberBuffer = 64
+)
+
+// activitySubscription 房间活动订阅实现
+type activitySubscription struct {
+	service *ActivityServiceImpl
+	roomID  string // 订阅的房间ID，为空表示所有房间
+	events  chan *model.Activity
+	closed  bool // 由service.mutex保护
+}
+
+// Events 活动通道
+func (sub *activitySubscription) Events() <-chan *model.Activity {
+	return sub.events
+}
+
+// Close 取消订阅
+func (sub *activitySubscription) Close() {
+	sub.service.unsubscribe(sub)
+}
+
+// ActivityServiceImpl 房间活动服务实现
+type ActivityServiceImpl struct {
+	mutex       sync.Mutex
+	nextID      int64
+	history     []*model.Activity // 最近的活动，按ID递增
+	subscribers map[*activitySubscription]struct{}
+}
+
+// NewActivityService 创建房间活动服务
+func NewActivityService() ActivityService {
+	return &ActivityServiceImpl{
+		nextID:      1,
+		history:     make([]*model.Activity, 0, activityHistorySize),
+		subscribers: make(map[*activitySubscription]struct{}),
+	}
+}
+
+// Publish 发布活动
+func (s *ActivityServiceImpl) Publish(activity *model.Activity) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	activity.ID = s.nextID
+	s.nextID++
+	if activity.Timestamp == 0 {
+		activity.Timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+
+	if len(s.history) >= activityHistorySize {
+		s.history = append(s.history[:0], s.history[len(s.history)-activityHistorySize+1:]...)
+	}
+	s.history = append(s.history, activity)
+
+	for sub := range s.subscribers {
+		if sub.roomID != "" && sub.roomID != activity.RoomID {
+			continue
+		}
+
+		select {
+		case sub.events <- activity:
+		default:
+			// 订阅者消费过慢，断开后由客户端携带Last-Event-ID重连
+			s.closeLocked(sub)
+		}
+	}
+}
+
+// Subscribe 订阅活动
+func (s *ActivityServiceImpl) Subscribe(roomID string, lastID int64) ([]*model.Activity, ActivitySubscription) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	backlog := make([]*model.Activity, 0)
+	if lastID > 0 {
+		for _, activity := range s.history {
+			if activity.ID > lastID && (roomID == "" || activity.RoomID == roomID) {
+				backlog = append(backlog, activity)
+			}
+		}
+	}
+
+	sub := &activitySubscription{
+		service: s,
+		roomID:  roomID,
+		events:  make(chan *model.Activity, activitySubscriberBuffer),
+	}
+	s.subscribers[sub] = struct{}{}
+
+	return backlog, sub
+}
+
+// unsubscribe 取消订阅
+func (s *ActivityServiceImpl) unsubscribe(sub *activitySubscription) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closeLocked(sub)
+}
+
+// closeLocked 关闭订阅，调用方需持有s.mutex
+func (s *ActivityServiceImpl) closeLocked(sub *activitySubscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(s.subscribers, sub)
+	close(sub.events)
+}
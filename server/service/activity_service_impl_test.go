@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"monitor/model"
+)
+
+func TestActivitySlowSubscriberIsClosed(t *testing.T) {
+	activities := NewActivityService()
+	_, slow := activities.Subscribe("room", 0)
+	_, other := activities.Subscribe("other", 0)
+	defer other.Close()
+
+	for i := 0; i <= activitySubscriberBuffer; i++ {
+		activities.Publish(&model.Activity{Type: model.ActivityTypeStatus, RoomID: "room", DeviceID: "camera-1"})
+	}
+
+	// 缓冲区满后订阅被关闭，已缓冲的活动仍可读取，客户端之后携带Last-Event-ID重连
+	count := 0
+	for range slow.Events() {
+		count++
+	}
+	if count != activitySubscriberBuffer {
+		t.Fatalf("buffered activities = %d, want %d", count, activitySubscriberBuffer)
+	}
+	slow.Close()
+
+	backlog, resumed := activities.Subscribe("room", int64(count))
+	defer resumed.Close()
+	if len(backlog) != 1 || backlog[0].ID != int64(count+1) {
+		t.Fatalf("resumed backlog = %+v, want the dropped activity", backlog)
+	}
+
+	// 其他房间的订阅不受影响
+	select {
+	case activity, ok := <-other.Events():
+		t.Fatalf("subscriber of another room received %+v (open %v)", activity, ok)
+	default:
+	}
+}
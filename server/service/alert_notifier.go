@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"monitor/model"
+)
+
+// AlertNotifier 告警通知方式
+type AlertNotifier interface {
+	// Name 通知方式名称，告警规则通过名称选择通知方式
+	Name() string
+
+	// Notify 发送告警或恢复通知
+	Notify(ctx context.Context, alert *model.Alert) error
+}
+
+// SMTPConfig 邮件通知配置
+type SMTPConfig struct {
+	Host     string   // SMTP服务器地址
+	Port     int      // SMTP服务器端口
+	Username string   // 登录用户名，为空时不认证
+	Password string   // 登录密码
+	From     string   // 发件人
+	To       []string // 收件人
+}
+
+// SMTPNotifier 通过邮件发送告警通知
+type SMTPNotifier struct {
+	config SMTPConfig
+}
+
+// NewSMTPNotifier 创建邮件通知
+func NewSMTPNotifier(config SMTPConfig) *SMTPNotifier {
+	return &SMTPNotifier{config: config}
+}
+
+// Name 通知方式名称
+func (n *SMTPNotifier) Name() string {
+	return "email"
+}
+
+// Notify 发送告警邮件
+func (n *SMTPNotifier) Notify(ctx context.Context, alert *model.Alert) error {
+	subject := "[告警] " + alert.Message
+	if alert.State == model.AlertStateResolved {
+		subject = "[恢复] " + alert.Message
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "房间：%s\r\n", alert.RoomID)
+	fmt.Fprintf(&body, "设备：%s\r\n", alert.DeviceID)
+	fmt.Fprintf(&body, "规则：%s\r\n", alert.Type)
+	fmt.Fprintf(&body, "开始时间：%s\r\n", formatAlertTime(alert.Since))
+	if alert.State == model.AlertStateResolved {
+		fmt.Fprintf(&body, "恢复时间：%s\r\n", formatAlertTime(alert.ResolveTime))
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.config.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(body.String())
+
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+	address := net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+
+	// smtp.SendMail不支持context，在单独的goroutine中发送并等待超时
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(address, auth, n.config.From, n.config.To, message.Bytes())
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WebhookNotifier 通过HTTP回调发送告警通知，请求体为告警的JSON
+type WebhookNotifier struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewWebhookNotifier 创建HTTP回调通知，token不为空时通过Authorization头携带
+func NewWebhookNotifier(url string, token string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		token:  token,
+		client: &http.Client{},
+	}
+}
+
+// Name 通知方式名称
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Notify 发送告警回调
+func (n *WebhookNotifier) Notify(ctx context.Context, alert *model.Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// formatAlertTime 格式化毫秒时间戳
+func formatAlertTime(millis int64) string {
+	return time.UnixMilli(millis).Format("2006-01-02 15:04:05")
+}
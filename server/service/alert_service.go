@@ -0,0 +1,26 @@
+package service
+
+import (
+	"monitor/model"
+)
+
+// AlertService 告警服务接口，后台定期根据告警规则检查房间内的设备状态
+type AlertService interface {
+	// CreateRule 在房间中创建告警规则
+	CreateRule(roomID string, rule *model.AlertRule) (*model.AlertRule, error)
+
+	// GetRules 获取房间内所有告警规则
+	GetRules(roomID string) ([]*model.AlertRule, error)
+
+	// UpdateRule 更新房间内指定告警规则
+	UpdateRule(roomID string, ruleID string, rule *model.AlertRule) (*model.AlertRule, error)
+
+	// DeleteRule 删除房间内指定告警规则，该规则产生的告警一并清除
+	DeleteRule(roomID string, ruleID string) (*model.AlertRule, error)
+
+	// GetAlerts 获取房间内正在告警的告警
+	GetAlerts(roomID string) []*model.Alert
+
+	// Close 停止后台检查并等待正在发送的通知完成
+	Close()
+}
@@ -0,0 +1,572 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"monitor/logger"
+	"monitor/metrics"
+	"monitor/model"
+)
+
+const (
+	// alertRulesFile 告警规则文件名
+	alertRulesFile = "rules.json"
+	// alertNotifyTimeout 单次发送通知的超时时间
+	alertNotifyTimeout = 30 * time.Second
+)
+
+// AlertConfig 告警服务配置
+type AlertConfig struct {
+	Dir           string          // 告警规则持久化目录，为空时仅保存在内存中
+	CheckInterval time.Duration   // 检查告警规则的间隔
+	Notifiers     []AlertNotifier // 已配置的通知方式
+}
+
+// AlertServiceImpl 告警服务实现
+type AlertServiceImpl struct {
+	config         AlertConfig
+	roomService    RoomService
+	historyService StatusHistoryService
+	startTime      int64 // 服务启动时间，此前的设备离开无法得知
+
+	mutex   sync.Mutex
+	rules   map[string]*model.AlertRule // key为ruleID
+	alerts  map[string]*model.Alert     // 正在告警的告警，key为ruleID/deviceID
+	cameras map[string]map[string]int64 // 有告警规则的房间内出现过的Camera，roomID -> deviceID -> 最后一次在线时间
+
+	notifying sync.WaitGroup
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewAlertService 创建告警服务，加载已保存的规则并在后台定期检查
+func NewAlertService(config AlertConfig, roomService RoomService, historyService StatusHistoryService) (AlertService, error) {
+	s := &AlertServiceImpl{
+		config:         config,
+		roomService:    roomService,
+		historyService: historyService,
+		startTime:      time.Now().UnixNano() / int64(time.Millisecond),
+		rules:          make(map[string]*model.AlertRule),
+		alerts:         make(map[string]*model.Alert),
+		cameras:        make(map[string]map[string]int64),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if config.CheckInterval <= 0 {
+		close(s.done)
+		return s, nil
+	}
+
+	go s.checkLoop()
+	return s, nil
+}
+
+// CreateRule 在房间中创建告警规则
+func (s *AlertServiceImpl) CreateRule(roomID string, rule *model.AlertRule) (*model.AlertRule, error) {
+	if err := s.validateRule(roomID, rule); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	created := &model.AlertRule{
+		ID:         generateID(),
+		RoomID:     roomID,
+		Type:       rule.Type,
+		DeviceID:   rule.DeviceID,
+		Duration:   rule.Duration,
+		Notifiers:  copyStrings(rule.Notifiers),
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	s.rules[created.ID] = created
+
+	if err := s.save(); err != nil {
+		delete(s.rules, created.ID)
+		return nil, err
+	}
+
+	return copyAlertRule(created), nil
+}
+
+// GetRules 获取房间内所有告警规则
+func (s *AlertServiceImpl) GetRules(roomID string) ([]*model.AlertRule, error) {
+	if !model.ValidRoomID(roomID) {
+		return nil, errors.New("无效的房间ID")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rules := make([]*model.AlertRule, 0)
+	for _, rule := range s.sortedRules() {
+		if rule.RoomID == roomID {
+			rules = append(rules, copyAlertRule(rule))
+		}
+	}
+	return rules, nil
+}
+
+// UpdateRule 更新房间内指定告警规则，规则已产生的告警被清除并重新评估
+func (s *AlertServiceImpl) UpdateRule(roomID string, ruleID string, rule *model.AlertRule) (*model.AlertRule, error) {
+	if err := s.validateRule(roomID, rule); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists := s.rules[ruleID]
+	if !exists || old.RoomID != roomID {
+		return nil, errors.New("告警规则不存在")
+	}
+
+	updated := &model.AlertRule{
+		ID:         old.ID,
+		RoomID:     roomID,
+		Type:       rule.Type,
+		DeviceID:   rule.DeviceID,
+		Duration:   rule.Duration,
+		Notifiers:  copyStrings(rule.Notifiers),
+		CreateTime: old.CreateTime,
+		UpdateTime: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	s.rules[ruleID] = updated
+
+	if err := s.save(); err != nil {
+		s.rules[ruleID] = old
+		return nil, err
+	}
+
+	s.clearAlerts(ruleID)
+	return copyAlertRule(updated), nil
+}
+
+// DeleteRule 删除房间内指定告警规则
+func (s *AlertServiceImpl) DeleteRule(roomID string, ruleID string) (*model.AlertRule, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists := s.rules[ruleID]
+	if !exists || old.RoomID != roomID {
+		return nil, errors.New("告警规则不存在")
+	}
+	delete(s.rules, ruleID)
+
+	if err := s.save(); err != nil {
+		s.rules[ruleID] = old
+		return nil, err
+	}
+
+	s.clearAlerts(ruleID)
+
+	// 房间没有其他规则时不再跟踪其Camera
+	tracked := false
+	for _, rule := range s.rules {
+		if rule.RoomID == roomID {
+			tracked = true
+			break
+		}
+	}
+	if !tracked {
+		delete(s.cameras, roomID)
+	}
+
+	return copyAlertRule(old), nil
+}
+
+// GetAlerts 获取房间内正在告警的告警，按触发时间排序
+func (s *AlertServiceImpl) GetAlerts(roomID string) []*model.Alert {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	alerts := make([]*model.Alert, 0)
+	for _, alert := range s.alerts {
+		if alert.RoomID == roomID {
+			copied := *alert
+			alerts = append(alerts, &copied)
+		}
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].FireTime != alerts[j].FireTime {
+			return alerts[i].FireTime < alerts[j].FireTime
+		}
+		return alerts[i].ID < alerts[j].ID
+	})
+	return alerts
+}
+
+// Check 检查所有告警规则，条件持续超过规则时长时告警，条件不再成立时恢复
+func (s *AlertServiceImpl) Check() {
+	type notification struct {
+		rule  *model.AlertRule
+		alert *model.Alert
+	}
+	notifications := make([]notification, 0)
+
+	s.mutex.Lock()
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	s.observeCameras(now)
+
+	for _, rule := range s.sortedRules() {
+		for _, deviceID := range s.ruleTargets(rule) {
+			key := rule.ID + "/" + deviceID
+			since, active := s.evaluate(rule, deviceID, now)
+			alert, firing := s.alerts[key]
+
+			switch {
+			case firing && !active:
+				delete(s.alerts, key)
+				resolved := *alert
+				resolved.State = model.AlertStateResolved
+				resolved.ResolveTime = now
+				notifications = append(notifications, notification{rule: copyAlertRule(rule), alert: &resolved})
+
+			case !firing && active && now-since >= rule.Duration*1000:
+				alert = &model.Alert{
+					ID:       generateID(),
+					RuleID:   rule.ID,
+					RoomID:   rule.RoomID,
+					DeviceID: deviceID,
+					Type:     rule.Type,
+					State:    model.AlertStateFiring,
+					Message:  alertMessage(rule, deviceID),
+					Since:    since,
+					FireTime: now,
+				}
+				s.alerts[key] = alert
+				copied := *alert
+				notifications = append(notifications, notification{rule: copyAlertRule(rule), alert: &copied})
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, n := range notifications {
+		slog.Info("alert state changed",
+			logger.KeyRoomID, n.alert.RoomID, logger.KeyDeviceID, n.alert.DeviceID,
+			"rule", n.alert.Type, "state", n.alert.State)
+		s.notify(n.rule, n.alert)
+	}
+}
+
+// Close 停止后台检查并等待正在发送的通知完成
+func (s *AlertServiceImpl) Close() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	s.notifying.Wait()
+}
+
+// checkLoop 定期检查告警规则
+func (s *AlertServiceImpl) checkLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Check()
+		}
+	}
+}
+
+// observeCameras 记录有告警规则的房间内当前在线的Camera，调用方需持有锁
+func (s *AlertServiceImpl) observeCameras(now int64) {
+	for _, rule := range s.rules {
+		if _, exists := s.cameras[rule.RoomID]; !exists {
+			s.cameras[rule.RoomID] = make(map[string]int64)
+		}
+	}
+
+	for roomID, seen := range s.cameras {
+		// 房间内没有设备时房间已被删除，保留之前出现过的Camera
+		cameras, err := s.roomService.GetCamerasInRoom(roomID)
+		if err != nil {
+			continue
+		}
+		for _, camera := range cameras {
+			seen[camera.ID] = now
+		}
+	}
+}
+
+// ruleTargets 规则检查的设备列表，调用方需持有锁
+func (s *AlertServiceImpl) ruleTargets(rule *model.AlertRule) []string {
+	if rule.DeviceID != "" {
+		return []string{rule.DeviceID}
+	}
+
+	deviceIDs := make([]string, 0, len(s.cameras[rule.RoomID]))
+	for deviceID := range s.cameras[rule.RoomID] {
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	sort.Strings(deviceIDs)
+	return deviceIDs
+}
+
+// evaluate 判断规则条件对设备是否成立，返回条件开始成立的时间，调用方需持有锁
+func (s *AlertServiceImpl) evaluate(rule *model.AlertRule, deviceID string, now int64) (int64, bool) {
+	device, err := s.roomService.GetDeviceById(rule.RoomID, deviceID)
+	present := err == nil && device.Type == model.DeviceTypeCamera
+
+	switch rule.Type {
+	case model.AlertRuleCameraAbsent:
+		if present {
+			return 0, false
+		}
+		return s.absentSince(rule, deviceID), true
+
+	case model.AlertRuleErrorStuck:
+		if !present || device.Status != model.DeviceStatusError {
+			return 0, false
+		}
+		if last := s.lastTransition(rule.RoomID, deviceID); last != nil && last.To == model.DeviceStatusError {
+			return last.Time, true
+		}
+		return now, true
+
+	case model.AlertRuleStreamingDropped:
+		if !present || device.Status != model.DeviceStatusReady {
+			return 0, false
+		}
+		last := s.lastTransition(rule.RoomID, deviceID)
+		if last == nil || last.From != model.DeviceStatusStreaming || last.To != model.DeviceStatusReady {
+			return 0, false
+		}
+		return last.Time, true
+	}
+
+	return 0, false
+}
+
+// absentSince Camera离开房间的时间，调用方需持有锁
+// 依次使用状态历史中的离开时间、最后一次观察到在线的时间、规则创建或服务启动时间
+func (s *AlertServiceImpl) absentSince(rule *model.AlertRule, deviceID string) int64 {
+	if last := s.lastTransition(rule.RoomID, deviceID); last != nil && last.To == model.DeviceStatusLeft {
+		return last.Time
+	}
+	if seen, exists := s.cameras[rule.RoomID][deviceID]; exists {
+		return seen
+	}
+	if rule.CreateTime > s.startTime {
+		return rule.CreateTime
+	}
+	return s.startTime
+}
+
+// lastTransition 设备最近一次状态变化，没有记录时返回nil
+func (s *AlertServiceImpl) lastTransition(roomID string, deviceID string) *model.StatusTransition {
+	history, err := s.historyService.GetHistory(roomID, deviceID, 0, 0)
+	if err != nil || len(history.Transitions) == 0 {
+		return nil
+	}
+	return history.Transitions[len(history.Transitions)-1]
+}
+
+// clearAlerts 清除规则产生的告警，不发送恢复通知，调用方需持有锁
+func (s *AlertServiceImpl) clearAlerts(ruleID string) {
+	for key, alert := range s.alerts {
+		if alert.RuleID == ruleID {
+			delete(s.alerts, key)
+		}
+	}
+}
+
+// notify 通过规则选择的通知方式异步发送通知
+func (s *AlertServiceImpl) notify(rule *model.AlertRule, alert *model.Alert) {
+	for _, notifier := range s.config.Notifiers {
+		if len(rule.Notifiers) > 0 && !containsString(rule.Notifiers, notifier.Name()) {
+			continue
+		}
+
+		s.notifying.Add(1)
+		go func(notifier AlertNotifier) {
+			defer s.notifying.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), alertNotifyTimeout)
+			defer cancel()
+
+			if err := notifier.Notify(ctx, alert); err != nil {
+				metrics.AlertNotifications.WithLabelValues(notifier.Name(), "error").Inc()
+				slog.Warn("send alert notification failed",
+					logger.KeyRoomID, alert.RoomID, logger.KeyDeviceID, alert.DeviceID,
+					"notifier", notifier.Name(), logger.KeyError, err)
+				return
+			}
+			metrics.AlertNotifications.WithLabelValues(notifier.Name(), "ok").Inc()
+		}(notifier)
+	}
+}
+
+// validateRule 校验告警规则参数
+func (s *AlertServiceImpl) validateRule(roomID string, rule *model.AlertRule) error {
+	if !model.ValidRoomID(roomID) {
+		return errors.New("无效的房间ID")
+	}
+
+	switch rule.Type {
+	case model.AlertRuleCameraAbsent, model.AlertRuleErrorStuck, model.AlertRuleStreamingDropped:
+	default:
+		return errors.New("不支持的告警规则类型")
+	}
+
+	if rule.Duration <= 0 {
+		return errors.New("告警时长必须大于0")
+	}
+
+	for _, name := range rule.Notifiers {
+		found := false
+		for _, notifier := range s.config.Notifiers {
+			if notifier.Name() == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("未配置的通知方式: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// rulesFile 告警规则文件路径
+func (s *AlertServiceImpl) rulesFile() string {
+	return filepath.Join(s.config.Dir, alertRulesFile)
+}
+
+// load 从磁盘加载告警规则
+func (s *AlertServiceImpl) load() error {
+	if s.config.Dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.rulesFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取告警规则文件失败: %w", err)
+	}
+
+	var rules []*model.AlertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("解析告警规则文件失败: %w", err)
+	}
+
+	for _, rule := range rules {
+		s.rules[rule.ID] = rule
+	}
+	return nil
+}
+
+// save 将告警规则写入磁盘，调用方需持有锁
+func (s *AlertServiceImpl) save() error {
+	if s.config.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.config.Dir, 0o755); err != nil {
+		return fmt.Errorf("创建告警目录失败: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s.sortedRules(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致文件损坏
+	path := s.rulesFile()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("写入告警规则文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("写入告警规则文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// sortedRules 按创建时间排序的规则列表，调用方需持有锁
+func (s *AlertServiceImpl) sortedRules() []*model.AlertRule {
+	rules := make([]*model.AlertRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, rule)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].CreateTime != rules[j].CreateTime {
+			return rules[i].CreateTime < rules[j].CreateTime
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules
+}
+
+// alertMessage 生成告警说明
+func alertMessage(rule *model.AlertRule, deviceID string) string {
+	duration := (time.Duration(rule.Duration) * time.Second).String()
+	switch rule.Type {
+	case model.AlertRuleCameraAbsent:
+		return fmt.Sprintf("房间 %s 的Camera %s 离线超过 %s", rule.RoomID, deviceID, duration)
+	case model.AlertRuleErrorStuck:
+		return fmt.Sprintf("房间 %s 的Camera %s 处于错误状态超过 %s", rule.RoomID, deviceID, duration)
+	case model.AlertRuleStreamingDropped:
+		return fmt.Sprintf("房间 %s 的Camera %s 停止传输超过 %s", rule.RoomID, deviceID, duration)
+	default:
+		return fmt.Sprintf("房间 %s 的设备 %s 触发告警 %s", rule.RoomID, deviceID, rule.Type)
+	}
+}
+
+// copyAlertRule 复制告警规则，避免调用方修改内部数据
+func copyAlertRule(rule *model.AlertRule) *model.AlertRule {
+	copied := *rule
+	copied.Notifiers = copyStrings(rule.Notifiers)
+	return &copied
+}
+
+// copyStrings 复制字符串切片
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	copied := make([]string, len(values))
+	copy(copied, values)
+	return copied
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
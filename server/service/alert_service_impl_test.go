@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"monitor/model"
+)
+
+// recordingNotifier 记录收到的告警通知
+type recordingNotifier struct {
+	mutex  sync.Mutex
+	alerts []*model.Alert
+}
+
+// Name 通知方式名称
+func (n *recordingNotifier) Name() string {
+	return "recording"
+}
+
+// Notify 记录告警通知
+func (n *recordingNotifier) Notify(ctx context.Context, alert *model.Alert) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+// count 指定状态的通知数量
+func (n *recordingNotifier) count(state model.AlertState) int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	count := 0
+	for _, alert := range n.alerts {
+		if alert.State == state {
+			count++
+		}
+	}
+	return count
+}
+
+func TestIceRestartTimeoutFiresOneAlert(t *testing.T) {
+	shortenNegotiationTimeout(t, 50*time.Millisecond)
+
+	r := newEventTestRoom(t)
+	camera := r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+	r.setStatus(t, "room", "camera-1", model.DeviceStatusStreaming)
+	r.setStatus(t, "room", "monitor-1", model.DeviceStatusReceiving)
+
+	notifier := &recordingNotifier{}
+	service, err := NewAlertService(AlertConfig{Notifiers: []AlertNotifier{notifier}}, r.rooms, r.history)
+	if err != nil {
+		t.Fatalf("NewAlertService: %v", err)
+	}
+	alerts := service.(*AlertServiceImpl)
+	if _, err := alerts.CreateRule("room", &model.AlertRule{Type: model.AlertRuleErrorStuck, DeviceID: "camera-1", Duration: 1}); err != nil {
+		t.Fatalf("CreateRule: %v", err)
+	}
+
+	iceRestartTimeout := func() {
+		t.Helper()
+		if err := r.events.ProcessEvent(testEvent(model.EventTypeIceRestart, "room", "camera-1", negotiation("monitor-1", model.NegotiationSDPOffer))); err != nil {
+			t.Fatalf("offer: %v", err)
+		}
+		readEvent(t, camera, model.EventTypeNegotiationTimeout)
+	}
+
+	iceRestartTimeout()
+	waitFor(t, "camera in error", func() bool { return r.status("room", "camera-1") == model.DeviceStatusError })
+
+	// 仍处于错误状态时再次超时，不会重新开始计时或产生新的告警
+	iceRestartTimeout()
+
+	deadline := time.Now().Add(1500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		alerts.Check()
+		time.Sleep(50 * time.Millisecond)
+	}
+	alerts.Close()
+	if got := notifier.count(model.AlertStateFiring); got != 1 {
+		t.Fatalf("firing notifications = %d, want 1", got)
+	}
+	if got := len(alerts.GetAlerts("room")); got != 1 {
+		t.Fatalf("active alerts = %d, want 1", got)
+	}
+
+	// ICE重启完成后设备恢复传输，告警恢复
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeIceRestart, "room", "camera-1", negotiation("monitor-1", model.NegotiationSDPOffer))); err != nil {
+		t.Fatalf("offer: %v", err)
+	}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeIceRestart, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPAnswer))); err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	alerts.Check()
+	alerts.Close()
+	if got := notifier.count(model.AlertStateResolved); got != 1 {
+		t.Fatalf("resolved notifications = %d, want 1", got)
+	}
+}
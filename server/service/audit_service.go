@@ -0,0 +1,26 @@
+package service
+
+import (
+	"monitor/model"
+)
+
+// AuditService 事件审计服务接口
+type AuditService interface {
+	// Record 记录一条事件，deviceID为连接对应的设备ID
+	Record(direction model.AuditDirection, deviceID string, event *model.Event)
+
+	// RecordInvalid 记录一条无法解析为事件的入站消息
+	RecordInvalid(roomID string, deviceID string, binary bool, message []byte, parseErr error)
+
+	// Query 查询审计记录，按时间顺序返回
+	Query(query *model.AuditQuery) ([]*model.AuditRecord, error)
+
+	// Dropped 返回服务启动以来因写入队列已满而丢弃的记录数量
+	Dropped() int64
+
+	// Prune 删除超出保留期限的审计文件
+	Prune() error
+
+	// Close 关闭审计文件
+	Close() error
+}
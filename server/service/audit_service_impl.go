@@ -0,0 +1,486 @@
+package service
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"monitor/logger"
+	"monitor/metrics"
+	"monitor/model"
+)
+
+const (
+	// auditFilePrefix 审计文件名前缀，文件名格式为audit-YYYY-MM-DD.jsonl
+	auditFilePrefix = "audit-"
+	// auditFileSuffix 审计文件名后缀
+	auditFileSuffix = ".jsonl"
+	// auditDayLayout 审计文件名中的日期格式
+	auditDayLayout = "2006-01-02"
+	// auditPruneInterval 清理过期审计文件的间隔
+	auditPruneInterval = time.Hour
+	// auditMaxLineSize 单条审计记录的最大长度
+	auditMaxLineSize = 16 * 1024 * 1024
+	// auditQueueSize 等待写入的审计记录数量上限，队列满时丢弃新记录，避免阻塞信令发送
+	auditQueueSize = 8192
+	// auditMaxRawSize 无法解析的入站消息最多记录的字节数
+	auditMaxRawSize = 4096
+)
+
+// AuditConfig 审计服务配置
+type AuditConfig struct {
+	Dir           string // 审计文件目录，为空时不记录
+	RetentionDays int    // 审计文件保留天数，小于等于0时不清理
+	RedactSDP     bool   // 是否隐去SDP内容
+}
+
+// AuditServiceImpl 事件审计服务实现，按天写入追加式JSONL文件
+type AuditServiceImpl struct {
+	config AuditConfig
+
+	mutex   sync.Mutex
+	file    *os.File // 当天的审计文件
+	fileDay string   // 当前打开文件对应的日期
+
+	records    chan *model.AuditRecord // 等待写入的审计记录，由writeLoop写入文件
+	dropped    atomic.Int64            // 因队列已满丢弃的记录数量
+	stop       chan struct{}
+	done       chan struct{} // pruneLoop退出后关闭
+	writerDone chan struct{} // writeLoop写完剩余记录后关闭
+}
+
+// NewAuditService 创建事件审计服务，并在后台定期清理过期文件
+func NewAuditService(config AuditConfig) (AuditService, error) {
+	s := &AuditServiceImpl{
+		config:     config,
+		records:    make(chan *model.AuditRecord, auditQueueSize),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		writerDone: make(chan struct{}),
+	}
+
+	if config.Dir == "" {
+		close(s.done)
+		close(s.writerDone)
+		return s, nil
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建审计目录失败: %w", err)
+	}
+
+	go s.pruneLoop()
+	go s.writeLoop()
+	return s, nil
+}
+
+// Record 记录一条事件，记录在后台写入文件，不阻塞调用方
+func (s *AuditServiceImpl) Record(direction model.AuditDirection, deviceID string, event *model.Event) {
+	if s.config.Dir == "" {
+		return
+	}
+
+	recorded := *event
+	s.enqueue(&model.AuditRecord{
+		Time:      time.Now().UnixNano() / int64(time.Millisecond),
+		Direction: direction,
+		RoomID:    event.RoomID,
+		DeviceID:  deviceID,
+		Event:     &recorded,
+	})
+}
+
+// RecordInvalid 记录一条无法解析为事件的入站消息，内容超出长度限制时截断
+func (s *AuditServiceImpl) RecordInvalid(roomID string, deviceID string, binary bool, message []byte, parseErr error) {
+	if s.config.Dir == "" {
+		return
+	}
+
+	raw := message
+	if len(raw) > auditMaxRawSize {
+		raw = raw[:auditMaxRawSize]
+	}
+	invalid := &model.AuditInvalid{
+		Error:  parseErr.Error(),
+		Size:   len(message),
+		Binary: binary,
+	}
+	if binary {
+		invalid.Raw = base64.StdEncoding.EncodeToString(raw)
+	} else {
+		invalid.Raw = strings.ToValidUTF8(string(raw), "\uFFFD")
+	}
+
+	s.enqueue(&model.AuditRecord{
+		Time:      time.Now().UnixNano() / int64(time.Millisecond),
+		Direction: model.AuditDirectionInbound,
+		RoomID:    roomID,
+		DeviceID:  deviceID,
+		Invalid:   invalid,
+	})
+}
+
+// enqueue 把记录放入写入队列，服务已关闭或队列已满时丢弃
+func (s *AuditServiceImpl) enqueue(record *model.AuditRecord) {
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+
+	select {
+	case s.records <- record:
+	default:
+		dropped := s.dropped.Add(1)
+		metrics.AuditDropped.Inc()
+		slog.Warn("audit queue full, record dropped",
+			logger.KeyRoomID, record.RoomID, logger.KeyDeviceID, record.DeviceID, "dropped", dropped)
+	}
+}
+
+// Dropped 返回因写入队列已满而丢弃的记录数量
+func (s *AuditServiceImpl) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// writeLoop 依次写入队列中的审计记录，关闭时写完剩余记录后退出
+func (s *AuditServiceImpl) writeLoop() {
+	defer close(s.writerDone)
+
+	for {
+		select {
+		case record := <-s.records:
+			s.write(record)
+		case <-s.stop:
+			for {
+				select {
+				case record := <-s.records:
+					s.write(record)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write 隐去敏感内容后把记录追加到当天的审计文件
+func (s *AuditServiceImpl) write(record *model.AuditRecord) {
+	eventType := model.EventType("")
+	if record.Event != nil {
+		eventType = record.Event.Type
+		record.Event.Payload = redactPayload(record.Event.Payload, s.config.RedactSDP)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		slog.Warn("marshal audit record failed",
+			logger.KeyRoomID, record.RoomID, logger.KeyDeviceID, record.DeviceID, logger.KeyEventType, eventType, logger.KeyError, err)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.openLocked(time.UnixMilli(record.Time)); err != nil {
+		slog.Error("open audit file failed", logger.KeyError, err)
+		return
+	}
+
+	if _, err := s.file.Write(line); err != nil {
+		slog.Error("write audit record failed",
+			logger.KeyRoomID, record.RoomID, logger.KeyDeviceID, record.DeviceID, logger.KeyEventType, eventType, logger.KeyError, err)
+	}
+}
+
+// Query 查询审计记录
+func (s *AuditServiceImpl) Query(query *model.AuditQuery) ([]*model.AuditRecord, error) {
+	records := make([]*model.AuditRecord, 0)
+	if s.config.Dir == "" {
+		return records, nil
+	}
+	if query.RoomID == "" {
+		return nil, errors.New("房间ID不能为空")
+	}
+
+	days, err := s.listDays()
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[model.EventType]bool, len(query.Types))
+	for _, eventType := range query.Types {
+		types[eventType] = true
+	}
+
+	// 先按文件日期过滤，只读取与查询时间范围重叠的文件
+	inRange := days[:0]
+	for _, day := range days {
+		if dayOverlaps(day, query.StartTime, query.EndTime) {
+			inRange = append(inRange, day)
+		}
+	}
+
+	for _, day := range inRange {
+		err := s.scanFile(s.dayFile(day), func(record *model.AuditRecord) bool {
+			if record.RoomID != query.RoomID {
+				return true
+			}
+			if query.DeviceID != "" && record.DeviceID != query.DeviceID {
+				return true
+			}
+			if len(types) > 0 && (record.Event == nil || !types[record.Event.Type]) {
+				return true
+			}
+			if query.StartTime > 0 && record.Time < query.StartTime {
+				return true
+			}
+			if query.EndTime > 0 && record.Time >= query.EndTime {
+				return true
+			}
+
+			records = append(records, record)
+			return query.Limit <= 0 || len(records) < query.Limit
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if query.Limit > 0 && len(records) >= query.Limit {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// Prune 删除超出保留期限的审计文件
+func (s *AuditServiceImpl) Prune() error {
+	if s.config.Dir == "" || s.config.RetentionDays <= 0 {
+		return nil
+	}
+
+	days, err := s.listDays()
+	if err != nil {
+		return err
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	cutoff := today.AddDate(0, 0, -s.config.RetentionDays)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, day := range days {
+		if !day.Before(cutoff) {
+			continue
+		}
+
+		dayName := day.Format(auditDayLayout)
+		if dayName == s.fileDay {
+			continue
+		}
+		if err := os.Remove(s.dayFile(day)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除审计文件失败: %w", err)
+		}
+		slog.Info("pruned audit file", "day", dayName)
+	}
+
+	return nil
+}
+
+// Close 关闭审计文件
+func (s *AuditServiceImpl) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	<-s.writerDone
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// pruneLoop 定期清理过期审计文件
+func (s *AuditServiceImpl) pruneLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(auditPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Prune(); err != nil {
+			slog.Warn("prune audit files failed", logger.KeyError, err)
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// openLocked 打开当天的审计文件，日期变化时切换文件，调用方需持有s.mutex
+func (s *AuditServiceImpl) openLocked(now time.Time) error {
+	day := now.UTC().Format(auditDayLayout)
+	if s.file != nil && s.fileDay == day {
+		return nil
+	}
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	path := filepath.Join(s.config.Dir, auditFilePrefix+day+auditFileSuffix)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.file = file
+	s.fileDay = day
+	return nil
+}
+
+// listDays 列出已有审计文件的日期，按时间升序
+func (s *AuditServiceImpl) listDays() ([]time.Time, error) {
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取审计目录失败: %w", err)
+	}
+
+	days := make([]time.Time, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, auditFilePrefix) || !strings.HasSuffix(name, auditFileSuffix) {
+			continue
+		}
+
+		day, err := time.Parse(auditDayLayout, strings.TrimSuffix(strings.TrimPrefix(name, auditFilePrefix), auditFileSuffix))
+		if err != nil {
+			continue
+		}
+		days = append(days, day)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+
+	return days, nil
+}
+
+// dayFile 指定日期的审计文件路径
+func (s *AuditServiceImpl) dayFile(day time.Time) string {
+	return filepath.Join(s.config.Dir, auditFilePrefix+day.Format(auditDayLayout)+auditFileSuffix)
+}
+
+// scanFile 逐行读取审计文件，visit返回false时停止
+func (s *AuditServiceImpl) scanFile(path string, visit func(record *model.AuditRecord) bool) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// 文件可能刚被清理
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取审计文件失败: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), auditMaxLineSize)
+	for scanner.Scan() {
+		var record model.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// 跳过正在写入的不完整行
+			continue
+		}
+		if !visit(&record) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+// dayOverlaps 判断某一天（UTC）是否与查询时间范围重叠
+func dayOverlaps(day time.Time, startTime int64, endTime int64) bool {
+	dayStart := day.UnixNano() / int64(time.Millisecond)
+	dayEnd := day.Add(24*time.Hour).UnixNano() / int64(time.Millisecond)
+
+	if startTime > 0 && dayEnd <= startTime {
+		return false
+	}
+	if endTime > 0 && dayStart >= endTime {
+		return false
+	}
+	return true
+}
+
+// redactedValue 替换敏感内容的占位符
+const redactedValue = "[redacted]"
+
+// redactPayload 隐去负载中的敏感内容：connect事件中的恢复凭证和ICE服务器密码总是隐去，
+// redactSDP为true时SDP只保留长度
+func redactPayload(payload json.RawMessage, redactSDP bool) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return payload
+	}
+
+	changed := false
+	if sdp, exists := fields["sdp"]; exists && redactSDP {
+		var value string
+		if err := json.Unmarshal(sdp, &value); err == nil {
+			fields["sdp"], _ = json.Marshal(fmt.Sprintf("[redacted %d bytes]", len(value)))
+			changed = true
+		}
+	}
+	if _, exists := fields["resumeToken"]; exists {
+		fields["resumeToken"], _ = json.Marshal(redactedValue)
+		changed = true
+	}
+	if servers, exists := fields["iceServers"]; exists {
+		var iceServers []map[string]json.RawMessage
+		if err := json.Unmarshal(servers, &iceServers); err == nil {
+			for _, server := range iceServers {
+				if _, exists := server["credential"]; exists {
+					server["credential"], _ = json.Marshal(redactedValue)
+					changed = true
+				}
+			}
+			fields["iceServers"], _ = json.Marshal(iceServers)
+		}
+	}
+	if !changed {
+		return payload
+	}
+
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return payload
+	}
+	return redacted
+}
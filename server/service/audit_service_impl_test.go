@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"monitor/model"
+)
+
+func TestRedactPayload(t *testing.T) {
+	payload := json.RawMessage(`{"sdp":"v=0\r\n","resumeToken":"secret-token","iceServers":[{"urls":["turn:turn.example.com"],"username":"u","credential":"p"}]}`)
+
+	redacted := string(redactPayload(payload, true))
+	for _, secret := range []string{"secret-token", `"credential":"p"`, "v=0"} {
+		if strings.Contains(redacted, secret) {
+			t.Fatalf("redacted payload %s still contains %q", redacted, secret)
+		}
+	}
+	if !strings.Contains(redacted, "[redacted 5 bytes]") {
+		t.Fatalf("redacted payload %s does not keep the SDP length", redacted)
+	}
+
+	// 不隐去SDP时凭证仍然隐去
+	kept := string(redactPayload(payload, false))
+	if !strings.Contains(kept, `v=0\r\n`) {
+		t.Fatalf("payload %s lost the SDP although redactSDP is false", kept)
+	}
+	if strings.Contains(kept, "secret-token") || strings.Contains(kept, `"credential":"p"`) {
+		t.Fatalf("payload %s still contains credentials", kept)
+	}
+
+	// 不是对象的负载原样返回
+	if got := string(redactPayload(json.RawMessage(`"text"`), true)); got != `"text"` {
+		t.Fatalf("redactPayload changed a non-object payload to %s", got)
+	}
+}
+
+func TestAuditRecordRedactedOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewAuditService(AuditConfig{Dir: dir, RedactSDP: true})
+	if err != nil {
+		t.Fatalf("NewAuditService: %v", err)
+	}
+
+	s.Record(model.AuditDirectionOutbound, "camera-1", &model.Event{
+		Type:    model.EventTypeConnect,
+		RoomID:  "room",
+		Payload: json.RawMessage(`{"resumeToken":"secret-token"}`),
+	})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, auditFilePrefix+"*"))
+	if len(files) != 1 {
+		t.Fatalf("got audit files %v, want one", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read audit file: %v", err)
+	}
+	if strings.Contains(string(data), "secret-token") || !strings.Contains(string(data), redactedValue) {
+		t.Fatalf("audit file was not redacted: %s", data)
+	}
+}
+
+func TestAuditQuerySkipsFilesOutsideRange(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewAuditService(AuditConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewAuditService: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	today := now.UTC().Format(auditDayLayout)
+	record, _ := json.Marshal(&model.AuditRecord{
+		Time:      now.UnixNano() / int64(time.Millisecond),
+		Direction: model.AuditDirectionInbound,
+		RoomID:    "room",
+		DeviceID:  "camera-1",
+		Event:     &model.Event{Type: model.EventTypeOffer, RoomID: "room"},
+	})
+	if err := os.WriteFile(filepath.Join(dir, auditFilePrefix+today+auditFileSuffix), append(record, '\n'), 0o644); err != nil {
+		t.Fatalf("write audit file: %v", err)
+	}
+
+	// 旧日期的文件指向目录，读取时会出错；按日期过滤后不应被打开
+	if err := os.Symlink(t.TempDir(), filepath.Join(dir, auditFilePrefix+"2020-01-01"+auditFileSuffix)); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	records, err := s.Query(&model.AuditQuery{
+		RoomID:    "room",
+		StartTime: now.Add(-time.Hour).UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("Query read a file outside the time range: %v", err)
+	}
+	if len(records) != 1 || records[0].DeviceID != "camera-1" {
+		t.Fatalf("Query returned %+v, want the record from today", records)
+	}
+
+	// 不限制时间时会读取旧文件
+	if _, err := s.Query(&model.AuditQuery{RoomID: "room"}); err == nil {
+		t.Fatal("Query without a time range did not read the old file")
+	}
+}
+
+func TestAuditDroppedCounter(t *testing.T) {
+	// 不启动写入协程，队列满后新记录被丢弃
+	s := &AuditServiceImpl{
+		config:  AuditConfig{Dir: t.TempDir()},
+		records: make(chan *model.AuditRecord, 2),
+		stop:    make(chan struct{}),
+	}
+
+	for i := 0; i < 5; i++ {
+		s.Record(model.AuditDirectionInbound, "camera-1", &model.Event{Type: model.EventTypeOffer, RoomID: "room"})
+	}
+
+	if got := s.Dropped(); got != 3 {
+		t.Fatalf("Dropped() = %d, want 3", got)
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"monitor/model"
+)
+
+// ClusterService 集群房间服务接口
+// 在本节点房间服务的基础上，通过消息总线同步各节点的设备，
+// 提供整个集群的房间视图，并把发往其他节点设备的事件转发给对应节点
+type ClusterService interface {
+	RoomService
+
+	// SetEventHandler 设置处理其他节点转发事件的处理器，需要在Start之前调用
+	SetEventHandler(handler ClusterEventHandler)
+
+	// Start 订阅消息总线并开始发送心跳
+	Start() error
+
+	// NodeID 获取本节点ID
+	NodeID() string
+
+	// GetNodes 获取当前可见的集群节点
+	GetNodes() []*model.ClusterNode
+
+	// AcquireRoom 获取房间所有权：租约空闲时由本节点获取，返回房间当前所属节点
+	AcquireRoom(roomID string) (*model.RoomOwner, error)
+
+	// GetRoomOwner 获取房间当前所属节点，不尝试获取租约
+	GetRoomOwner(roomID string) (*model.RoomOwner, error)
+
+	// UpdateDeviceStatusWithCause 更新设备状态，设备在其他节点时连同引起变化的事件类型发送给其所在节点，
+	// 由该节点的ClusterEventHandler.HandleRemoteStatus记录
+	UpdateDeviceStatusWithCause(roomID string, deviceID string, status model.DeviceStatus, cause model.EventType) error
+
+	// ReleaseRooms 释放本节点持有的所有房间租约并不再获取新的租约，用于关闭前让其他节点接管
+	ReleaseRooms()
+
+	// Close 通知其他节点本节点下线，释放房间租约并关闭消息总线
+	Close()
+}
+
+// ClusterEventHandler 处理其他节点转发的事件
+type ClusterEventHandler interface {
+	// DeliverRemoteEvent 将其他节点转发的事件发送给本节点的设备
+	DeliverRemoteEvent(roomID string, deviceID string, event *model.Event) error
+
+	// HandleRemoteDeviceLeave 清理其他节点上的设备离开后残留的会话状态
+	HandleRemoteDeviceLeave(roomID string, deviceID string)
+
+	// HandleRemoteStatus 按其他节点的请求更新本节点设备的状态，与本节点的状态变化一样记录状态历史并发布活动
+	HandleRemoteStatus(roomID string, deviceID string, status model.DeviceStatus, cause model.EventType) error
+}
@@ -0,0 +1,1254 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"monitor/cluster"
+	"monitor/logger"
+	"monitor/metrics"
+	"monitor/model"
+)
+
+const (
+	// clusterPublishTimeout 发布单条集群消息的超时时间
+	clusterPublishTimeout = 5 * time.Second
+	// defaultHeartbeatInterval 默认心跳间隔
+	defaultHeartbeatInterval = 2 * time.Second
+	// defaultLeaseTTL 默认房间租约有效期
+	defaultLeaseTTL = 15 * time.Second
+	// createRoomAttempts 创建房间时房间号被其他节点占用的最大重试次数
+	createRoomAttempts = 5
+	// clusterDeliveryQueueSize 转发给本节点单个设备的事件等待写入的数量上限
+	clusterDeliveryQueueSize = 256
+)
+
+// errDeliveryQueueFull 设备的转发事件队列已满，设备接收过慢
+var errDeliveryQueueFull = errors.New("设备的转发事件队列已满")
+
+// ClusterConfig 集群配置
+type ClusterConfig struct {
+	NodeID            string             // 节点唯一标识，集群内不能重复
+	HeartbeatInterval time.Duration      // 心跳间隔
+	NodeTimeout       time.Duration      // 超过该时长没有收到消息的节点视为下线，其设备全部离开房间
+	AdvertiseURL      string             // 本节点对外地址，其他节点据此代理或重定向连接
+	Leases            cluster.LeaseStore // 房间租约存储，为空时不限制房间所属节点
+	LeaseTTL          time.Duration      // 房间租约有效期，每隔三分之一有效期续约一次
+}
+
+// clusterMessageType 集群消息类型
+type clusterMessageType string
+
+const (
+	clusterMessageHeartbeat    clusterMessageType = "heartbeat"     // 节点心跳
+	clusterMessageSyncRequest  clusterMessageType = "sync_request"  // 请求节点发送本节点的全部房间和设备
+	clusterMessageNodeLeave    clusterMessageType = "node_leave"    // 节点下线
+	clusterMessageRoom         clusterMessageType = "room"          // 房间创建或同步
+	clusterMessageDeviceJoin   clusterMessageType = "device_join"   // 设备加入或同步
+	clusterMessageDeviceUpdate clusterMessageType = "device_update" // 设备信息变化
+	clusterMessageDeviceLeave  clusterMessageType = "device_leave"  // 设备离开
+	clusterMessageStatus       clusterMessageType = "status"        // 请求设备所在节点更新设备状态
+	clusterMessageEvent        clusterMessageType = "event"         // 转发给设备的事件
+	clusterMessageChat         clusterMessageType = "chat"          // 房间聊天记录
+)
+
+// clusterMessage 节点间消息
+type clusterMessage struct {
+	Type       clusterMessageType `json:"type"`
+	NodeID     string             `json:"nodeId"`               // 发送节点
+	TargetNode string             `json:"targetNode,omitempty"` // 接收节点，为空时所有节点处理
+	StartTime  int64              `json:"startTime,omitempty"`  // 发送节点的启动时间，仅心跳携带
+	URL        string             `json:"url,omitempty"`        // 发送节点的对外地址，仅心跳携带
+	RoomID     string             `json:"roomId,omitempty"`
+	DeviceID   string             `json:"deviceId,omitempty"`
+	Room       *clusterRoom       `json:"room,omitempty"`
+	Device     *model.Device      `json:"device,omitempty"`
+	Status     model.DeviceStatus `json:"status,omitempty"`
+	Cause      model.EventType    `json:"cause,omitempty"`      // 引起状态变化的事件类型，仅status消息携带
+	RoomClosed bool               `json:"roomClosed,omitempty"` // 设备离开后发送节点上的房间已删除
+	Event      *model.Event       `json:"event,omitempty"`
+	Chat       *model.ChatMessage `json:"chat,omitempty"`
+}
+
+// clusterRoom 其他节点上的房间信息
+type clusterRoom struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CreateTime int64  `json:"createTime"`
+}
+
+// remoteDevice 其他节点上的设备
+type remoteDevice struct {
+	nodeID string
+	device *model.Device // 更新时整体替换，读取方不需要加锁
+}
+
+// deliveryQueue 转发给本节点某个设备的事件队列，由单独的协程按顺序写入设备连接，
+// 接收过慢的设备不会阻塞消息总线的接收协程
+type deliveryQueue struct {
+	mutex   sync.Mutex
+	events  []*model.Event
+	running bool // 写入协程是否在运行
+	retired bool // 队列已清空并从映射表移除，不再接受新事件
+}
+
+// clusterNode 其他节点的状态
+type clusterNode struct {
+	startTime int64
+	url       string
+	lastSeen  time.Time
+}
+
+// ClusterServiceImpl 集群房间服务实现
+// 设备连接只保存在本节点的房间服务中，其他节点的房间和设备通过消息总线同步到本地副本；
+// 所有消息使用同一个频道，保证同一节点发出的设备加入和转发事件按顺序到达
+type ClusterServiceImpl struct {
+	local     RoomService
+	bus       cluster.Bus
+	config    ClusterConfig
+	startTime int64
+	handler   ClusterEventHandler
+
+	mutex   sync.RWMutex
+	nodes   map[string]*clusterNode             // 其他节点，key为节点ID
+	rooms   map[string]map[string]*clusterRoom  // 其他节点上的房间，key为roomID和节点ID
+	devices map[string]map[string]*remoteDevice // 其他节点上的设备，key为roomID和deviceID
+
+	leaseMutex     sync.Mutex
+	leases         map[string]time.Time     // 本节点持有的房间租约，value为最近一次获取或续约成功的时间
+	releasing      map[string]chan struct{} // 正在租约存储中释放的房间租约，释放完成后关闭
+	leasesReleased bool                     // 已释放所有租约，不再获取新的租约
+
+	deliveries sync.Map // 本节点设备的转发事件队列，key为roomID/deviceID，value为*deliveryQueue
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewClusterService 创建集群房间服务，local为本节点的房间服务
+func NewClusterService(config ClusterConfig, local RoomService, bus cluster.Bus) ClusterService {
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if config.NodeTimeout <= config.HeartbeatInterval {
+		config.NodeTimeout = 3 * config.HeartbeatInterval
+	}
+	if config.LeaseTTL <= 0 {
+		config.LeaseTTL = defaultLeaseTTL
+	}
+
+	return &ClusterServiceImpl{
+		local:     local,
+		bus:       bus,
+		config:    config,
+		startTime: time.Now().UnixNano() / int64(time.Millisecond),
+		nodes:     make(map[string]*clusterNode),
+		rooms:     make(map[string]map[string]*clusterRoom),
+		devices:   make(map[string]map[string]*remoteDevice),
+		leases:    make(map[string]time.Time),
+		releasing: make(map[string]chan struct{}),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// SetEventHandler 设置处理其他节点转发事件的处理器
+func (s *ClusterServiceImpl) SetEventHandler(handler ClusterEventHandler) {
+	s.handler = handler
+}
+
+// Start 订阅消息总线，宣告本节点上线并请求其他节点同步设备
+func (s *ClusterServiceImpl) Start() error {
+	if s.handler == nil {
+		return errors.New("未设置集群事件处理器")
+	}
+
+	if err := s.bus.Subscribe(s.handleMessage); err != nil {
+		return err
+	}
+
+	s.publish(s.heartbeat())
+	s.publish(&clusterMessage{Type: clusterMessageSyncRequest})
+
+	go s.run()
+
+	slog.Info("cluster started", "nodeId", s.config.NodeID,
+		"heartbeatInterval", s.config.HeartbeatInterval, "nodeTimeout", s.config.NodeTimeout)
+	return nil
+}
+
+// run 定时发送心跳、移除超时的节点并续约房间租约
+func (s *ClusterServiceImpl) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	// 未配置租约存储时renew为nil，不会触发
+	var renew <-chan time.Time
+	if s.config.Leases != nil {
+		renewTicker := time.NewTicker(s.config.LeaseTTL / 3)
+		defer renewTicker.Stop()
+		renew = renewTicker.C
+	}
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.publish(s.heartbeat())
+			s.expireNodes()
+		case <-renew:
+			s.renewLeases()
+		}
+	}
+}
+
+// heartbeat 构造心跳消息
+func (s *ClusterServiceImpl) heartbeat() *clusterMessage {
+	return &clusterMessage{
+		Type:      clusterMessageHeartbeat,
+		StartTime: s.startTime,
+		URL:       s.config.AdvertiseURL,
+	}
+}
+
+// Close 通知其他节点本节点下线，并关闭消息总线
+func (s *ClusterServiceImpl) Close() {
+	select {
+	case <-s.stop:
+		return
+	default:
+		close(s.stop)
+	}
+
+	select {
+	case <-s.done:
+	case <-time.After(clusterPublishTimeout):
+	}
+
+	s.ReleaseRooms()
+	s.publish(&clusterMessage{Type: clusterMessageNodeLeave})
+	if err := s.bus.Close(); err != nil {
+		slog.Warn("close cluster bus failed", logger.KeyError, err)
+	}
+	if s.config.Leases != nil {
+		if err := s.config.Leases.Close(); err != nil {
+			slog.Warn("close lease store failed", logger.KeyError, err)
+		}
+	}
+}
+
+// NodeID 获取本节点ID
+func (s *ClusterServiceImpl) NodeID() string {
+	return s.config.NodeID
+}
+
+// GetNodes 获取当前可见的集群节点，包括本节点
+func (s *ClusterServiceImpl) GetNodes() []*model.ClusterNode {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	localDevices := 0
+	rooms, _ := s.local.GetRooms()
+	for _, room := range rooms {
+		devices, err := s.local.GetDevicesInRoom(room.ID)
+		if err == nil {
+			localDevices += len(devices)
+		}
+	}
+
+	nodes := []*model.ClusterNode{{
+		ID:        s.config.NodeID,
+		URL:       s.config.AdvertiseURL,
+		Self:      true,
+		Devices:   localDevices,
+		StartTime: s.startTime,
+		LastSeen:  now,
+	}}
+
+	s.mutex.RLock()
+	counts := make(map[string]int)
+	for _, byID := range s.devices {
+		for _, remote := range byID {
+			counts[remote.nodeID]++
+		}
+	}
+	for nodeID, node := range s.nodes {
+		nodes = append(nodes, &model.ClusterNode{
+			ID:        nodeID,
+			URL:       node.url,
+			Devices:   counts[nodeID],
+			StartTime: node.startTime,
+			LastSeen:  node.lastSeen.UnixNano() / int64(time.Millisecond),
+		})
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes
+}
+
+// AcquireRoom 获取房间所有权：租约空闲时由本节点获取，返回房间当前所属节点
+func (s *ClusterServiceImpl) AcquireRoom(roomID string) (*model.RoomOwner, error) {
+	if s.config.Leases == nil {
+		return s.roomOwner(roomID, s.config.NodeID), nil
+	}
+
+	s.leaseMutex.Lock()
+	_, owned := s.leases[roomID]
+	released := s.leasesReleased
+	releasing := s.releasing[roomID]
+	s.leaseMutex.Unlock()
+
+	if owned {
+		return s.roomOwner(roomID, s.config.NodeID), nil
+	}
+	if released {
+		return s.GetRoomOwner(roomID)
+	}
+	// 等待正在进行的释放完成，避免重新获取到随后被释放的租约
+	if releasing != nil {
+		<-releasing
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterPublishTimeout)
+	defer cancel()
+
+	holder, err := s.config.Leases.Acquire(ctx, roomLeaseKey(roomID), s.config.NodeID, s.config.LeaseTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if holder == s.config.NodeID {
+		s.leaseMutex.Lock()
+		s.leases[roomID] = time.Now()
+		s.leaseMutex.Unlock()
+		slog.Debug("room lease acquired", logger.KeyRoomID, roomID)
+	}
+
+	return s.roomOwner(roomID, holder), nil
+}
+
+// GetRoomOwner 获取房间当前所属节点，不尝试获取租约
+func (s *ClusterServiceImpl) GetRoomOwner(roomID string) (*model.RoomOwner, error) {
+	if s.config.Leases == nil {
+		return s.roomOwner(roomID, s.config.NodeID), nil
+	}
+
+	s.leaseMutex.Lock()
+	_, owned := s.leases[roomID]
+	s.leaseMutex.Unlock()
+	if owned {
+		return s.roomOwner(roomID, s.config.NodeID), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterPublishTimeout)
+	defer cancel()
+
+	holder, err := s.config.Leases.Holder(ctx, roomLeaseKey(roomID))
+	if err != nil {
+		return nil, err
+	}
+	if holder == "" {
+		return nil, errors.New("房间没有所属节点")
+	}
+
+	return s.roomOwner(roomID, holder), nil
+}
+
+// ReleaseRooms 释放本节点持有的所有房间租约并不再获取新的租约
+func (s *ClusterServiceImpl) ReleaseRooms() {
+	if s.config.Leases == nil {
+		return
+	}
+
+	s.leaseMutex.Lock()
+	s.leasesReleased = true
+	roomIDs := make([]string, 0, len(s.leases))
+	for roomID := range s.leases {
+		roomIDs = append(roomIDs, roomID)
+	}
+	s.leaseMutex.Unlock()
+
+	for _, roomID := range roomIDs {
+		s.releaseRoom(roomID)
+	}
+	if len(roomIDs) > 0 {
+		slog.Info("room leases released", "rooms", len(roomIDs))
+	}
+}
+
+// releaseRoom 释放房间租约
+func (s *ClusterServiceImpl) releaseRoom(roomID string) {
+	if s.config.Leases == nil {
+		return
+	}
+
+	s.leaseMutex.Lock()
+	_, owned := s.leases[roomID]
+	delete(s.leases, roomID)
+	s.leaseMutex.Unlock()
+	if owned {
+		s.releaseLease(roomID)
+	}
+}
+
+// releaseIdleRoom 房间已没有本节点的设备时释放租约。检查房间和移除租约记录在leaseMutex内完成，
+// 租约存储的释放在锁外进行，期间AcquireRoom等待释放完成后再重新获取；
+// 并发加入的设备在加入后由confirmRoomLease确认租约，避免房间重新创建后租约被释放
+func (s *ClusterServiceImpl) releaseIdleRoom(roomID string) {
+	if s.config.Leases == nil {
+		return
+	}
+
+	s.leaseMutex.Lock()
+	if _, err := s.local.GetRoom(roomID); err == nil {
+		s.leaseMutex.Unlock()
+		return
+	}
+	if _, owned := s.leases[roomID]; !owned {
+		s.leaseMutex.Unlock()
+		return
+	}
+	delete(s.leases, roomID)
+	done := make(chan struct{})
+	s.releasing[roomID] = done
+	s.leaseMutex.Unlock()
+
+	s.releaseLease(roomID)
+
+	s.leaseMutex.Lock()
+	delete(s.releasing, roomID)
+	s.leaseMutex.Unlock()
+	close(done)
+}
+
+// confirmRoomLease 设备加入本节点的房间后确认租约仍由本节点持有，
+// 租约在加入期间被释放时重新获取，返回房间是否仍由本节点处理
+func (s *ClusterServiceImpl) confirmRoomLease(roomID string) bool {
+	if s.config.Leases == nil {
+		return true
+	}
+
+	s.leaseMutex.Lock()
+	_, owned := s.leases[roomID]
+	s.leaseMutex.Unlock()
+	if owned {
+		return true
+	}
+
+	owner, err := s.AcquireRoom(roomID)
+	if err != nil {
+		slog.Warn("reacquire room lease failed", logger.KeyRoomID, roomID, logger.KeyError, err)
+		return false
+	}
+	return owner.Self
+}
+
+// releaseLease 在租约存储中释放本节点持有的房间租约
+func (s *ClusterServiceImpl) releaseLease(roomID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterPublishTimeout)
+	defer cancel()
+
+	if err := s.config.Leases.Release(ctx, roomLeaseKey(roomID), s.config.NodeID); err != nil {
+		slog.Warn("release room lease failed", logger.KeyRoomID, roomID, logger.KeyError, err)
+	}
+}
+
+// renewLeases 续约本节点持有的房间租约；租约已被其他节点获取，
+// 或超过有效期仍无法续约时放弃房间，断开房间内本节点的连接使设备重连到新的所属节点
+func (s *ClusterServiceImpl) renewLeases() {
+	s.leaseMutex.Lock()
+	renewed := make(map[string]time.Time, len(s.leases))
+	for roomID, renewTime := range s.leases {
+		renewed[roomID] = renewTime
+	}
+	s.leaseMutex.Unlock()
+
+	for roomID, renewTime := range renewed {
+		// 获取租约后没有设备加入（如连接握手失败），释放租约避免一直占用房间
+		if _, err := s.local.GetRoom(roomID); err != nil {
+			s.releaseIdleRoom(roomID)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), clusterPublishTimeout)
+		ok, err := s.config.Leases.Renew(ctx, roomLeaseKey(roomID), s.config.NodeID, s.config.LeaseTTL)
+		cancel()
+
+		if err == nil && ok {
+			s.leaseMutex.Lock()
+			if _, exists := s.leases[roomID]; exists {
+				s.leases[roomID] = time.Now()
+			}
+			s.leaseMutex.Unlock()
+			continue
+		}
+
+		if err != nil {
+			if time.Since(renewTime) < s.config.LeaseTTL {
+				slog.Warn("renew room lease failed", logger.KeyRoomID, roomID, logger.KeyError, err)
+				continue
+			}
+			slog.Warn("room lease expired without renewal", logger.KeyRoomID, roomID, logger.KeyError, err)
+		} else {
+			slog.Warn("room lease lost", logger.KeyRoomID, roomID)
+		}
+
+		s.leaseMutex.Lock()
+		delete(s.leases, roomID)
+		s.leaseMutex.Unlock()
+		s.evictRoom(roomID)
+	}
+}
+
+// evictRoom 断开房间内本节点的所有连接，设备重连后由新的所属节点处理
+func (s *ClusterServiceImpl) evictRoom(roomID string) {
+	devices, err := s.local.GetDevicesInRoom(roomID)
+	if err != nil {
+		return
+	}
+
+	for _, device := range devices {
+		conn, err := s.local.GetDeviceConnection(roomID, device.ID)
+		if err != nil {
+			continue
+		}
+		conn.GetConn().WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseServiceRestart, "room moved"), time.Now().Add(time.Second))
+		conn.GetConn().Close()
+	}
+	slog.Info("room evicted", logger.KeyRoomID, roomID, "devices", len(devices))
+}
+
+// roomOwner 构造房间所属节点信息
+func (s *ClusterServiceImpl) roomOwner(roomID string, nodeID string) *model.RoomOwner {
+	owner := &model.RoomOwner{
+		RoomID: roomID,
+		NodeID: nodeID,
+		Self:   nodeID == s.config.NodeID,
+	}
+
+	if owner.Self {
+		owner.URL = s.config.AdvertiseURL
+		return owner
+	}
+
+	s.mutex.RLock()
+	if node, exists := s.nodes[nodeID]; exists {
+		owner.URL = node.url
+	}
+	s.mutex.RUnlock()
+
+	return owner
+}
+
+// CreateRoom 在本节点创建房间并同步给其他节点，房间号已被其他节点持有时重新生成
+func (s *ClusterServiceImpl) CreateRoom(name string) (*model.Room, error) {
+	for attempt := 0; attempt < createRoomAttempts; attempt++ {
+		room, err := s.local.CreateRoom(name)
+		if err != nil {
+			return nil, err
+		}
+
+		owner, err := s.AcquireRoom(room.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !owner.Self {
+			continue
+		}
+
+		s.publish(&clusterMessage{Type: clusterMessageRoom, RoomID: room.ID, Room: toClusterRoom(room)})
+		return room, nil
+	}
+
+	return nil, errors.New("房间号已被占用，请重试")
+}
+
+// GetRooms 获取集群内所有房间
+func (s *ClusterServiceImpl) GetRooms() ([]*model.Room, error) {
+	rooms, err := s.local.GetRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(rooms))
+	for _, room := range rooms {
+		seen[room.ID] = true
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for roomID, byNode := range s.rooms {
+		if !seen[roomID] {
+			rooms = append(rooms, newRemoteRoom(roomID, byNode))
+		}
+	}
+
+	return rooms, nil
+}
+
+// GetRoom 获取房间信息，本节点没有该房间时使用其他节点的房间信息
+func (s *ClusterServiceImpl) GetRoom(roomID string) (*model.Room, error) {
+	room, err := s.local.GetRoom(roomID)
+	if err == nil {
+		return room, nil
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	byNode, exists := s.rooms[roomID]
+	if !exists {
+		return nil, err
+	}
+	return newRemoteRoom(roomID, byNode), nil
+}
+
+// JoinRoom 设备加入本节点的房间，房间必须由本节点持有，Monitor数量限制在整个集群内检查
+func (s *ClusterServiceImpl) JoinRoom(roomID string, device *model.Device, conn *websocket.Conn) error {
+	owner, err := s.AcquireRoom(roomID)
+	if err != nil {
+		return err
+	}
+	if !owner.Self {
+		return errors.New("房间由其他节点处理")
+	}
+
+	if device.Type == model.DeviceTypeMonitor && s.findRemoteMonitor(roomID) != nil {
+		return model.ErrRoomHasMonitor
+	}
+
+	if err := s.local.JoinRoom(roomID, device, conn); err != nil {
+		return err
+	}
+
+	// 房间在获取所有权之后可能因没有设备而释放了租约
+	if !s.confirmRoomLease(roomID) {
+		s.local.LeaveRoom(roomID, device.ID, conn)
+		return errors.New("房间由其他节点处理")
+	}
+
+	message := &clusterMessage{
+		Type:     clusterMessageDeviceJoin,
+		RoomID:   roomID,
+		DeviceID: device.ID,
+		Device:   copyDevice(device),
+	}
+	if room, err := s.local.GetRoom(roomID); err == nil {
+		message.Room = toClusterRoom(room)
+	}
+	s.publish(message)
+
+	return nil
+}
+
+// LeaveRoom 设备离开本节点的房间并同步给其他节点
+func (s *ClusterServiceImpl) LeaveRoom(roomID string, deviceID string, conn *websocket.Conn) error {
+	if err := s.local.LeaveRoom(roomID, deviceID, conn); err != nil {
+		return err
+	}
+
+	_, err := s.local.GetRoom(roomID)
+	roomClosed := err != nil
+	s.publish(&clusterMessage{
+		Type:       clusterMessageDeviceLeave,
+		RoomID:     roomID,
+		DeviceID:   deviceID,
+		RoomClosed: roomClosed,
+	})
+
+	// 房间已没有本节点的设备，释放租约使其他节点可以接管
+	if roomClosed {
+		s.releaseIdleRoom(roomID)
+	}
+
+	return nil
+}
+
+// UpdateDeviceStatus 更新设备状态，其他节点上的设备由其所在节点更新
+func (s *ClusterServiceImpl) UpdateDeviceStatus(roomID string, deviceID string, status model.DeviceStatus) error {
+	return s.UpdateDeviceStatusWithCause(roomID, deviceID, status, "")
+}
+
+// UpdateDeviceStatusWithCause 更新设备状态，设备在其他节点时连同引起变化的事件类型发送给其所在节点
+func (s *ClusterServiceImpl) UpdateDeviceStatusWithCause(roomID string, deviceID string, status model.DeviceStatus, cause model.EventType) error {
+	if _, err := s.local.GetDeviceById(roomID, deviceID); err == nil {
+		return s.updateLocalDeviceStatus(roomID, deviceID, status)
+	}
+
+	s.mutex.Lock()
+	remote := s.devices[roomID][deviceID]
+	if remote == nil {
+		s.mutex.Unlock()
+		return s.local.UpdateDeviceStatus(roomID, deviceID, status)
+	}
+
+	// 先更新本地副本，使后续处理立即看到新状态
+	device := copyDevice(remote.device)
+	device.Status = status
+	device.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
+	s.devices[roomID][deviceID] = &remoteDevice{nodeID: remote.nodeID, device: device}
+	s.mutex.Unlock()
+
+	return s.publish(&clusterMessage{
+		Type:       clusterMessageStatus,
+		TargetNode: remote.nodeID,
+		RoomID:     roomID,
+		DeviceID:   deviceID,
+		Status:     status,
+		Cause:      cause,
+	})
+}
+
+// updateLocalDeviceStatus 更新本节点设备的状态并同步给其他节点
+func (s *ClusterServiceImpl) updateLocalDeviceStatus(roomID string, deviceID string, status model.DeviceStatus) error {
+	if err := s.local.UpdateDeviceStatus(roomID, deviceID, status); err != nil {
+		return err
+	}
+
+	if device, err := s.local.GetDeviceById(roomID, deviceID); err == nil {
+		s.publish(&clusterMessage{
+			Type:     clusterMessageDeviceUpdate,
+			RoomID:   roomID,
+			DeviceID: deviceID,
+			Device:   copyDevice(device),
+		})
+	}
+
+	return nil
+}
+
+// GetDevicesInRoom 获取集群内房间的所有设备
+func (s *ClusterServiceImpl) GetDevicesInRoom(roomID string) ([]*model.Device, error) {
+	devices, err := s.local.GetDevicesInRoom(roomID)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	remotes := s.devices[roomID]
+	if err != nil {
+		if _, exists := s.rooms[roomID]; !exists && len(remotes) == 0 {
+			return nil, err
+		}
+		devices = make([]*model.Device, 0, len(remotes))
+	}
+
+	local := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		local[device.ID] = true
+	}
+	for deviceID, remote := range remotes {
+		if !local[deviceID] {
+			devices = append(devices, remote.device)
+		}
+	}
+
+	return devices, nil
+}
+
+// GetCamerasInRoom 获取集群内房间的所有Camera设备
+func (s *ClusterServiceImpl) GetCamerasInRoom(roomID string) ([]*model.Device, error) {
+	devices, err := s.GetDevicesInRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	cameras := make([]*model.Device, 0)
+	for _, device := range devices {
+		if device.Type == model.DeviceTypeCamera {
+			cameras = append(cameras, device)
+		}
+	}
+
+	return cameras, nil
+}
+
+// GetMonitorInRoom 获取集群内房间的Monitor设备
+func (s *ClusterServiceImpl) GetMonitorInRoom(roomID string) (*model.Device, error) {
+	devices, err := s.GetDevicesInRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		if device.Type == model.DeviceTypeMonitor {
+			return device, nil
+		}
+	}
+
+	return nil, errors.New("房间内没有Monitor设备")
+}
+
+// GetDeviceById 根据设备ID获取设备信息，本节点优先
+func (s *ClusterServiceImpl) GetDeviceById(roomID string, deviceID string) (*model.Device, error) {
+	device, err := s.local.GetDeviceById(roomID, deviceID)
+	if err == nil {
+		return device, nil
+	}
+
+	if remote := s.findRemoteDevice(roomID, deviceID); remote != nil {
+		return remote.device, nil
+	}
+	return nil, err
+}
+
+// GetDeviceConnection 获取本节点设备的WebSocket连接，设备在其他节点时返回ErrRemoteDevice
+func (s *ClusterServiceImpl) GetDeviceConnection(roomID string, deviceID string) (*model.SafeConn, error) {
+	conn, err := s.local.GetDeviceConnection(roomID, deviceID)
+	if err == nil {
+		return conn, nil
+	}
+
+	if s.findRemoteDevice(roomID, deviceID) != nil {
+		return nil, ErrRemoteDevice
+	}
+	return nil, err
+}
+
+// ForwardEvent 将事件转发给设备所在的节点
+func (s *ClusterServiceImpl) ForwardEvent(roomID string, deviceID string, event *model.Event) error {
+	remote := s.findRemoteDevice(roomID, deviceID)
+	if remote == nil {
+		return errors.New("设备不存在")
+	}
+
+	return s.publish(&clusterMessage{
+		Type:       clusterMessageEvent,
+		TargetNode: remote.nodeID,
+		RoomID:     roomID,
+		DeviceID:   deviceID,
+		Event:      event,
+	})
+}
+
+// AddChatMessage 记录房间聊天消息并同步给其他节点
+func (s *ClusterServiceImpl) AddChatMessage(roomID string, message *model.ChatMessage) error {
+	if err := s.local.AddChatMessage(roomID, message); err != nil {
+		return err
+	}
+
+	s.publish(&clusterMessage{Type: clusterMessageChat, RoomID: roomID, Chat: message})
+	return nil
+}
+
+// GetChatMessages 获取对指定设备可见的房间聊天记录
+func (s *ClusterServiceImpl) GetChatMessages(roomID string, deviceID string) ([]*model.ChatMessage, error) {
+	return s.local.GetChatMessages(roomID, deviceID)
+}
+
+// handleMessage 处理其他节点发来的消息，由消息总线的接收协程按顺序调用
+func (s *ClusterServiceImpl) handleMessage(data []byte) {
+	var message clusterMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		slog.Warn("parse cluster message failed", logger.KeyError, err)
+		return
+	}
+
+	// 忽略本节点发出的消息和发给其他节点的消息
+	if message.NodeID == "" || message.NodeID == s.config.NodeID {
+		return
+	}
+	if message.TargetNode != "" && message.TargetNode != s.config.NodeID {
+		return
+	}
+	metrics.ClusterMessages.WithLabelValues("in", string(message.Type)).Inc()
+
+	if message.Type == clusterMessageNodeLeave {
+		slog.Info("cluster node left", "nodeId", message.NodeID)
+		s.removeNode(message.NodeID)
+		return
+	}
+	s.touchNode(&message)
+
+	switch message.Type {
+	case clusterMessageSyncRequest:
+		s.publishState()
+
+	case clusterMessageRoom:
+		if message.Room != nil {
+			s.mutex.Lock()
+			s.storeRoom(message.NodeID, message.Room)
+			s.mutex.Unlock()
+		}
+
+	case clusterMessageDeviceJoin, clusterMessageDeviceUpdate:
+		if message.Device != nil {
+			s.storeDevice(message.NodeID, message.RoomID, message.Room, message.Device)
+		}
+
+	case clusterMessageDeviceLeave:
+		if s.removeDevice(message.NodeID, message.RoomID, message.DeviceID, message.RoomClosed) {
+			s.handler.HandleRemoteDeviceLeave(message.RoomID, message.DeviceID)
+		}
+
+	case clusterMessageStatus:
+		// 与本节点的状态变化一样由事件处理器记录状态历史并发布活动
+		if err := s.handler.HandleRemoteStatus(message.RoomID, message.DeviceID, message.Status, message.Cause); err != nil {
+			slog.Debug("update device status from cluster failed",
+				logger.KeyRoomID, message.RoomID, logger.KeyDeviceID, message.DeviceID, logger.KeyError, err)
+		}
+
+	case clusterMessageEvent:
+		if message.Event == nil {
+			return
+		}
+		if err := s.deliverRemoteEvent(message.RoomID, message.DeviceID, message.Event); err != nil {
+			slog.Warn("deliver forwarded event failed",
+				logger.KeyRoomID, message.RoomID, logger.KeyDeviceID, message.DeviceID,
+				logger.KeyEventType, message.Event.Type, "nodeId", message.NodeID, logger.KeyError, err)
+		}
+
+	case clusterMessageChat:
+		// 本节点没有该房间时不需要保存聊天记录
+		if message.Chat != nil {
+			s.local.AddChatMessage(message.RoomID, message.Chat)
+		}
+	}
+}
+
+// deliverRemoteEvent 把转发的事件放入设备的发送队列，由队列的写入协程发送给设备。
+// 队列已满时返回错误并断开设备连接，设备重连后重新同步房间状态
+func (s *ClusterServiceImpl) deliverRemoteEvent(roomID string, deviceID string, event *model.Event) error {
+	key := roomID + "/" + deviceID
+	for {
+		value, _ := s.deliveries.LoadOrStore(key, &deliveryQueue{})
+		queue := value.(*deliveryQueue)
+
+		queue.mutex.Lock()
+		if queue.retired {
+			// 写入协程刚清空并移除了队列，重新创建
+			queue.mutex.Unlock()
+			continue
+		}
+		if len(queue.events) >= clusterDeliveryQueueSize {
+			queue.mutex.Unlock()
+			s.disconnectSlowDevice(roomID, deviceID)
+			return errDeliveryQueueFull
+		}
+
+		queue.events = append(queue.events, event)
+		if !queue.running {
+			queue.running = true
+			go s.drainDeliveries(key, roomID, deviceID, queue)
+		}
+		queue.mutex.Unlock()
+		return nil
+	}
+}
+
+// drainDeliveries 按顺序把队列中的事件发送给设备，队列清空后移除队列并退出
+func (s *ClusterServiceImpl) drainDeliveries(key string, roomID string, deviceID string, queue *deliveryQueue) {
+	for {
+		queue.mutex.Lock()
+		if len(queue.events) == 0 {
+			queue.running = false
+			queue.retired = true
+			s.deliveries.CompareAndDelete(key, queue)
+			queue.mutex.Unlock()
+			return
+		}
+		event := queue.events[0]
+		queue.events[0] = nil
+		queue.events = queue.events[1:]
+		queue.mutex.Unlock()
+
+		if err := s.handler.DeliverRemoteEvent(roomID, deviceID, event); err != nil {
+			slog.Warn("deliver forwarded event failed",
+				logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, logger.KeyEventType, event.Type, logger.KeyError, err)
+		}
+	}
+}
+
+// disconnectSlowDevice 断开接收过慢的设备的连接
+func (s *ClusterServiceImpl) disconnectSlowDevice(roomID string, deviceID string) {
+	conn, err := s.local.GetDeviceConnection(roomID, deviceID)
+	if err != nil || conn.GetConn() == nil {
+		return
+	}
+
+	slog.Warn("forwarded event queue full, disconnecting device", logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID)
+	conn.GetConn().WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(time.Second))
+	conn.GetConn().Close()
+}
+
+// touchNode 记录节点活跃时间；首次收到节点心跳或节点重启后请求其同步设备
+func (s *ClusterServiceImpl) touchNode(message *clusterMessage) {
+	s.mutex.Lock()
+	node, exists := s.nodes[message.NodeID]
+	if !exists {
+		node = &clusterNode{}
+		s.nodes[message.NodeID] = node
+	}
+	node.lastSeen = time.Now()
+	if message.URL != "" {
+		node.url = message.URL
+	}
+
+	restarted, requestSync := false, false
+	if !exists {
+		slog.Info("cluster node joined", "nodeId", message.NodeID)
+	}
+	if message.Type == clusterMessageHeartbeat && node.startTime != message.StartTime {
+		restarted = node.startTime != 0
+		node.startTime = message.StartTime
+		requestSync = true
+	}
+	s.mutex.Unlock()
+
+	if restarted {
+		slog.Info("cluster node restarted", "nodeId", message.NodeID)
+		s.dropNodeState(message.NodeID)
+	}
+	if requestSync {
+		s.publish(&clusterMessage{Type: clusterMessageSyncRequest, TargetNode: message.NodeID})
+	}
+}
+
+// expireNodes 移除超时没有消息的节点
+func (s *ClusterServiceImpl) expireNodes() {
+	cutoff := time.Now().Add(-s.config.NodeTimeout)
+
+	s.mutex.RLock()
+	expired := make([]string, 0)
+	for nodeID, node := range s.nodes {
+		if node.lastSeen.Before(cutoff) {
+			expired = append(expired, nodeID)
+		}
+	}
+	s.mutex.RUnlock()
+
+	for _, nodeID := range expired {
+		slog.Warn("cluster node timed out", "nodeId", nodeID)
+		s.removeNode(nodeID)
+	}
+}
+
+// removeNode 移除节点及其房间和设备
+func (s *ClusterServiceImpl) removeNode(nodeID string) {
+	s.mutex.Lock()
+	delete(s.nodes, nodeID)
+	s.mutex.Unlock()
+
+	s.dropNodeState(nodeID)
+}
+
+// dropNodeState 移除节点上的房间和设备，并向本节点的设备发送这些设备离开房间的事件
+func (s *ClusterServiceImpl) dropNodeState(nodeID string) {
+	s.mutex.Lock()
+	removed := make([]*model.Device, 0)
+	for roomID, byID := range s.devices {
+		for deviceID, remote := range byID {
+			if remote.nodeID == nodeID {
+				removed = append(removed, remote.device)
+				delete(byID, deviceID)
+			}
+		}
+		if len(byID) == 0 {
+			delete(s.devices, roomID)
+		}
+	}
+	for roomID, byNode := range s.rooms {
+		delete(byNode, nodeID)
+		if len(byNode) == 0 {
+			delete(s.rooms, roomID)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, device := range removed {
+		// 设备已重新连接到本节点（如房间所属节点故障后转移），不再通知离开
+		if _, err := s.local.GetDeviceById(device.RoomID, device.ID); err == nil {
+			continue
+		}
+
+		s.handler.HandleRemoteDeviceLeave(device.RoomID, device.ID)
+
+		devices, err := s.local.GetDevicesInRoom(device.RoomID)
+		if err != nil {
+			continue
+		}
+
+		leaveRoomEvent := &model.Event{
+			Type:      model.EventTypeLeaveRoom,
+			RoomID:    device.RoomID,
+			DeviceID:  device.ID,
+			Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+			Payload:   json.RawMessage("{}"),
+		}
+		for _, local := range devices {
+			if err := s.deliverRemoteEvent(device.RoomID, local.ID, leaveRoomEvent); err != nil {
+				slog.Warn("send leave_room of remote device failed",
+					logger.KeyRoomID, device.RoomID, logger.KeyDeviceID, local.ID, logger.KeyError, err)
+			}
+		}
+	}
+}
+
+// publishState 发布本节点的全部房间和设备，供其他节点同步
+func (s *ClusterServiceImpl) publishState() {
+	rooms, err := s.local.GetRooms()
+	if err != nil {
+		return
+	}
+
+	for _, room := range rooms {
+		s.publish(&clusterMessage{Type: clusterMessageRoom, RoomID: room.ID, Room: toClusterRoom(room)})
+
+		devices, err := s.local.GetDevicesInRoom(room.ID)
+		if err != nil {
+			continue
+		}
+		for _, device := range devices {
+			s.publish(&clusterMessage{
+				Type:     clusterMessageDeviceJoin,
+				RoomID:   room.ID,
+				DeviceID: device.ID,
+				Device:   copyDevice(device),
+			})
+		}
+	}
+}
+
+// storeRoom 保存其他节点上的房间，调用方需持有写锁
+func (s *ClusterServiceImpl) storeRoom(nodeID string, room *clusterRoom) {
+	byNode, exists := s.rooms[room.ID]
+	if !exists {
+		byNode = make(map[string]*clusterRoom)
+		s.rooms[room.ID] = byNode
+	}
+	byNode[nodeID] = room
+}
+
+// storeDevice 保存其他节点上的设备
+func (s *ClusterServiceImpl) storeDevice(nodeID string, roomID string, room *clusterRoom, device *model.Device) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if room != nil {
+		s.storeRoom(nodeID, room)
+	}
+
+	byID, exists := s.devices[roomID]
+	if !exists {
+		byID = make(map[string]*remoteDevice)
+		s.devices[roomID] = byID
+	}
+	byID[device.ID] = &remoteDevice{nodeID: nodeID, device: device}
+}
+
+// removeDevice 移除其他节点上的设备，返回设备是否由该节点持有
+func (s *ClusterServiceImpl) removeDevice(nodeID string, roomID string, deviceID string, roomClosed bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 设备可能已重连到其他节点，只移除由发送节点持有的记录
+	removed := false
+	if byID, exists := s.devices[roomID]; exists {
+		if remote := byID[deviceID]; remote != nil && remote.nodeID == nodeID {
+			delete(byID, deviceID)
+			removed = true
+		}
+		if len(byID) == 0 {
+			delete(s.devices, roomID)
+		}
+	}
+
+	if byNode, exists := s.rooms[roomID]; exists && roomClosed {
+		delete(byNode, nodeID)
+		if len(byNode) == 0 {
+			delete(s.rooms, roomID)
+		}
+	}
+
+	return removed
+}
+
+// findRemoteDevice 查找其他节点上的设备
+func (s *ClusterServiceImpl) findRemoteDevice(roomID string, deviceID string) *remoteDevice {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.devices[roomID][deviceID]
+}
+
+// findRemoteMonitor 查找其他节点上的Monitor设备
+func (s *ClusterServiceImpl) findRemoteMonitor(roomID string) *remoteDevice {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, remote := range s.devices[roomID] {
+		if remote.device.Type == model.DeviceTypeMonitor {
+			return remote
+		}
+	}
+	return nil
+}
+
+// publish 发布集群消息，失败时记录日志并返回错误
+func (s *ClusterServiceImpl) publish(message *clusterMessage) error {
+	message.NodeID = s.config.NodeID
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterPublishTimeout)
+	defer cancel()
+
+	if err := s.bus.Publish(ctx, data); err != nil {
+		slog.Warn("publish cluster message failed", "type", message.Type, logger.KeyError, err)
+		return err
+	}
+
+	metrics.ClusterMessages.WithLabelValues("out", string(message.Type)).Inc()
+	return nil
+}
+
+// roomLeaseKey 房间租约的key
+func roomLeaseKey(roomID string) string {
+	return "room/" + roomID
+}
+
+// toClusterRoom 提取需要同步的房间信息
+func toClusterRoom(room *model.Room) *clusterRoom {
+	return &clusterRoom{
+		ID:         room.ID,
+		Name:       room.Name,
+		CreateTime: room.CreateTime,
+	}
+}
+
+// newRemoteRoom 根据其他节点的房间信息构造房间对象，多个节点都有该房间时使用最早创建的
+func newRemoteRoom(roomID string, byNode map[string]*clusterRoom) *model.Room {
+	var earliest *clusterRoom
+	for _, room := range byNode {
+		if earliest == nil || room.CreateTime < earliest.CreateTime {
+			earliest = room
+		}
+	}
+
+	if earliest == nil {
+		return model.NewRoom(roomID, "Room "+roomID, 0)
+	}
+	return model.NewRoom(roomID, earliest.Name, earliest.CreateTime)
+}
+
+// copyDevice 复制设备信息，避免发布或替换时与原对象共享可变字段
+func copyDevice(device *model.Device) *model.Device {
+	copied := *device
+	return &copied
+}
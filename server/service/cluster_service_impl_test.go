@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"monitor/cluster"
+	"monitor/model"
+)
+
+// clusterTestNode 使用进程内消息总线的集群节点
+type clusterTestNode struct {
+	cluster *ClusterServiceImpl
+	events  *EventServiceImpl
+	history StatusHistoryService
+}
+
+// newClusterTestNode 创建并启动集群节点，leases为nil时不限制房间所属节点
+func newClusterTestNode(t *testing.T, network *cluster.MemoryNetwork, nodeID string, leases cluster.LeaseStore) *clusterTestNode {
+	t.Helper()
+
+	clusterService := NewClusterService(ClusterConfig{
+		NodeID:            nodeID,
+		HeartbeatInterval: 50 * time.Millisecond,
+		AdvertiseURL:      "http://" + nodeID,
+		Leases:            leases,
+		LeaseTTL:          300 * time.Millisecond,
+	}, NewRoomService(), network.NewBus()).(*ClusterServiceImpl)
+
+	auditService, _ := NewAuditService(AuditConfig{})
+	webhookService, err := NewWebhookService(WebhookConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewWebhookService: %v", err)
+	}
+	t.Cleanup(webhookService.Close)
+
+	history := NewStatusHistoryService()
+	events := NewEventService(clusterService, NewActivityService(), auditService, NewQualityService(), history, webhookService).(*EventServiceImpl)
+	clusterService.SetEventHandler(events)
+	if err := clusterService.Start(); err != nil {
+		t.Fatalf("start %s: %v", nodeID, err)
+	}
+	t.Cleanup(clusterService.Close)
+
+	return &clusterTestNode{cluster: clusterService, events: events, history: history}
+}
+
+// join 设备通过新的连接加入节点上的房间，返回设备的客户端连接
+func (n *clusterTestNode) join(t *testing.T, roomID string, deviceID string, deviceType model.DeviceType) *websocket.Conn {
+	t.Helper()
+
+	serverConn, client := newTestConn(t)
+	if err := n.cluster.JoinRoom(roomID, &model.Device{ID: deviceID, Type: deviceType}, serverConn); err != nil {
+		t.Fatalf("join %s: %v", deviceID, err)
+	}
+	return client
+}
+
+// sees 节点是否能看到其他节点上的设备
+func (n *clusterTestNode) sees(roomID string, deviceID string) bool {
+	return n.cluster.findRemoteDevice(roomID, deviceID) != nil
+}
+
+func TestClusterForwardEvent(t *testing.T) {
+	network := cluster.NewMemoryNetwork()
+	a := newClusterTestNode(t, network, "a", nil)
+	b := newClusterTestNode(t, network, "b", nil)
+
+	a.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := b.join(t, "room", "monitor", model.DeviceTypeMonitor)
+	waitFor(t, "node a to see the monitor", func() bool { return a.sees("room", "monitor") })
+
+	offer := &model.Event{
+		Type:     model.EventTypeOffer,
+		RoomID:   "room",
+		DeviceID: "camera-1",
+		Payload:  json.RawMessage(`{"sdp":"v=0"}`),
+	}
+	if err := a.events.SendEventToDevice("room", "monitor", offer); err != nil {
+		t.Fatalf("SendEventToDevice: %v", err)
+	}
+
+	received := readEvent(t, monitor, model.EventTypeOffer)
+	if received.DeviceID != "camera-1" || string(received.Payload) != `{"sdp":"v=0"}` {
+		t.Fatalf("monitor received %+v", received)
+	}
+}
+
+func TestClusterRemoteStatusRecordedOnOwner(t *testing.T) {
+	network := cluster.NewMemoryNetwork()
+	a := newClusterTestNode(t, network, "a", nil)
+	b := newClusterTestNode(t, network, "b", nil)
+
+	b.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	waitFor(t, "node a to see the camera", func() bool { return a.sees("room", "camera-1") })
+
+	if err := a.events.updateDeviceStatus("room", "camera-1", model.DeviceStatusError, model.EventTypeNegotiationTimeout); err != nil {
+		t.Fatalf("updateDeviceStatus: %v", err)
+	}
+
+	// 设备所在节点与本地状态变化一样记录状态历史，并同步给其他节点
+	waitFor(t, "node b to record the status", func() bool {
+		history, err := b.history.GetHistory("room", "camera-1", 0, 0)
+		if err != nil {
+			return false
+		}
+		for _, transition := range history.Transitions {
+			if transition.To == model.DeviceStatusError && transition.Cause == model.EventTypeNegotiationTimeout {
+				return true
+			}
+		}
+		return false
+	})
+	waitFor(t, "node a to see the new status", func() bool {
+		device, err := a.cluster.GetDeviceById("room", "camera-1")
+		return err == nil && device.Status == model.DeviceStatusError
+	})
+
+	// 发起更新的节点不重复记录
+	if history, err := a.history.GetHistory("room", "camera-1", 0, 0); err == nil && len(history.Transitions) > 0 {
+		t.Fatalf("node a recorded %d transitions for a remote device", len(history.Transitions))
+	}
+}
+
+func TestClusterNodeLeave(t *testing.T) {
+	network := cluster.NewMemoryNetwork()
+	a := newClusterTestNode(t, network, "a", nil)
+	b := newClusterTestNode(t, network, "b", nil)
+
+	monitor := a.join(t, "room", "monitor", model.DeviceTypeMonitor)
+	b.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	waitFor(t, "node a to see the camera", func() bool { return a.sees("room", "camera-1") })
+
+	b.cluster.Close()
+
+	leave := readEvent(t, monitor, model.EventTypeLeaveRoom)
+	if leave.DeviceID != "camera-1" {
+		t.Fatalf("leave_room for %s, want camera-1", leave.DeviceID)
+	}
+	if a.sees("room", "camera-1") {
+		t.Fatal("node a still sees the camera of the departed node")
+	}
+	for _, node := range a.cluster.GetNodes() {
+		if node.ID == "b" {
+			t.Fatal("node b is still listed after leaving")
+		}
+	}
+}
+
+// blockingHandler 对指定设备的投递一直阻塞，用于模拟接收过慢的设备
+type blockingHandler struct {
+	slowID  string
+	blocked chan struct{} // 开始阻塞时通知
+	release chan struct{}
+
+	mutex     sync.Mutex
+	delivered map[string]int
+}
+
+func (h *blockingHandler) DeliverRemoteEvent(roomID string, deviceID string, event *model.Event) error {
+	if deviceID == h.slowID {
+		select {
+		case h.blocked <- struct{}{}:
+		default:
+		}
+		<-h.release
+	}
+	h.mutex.Lock()
+	h.delivered[deviceID]++
+	h.mutex.Unlock()
+	return nil
+}
+
+func (h *blockingHandler) HandleRemoteDeviceLeave(roomID string, deviceID string) {}
+
+func (h *blockingHandler) HandleRemoteStatus(roomID string, deviceID string, status model.DeviceStatus, cause model.EventType) error {
+	return nil
+}
+
+func (h *blockingHandler) count(deviceID string) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.delivered[deviceID]
+}
+
+func TestClusterSlowDeviceDoesNotBlockDelivery(t *testing.T) {
+	handler := &blockingHandler{
+		slowID:    "slow",
+		blocked:   make(chan struct{}, 1),
+		release:   make(chan struct{}),
+		delivered: make(map[string]int),
+	}
+	s := NewClusterService(ClusterConfig{NodeID: "a"}, NewRoomService(), cluster.NewMemoryNetwork().NewBus()).(*ClusterServiceImpl)
+	s.SetEventHandler(handler)
+
+	event := &model.Event{Type: model.EventTypeOffer, RoomID: "room"}
+
+	// 第一个事件阻塞在写入中，之后的事件填满队列
+	if err := s.deliverRemoteEvent("room", "slow", event); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	<-handler.blocked
+	for i := 0; i < clusterDeliveryQueueSize; i++ {
+		if err := s.deliverRemoteEvent("room", "slow", event); err != nil {
+			t.Fatalf("deliver %d: %v", i, err)
+		}
+	}
+	if err := s.deliverRemoteEvent("room", "slow", event); err != errDeliveryQueueFull {
+		t.Fatalf("deliver to a full queue returned %v, want errDeliveryQueueFull", err)
+	}
+
+	// 其他设备不受影响
+	if err := s.deliverRemoteEvent("room", "fast", event); err != nil {
+		t.Fatalf("deliver to fast device: %v", err)
+	}
+	waitFor(t, "the fast device to receive its event", func() bool { return handler.count("fast") == 1 })
+
+	close(handler.release)
+	waitFor(t, "the slow device to drain", func() bool { return handler.count("slow") == clusterDeliveryQueueSize+1 })
+	waitFor(t, "the drained queues to be removed", func() bool {
+		_, slow := s.deliveries.Load("room/slow")
+		_, fast := s.deliveries.Load("room/fast")
+		return !slow && !fast
+	})
+}
+
+func TestClusterRoomFailover(t *testing.T) {
+	network := cluster.NewMemoryNetwork()
+	leases := cluster.NewMemoryLeaseStore()
+	a := newClusterTestNode(t, network, "a", leases)
+	b := newClusterTestNode(t, network, "b", leases)
+
+	a.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	waitFor(t, "node b to learn the address of node a", func() bool {
+		for _, node := range b.cluster.GetNodes() {
+			if node.ID == "a" && node.URL != "" {
+				return true
+			}
+		}
+		return false
+	})
+	owner, err := b.cluster.AcquireRoom("room")
+	if err != nil {
+		t.Fatalf("AcquireRoom on b: %v", err)
+	}
+	if owner.NodeID != "a" || owner.URL != "http://a" {
+		t.Fatalf("owner = %+v, want node a", owner)
+	}
+	if err := b.cluster.JoinRoom("room", &model.Device{ID: "monitor", Type: model.DeviceTypeMonitor}, nil); err == nil {
+		t.Fatal("node b accepted a device for a room owned by node a")
+	}
+
+	// 节点a停止续约（如进程崩溃），租约过期后由节点b接管
+	close(a.cluster.stop)
+	waitFor(t, "node b to take over the room", func() bool {
+		owner, err := b.cluster.AcquireRoom("room")
+		return err == nil && owner.Self
+	})
+	b.join(t, "room", "monitor", model.DeviceTypeMonitor)
+}
+
+func TestClusterRoomsReleasedOnClose(t *testing.T) {
+	network := cluster.NewMemoryNetwork()
+	leases := cluster.NewMemoryLeaseStore()
+	a := newClusterTestNode(t, network, "a", leases)
+	b := newClusterTestNode(t, network, "b", leases)
+
+	a.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	a.cluster.Close()
+
+	// 正常关闭时立即释放租约，不需要等待过期
+	owner, err := b.cluster.AcquireRoom("room")
+	if err != nil || !owner.Self {
+		t.Fatalf("AcquireRoom after close = %+v, %v; want node b", owner, err)
+	}
+}
+
+// slowReleaseStore 第一次释放租约时阻塞，直到测试放行
+type slowReleaseStore struct {
+	*cluster.MemoryLeaseStore
+	once      sync.Once
+	releasing chan struct{}
+	proceed   chan struct{}
+}
+
+func (s *slowReleaseStore) Release(ctx context.Context, key string, owner string) error {
+	s.once.Do(func() {
+		s.releasing <- struct{}{}
+		<-s.proceed
+	})
+	return s.MemoryLeaseStore.Release(ctx, key, owner)
+}
+
+func TestClusterLeaseReleaseRace(t *testing.T) {
+	store := &slowReleaseStore{
+		MemoryLeaseStore: cluster.NewMemoryLeaseStore(),
+		releasing:        make(chan struct{}, 1),
+		proceed:          make(chan struct{}),
+	}
+	a := newClusterTestNode(t, cluster.NewMemoryNetwork(), "a", store)
+	var proceedOnce sync.Once
+	allow := func() { proceedOnce.Do(func() { close(store.proceed) }) }
+	t.Cleanup(allow)
+
+	serverConn, _ := newTestConn(t)
+	if err := a.cluster.JoinRoom("room", &model.Device{ID: "camera-1", Type: model.DeviceTypeCamera}, serverConn); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+
+	// 最后一个设备离开，释放租约阻塞在租约存储中
+	left := make(chan error, 1)
+	go func() { left <- a.cluster.LeaveRoom("room", "camera-1", serverConn) }()
+	select {
+	case <-store.releasing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("LeaveRoom did not release the room lease")
+	}
+
+	// 释放期间不持有leaseMutex，其他房间不受影响
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := a.cluster.AcquireRoom("other")
+		acquired <- err
+	}()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("AcquireRoom other: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("AcquireRoom for another room blocked while a lease was being released")
+	}
+
+	// 同一房间的新设备等待释放完成后重新获取租约
+	joined := make(chan error, 1)
+	go func() {
+		conn, _ := newTestConn(t)
+		joined <- a.cluster.JoinRoom("room", &model.Device{ID: "camera-2", Type: model.DeviceTypeCamera}, conn)
+	}()
+	select {
+	case err := <-joined:
+		t.Fatalf("JoinRoom finished before the release completed: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	allow()
+	if err := <-left; err != nil {
+		t.Fatalf("LeaveRoom: %v", err)
+	}
+	if err := <-joined; err != nil {
+		t.Fatalf("JoinRoom: %v", err)
+	}
+
+	if holder, _ := store.Holder(context.Background(), roomLeaseKey("room")); holder != "a" {
+		t.Fatalf("lease holder after the race = %q, want a", holder)
+	}
+	owner, err := a.cluster.GetRoomOwner("room")
+	if err != nil || !owner.Self {
+		t.Fatalf("GetRoomOwner = %+v, %v; want node a", owner, err)
+	}
+}
@@ -29,4 +29,31 @@ type EventService interface {
 
 	// HandleWebRTCIceCandidate 处理WebRTC ICE Candidate事件
 	HandleWebRTCIceCandidate(event *model.Event, payload *model.WebRTCIceCandidatePayload) error
+
+	// HandleWebRTCNegotiation 处理重新协商/ICE重启事件
+	HandleWebRTCNegotiation(event *model.Event, payload *model.WebRTCNegotiationPayload) error
+
+	// HandleStatsReport 处理WebRTC统计上报事件
+	HandleStatsReport(event *model.Event, payload *model.StatsReportPayload) error
+
+	// HandleChatMessage 处理聊天消息事件
+	HandleChatMessage(event *model.Event, payload *model.ChatMessagePayload) error
+
+	// HandleTalkbackRequest 处理Monitor发起的对讲请求
+	HandleTalkbackRequest(event *model.Event, payload *model.TalkbackRequestPayload) error
+
+	// HandleTalkbackStop 处理Monitor结束对讲事件
+	HandleTalkbackStop(event *model.Event, payload *model.TalkbackRequestPayload) error
+
+	// HandleDeviceLeave 清理设备离开房间后残留的事件处理状态
+	HandleDeviceLeave(roomID string, deviceID string)
+
+	// DeliverRemoteEvent 将集群其他节点转发的事件发送给本节点的设备
+	DeliverRemoteEvent(roomID string, deviceID string, event *model.Event) error
+
+	// HandleRemoteDeviceLeave 清理集群其他节点上的设备离开后残留的会话状态
+	HandleRemoteDeviceLeave(roomID string, deviceID string)
+
+	// HandleRemoteStatus 按集群其他节点的请求更新本节点设备的状态
+	HandleRemoteStatus(roomID string, deviceID string, status model.DeviceStatus, cause model.EventType) error
 }
@@ -1,29 +1,174 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
-	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
 
+	"monitor/logger"
+	"monitor/metrics"
 	"monitor/model"
+	"monitor/tracing"
+)
+
+const (
+	// maxChatMessageLength 聊天消息最大字符数
+	maxChatMessageLength = 500
+)
+
+// 协商超时时间，测试中可以缩短
+var (
+	// negotiationTimeout 重新协商/ICE重启等待应答的超时时间
+	negotiationTimeout = 15 * time.Second
+	// talkbackNegotiationTimeout 对讲开始后等待Monitor发起并完成音频重新协商的时间
+	talkbackNegotiationTimeout = 2 * negotiationTimeout
 )
 
 // EventServiceImpl 事件服务实现
 type EventServiceImpl struct {
-	roomService RoomService
+	roomService     RoomService
+	activityService ActivityService
+	auditService    AuditService
+	qualityService  QualityService
+	historyService  StatusHistoryService
+	webhookService  WebhookService
+	talkbacks       sync.Map // 对讲会话，key为roomID/cameraID，value为*model.TalkbackSession
+	negotiations    sync.Map // 进行中的重新协商，key为roomID/设备对，value为*pendingNegotiation
+	traces          sync.Map // 设备对最近一次协商的链路，key为roomID/设备对，value为*sessionTrace
+}
+
+// sessionTrace 设备对之间协商所属的链路，用于关联未携带追踪上下文的应答和ICE候选
+type sessionTrace struct {
+	roomID      string
+	deviceA     string
+	deviceB     string
+	spanContext oteltrace.SpanContext
+}
+
+// pendingNegotiation 等待应答的重新协商
+type pendingNegotiation struct {
+	roomID     string
+	kind       model.EventType // renegotiate或ice_restart
+	offererID  string          // 发起方设备ID
+	answererID string          // 应答方设备ID
+	timer      *time.Timer     // 超时定时器
+	remote     bool            // 由其他节点转发的协商，超时由发起方所在节点通知
 }
 
 // NewEventService 创建事件服务
-func NewEventService(roomService RoomService) EventService {
+func NewEventService(roomService RoomService, activityService ActivityService, auditService AuditService, qualityService QualityService, historyService StatusHistoryService, webhookService WebhookService) EventService {
 	return &EventServiceImpl{
-		roomService: roomService,
+		roomService:     roomService,
+		activityService: activityService,
+		auditService:    auditService,
+		qualityService:  qualityService,
+		historyService:  historyService,
+		webhookService:  webhookService,
 	}
 }
 
+// ErrUnknownEventType 未知事件类型
+var ErrUnknownEventType = errors.New("未知事件类型")
+
 // ProcessEvent 处理事件
-func (s *EventServiceImpl) ProcessEvent(event *model.Event) error {
+func (s *EventServiceImpl) ProcessEvent(event *model.Event) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(s.traceParent(event), "EventService.ProcessEvent",
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+		oteltrace.WithAttributes(
+			tracing.AttrRoomID.String(event.RoomID),
+			tracing.AttrDeviceID.String(event.DeviceID),
+		))
+
+	defer func() {
+		eventType := string(event.Type)
+		if errors.Is(err, ErrUnknownEventType) {
+			eventType = metrics.UnknownLabel
+		}
+		metrics.ObserveEvent(eventType, start, err)
+
+		span.SetAttributes(tracing.AttrEventType.String(eventType))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// 转发的事件携带本次处理的链路，接收方原样带回应答即可关联
+	event.Trace = tracing.Inject(ctx)
+	s.rememberTrace(event, span.SpanContext())
+
+	return s.dispatchEvent(event)
+}
+
+// traceParent 确定事件处理span的父链路：优先使用事件携带的追踪上下文，
+// 其次使用该设备对最近一次协商的链路
+func (s *EventServiceImpl) traceParent(event *model.Event) context.Context {
+	ctx := context.Background()
+	if len(event.Trace) > 0 {
+		return tracing.Extract(ctx, event.Trace)
+	}
+
+	targetID := targetDeviceID(event)
+	if targetID == "" {
+		return ctx
+	}
+
+	value, exists := s.traces.Load(negotiationKey(event.RoomID, event.DeviceID, targetID))
+	if !exists {
+		return ctx
+	}
+	return oteltrace.ContextWithRemoteSpanContext(ctx, value.(*sessionTrace).spanContext)
+}
+
+// rememberTrace 记录Offer类事件的链路，供后续的Answer和ICE候选关联
+func (s *EventServiceImpl) rememberTrace(event *model.Event, spanContext oteltrace.SpanContext) {
+	if !spanContext.IsValid() {
+		return
+	}
+
+	switch event.Type {
+	case model.EventTypeOffer, model.EventTypeRenegotiate, model.EventTypeIceRestart:
+	default:
+		return
+	}
+
+	targetID := targetDeviceID(event)
+	if targetID == "" {
+		return
+	}
+
+	s.traces.Store(negotiationKey(event.RoomID, event.DeviceID, targetID), &sessionTrace{
+		roomID:      event.RoomID,
+		deviceA:     event.DeviceID,
+		deviceB:     targetID,
+		spanContext: spanContext,
+	})
+}
+
+// targetDeviceID 读取事件负载中的目标设备ID
+func targetDeviceID(event *model.Event) string {
+	var target struct {
+		TargetDeviceID string `json:"targetDeviceId"`
+	}
+	if err := event.ParsePayload(&target); err != nil {
+		return ""
+	}
+	return target.TargetDeviceID
+}
+
+// dispatchEvent 根据事件类型分发事件
+func (s *EventServiceImpl) dispatchEvent(event *model.Event) error {
 	switch event.Type {
 	case model.EventTypeCameraReady:
 		var payload model.ReadyPayload
@@ -60,15 +205,50 @@ func (s *EventServiceImpl) ProcessEvent(event *model.Event) error {
 		}
 		return s.HandleWebRTCIceCandidate(event, &payload)
 
+	case model.EventTypeRenegotiate, model.EventTypeIceRestart:
+		var payload model.WebRTCNegotiationPayload
+		if err := event.ParsePayload(&payload); err != nil {
+			return err
+		}
+		return s.HandleWebRTCNegotiation(event, &payload)
+
+	case model.EventTypeStatsReport:
+		var payload model.StatsReportPayload
+		if err := event.ParsePayload(&payload); err != nil {
+			return err
+		}
+		return s.HandleStatsReport(event, &payload)
+
+	case model.EventTypeChatMessage:
+		var payload model.ChatMessagePayload
+		if err := event.ParsePayload(&payload); err != nil {
+			return err
+		}
+		return s.HandleChatMessage(event, &payload)
+
+	case model.EventTypeTalkbackRequest:
+		var payload model.TalkbackRequestPayload
+		if err := event.ParsePayload(&payload); err != nil {
+			return err
+		}
+		return s.HandleTalkbackRequest(event, &payload)
+
+	case model.EventTypeTalkbackStop:
+		var payload model.TalkbackRequestPayload
+		if err := event.ParsePayload(&payload); err != nil {
+			return err
+		}
+		return s.HandleTalkbackStop(event, &payload)
+
 	default:
-		return errors.New("未知事件类型")
+		return ErrUnknownEventType
 	}
 }
 
 // HandleCameraReady 处理Camera设备准备就绪事件
 func (s *EventServiceImpl) HandleCameraReady(event *model.Event, payload *model.ReadyPayload) error {
 	// 更新Camera设备状态为Ready
-	err := s.roomService.UpdateDeviceStatus(event.RoomID, event.DeviceID, model.DeviceStatusReady)
+	err := s.updateDeviceStatus(event.RoomID, event.DeviceID, model.DeviceStatusReady, event.Type)
 	if err != nil {
 		return err
 	}
@@ -91,7 +271,7 @@ func (s *EventServiceImpl) HandleCameraReady(event *model.Event, payload *model.
 // HandleMonitorReady 处理Monitor设备准备就绪事件
 func (s *EventServiceImpl) HandleMonitorReady(event *model.Event, payload *model.ReadyPayload) error {
 	// 更新Monitor设备状态为Ready
-	err := s.roomService.UpdateDeviceStatus(event.RoomID, event.DeviceID, model.DeviceStatusReady)
+	err := s.updateDeviceStatus(event.RoomID, event.DeviceID, model.DeviceStatusReady, event.Type)
 	if err != nil {
 		return err
 	}
@@ -111,7 +291,8 @@ func (s *EventServiceImpl) HandleMonitorReady(event *model.Event, payload *model
 		if camera.Status == model.DeviceStatusReady {
 			err := s.SendEventToDevice(camera.RoomID, camera.ID, event)
 			if err != nil {
-				log.Printf("向Camera设备 %s 发送Monitor Ready事件失败: %v", camera.ID, err)
+				slog.Warn("send monitor_ready to camera failed",
+					logger.KeyRoomID, camera.RoomID, logger.KeyDeviceID, camera.ID, logger.KeyError, err)
 			}
 		}
 	}
@@ -124,9 +305,10 @@ func (s *EventServiceImpl) HandleWebRTCOffer(event *model.Event, payload *model.
 	// 如果Camera设备状态为Ready，则更新为Streaming
 	device, err := s.getDeviceById(event.RoomID, event.DeviceID)
 	if err == nil && device.Type == model.DeviceTypeCamera && device.Status == model.DeviceStatusReady {
-		err := s.roomService.UpdateDeviceStatus(event.RoomID, event.DeviceID, model.DeviceStatusStreaming)
+		err := s.updateDeviceStatus(event.RoomID, event.DeviceID, model.DeviceStatusStreaming, event.Type)
 		if err != nil {
-			log.Printf("更新Camera设备 %s 状态失败: %v", event.DeviceID, err)
+			slog.Warn("update camera status failed",
+				logger.KeyRoomID, event.RoomID, logger.KeyDeviceID, event.DeviceID, logger.KeyError, err)
 		}
 	}
 
@@ -139,9 +321,10 @@ func (s *EventServiceImpl) HandleWebRTCAnswer(event *model.Event, payload *model
 	// 如果Monitor设备状态为Ready，则更新为Receiving
 	device, err := s.getDeviceById(event.RoomID, event.DeviceID)
 	if err == nil && device.Type == model.DeviceTypeMonitor && device.Status == model.DeviceStatusReady {
-		err := s.roomService.UpdateDeviceStatus(event.RoomID, event.DeviceID, model.DeviceStatusReceiving)
+		err := s.updateDeviceStatus(event.RoomID, event.DeviceID, model.DeviceStatusReceiving, event.Type)
 		if err != nil {
-			log.Printf("更新Monitor设备 %s 状态失败: %v", event.DeviceID, err)
+			slog.Warn("update monitor status failed",
+				logger.KeyRoomID, event.RoomID, logger.KeyDeviceID, event.DeviceID, logger.KeyError, err)
 		}
 	}
 
@@ -155,9 +338,513 @@ func (s *EventServiceImpl) HandleWebRTCIceCandidate(event *model.Event, payload
 	return s.SendEventToDevice(event.RoomID, payload.TargetDeviceID, event)
 }
 
+// HandleWebRTCNegotiation 处理重新协商/ICE重启事件
+// 发起方发送sdpType为offer的事件，应答方回复同类型、sdpType为answer的事件；
+// 同一对设备之间同时只允许一个进行中的协商，超时未应答时通知发起方
+func (s *EventServiceImpl) HandleWebRTCNegotiation(event *model.Event, payload *model.WebRTCNegotiationPayload) error {
+	if payload.SDP == "" {
+		return errors.New("SDP不能为空")
+	}
+
+	sender, err := s.getDeviceById(event.RoomID, event.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	target, err := s.getDeviceById(event.RoomID, payload.TargetDeviceID)
+	if err != nil {
+		return err
+	}
+
+	// 只允许Camera与Monitor之间协商
+	if sender.ID == target.ID || sender.Type == target.Type {
+		return errors.New("协商目标必须是房间内另一类型的设备")
+	}
+
+	key := negotiationKey(event.RoomID, sender.ID, target.ID)
+
+	switch payload.SDPType {
+	case model.NegotiationSDPOffer:
+		pending := &pendingNegotiation{
+			roomID:     event.RoomID,
+			kind:       event.Type,
+			offererID:  sender.ID,
+			answererID: target.ID,
+		}
+		pending.timer = time.AfterFunc(negotiationTimeout, func() {
+			s.expireNegotiation(key, pending)
+		})
+
+		if _, loaded := s.negotiations.LoadOrStore(key, pending); loaded {
+			pending.timer.Stop()
+			return errors.New("与该设备的协商正在进行中")
+		}
+
+		if err := s.SendEventToDevice(event.RoomID, target.ID, event); err != nil {
+			s.clearNegotiation(key, pending)
+			return err
+		}
+		return nil
+
+	case model.NegotiationSDPAnswer:
+		value, exists := s.negotiations.Load(key)
+		if !exists {
+			return errors.New("没有待应答的协商")
+		}
+
+		pending := value.(*pendingNegotiation)
+		if pending.kind != event.Type || pending.offererID != target.ID || pending.answererID != sender.ID {
+			return errors.New("没有待应答的协商")
+		}
+		if !s.clearNegotiation(key, pending) {
+			return errors.New("协商已超时")
+		}
+
+		// 协商完成后连接恢复，Ready或Error状态的设备回到传输状态，已在传输的设备保持不变
+		s.promoteNegotiatedStatus(sender, event.Type)
+		s.promoteNegotiatedStatus(target, event.Type)
+
+		if err := s.SendEventToDevice(event.RoomID, target.ID, event); err != nil {
+			return err
+		}
+		s.activateTalkback(pending, event.Trace)
+		return nil
+
+	default:
+		return errors.New("无效的SDP类型")
+	}
+}
+
+// promoteNegotiatedStatus 协商完成后更新设备状态
+func (s *EventServiceImpl) promoteNegotiatedStatus(device *model.Device, cause model.EventType) {
+	if device.Status != model.DeviceStatusReady && device.Status != model.DeviceStatusError {
+		return
+	}
+
+	status := model.DeviceStatusStreaming
+	if device.Type == model.DeviceTypeMonitor {
+		status = model.DeviceStatusReceiving
+	}
+
+	if err := s.updateDeviceStatus(device.RoomID, device.ID, status, cause); err != nil {
+		slog.Warn("update device status failed",
+			logger.KeyRoomID, device.RoomID, logger.KeyDeviceID, device.ID, logger.KeyError, err)
+	}
+}
+
+// failNegotiatedStatus ICE重启失败后把已建立连接的设备更新为Error状态
+func (s *EventServiceImpl) failNegotiatedStatus(roomID string, deviceID string) {
+	device, err := s.getDeviceById(roomID, deviceID)
+	if err != nil {
+		return
+	}
+	if device.Status != model.DeviceStatusReady && device.Status != model.DeviceStatusStreaming &&
+		device.Status != model.DeviceStatusReceiving {
+		return
+	}
+
+	if err := s.updateDeviceStatus(roomID, deviceID, model.DeviceStatusError, model.EventTypeNegotiationTimeout); err != nil {
+		slog.Warn("update device status failed",
+			logger.KeyRoomID, roomID, logger.KeyDeviceID, deviceID, logger.KeyError, err)
+	}
+}
+
+// clearNegotiation 移除进行中的协商，返回是否由本次调用移除
+func (s *EventServiceImpl) clearNegotiation(key string, pending *pendingNegotiation) bool {
+	if !s.negotiations.CompareAndDelete(key, pending) {
+		return false
+	}
+	pending.timer.Stop()
+	return true
+}
+
+// expireNegotiation 协商超时，通知发起方
+func (s *EventServiceImpl) expireNegotiation(key string, pending *pendingNegotiation) {
+	if !s.negotiations.CompareAndDelete(key, pending) || pending.remote {
+		return
+	}
+
+	slog.Info("negotiation timed out",
+		logger.KeyRoomID, pending.roomID, logger.KeyDeviceID, pending.offererID,
+		logger.KeyEventType, pending.kind, "targetDeviceId", pending.answererID)
+
+	payloadJSON, _ := json.Marshal(model.NegotiationTimeoutPayload{
+		TargetDeviceID: pending.answererID,
+		Kind:           pending.kind,
+	})
+	timeoutEvent := &model.Event{
+		Type:      model.EventTypeNegotiationTimeout,
+		RoomID:    pending.roomID,
+		DeviceID:  pending.answererID,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:   payloadJSON,
+	}
+	if err := s.SendEventToDevice(pending.roomID, pending.offererID, timeoutEvent); err != nil {
+		slog.Warn("send negotiation_timeout failed",
+			logger.KeyRoomID, pending.roomID, logger.KeyDeviceID, pending.offererID, logger.KeyError, err)
+	}
+
+	// ICE重启超时说明连接无法恢复，双方进入Error状态，之后的协商完成时再恢复
+	if pending.kind == model.EventTypeIceRestart {
+		s.failNegotiatedStatus(pending.roomID, pending.offererID)
+		s.failNegotiatedStatus(pending.roomID, pending.answererID)
+	}
+
+	// 添加对讲音频的重新协商失败时结束对讲
+	if pending.kind == model.EventTypeRenegotiate {
+		sessionKey := talkbackKey(pending.roomID, pending.answererID)
+		if value, exists := s.talkbacks.Load(sessionKey); exists {
+			session := value.(*model.TalkbackSession)
+			if session.MonitorID == pending.offererID && !session.Negotiated {
+				s.endTalkback(sessionKey, session, model.TalkbackEndReasonNegotiationFailed, nil)
+			}
+		}
+	}
+}
+
+// negotiationKey 协商映射表的key，与方向无关
+func negotiationKey(roomID string, deviceA string, deviceB string) string {
+	if deviceA > deviceB {
+		deviceA, deviceB = deviceB, deviceA
+	}
+	return roomID + "/" + deviceA + "/" + deviceB
+}
+
+// HandleStatsReport 处理WebRTC统计上报事件，更新连接质量并推送给Monitor
+func (s *EventServiceImpl) HandleStatsReport(event *model.Event, payload *model.StatsReportPayload) error {
+	if payload.PacketLoss < 0 || payload.PacketLoss > 1 || payload.RTT < 0 || payload.Bitrate < 0 {
+		return errors.New("无效的统计数据")
+	}
+
+	reporter, err := s.getDeviceById(event.RoomID, event.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	peer, err := s.getDeviceById(event.RoomID, payload.TargetDeviceID)
+	if err != nil {
+		return err
+	}
+
+	cameraID, monitorID := reporter.ID, peer.ID
+	switch {
+	case reporter.Type == model.DeviceTypeCamera && peer.Type == model.DeviceTypeMonitor:
+	case reporter.Type == model.DeviceTypeMonitor && peer.Type == model.DeviceTypeCamera:
+		cameraID, monitorID = peer.ID, reporter.ID
+	default:
+		return errors.New("统计上报的对端必须是房间内另一类型的设备")
+	}
+
+	quality := s.qualityService.Report(event.RoomID, cameraID, monitorID, &model.StatsReport{
+		ReporterID:        reporter.ID,
+		Bitrate:           payload.Bitrate,
+		PacketLoss:        payload.PacketLoss,
+		RTT:               payload.RTT,
+		FramesDecoded:     payload.FramesDecoded,
+		CandidatePairType: payload.CandidatePairType,
+		Timestamp:         event.Timestamp,
+	})
+
+	payloadJSON, err := json.Marshal(model.QualityPayload{Quality: quality})
+	if err != nil {
+		return err
+	}
+
+	qualityEvent := &model.Event{
+		Type:      model.EventTypeQuality,
+		RoomID:    event.RoomID,
+		DeviceID:  cameraID,
+		Timestamp: event.Timestamp,
+		Payload:   payloadJSON,
+		Trace:     event.Trace,
+	}
+	return s.SendEventToDevice(event.RoomID, monitorID, qualityEvent)
+}
+
+// HandleChatMessage 处理聊天消息事件
+func (s *EventServiceImpl) HandleChatMessage(event *model.Event, payload *model.ChatMessagePayload) error {
+	text := strings.TrimSpace(payload.Text)
+	if text == "" {
+		return errors.New("消息内容不能为空")
+	}
+	if utf8.RuneCountInString(text) > maxChatMessageLength {
+		return fmt.Errorf("消息内容不能超过%d个字符", maxChatMessageLength)
+	}
+
+	sender, err := s.getDeviceById(event.RoomID, event.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	// 私聊消息的目标设备必须在房间内
+	if payload.TargetDeviceID != "" {
+		if _, err := s.getDeviceById(event.RoomID, payload.TargetDeviceID); err != nil {
+			return err
+		}
+	}
+
+	message := &model.ChatMessage{
+		ID:             generateID(),
+		RoomID:         event.RoomID,
+		FromDeviceID:   event.DeviceID,
+		FromDeviceName: sender.Name,
+		TargetDeviceID: payload.TargetDeviceID,
+		Text:           text,
+		Timestamp:      event.Timestamp,
+	}
+	if err := s.roomService.AddChatMessage(event.RoomID, message); err != nil {
+		return err
+	}
+
+	payloadJSON, err := json.Marshal(model.ChatMessagePayload{
+		TargetDeviceID: payload.TargetDeviceID,
+		Message:        message,
+	})
+	if err != nil {
+		return err
+	}
+
+	chatEvent := &model.Event{
+		Type:      model.EventTypeChatMessage,
+		RoomID:    event.RoomID,
+		DeviceID:  event.DeviceID,
+		Timestamp: event.Timestamp,
+		Payload:   payloadJSON,
+		Trace:     event.Trace,
+	}
+
+	// 未指定目标设备时广播给整个房间
+	if payload.TargetDeviceID == "" {
+		return s.BroadcastEvent(event.RoomID, chatEvent)
+	}
+
+	// 私聊消息同时回显给发送方，便于多端同步
+	if err := s.SendEventToDevice(event.RoomID, payload.TargetDeviceID, chatEvent); err != nil {
+		return err
+	}
+	return s.SendEventToDevice(event.RoomID, event.DeviceID, chatEvent)
+}
+
+// HandleTalkbackRequest 处理Monitor发起的对讲请求
+func (s *EventServiceImpl) HandleTalkbackRequest(event *model.Event, payload *model.TalkbackRequestPayload) error {
+	monitor, err := s.getDeviceById(event.RoomID, event.DeviceID)
+	if err != nil {
+		return err
+	}
+	if monitor.Type != model.DeviceTypeMonitor {
+		return errors.New("只有Monitor设备可以发起对讲")
+	}
+
+	camera, err := s.getDeviceById(event.RoomID, payload.TargetDeviceID)
+	if err != nil {
+		return err
+	}
+	if camera.Type != model.DeviceTypeCamera {
+		return errors.New("对讲目标必须是Camera设备")
+	}
+
+	// 每个Camera同一时间只允许一个讲话方
+	session := &model.TalkbackSession{
+		RoomID:    event.RoomID,
+		CameraID:  camera.ID,
+		MonitorID: monitor.ID,
+		StartTime: event.Timestamp,
+	}
+	key := talkbackKey(event.RoomID, camera.ID)
+	existing, loaded := s.talkbacks.LoadOrStore(key, session)
+	if loaded {
+		if existing.(*model.TalkbackSession).MonitorID == monitor.ID {
+			return errors.New("已在与该Camera对讲")
+		}
+		return errors.New("该Camera正在与其他设备对讲")
+	}
+
+	slog.Info("talkback started",
+		logger.KeyRoomID, event.RoomID, logger.KeyDeviceID, monitor.ID, "cameraId", camera.ID)
+
+	// Monitor需在限定时间内通过renegotiate添加音频轨道，否则释放话权。
+	// 协商完成后会话被替换，此处只结束仍未完成协商的会话
+	time.AfterFunc(talkbackNegotiationTimeout, func() {
+		s.endTalkback(key, session, model.TalkbackEndReasonNegotiationFailed, nil)
+	})
+
+	// 通知双方开始对讲，由Monitor发起renegotiate添加音频轨道
+	return s.notifyTalkback(model.EventTypeTalkbackStart, session, "", event.Trace)
+}
+
+// activateTalkback Monitor向Camera发起的重新协商完成后，标记对讲音频已协商并通知双方
+func (s *EventServiceImpl) activateTalkback(pending *pendingNegotiation, traceContext map[string]string) {
+	if pending.kind != model.EventTypeRenegotiate {
+		return
+	}
+
+	key := talkbackKey(pending.roomID, pending.answererID)
+	value, exists := s.talkbacks.Load(key)
+	if !exists {
+		return
+	}
+	session := value.(*model.TalkbackSession)
+	if session.MonitorID != pending.offererID || session.Negotiated {
+		return
+	}
+
+	active := *session
+	active.Negotiated = true
+	if !s.talkbacks.CompareAndSwap(key, session, &active) {
+		return
+	}
+
+	slog.Info("talkback audio negotiated",
+		logger.KeyRoomID, active.RoomID, logger.KeyDeviceID, active.MonitorID, "cameraId", active.CameraID)
+	s.notifyTalkback(model.EventTypeTalkbackActive, &active, "", traceContext)
+}
+
+// HandleTalkbackStop 处理Monitor结束对讲事件
+func (s *EventServiceImpl) HandleTalkbackStop(event *model.Event, payload *model.TalkbackRequestPayload) error {
+	key := talkbackKey(event.RoomID, payload.TargetDeviceID)
+	value, exists := s.talkbacks.Load(key)
+	if !exists {
+		return errors.New("对讲会话不存在")
+	}
+
+	session := value.(*model.TalkbackSession)
+	if session.MonitorID != event.DeviceID {
+		return errors.New("只有持有话权的设备可以结束对讲")
+	}
+
+	return s.endTalkback(key, session, model.TalkbackEndReasonStopped, event.Trace)
+}
+
+// endTalkback 结束对讲会话并通知双方，traceContext为触发结束的事件所属链路
+func (s *EventServiceImpl) endTalkback(key string, session *model.TalkbackSession, reason string, traceContext map[string]string) error {
+	// 仅删除当前会话，避免误删并发建立的新会话
+	if !s.talkbacks.CompareAndDelete(key, session) {
+		return nil
+	}
+
+	slog.Info("talkback ended",
+		logger.KeyRoomID, session.RoomID, logger.KeyDeviceID, session.MonitorID,
+		"cameraId", session.CameraID, "reason", reason)
+	return s.notifyTalkback(model.EventTypeTalkbackEnd, session, reason, traceContext)
+}
+
+// notifyTalkback 向对讲双方发送对讲事件
+func (s *EventServiceImpl) notifyTalkback(eventType model.EventType, session *model.TalkbackSession, reason string, traceContext map[string]string) error {
+	payloadJSON, err := json.Marshal(model.TalkbackSessionPayload{
+		Session: session,
+		Reason:  reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	event := &model.Event{
+		Type:      eventType,
+		RoomID:    session.RoomID,
+		DeviceID:  session.MonitorID,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:   payloadJSON,
+		Trace:     traceContext,
+	}
+
+	// 对讲一方可能已离开房间，只通知仍在房间内的设备，分别发送互不影响
+	var firstErr error
+	for _, deviceID := range []string{session.CameraID, session.MonitorID} {
+		if _, err := s.getDeviceById(session.RoomID, deviceID); err != nil {
+			continue
+		}
+		if err := s.SendEventToDevice(session.RoomID, deviceID, event); err != nil {
+			slog.Warn("send talkback event failed",
+				logger.KeyRoomID, session.RoomID, logger.KeyDeviceID, deviceID,
+				logger.KeyEventType, eventType, logger.KeyError, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// HandleDeviceLeave 清理设备离开房间后残留的事件处理状态
+func (s *EventServiceImpl) HandleDeviceLeave(roomID string, deviceID string) {
+	s.historyService.Record(roomID, deviceID, model.DeviceStatusLeft, model.EventTypeLeaveRoom)
+	s.qualityService.RemoveDevice(roomID, deviceID)
+	s.releaseDeviceSessions(roomID, deviceID)
+}
+
+// HandleRemoteDeviceLeave 清理集群其他节点上的设备离开后残留的会话状态
+func (s *EventServiceImpl) HandleRemoteDeviceLeave(roomID string, deviceID string) {
+	s.qualityService.RemoveDevice(roomID, deviceID)
+	s.releaseDeviceSessions(roomID, deviceID)
+}
+
+// HandleRemoteStatus 按集群其他节点的请求更新本节点设备的状态，
+// 设备已不在本节点时返回错误，不再转发，避免节点视图不一致时来回发送
+func (s *EventServiceImpl) HandleRemoteStatus(roomID string, deviceID string, status model.DeviceStatus, cause model.EventType) error {
+	if _, err := s.getDeviceConnection(roomID, deviceID); err != nil {
+		return err
+	}
+	return s.updateDeviceStatus(roomID, deviceID, status, cause)
+}
+
+// releaseDeviceSessions 清除设备参与的协商链路、协商和对讲
+func (s *EventServiceImpl) releaseDeviceSessions(roomID string, deviceID string) {
+	// 清除该设备参与的协商链路
+	s.traces.Range(func(key, value interface{}) bool {
+		session := value.(*sessionTrace)
+		if session.roomID == roomID && (session.deviceA == deviceID || session.deviceB == deviceID) {
+			s.traces.Delete(key)
+		}
+		return true
+	})
+
+	// 取消该设备参与的所有协商
+	s.negotiations.Range(func(key, value interface{}) bool {
+		pending := value.(*pendingNegotiation)
+		if pending.roomID == roomID && (pending.offererID == deviceID || pending.answererID == deviceID) {
+			s.clearNegotiation(key.(string), pending)
+		}
+		return true
+	})
+
+	// 结束该设备参与的所有对讲
+	s.talkbacks.Range(func(key, value interface{}) bool {
+		session := value.(*model.TalkbackSession)
+		if session.RoomID == roomID && (session.CameraID == deviceID || session.MonitorID == deviceID) {
+			s.endTalkback(key.(string), session, model.TalkbackEndReasonDeviceLeft, nil)
+		}
+		return true
+	})
+}
+
+// talkbackKey 对讲会话映射表的key
+func talkbackKey(roomID string, cameraID string) string {
+	return roomID + "/" + cameraID
+}
+
 // 移除不再需要的mapEvent函数，因为现在使用Event.ParsePayload方法
 // BroadcastEvent 广播事件到房间内所有设备
 func (s *EventServiceImpl) BroadcastEvent(roomID string, event *model.Event) error {
+	// 设备加入/离开房间时发布房间活动
+	// 最后一个设备离开后房间已被删除，活动和回调仍需在获取设备列表之前发出
+	switch event.Type {
+	case model.EventTypeJoinRoom:
+		s.historyService.Record(event.RoomID, event.DeviceID, model.DeviceStatusConnected, event.Type)
+		s.publishActivity(event, model.ActivityTypeJoin, func(activity *model.Activity) {
+			var payload model.JoinRoomPayload
+			if err := event.ParsePayload(&payload); err == nil && payload.Device != nil {
+				device := *payload.Device
+				activity.Device = &device
+			}
+		})
+	case model.EventTypeLeaveRoom:
+		s.publishActivity(event, model.ActivityTypeLeave, nil)
+	}
+
+	// 投递给回调订阅，只加入队列不会阻塞广播
+	s.webhookService.Dispatch(event)
+
 	// 获取房间内所有设备
 	devices, err := s.roomService.GetDevicesInRoom(roomID)
 	if err != nil {
@@ -168,29 +855,159 @@ func (s *EventServiceImpl) BroadcastEvent(roomID string, event *model.Event) err
 	for _, device := range devices {
 		err := s.SendEventToDevice(roomID, device.ID, event)
 		if err != nil {
-			log.Printf("向设备 %s 发送事件失败: %v", device.ID, err)
+			slog.Warn("broadcast event to device failed",
+				logger.KeyRoomID, roomID, logger.KeyDeviceID, device.ID,
+				logger.KeyEventType, event.Type, logger.KeyError, err)
 		}
 	}
 
 	return nil
 }
 
-// SendEventToDevice 发送事件到特定设备
+// SendEventToDevice 发送事件到特定设备，设备连接在集群其他节点时转发给该节点
 func (s *EventServiceImpl) SendEventToDevice(roomID string, deviceID string, event *model.Event) error {
+	return s.sendEvent(roomID, deviceID, event, true)
+}
+
+// DeliverRemoteEvent 将集群其他节点转发的事件发送给本节点的设备，不再次转发
+func (s *EventServiceImpl) DeliverRemoteEvent(roomID string, deviceID string, event *model.Event) error {
+	s.syncRemoteNegotiation(deviceID, event)
+	return s.sendEvent(roomID, deviceID, event, false)
+}
+
+// syncRemoteNegotiation 同步其他节点转发的重新协商状态，
+// 使本节点设备的应答能匹配到发起方所在节点记录的协商
+func (s *EventServiceImpl) syncRemoteNegotiation(deviceID string, event *model.Event) {
+	if event.Type != model.EventTypeRenegotiate && event.Type != model.EventTypeIceRestart {
+		return
+	}
+
+	var payload model.WebRTCNegotiationPayload
+	if err := event.ParsePayload(&payload); err != nil {
+		return
+	}
+
+	key := negotiationKey(event.RoomID, event.DeviceID, deviceID)
+
+	switch payload.SDPType {
+	case model.NegotiationSDPOffer:
+		pending := &pendingNegotiation{
+			roomID:     event.RoomID,
+			kind:       event.Type,
+			offererID:  event.DeviceID,
+			answererID: deviceID,
+			remote:     true,
+		}
+		pending.timer = time.AfterFunc(negotiationTimeout, func() {
+			s.expireNegotiation(key, pending)
+		})
+		if previous, loaded := s.negotiations.Swap(key, pending); loaded {
+			previous.(*pendingNegotiation).timer.Stop()
+		}
+
+	case model.NegotiationSDPAnswer:
+		value, exists := s.negotiations.Load(key)
+		if !exists {
+			return
+		}
+		pending := value.(*pendingNegotiation)
+		if pending.kind == event.Type && pending.offererID == deviceID && pending.answererID == event.DeviceID &&
+			s.clearNegotiation(key, pending) {
+			s.activateTalkback(pending, event.Trace)
+		}
+	}
+}
+
+// sendEvent 发送事件到特定设备，forward为false时不转发给其他节点
+func (s *EventServiceImpl) sendEvent(roomID string, deviceID string, event *model.Event, forward bool) (err error) {
+	_, span := tracing.Tracer().Start(tracing.Extract(context.Background(), event.Trace), "EventService.SendEventToDevice",
+		oteltrace.WithSpanKind(oteltrace.SpanKindProducer),
+		oteltrace.WithAttributes(
+			tracing.AttrRoomID.String(roomID),
+			tracing.AttrDeviceID.String(event.DeviceID),
+			tracing.AttrTargetDeviceID.String(deviceID),
+			tracing.AttrEventType.String(string(event.Type)),
+		))
+
+	defer func() {
+		if err != nil {
+			metrics.RoutingFailures.WithLabelValues(string(event.Type)).Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// 发送给设备的错误事件同时作为房间活动发布
+	if event.Type == model.EventTypeError {
+		s.publishActivity(event, model.ActivityTypeError, func(activity *model.Activity) {
+			activity.DeviceID = deviceID
+			var payload model.ErrorPayload
+			if err := event.ParsePayload(&payload); err == nil {
+				activity.Error = payload.Error
+			}
+		})
+	}
+
 	// 获取设备连接
 	conn, err := s.getDeviceConnection(roomID, deviceID)
+	if errors.Is(err, ErrRemoteDevice) && forward {
+		span.SetAttributes(tracing.AttrForwarded.Bool(true))
+		return s.roomService.ForwardEvent(roomID, deviceID, event)
+	}
 	if err != nil {
 		return err
 	}
 
-	// 序列化事件
-	eventJSON, err := json.Marshal(event)
+	// 按连接协商的编码发送事件
+	start := time.Now()
+	err = conn.WriteEvent(event)
+	metrics.WriteDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
 		return err
 	}
 
-	// 发送事件 - 使用安全连接的WriteMessage方法
-	return conn.WriteMessage(websocket.TextMessage, eventJSON)
+	s.auditService.Record(model.AuditDirectionOutbound, deviceID, event)
+	return nil
+}
+
+// updateDeviceStatus 更新设备状态，记录状态历史并发布状态变化活动，cause为引起变化的事件类型
+func (s *EventServiceImpl) updateDeviceStatus(roomID string, deviceID string, status model.DeviceStatus, cause model.EventType) error {
+	// 集群其他节点上的设备交给其所在节点更新，由该节点通过HandleRemoteStatus记录，避免重复记录
+	if cluster, ok := s.roomService.(ClusterService); ok {
+		if _, err := cluster.GetDeviceConnection(roomID, deviceID); errors.Is(err, ErrRemoteDevice) {
+			return cluster.UpdateDeviceStatusWithCause(roomID, deviceID, status, cause)
+		}
+	}
+
+	if err := s.roomService.UpdateDeviceStatus(roomID, deviceID, status); err != nil {
+		return err
+	}
+	s.historyService.Record(roomID, deviceID, status, cause)
+
+	s.activityService.Publish(&model.Activity{
+		Type:     model.ActivityTypeStatus,
+		RoomID:   roomID,
+		DeviceID: deviceID,
+		Status:   status,
+	})
+
+	return nil
+}
+
+// publishActivity 根据事件发布房间活动，fill用于补充活动详情
+func (s *EventServiceImpl) publishActivity(event *model.Event, activityType model.ActivityType, fill func(activity *model.Activity)) {
+	activity := &model.Activity{
+		Type:      activityType,
+		RoomID:    event.RoomID,
+		DeviceID:  event.DeviceID,
+		Timestamp: event.Timestamp,
+	}
+	if fill != nil {
+		fill(activity)
+	}
+
+	s.activityService.Publish(activity)
 }
 
 // 辅助函数：获取设备连接
@@ -0,0 +1,611 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"monitor/metrics"
+	"monitor/model"
+)
+
+// newTestConn 创建一对相连的WebSocket连接，返回服务端连接和客户端连接
+func newTestConn(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+
+	serverConns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	serverConn := <-serverConns
+	t.Cleanup(func() {
+		client.Close()
+		serverConn.Close()
+	})
+
+	return serverConn, client
+}
+
+// readEvent 从客户端连接读取下一个指定类型的事件
+func readEvent(t *testing.T, client *websocket.Conn, eventType model.EventType) *model.Event {
+	t.Helper()
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("read %s: %v", eventType, err)
+		}
+		var event model.Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatalf("parse event: %v", err)
+		}
+		if event.Type == eventType {
+			return &event
+		}
+	}
+}
+
+// waitFor 等待条件成立，超时后测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// eventTestRoom 使用本节点房间服务的事件服务
+type eventTestRoom struct {
+	rooms   RoomService
+	events  *EventServiceImpl
+	history StatusHistoryService
+}
+
+// newEventTestRoom 创建事件服务及其依赖的服务
+func newEventTestRoom(t *testing.T) *eventTestRoom {
+	t.Helper()
+
+	auditService, _ := NewAuditService(AuditConfig{})
+	webhookService, err := NewWebhookService(WebhookConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewWebhookService: %v", err)
+	}
+	t.Cleanup(webhookService.Close)
+
+	rooms := NewRoomService()
+	history := NewStatusHistoryService()
+	events := NewEventService(rooms, NewActivityService(), auditService, NewQualityService(), history, webhookService).(*EventServiceImpl)
+	return &eventTestRoom{rooms: rooms, events: events, history: history}
+}
+
+// join 设备通过新的连接加入房间，返回设备的客户端连接
+func (r *eventTestRoom) join(t *testing.T, roomID string, deviceID string, deviceType model.DeviceType) *websocket.Conn {
+	t.Helper()
+
+	serverConn, client := newTestConn(t)
+	if err := r.rooms.JoinRoom(roomID, &model.Device{ID: deviceID, Type: deviceType}, serverConn); err != nil {
+		t.Fatalf("join %s: %v", deviceID, err)
+	}
+	return client
+}
+
+// setStatus 直接设置设备状态
+func (r *eventTestRoom) setStatus(t *testing.T, roomID string, deviceID string, status model.DeviceStatus) {
+	t.Helper()
+
+	if err := r.rooms.UpdateDeviceStatus(roomID, deviceID, status); err != nil {
+		t.Fatalf("set %s status: %v", deviceID, err)
+	}
+}
+
+// status 获取设备当前状态
+func (r *eventTestRoom) status(roomID string, deviceID string) model.DeviceStatus {
+	device, err := r.rooms.GetDeviceById(roomID, deviceID)
+	if err != nil {
+		return ""
+	}
+	return device.Status
+}
+
+// testEvent 创建设备发送的事件
+func testEvent(eventType model.EventType, roomID string, deviceID string, payload interface{}) *model.Event {
+	payloadJSON, _ := json.Marshal(payload)
+	return &model.Event{
+		Type:      eventType,
+		RoomID:    roomID,
+		DeviceID:  deviceID,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:   payloadJSON,
+	}
+}
+
+// shortenNegotiationTimeout 在测试期间缩短协商超时时间
+func shortenNegotiationTimeout(t *testing.T, timeout time.Duration) {
+	t.Helper()
+
+	original := negotiationTimeout
+	negotiationTimeout = timeout
+	t.Cleanup(func() { negotiationTimeout = original })
+}
+
+// negotiation 创建重新协商/ICE重启事件的负载
+func negotiation(targetDeviceID string, sdpType model.NegotiationSDPType) *model.WebRTCNegotiationPayload {
+	return &model.WebRTCNegotiationPayload{TargetDeviceID: targetDeviceID, SDPType: sdpType, SDP: "v=0"}
+}
+
+func TestNegotiationForwardedAndAnswered(t *testing.T) {
+	r := newEventTestRoom(t)
+	camera := r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+	r.join(t, "room", "camera-2", model.DeviceTypeCamera)
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "camera-2", negotiation("camera-1", model.NegotiationSDPOffer))); err == nil {
+		t.Fatal("negotiation between two cameras was accepted")
+	}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPAnswer))); err == nil {
+		t.Fatal("answer without a pending offer was accepted")
+	}
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "camera-1", negotiation("monitor-1", model.NegotiationSDPOffer))); err != nil {
+		t.Fatalf("offer: %v", err)
+	}
+	readEvent(t, monitor, model.EventTypeRenegotiate)
+
+	// 同一对设备之间同时只能有一个协商，两个方向都一样
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeIceRestart, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPOffer))); err == nil {
+		t.Fatal("second offer between the same devices was accepted")
+	}
+	// 应答类型必须与发起的协商一致
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeIceRestart, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPAnswer))); err == nil {
+		t.Fatal("ice_restart answer to a renegotiate offer was accepted")
+	}
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPAnswer))); err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	answer := readEvent(t, camera, model.EventTypeRenegotiate)
+	var payload model.WebRTCNegotiationPayload
+	if err := answer.ParsePayload(&payload); err != nil || payload.SDPType != model.NegotiationSDPAnswer {
+		t.Fatalf("camera received %s, want an answer", answer.Payload)
+	}
+
+	// 完成后可以开始新的协商
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeIceRestart, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPOffer))); err != nil {
+		t.Fatalf("offer after the previous negotiation completed: %v", err)
+	}
+}
+
+func TestNegotiationTimeoutNotifiesOfferer(t *testing.T) {
+	shortenNegotiationTimeout(t, 50*time.Millisecond)
+
+	r := newEventTestRoom(t)
+	camera := r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "camera-1", negotiation("monitor-1", model.NegotiationSDPOffer))); err != nil {
+		t.Fatalf("offer: %v", err)
+	}
+
+	timeout := readEvent(t, camera, model.EventTypeNegotiationTimeout)
+	var payload model.NegotiationTimeoutPayload
+	if err := timeout.ParsePayload(&payload); err != nil {
+		t.Fatalf("parse negotiation_timeout: %v", err)
+	}
+	if payload.TargetDeviceID != "monitor-1" || payload.Kind != model.EventTypeRenegotiate {
+		t.Fatalf("negotiation_timeout payload = %+v", payload)
+	}
+
+	// 超时后的应答被拒绝
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPAnswer))); err == nil {
+		t.Fatal("answer after the timeout was accepted")
+	}
+}
+
+func TestIceRestartTimeoutMovesDevicesToError(t *testing.T) {
+	shortenNegotiationTimeout(t, 50*time.Millisecond)
+
+	r := newEventTestRoom(t)
+	camera := r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+	r.setStatus(t, "room", "camera-1", model.DeviceStatusStreaming)
+	r.setStatus(t, "room", "monitor-1", model.DeviceStatusReceiving)
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeIceRestart, "room", "camera-1", negotiation("monitor-1", model.NegotiationSDPOffer))); err != nil {
+		t.Fatalf("offer: %v", err)
+	}
+	readEvent(t, camera, model.EventTypeNegotiationTimeout)
+	waitFor(t, "devices in error", func() bool {
+		return r.status("room", "camera-1") == model.DeviceStatusError && r.status("room", "monitor-1") == model.DeviceStatusError
+	})
+
+	// 之后的ICE重启完成时恢复传输状态
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeIceRestart, "room", "camera-1", negotiation("monitor-1", model.NegotiationSDPOffer))); err != nil {
+		t.Fatalf("second offer: %v", err)
+	}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeIceRestart, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPAnswer))); err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	if got := r.status("room", "camera-1"); got != model.DeviceStatusStreaming {
+		t.Fatalf("camera status after ICE restart = %s, want streaming", got)
+	}
+	if got := r.status("room", "monitor-1"); got != model.DeviceStatusReceiving {
+		t.Fatalf("monitor status after ICE restart = %s, want receiving", got)
+	}
+}
+
+// talkbackEvent 读取对讲事件并解析负载
+func talkbackEvent(t *testing.T, client *websocket.Conn, eventType model.EventType) *model.TalkbackSessionPayload {
+	t.Helper()
+
+	var payload model.TalkbackSessionPayload
+	if err := readEvent(t, client, eventType).ParsePayload(&payload); err != nil {
+		t.Fatalf("parse %s: %v", eventType, err)
+	}
+	return &payload
+}
+
+func TestTalkbackFloorControl(t *testing.T) {
+	r := newEventTestRoom(t)
+	camera := r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+	r.join(t, "room", "camera-2", model.DeviceTypeCamera)
+
+	request := &model.TalkbackRequestPayload{TargetDeviceID: "camera-1"}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackRequest, "room", "camera-2", request)); err == nil {
+		t.Fatal("talkback request from a camera was accepted")
+	}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackRequest, "room", "monitor-1", &model.TalkbackRequestPayload{TargetDeviceID: "monitor-1"})); err == nil {
+		t.Fatal("talkback request targeting a monitor was accepted")
+	}
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackRequest, "room", "monitor-1", request)); err != nil {
+		t.Fatalf("talkback request: %v", err)
+	}
+	for _, client := range []*websocket.Conn{camera, monitor} {
+		if payload := talkbackEvent(t, client, model.EventTypeTalkbackStart); payload.Session.MonitorID != "monitor-1" || payload.Session.Negotiated {
+			t.Fatalf("talkback_start session = %+v", payload.Session)
+		}
+	}
+
+	// 每个Camera同一时间只有一个讲话方，只有持有话权的设备可以结束对讲
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackRequest, "room", "monitor-1", request)); err == nil {
+		t.Fatal("second talkback request for the same camera was accepted")
+	}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackStop, "room", "camera-2", request)); err == nil {
+		t.Fatal("talkback stopped by a device without the floor")
+	}
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackStop, "room", "monitor-1", request)); err != nil {
+		t.Fatalf("talkback stop: %v", err)
+	}
+	for _, client := range []*websocket.Conn{camera, monitor} {
+		if payload := talkbackEvent(t, client, model.EventTypeTalkbackEnd); payload.Reason != model.TalkbackEndReasonStopped {
+			t.Fatalf("talkback_end reason = %s, want stopped", payload.Reason)
+		}
+	}
+
+	// 结束后可以再次对讲
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackRequest, "room", "monitor-1", request)); err != nil {
+		t.Fatalf("talkback request after stop: %v", err)
+	}
+}
+
+func TestTalkbackEndsWhenDeviceLeaves(t *testing.T) {
+	r := newEventTestRoom(t)
+	cameraConn, _ := newTestConn(t)
+	if err := r.rooms.JoinRoom("room", &model.Device{ID: "camera-1", Type: model.DeviceTypeCamera}, cameraConn); err != nil {
+		t.Fatalf("join camera-1: %v", err)
+	}
+	monitor := r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackRequest, "room", "monitor-1", &model.TalkbackRequestPayload{TargetDeviceID: "camera-1"})); err != nil {
+		t.Fatalf("talkback request: %v", err)
+	}
+	talkbackEvent(t, monitor, model.EventTypeTalkbackStart)
+
+	if err := r.rooms.LeaveRoom("room", "camera-1", cameraConn); err != nil {
+		t.Fatalf("LeaveRoom: %v", err)
+	}
+	r.events.HandleDeviceLeave("room", "camera-1")
+
+	if payload := talkbackEvent(t, monitor, model.EventTypeTalkbackEnd); payload.Reason != model.TalkbackEndReasonDeviceLeft {
+		t.Fatalf("talkback_end reason = %s, want device_left", payload.Reason)
+	}
+}
+
+func TestTalkbackActivatedByRenegotiation(t *testing.T) {
+	r := newEventTestRoom(t)
+	camera := r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackRequest, "room", "monitor-1", &model.TalkbackRequestPayload{TargetDeviceID: "camera-1"})); err != nil {
+		t.Fatalf("talkback request: %v", err)
+	}
+
+	// Camera发起的重新协商不会让对讲生效
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "camera-1", negotiation("monitor-1", model.NegotiationSDPOffer))); err != nil {
+		t.Fatalf("camera offer: %v", err)
+	}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPAnswer))); err != nil {
+		t.Fatalf("monitor answer: %v", err)
+	}
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "monitor-1", negotiation("camera-1", model.NegotiationSDPOffer))); err != nil {
+		t.Fatalf("monitor offer: %v", err)
+	}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeRenegotiate, "room", "camera-1", negotiation("monitor-1", model.NegotiationSDPAnswer))); err != nil {
+		t.Fatalf("camera answer: %v", err)
+	}
+	for _, client := range []*websocket.Conn{camera, monitor} {
+		if payload := talkbackEvent(t, client, model.EventTypeTalkbackActive); !payload.Session.Negotiated {
+			t.Fatalf("talkback_active session = %+v", payload.Session)
+		}
+	}
+}
+
+func TestTalkbackEndsWithoutRenegotiation(t *testing.T) {
+	original := talkbackNegotiationTimeout
+	talkbackNegotiationTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { talkbackNegotiationTimeout = original })
+
+	r := newEventTestRoom(t)
+	r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeTalkbackRequest, "room", "monitor-1", &model.TalkbackRequestPayload{TargetDeviceID: "camera-1"})); err != nil {
+		t.Fatalf("talkback request: %v", err)
+	}
+	if payload := talkbackEvent(t, monitor, model.EventTypeTalkbackEnd); payload.Reason != model.TalkbackEndReasonNegotiationFailed {
+		t.Fatalf("talkback_end reason = %s, want negotiation_failed", payload.Reason)
+	}
+}
+
+// counterValue 读取计数器指标的当前值
+func counterValue(t *testing.T, collector prometheus.Collector, labels map[string]string) float64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] == label.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(labels) {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestProcessEventMetrics(t *testing.T) {
+	r := newEventTestRoom(t)
+	r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+
+	unknown := map[string]string{"type": metrics.UnknownLabel, "result": "error"}
+	before := counterValue(t, metrics.EventsProcessed, unknown)
+	// 未知事件类型使用固定标签，避免客户端随意构造标签
+	if err := r.events.ProcessEvent(testEvent("made_up_type", "room", "camera-1", nil)); err == nil {
+		t.Fatal("unknown event type was accepted")
+	}
+	if got := counterValue(t, metrics.EventsProcessed, unknown) - before; got != 1 {
+		t.Fatalf("unknown events counted %v times, want 1", got)
+	}
+	if got := counterValue(t, metrics.EventsProcessed, map[string]string{"type": "made_up_type", "result": "error"}); got != 0 {
+		t.Fatalf("unknown event type was counted under its own label %v times", got)
+	}
+
+	routing := map[string]string{"type": string(model.EventTypeOffer)}
+	before = counterValue(t, metrics.RoutingFailures, routing)
+	if err := r.events.SendEventToDevice("room", "monitor-1", testEvent(model.EventTypeOffer, "room", "camera-1", nil)); err == nil {
+		t.Fatal("event to a missing device was delivered")
+	}
+	if got := counterValue(t, metrics.RoutingFailures, routing) - before; got != 1 {
+		t.Fatalf("routing failures counted %v times, want 1", got)
+	}
+}
+
+func TestStatsReportPushesQualityToMonitor(t *testing.T) {
+	r := newEventTestRoom(t)
+	r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+	r.join(t, "room", "camera-2", model.DeviceTypeCamera)
+
+	for name, payload := range map[string]*model.StatsReportPayload{
+		"packet loss above 1": {TargetDeviceID: "monitor-1", PacketLoss: 1.5},
+		"negative RTT":        {TargetDeviceID: "monitor-1", RTT: -1},
+		"camera peer":         {TargetDeviceID: "camera-2"},
+	} {
+		if err := r.events.ProcessEvent(testEvent(model.EventTypeStatsReport, "room", "camera-1", payload)); err == nil {
+			t.Errorf("stats report with %s was accepted", name)
+		}
+	}
+
+	report := &model.StatsReportPayload{TargetDeviceID: "monitor-1", Bitrate: 1000000, PacketLoss: 0.1, RTT: 80, CandidatePairType: "relay"}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeStatsReport, "room", "camera-1", report)); err != nil {
+		t.Fatalf("stats report: %v", err)
+	}
+
+	event := readEvent(t, monitor, model.EventTypeQuality)
+	var payload model.QualityPayload
+	if err := event.ParsePayload(&payload); err != nil {
+		t.Fatalf("parse quality: %v", err)
+	}
+	quality := payload.Quality
+	if event.DeviceID != "camera-1" || quality.CameraID != "camera-1" || quality.MonitorID != "monitor-1" ||
+		quality.Level != model.QualityLevelPoor || quality.Camera.CandidatePairType != "relay" {
+		t.Fatalf("quality event from %s = %+v", event.DeviceID, quality)
+	}
+}
+
+// recordSpans 在测试期间使用记录所有span的全局TracerProvider
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestOfferAndAnswerShareTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	r := newEventTestRoom(t)
+	camera := r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+
+	offer := &model.WebRTCOfferPayload{TargetDeviceID: "monitor-1", SDP: "v=0"}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeOffer, "room", "camera-1", offer)); err != nil {
+		t.Fatalf("offer: %v", err)
+	}
+	// 转发的事件携带追踪上下文
+	if forwarded := readEvent(t, monitor, model.EventTypeOffer); forwarded.Trace["traceparent"] == "" {
+		t.Fatalf("forwarded offer has no trace context: %v", forwarded.Trace)
+	}
+
+	// 未携带追踪上下文的应答关联到同一设备对最近一次协商的链路
+	answer := &model.WebRTCAnswerPayload{TargetDeviceID: "camera-1", SDP: "v=0"}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeAnswer, "room", "monitor-1", answer)); err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	readEvent(t, camera, model.EventTypeAnswer)
+
+	spans := recorder.Ended()
+	names := make(map[string]int)
+	for _, span := range spans {
+		names[span.Name()]++
+		if span.SpanContext().TraceID() != spans[0].SpanContext().TraceID() {
+			t.Fatalf("span %s is in trace %s, want %s", span.Name(), span.SpanContext().TraceID(), spans[0].SpanContext().TraceID())
+		}
+	}
+	if names["EventService.ProcessEvent"] != 2 || names["EventService.SendEventToDevice"] != 2 {
+		t.Fatalf("recorded spans = %v", names)
+	}
+}
+
+func TestStatusChangesAreRecordedWithCause(t *testing.T) {
+	r := newEventTestRoom(t)
+	r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeCameraReady, "room", "camera-1", &model.ReadyPayload{})); err != nil {
+		t.Fatalf("camera_ready: %v", err)
+	}
+	r.events.HandleDeviceLeave("room", "camera-1")
+
+	timeline, err := r.history.GetHistory("room", "camera-1", 0, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	causes := make([]model.EventType, 0)
+	for _, transition := range timeline.Transitions {
+		causes = append(causes, transition.Cause)
+	}
+	last := timeline.Transitions[len(timeline.Transitions)-1]
+	if last.To != model.DeviceStatusLeft || timeline.Counts[model.DeviceStatusReady] != 1 {
+		t.Fatalf("timeline causes %v, counts %v", causes, timeline.Counts)
+	}
+	for _, transition := range timeline.Transitions {
+		if transition.To == model.DeviceStatusReady && transition.Cause != model.EventTypeCameraReady {
+			t.Fatalf("ready caused by %s, want camera_ready", transition.Cause)
+		}
+	}
+}
+
+// chatText 读取下一个聊天消息事件的内容
+func chatText(t *testing.T, client *websocket.Conn) string {
+	t.Helper()
+
+	var payload model.ChatMessagePayload
+	if err := readEvent(t, client, model.EventTypeChatMessage).ParsePayload(&payload); err != nil || payload.Message == nil {
+		t.Fatalf("parse chat_message: %v", err)
+	}
+	return payload.Message.Text
+}
+
+func TestChatMessageRouting(t *testing.T) {
+	r := newEventTestRoom(t)
+	camera := r.join(t, "room", "camera-1", model.DeviceTypeCamera)
+	monitor := r.join(t, "room", "monitor-1", model.DeviceTypeMonitor)
+	other := r.join(t, "room", "camera-2", model.DeviceTypeCamera)
+
+	for _, payload := range []*model.ChatMessagePayload{
+		{Text: "   "},
+		{Text: strings.Repeat("字", maxChatMessageLength+1)},
+		{Text: "hello", TargetDeviceID: "missing"},
+	} {
+		if err := r.events.ProcessEvent(testEvent(model.EventTypeChatMessage, "room", "monitor-1", payload)); err == nil {
+			t.Fatalf("chat message %+v was accepted", payload)
+		}
+	}
+
+	// 私聊消息只发给目标设备和发送方
+	private := &model.ChatMessagePayload{Text: " private ", TargetDeviceID: "camera-1"}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeChatMessage, "room", "monitor-1", private)); err != nil {
+		t.Fatalf("private message: %v", err)
+	}
+	if err := r.events.ProcessEvent(testEvent(model.EventTypeChatMessage, "room", "monitor-1", &model.ChatMessagePayload{Text: "everyone"})); err != nil {
+		t.Fatalf("room message: %v", err)
+	}
+	for name, client := range map[string]*websocket.Conn{"camera-1": camera, "monitor-1": monitor} {
+		if text := chatText(t, client); text != "private" {
+			t.Fatalf("%s first message = %q, want the trimmed private message", name, text)
+		}
+	}
+	if text := chatText(t, other); text != "everyone" {
+		t.Fatalf("camera-2 first message = %q, want the room message", text)
+	}
+
+	// 聊天记录同样按可见性过滤
+	history, err := r.rooms.GetChatMessages("room", "camera-2")
+	if err != nil || len(history) != 1 || history[0].Text != "everyone" || history[0].FromDeviceID != "monitor-1" {
+		t.Fatalf("camera-2 history = %+v, %v", history, err)
+	}
+	if history, _ := r.rooms.GetChatMessages("room", "camera-1"); len(history) != 2 {
+		t.Fatalf("camera-1 history has %d messages, want 2", len(history))
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"errors"
+
+	"monitor/model"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrInvalidResumeToken 恢复凭证与设备不匹配
+var ErrInvalidResumeToken = errors.New("恢复凭证无效")
+
+// HandoffService 进程交接服务接口：旧进程导出房间和设备状态，新进程恢复后等待设备携带恢复凭证重新连接
+type HandoffService interface {
+	// ResumeToken 签发设备在交接后重新连接时使用的恢复凭证，凭证在恢复窗口结束后过期
+	ResumeToken(roomID string, deviceID string) string
+
+	// ResumeDevice 校验旧进程签发的恢复凭证，为等待恢复的设备绑定新的连接，设备状态保持不变，
+	// 凭证使用后失效
+	ResumeDevice(roomID string, deviceID string, token string, conn *websocket.Conn) (*model.Device, error)
+
+	// Snapshot 导出本节点的房间和设备状态
+	Snapshot() *model.HandoffState
+
+	// Restore 恢复旧进程导出的状态，返回恢复的房间数和设备数
+	Restore(state *model.HandoffState) (int, int, error)
+
+	// RemovePendingDevices 移除仍未重新连接的设备，返回按房间ID分组的设备，旧进程签发的凭证随之失效
+	RemovePendingDevices() map[string][]*model.Device
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"monitor/model"
+)
+
+// HandoffServiceImpl 进程交接服务实现
+type HandoffServiceImpl struct {
+	rooms        *RoomServiceImpl
+	resumeWindow time.Duration // 恢复凭证的有效期
+
+	mutex        sync.Mutex
+	secret       []byte              // 本进程签发恢复凭证的密钥，每个进程随机生成
+	resumeSecret []byte              // 旧进程的密钥，只用于校验旧进程签发的凭证，恢复窗口结束后清空
+	usedTokens   map[string]struct{} // 已使用的恢复凭证
+}
+
+// NewHandoffService 创建进程交接服务，rooms必须是NewRoomService创建的本节点房间服务，
+// resumeWindow为新进程等待设备重连的时间，也是恢复凭证的有效期
+func NewHandoffService(rooms RoomService, resumeWindow time.Duration) (HandoffService, error) {
+	local, ok := rooms.(*RoomServiceImpl)
+	if !ok {
+		return nil, fmt.Errorf("handoff requires the local room service, got %T", rooms)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate resume secret: %w", err)
+	}
+
+	return &HandoffServiceImpl{
+		rooms:        local,
+		resumeWindow: resumeWindow,
+		secret:       secret,
+		usedTokens:   make(map[string]struct{}),
+	}, nil
+}
+
+// ResumeToken 签发设备的恢复凭证，格式为 过期时间（毫秒）.HMAC，HMAC覆盖房间ID、设备ID和过期时间
+func (s *HandoffServiceImpl) ResumeToken(roomID string, deviceID string) string {
+	s.mutex.Lock()
+	secret := s.secret
+	s.mutex.Unlock()
+
+	expires := strconv.FormatInt(time.Now().Add(s.resumeWindow).UnixNano()/int64(time.Millisecond), 10)
+	return expires + "." + resumeMAC(secret, roomID, deviceID, expires)
+}
+
+// ResumeDevice 校验恢复凭证，为等待恢复的设备绑定新的连接
+func (s *HandoffServiceImpl) ResumeDevice(roomID string, deviceID string, token string, conn *websocket.Conn) (*model.Device, error) {
+	expires, mac, found := strings.Cut(token, ".")
+	if !found {
+		return nil, ErrInvalidResumeToken
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().UnixNano()/int64(time.Millisecond) > expiresAt {
+		return nil, ErrInvalidResumeToken
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.resumeSecret) == 0 || !hmac.Equal([]byte(mac), []byte(resumeMAC(s.resumeSecret, roomID, deviceID, expires))) {
+		return nil, ErrInvalidResumeToken
+	}
+	if _, used := s.usedTokens[token]; used {
+		return nil, ErrInvalidResumeToken
+	}
+
+	device, err := s.rooms.resumeDevice(roomID, deviceID, conn)
+	if err != nil {
+		return nil, err
+	}
+	s.usedTokens[token] = struct{}{}
+	return device, nil
+}
+
+// resumeMAC 计算恢复凭证的HMAC-SHA256
+func resumeMAC(secret []byte, roomID string, deviceID string, expires string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(roomID + "\x00" + deviceID + "\x00" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Snapshot 导出本节点的房间和设备状态，以及本进程签发凭证的密钥
+func (s *HandoffServiceImpl) Snapshot() *model.HandoffState {
+	s.mutex.Lock()
+	secret := s.secret
+	s.mutex.Unlock()
+
+	return &model.HandoffState{
+		Version:      model.HandoffStateVersion,
+		ResumeSecret: secret,
+		Rooms:        s.rooms.snapshot(),
+		CreateTime:   time.Now().UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// Restore 恢复旧进程导出的状态。旧进程的密钥只用于校验它签发的凭证，
+// 本进程之后签发的凭证使用自己的密钥，密钥因此在每次交接时更换
+func (s *HandoffServiceImpl) Restore(state *model.HandoffState) (int, int, error) {
+	if state.Version != model.HandoffStateVersion {
+		return 0, 0, fmt.Errorf("unsupported handoff state version %d", state.Version)
+	}
+	if len(state.ResumeSecret) == 0 {
+		return 0, 0, errors.New("handoff state has no resume secret")
+	}
+
+	s.mutex.Lock()
+	s.resumeSecret = state.ResumeSecret
+	s.mutex.Unlock()
+
+	devices := 0
+	for _, snapshot := range state.Rooms {
+		s.rooms.restoreRoom(snapshot)
+		devices += len(snapshot.Devices)
+	}
+	return len(state.Rooms), devices, nil
+}
+
+// RemovePendingDevices 移除仍未重新连接的设备，并清空旧进程的密钥和已使用的凭证
+func (s *HandoffServiceImpl) RemovePendingDevices() map[string][]*model.Device {
+	s.mutex.Lock()
+	s.resumeSecret = nil
+	s.usedTokens = make(map[string]struct{})
+	s.mutex.Unlock()
+
+	return s.rooms.removePendingDevices()
+}
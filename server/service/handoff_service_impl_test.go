@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"monitor/model"
+)
+
+// newHandoffTestService 创建使用新房间服务的交接服务
+func newHandoffTestService(t *testing.T, resumeWindow time.Duration) (HandoffService, RoomService) {
+	t.Helper()
+
+	rooms := NewRoomService()
+	handoff, err := NewHandoffService(rooms, resumeWindow)
+	if err != nil {
+		t.Fatalf("NewHandoffService: %v", err)
+	}
+	return handoff, rooms
+}
+
+// handoffRoundTrip 把旧进程的快照经过JSON编码后交给新进程恢复
+func handoffRoundTrip(t *testing.T, old HandoffService, successor HandoffService) {
+	t.Helper()
+
+	data, err := json.Marshal(old.Snapshot())
+	if err != nil {
+		t.Fatalf("marshal snapshot: %v", err)
+	}
+	var state model.HandoffState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("unmarshal snapshot: %v", err)
+	}
+	if _, _, err := successor.Restore(&state); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+}
+
+func TestHandoffStateRoundTrip(t *testing.T) {
+	old, oldRooms := newHandoffTestService(t, time.Minute)
+	if err := oldRooms.JoinRoom("room", &model.Device{ID: "camera-1", Type: model.DeviceTypeCamera}, nil); err != nil {
+		t.Fatalf("JoinRoom: %v", err)
+	}
+	if err := oldRooms.UpdateDeviceStatus("room", "camera-1", model.DeviceStatusStreaming); err != nil {
+		t.Fatalf("UpdateDeviceStatus: %v", err)
+	}
+	if err := oldRooms.AddChatMessage("room", &model.ChatMessage{ID: "m1", FromDeviceID: "camera-1", Text: "hello"}); err != nil {
+		t.Fatalf("AddChatMessage: %v", err)
+	}
+	token := old.ResumeToken("room", "camera-1")
+
+	successor, rooms := newHandoffTestService(t, time.Minute)
+	handoffRoundTrip(t, old, successor)
+
+	// 恢复的设备没有连接，状态和聊天记录保持不变
+	if _, err := rooms.GetDeviceConnection("room", "camera-1"); err == nil {
+		t.Fatal("restored device has a connection before resuming")
+	}
+	messages, _ := rooms.GetChatMessages("room", "camera-1")
+	if len(messages) != 1 || messages[0].Text != "hello" {
+		t.Fatalf("restored chat messages = %+v", messages)
+	}
+
+	if _, err := successor.ResumeDevice("room", "camera-1", old.ResumeToken("room", "camera-2"), nil); err == nil {
+		t.Fatal("ResumeDevice accepted a token issued for another device")
+	}
+	device, err := successor.ResumeDevice("room", "camera-1", token, nil)
+	if err != nil {
+		t.Fatalf("ResumeDevice: %v", err)
+	}
+	if device.Status != model.DeviceStatusStreaming {
+		t.Fatalf("resumed device status = %s, want streaming", device.Status)
+	}
+}
+
+func TestHandoffResumeTokenSingleUse(t *testing.T) {
+	old, oldRooms := newHandoffTestService(t, time.Minute)
+	if err := oldRooms.JoinRoom("room", &model.Device{ID: "camera-1", Type: model.DeviceTypeCamera}, nil); err != nil {
+		t.Fatalf("JoinRoom: %v", err)
+	}
+	token := old.ResumeToken("room", "camera-1")
+
+	successor, _ := newHandoffTestService(t, time.Minute)
+	handoffRoundTrip(t, old, successor)
+	if _, err := successor.ResumeDevice("room", "camera-1", token, nil); err != nil {
+		t.Fatalf("ResumeDevice: %v", err)
+	}
+
+	// 设备再次等待恢复时，已使用的凭证不能再次使用
+	handoffRoundTrip(t, old, successor)
+	if _, err := successor.ResumeDevice("room", "camera-1", token, nil); !errors.Is(err, ErrInvalidResumeToken) {
+		t.Fatalf("second ResumeDevice returned %v, want ErrInvalidResumeToken", err)
+	}
+}
+
+func TestHandoffResumeTokenExpires(t *testing.T) {
+	old, oldRooms := newHandoffTestService(t, -time.Second)
+	if err := oldRooms.JoinRoom("room", &model.Device{ID: "camera-1", Type: model.DeviceTypeCamera}, nil); err != nil {
+		t.Fatalf("JoinRoom: %v", err)
+	}
+	token := old.ResumeToken("room", "camera-1")
+
+	successor, _ := newHandoffTestService(t, time.Minute)
+	handoffRoundTrip(t, old, successor)
+	if _, err := successor.ResumeDevice("room", "camera-1", token, nil); !errors.Is(err, ErrInvalidResumeToken) {
+		t.Fatalf("ResumeDevice with an expired token returned %v, want ErrInvalidResumeToken", err)
+	}
+}
+
+func TestHandoffSecretRotates(t *testing.T) {
+	old, oldRooms := newHandoffTestService(t, time.Minute)
+	if err := oldRooms.JoinRoom("room", &model.Device{ID: "camera-1", Type: model.DeviceTypeCamera}, nil); err != nil {
+		t.Fatalf("JoinRoom: %v", err)
+	}
+	oldToken := old.ResumeToken("room", "camera-1")
+
+	successor, _ := newHandoffTestService(t, time.Minute)
+	handoffRoundTrip(t, old, successor)
+
+	// 新进程使用自己的密钥签发凭证，并把自己的密钥交给下一个进程
+	if string(successor.Snapshot().ResumeSecret) == string(old.Snapshot().ResumeSecret) {
+		t.Fatal("successor kept the predecessor's secret")
+	}
+	if _, err := successor.ResumeDevice("room", "camera-1", successor.ResumeToken("room", "camera-1"), nil); err == nil {
+		t.Fatal("ResumeDevice accepted a token issued by the successor itself")
+	}
+
+	// 恢复窗口结束后旧进程的密钥被丢弃，即使设备仍在等待恢复，旧进程签发的凭证也失效
+	successor.RemovePendingDevices()
+	for _, snapshot := range old.Snapshot().Rooms {
+		successor.(*HandoffServiceImpl).rooms.restoreRoom(snapshot)
+	}
+	if _, err := successor.ResumeDevice("room", "camera-1", oldToken, nil); !errors.Is(err, ErrInvalidResumeToken) {
+		t.Fatalf("ResumeDevice after the resume window returned %v, want ErrInvalidResumeToken", err)
+	}
+}
+
+func TestNewHandoffServiceRequiresLocalRooms(t *testing.T) {
+	if _, err := NewHandoffService(&ClusterServiceImpl{}, time.Minute); err == nil {
+		t.Fatal("NewHandoffService accepted a room service that is not the local one")
+	}
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"monitor/model"
+)
+
+// LayoutService 布局服务接口
+type LayoutService interface {
+	// CreateLayout 在房间中创建布局
+	CreateLayout(roomID string, layout *model.Layout) (*model.Layout, error)
+
+	// GetLayouts 获取房间内所有布局
+	GetLayouts(roomID string) ([]*model.Layout, error)
+
+	// GetLayout 获取房间内指定布局
+	GetLayout(roomID string, layoutID string) (*model.Layout, error)
+
+	// UpdateLayout 更新房间内指定布局
+	UpdateLayout(roomID string, layoutID string, layout *model.Layout) (*model.Layout, error)
+
+	// DeleteLayout 删除房间内指定布局
+	DeleteLayout(roomID string, layoutID string) (*model.Layout, error)
+}
@@ -0,0 +1,359 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"monitor/model"
+)
+
+// maxLayoutsPerRoom 单个房间最多保存的布局数量
+const maxLayoutsPerRoom = 32
+
+// roomLayouts 单个房间的布局集合
+type roomLayouts struct {
+	mutex   sync.Mutex
+	loaded  bool                     // 是否已从磁盘加载
+	layouts map[string]*model.Layout // key为layoutID
+}
+
+// LayoutServiceImpl 布局服务实现
+type LayoutServiceImpl struct {
+	dataDir     string      // 布局持久化目录，为空时仅保存在内存中
+	roomService RoomService // 房间服务，只为存在的房间创建布局集合
+	rooms       sync.Map    // 房间布局映射表，key为roomID，value为*roomLayouts
+}
+
+// NewLayoutService 创建布局服务
+func NewLayoutService(dataDir string, roomService RoomService) LayoutService {
+	return &LayoutServiceImpl{
+		dataDir:     dataDir,
+		roomService: roomService,
+		rooms:       sync.Map{},
+	}
+}
+
+// CreateLayout 在房间中创建布局
+func (s *LayoutServiceImpl) CreateLayout(roomID string, layout *model.Layout) (*model.Layout, error) {
+	if err := validateLayout(layout); err != nil {
+		return nil, err
+	}
+
+	rl, err := s.getRoomLayouts(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if nameTaken(rl.layouts, layout.Name, "") {
+		return nil, errors.New("布局名称已存在")
+	}
+
+	if len(rl.layouts) >= maxLayoutsPerRoom {
+		return nil, fmt.Errorf("房间布局数量不能超过%d个", maxLayoutsPerRoom)
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	created := &model.Layout{
+		ID:         generateID(),
+		RoomID:     roomID,
+		Name:       layout.Name,
+		Grid:       layout.Grid,
+		Cells:      copyCells(layout.Cells),
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	rl.layouts[created.ID] = created
+
+	if err := s.save(roomID, rl); err != nil {
+		delete(rl.layouts, created.ID)
+		return nil, err
+	}
+
+	return copyLayout(created), nil
+}
+
+// GetLayouts 获取房间内所有布局
+func (s *LayoutServiceImpl) GetLayouts(roomID string) ([]*model.Layout, error) {
+	rl, err := s.getRoomLayouts(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	return sortedLayouts(rl.layouts), nil
+}
+
+// GetLayout 获取房间内指定布局
+func (s *LayoutServiceImpl) GetLayout(roomID string, layoutID string) (*model.Layout, error) {
+	rl, err := s.getRoomLayouts(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	layout, exists := rl.layouts[layoutID]
+	if !exists {
+		return nil, errors.New("布局不存在")
+	}
+
+	return copyLayout(layout), nil
+}
+
+// UpdateLayout 更新房间内指定布局
+func (s *LayoutServiceImpl) UpdateLayout(roomID string, layoutID string, layout *model.Layout) (*model.Layout, error) {
+	if err := validateLayout(layout); err != nil {
+		return nil, err
+	}
+
+	rl, err := s.getRoomLayouts(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	old, exists := rl.layouts[layoutID]
+	if !exists {
+		return nil, errors.New("布局不存在")
+	}
+
+	if nameTaken(rl.layouts, layout.Name, layoutID) {
+		return nil, errors.New("布局名称已存在")
+	}
+
+	updated := &model.Layout{
+		ID:         old.ID,
+		RoomID:     roomID,
+		Name:       layout.Name,
+		Grid:       layout.Grid,
+		Cells:      copyCells(layout.Cells),
+		CreateTime: old.CreateTime,
+		UpdateTime: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	rl.layouts[layoutID] = updated
+
+	if err := s.save(roomID, rl); err != nil {
+		rl.layouts[layoutID] = old
+		return nil, err
+	}
+
+	return copyLayout(updated), nil
+}
+
+// DeleteLayout 删除房间内指定布局
+func (s *LayoutServiceImpl) DeleteLayout(roomID string, layoutID string) (*model.Layout, error) {
+	rl, err := s.getRoomLayouts(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	old, exists := rl.layouts[layoutID]
+	if !exists {
+		return nil, errors.New("布局不存在")
+	}
+	delete(rl.layouts, layoutID)
+
+	if err := s.save(roomID, rl); err != nil {
+		rl.layouts[layoutID] = old
+		return nil, err
+	}
+
+	return copyLayout(old), nil
+}
+
+// getRoomLayouts 获取房间的布局集合，首次访问时从磁盘加载。
+// 只为在线的房间或已保存过布局的房间创建集合，避免任意房间ID占用内存
+func (s *LayoutServiceImpl) getRoomLayouts(roomID string) (*roomLayouts, error) {
+	if !model.ValidRoomID(roomID) {
+		return nil, errors.New("无效的房间ID")
+	}
+
+	value, exists := s.rooms.Load(roomID)
+	if !exists {
+		if !s.roomExists(roomID) {
+			return nil, errors.New("房间不存在")
+		}
+		value, _ = s.rooms.LoadOrStore(roomID, &roomLayouts{
+			layouts: make(map[string]*model.Layout),
+		})
+	}
+	rl := value.(*roomLayouts)
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if !rl.loaded {
+		if err := s.load(roomID, rl); err != nil {
+			return nil, err
+		}
+		rl.loaded = true
+	}
+
+	return rl, nil
+}
+
+// roomExists 房间是否在线，或在磁盘上有已保存的布局
+func (s *LayoutServiceImpl) roomExists(roomID string) bool {
+	if room, err := s.roomService.GetRoom(roomID); err == nil && room != nil {
+		return true
+	}
+
+	if s.dataDir == "" {
+		return false
+	}
+	_, err := os.Stat(s.layoutFile(roomID))
+	return err == nil
+}
+
+// layoutFile 房间布局文件路径，房间ID经过转义后作为文件名
+func (s *LayoutServiceImpl) layoutFile(roomID string) string {
+	return filepath.Join(s.dataDir, "layouts", url.PathEscape(roomID)+".json")
+}
+
+// load 从磁盘加载房间布局，调用方需持有rl.mutex
+func (s *LayoutServiceImpl) load(roomID string, rl *roomLayouts) error {
+	if s.dataDir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.layoutFile(roomID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取布局文件失败: %w", err)
+	}
+
+	var layouts []*model.Layout
+	if err := json.Unmarshal(data, &layouts); err != nil {
+		return fmt.Errorf("解析布局文件失败: %w", err)
+	}
+
+	for _, layout := range layouts {
+		rl.layouts[layout.ID] = layout
+	}
+
+	return nil
+}
+
+// save 将房间布局写入磁盘，调用方需持有rl.mutex
+func (s *LayoutServiceImpl) save(roomID string, rl *roomLayouts) error {
+	if s.dataDir == "" {
+		return nil
+	}
+
+	path := s.layoutFile(roomID)
+	if len(rl.layouts) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除布局文件失败: %w", err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("创建布局目录失败: %w", err)
+	}
+
+	data, err := json.MarshalIndent(sortedLayouts(rl.layouts), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致文件损坏
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("写入布局文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("写入布局文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// validateLayout 校验布局参数
+func validateLayout(layout *model.Layout) error {
+	if layout.Name == "" {
+		return errors.New("布局名称不能为空")
+	}
+
+	cellCount := layout.Grid.CellCount()
+	if cellCount == 0 {
+		return errors.New("不支持的网格类型")
+	}
+
+	used := make(map[int]bool, len(layout.Cells))
+	for _, cell := range layout.Cells {
+		if cell.Index < 0 || cell.Index >= cellCount {
+			return fmt.Errorf("格子序号 %d 超出网格范围", cell.Index)
+		}
+		if used[cell.Index] {
+			return fmt.Errorf("格子序号 %d 重复", cell.Index)
+		}
+		if cell.DeviceID == "" && cell.DeviceName == "" {
+			return fmt.Errorf("格子 %d 未指定设备ID或设备名称", cell.Index)
+		}
+		used[cell.Index] = true
+	}
+
+	return nil
+}
+
+// nameTaken 检查布局名称是否已被其他布局使用
+func nameTaken(layouts map[string]*model.Layout, name string, excludeID string) bool {
+	for id, layout := range layouts {
+		if id != excludeID && layout.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedLayouts 按创建时间排序后返回布局副本
+func sortedLayouts(layouts map[string]*model.Layout) []*model.Layout {
+	result := make([]*model.Layout, 0, len(layouts))
+	for _, layout := range layouts {
+		result = append(result, copyLayout(layout))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreateTime != result[j].CreateTime {
+			return result[i].CreateTime < result[j].CreateTime
+		}
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}
+
+// copyLayout 复制布局，避免调用方修改内部数据
+func copyLayout(layout *model.Layout) *model.Layout {
+	copied := *layout
+	copied.Cells = copyCells(layout.Cells)
+	return &copied
+}
+
+// copyCells 复制格子列表
+func copyCells(cells []model.LayoutCell) []model.LayoutCell {
+	copied := make([]model.LayoutCell, len(cells))
+	copy(copied, cells)
+	return copied
+}
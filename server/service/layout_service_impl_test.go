@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"monitor/model"
+)
+
+// newLayoutTestRooms 创建包含指定在线房间的房间服务
+func newLayoutTestRooms(t *testing.T, roomIDs ...string) RoomService {
+	t.Helper()
+
+	rooms := NewRoomService()
+	for _, roomID := range roomIDs {
+		if err := rooms.JoinRoom(roomID, &model.Device{ID: "monitor", Type: model.DeviceTypeMonitor}, nil); err != nil {
+			t.Fatalf("join room %s: %v", roomID, err)
+		}
+	}
+	return rooms
+}
+
+// testLayout 创建只有一个格子的布局
+func testLayout(name string) *model.Layout {
+	return &model.Layout{
+		Name:  name,
+		Grid:  model.LayoutGrid2x2,
+		Cells: []model.LayoutCell{{Index: 0, DeviceID: "camera-1"}},
+	}
+}
+
+func TestLayoutUnknownRoomNotStored(t *testing.T) {
+	s := NewLayoutService(t.TempDir(), newLayoutTestRooms(t)).(*LayoutServiceImpl)
+
+	for i := 0; i < 100; i++ {
+		roomID := fmt.Sprintf("missing-%d", i)
+		if _, err := s.GetLayouts(roomID); err == nil {
+			t.Fatalf("GetLayouts(%s) succeeded for a room that does not exist", roomID)
+		}
+		if _, err := s.CreateLayout(roomID, testLayout("main")); err == nil {
+			t.Fatalf("CreateLayout(%s) succeeded for a room that does not exist", roomID)
+		}
+	}
+
+	count := 0
+	s.rooms.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count != 0 {
+		t.Fatalf("layout service stored %d rooms, want 0", count)
+	}
+}
+
+func TestLayoutRoomIDMatchesWebSocket(t *testing.T) {
+	// 房间ID包含WebSocket路径允许的字符，布局文件名需要转义
+	roomID := "大厅.1:east"
+	dir := t.TempDir()
+	s := NewLayoutService(dir, newLayoutTestRooms(t, roomID))
+
+	created, err := s.CreateLayout(roomID, testLayout("main"))
+	if err != nil {
+		t.Fatalf("CreateLayout: %v", err)
+	}
+
+	// 房间离线后，已保存过布局的房间仍可以读取
+	reloaded := NewLayoutService(dir, newLayoutTestRooms(t))
+	layouts, err := reloaded.GetLayouts(roomID)
+	if err != nil {
+		t.Fatalf("GetLayouts after reload: %v", err)
+	}
+	if len(layouts) != 1 || layouts[0].ID != created.ID {
+		t.Fatalf("reloaded layouts = %+v, want [%s]", layouts, created.ID)
+	}
+
+	for _, invalid := range []string{"", ".", "..", "a/b", "a\\b", strings.Repeat("a", model.MaxRoomIDLength+1)} {
+		if _, err := s.GetLayouts(invalid); err == nil {
+			t.Fatalf("GetLayouts(%q) accepted an invalid room ID", invalid)
+		}
+	}
+}
+
+func TestLayoutLimitPerRoom(t *testing.T) {
+	s := NewLayoutService("", newLayoutTestRooms(t, "room"))
+
+	for i := 0; i < maxLayoutsPerRoom; i++ {
+		if _, err := s.CreateLayout("room", testLayout(fmt.Sprintf("layout-%d", i))); err != nil {
+			t.Fatalf("CreateLayout %d: %v", i, err)
+		}
+	}
+	if _, err := s.CreateLayout("room", testLayout("one-too-many")); err == nil {
+		t.Fatal("CreateLayout succeeded beyond the per-room limit")
+	}
+
+	layouts, err := s.GetLayouts("room")
+	if err != nil {
+		t.Fatalf("GetLayouts: %v", err)
+	}
+	if len(layouts) != maxLayoutsPerRoom {
+		t.Fatalf("got %d layouts, want %d", len(layouts), maxLayoutsPerRoom)
+	}
+
+	// 删除后可以继续创建
+	if _, err := s.DeleteLayout("room", layouts[0].ID); err != nil {
+		t.Fatalf("DeleteLayout: %v", err)
+	}
+	if _, err := s.CreateLayout("room", testLayout("replacement")); err != nil {
+		t.Fatalf("CreateLayout after delete: %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"monitor/model"
+)
+
+// QualityService 连接质量服务接口
+type QualityService interface {
+	// Report 记录一次统计上报，返回更新后的连接质量
+	Report(roomID string, cameraID string, monitorID string, report *model.StatsReport) *model.PairQuality
+
+	// GetDeviceQuality 获取设备参与的所有连接的质量
+	GetDeviceQuality(roomID string, deviceID string) []*model.PairQuality
+
+	// RemoveDevice 清除设备参与的所有连接的统计数据
+	RemoveDevice(roomID string, deviceID string)
+}
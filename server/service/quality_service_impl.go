@@ -0,0 +1,148 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"monitor/model"
+)
+
+const (
+	// qualityHistorySize 每对连接保留的统计上报数量
+	qualityHistorySize = 60
+
+	// 质量等级阈值
+	poorPacketLoss = 0.05
+	poorRTT        = 400
+	fairPacketLoss = 0.02
+	fairRTT        = 200
+)
+
+// QualityServiceImpl 连接质量服务实现，数据只保存在内存中
+type QualityServiceImpl struct {
+	mutex sync.Mutex
+	pairs map[string]*model.PairQuality // key为roomID/cameraID/monitorID
+}
+
+// NewQualityService 创建连接质量服务
+func NewQualityService() QualityService {
+	return &QualityServiceImpl{
+		pairs: make(map[string]*model.PairQuality),
+	}
+}
+
+// Report 记录一次统计上报
+func (s *QualityServiceImpl) Report(roomID string, cameraID string, monitorID string, report *model.StatsReport) *model.PairQuality {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := roomID + "/" + cameraID + "/" + monitorID
+	pair, exists := s.pairs[key]
+	if !exists {
+		pair = &model.PairQuality{
+			RoomID:    roomID,
+			CameraID:  cameraID,
+			MonitorID: monitorID,
+		}
+		s.pairs[key] = pair
+	}
+
+	if report.ReporterID == cameraID {
+		pair.Camera = report
+	} else {
+		pair.Monitor = report
+	}
+
+	if len(pair.History) >= qualityHistorySize {
+		pair.History = append(pair.History[:0], pair.History[len(pair.History)-qualityHistorySize+1:]...)
+	}
+	pair.History = append(pair.History, report)
+	pair.Level = evaluateQuality(pair)
+	pair.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
+
+	return copyPairQuality(pair, false)
+}
+
+// GetDeviceQuality 获取设备参与的所有连接的质量
+func (s *QualityServiceImpl) GetDeviceQuality(roomID string, deviceID string) []*model.PairQuality {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]*model.PairQuality, 0)
+	for _, pair := range s.pairs {
+		if pair.RoomID == roomID && (pair.CameraID == deviceID || pair.MonitorID == deviceID) {
+			result = append(result, copyPairQuality(pair, true))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CameraID != result[j].CameraID {
+			return result[i].CameraID < result[j].CameraID
+		}
+		return result[i].MonitorID < result[j].MonitorID
+	})
+
+	return result
+}
+
+// RemoveDevice 清除设备参与的所有连接的统计数据
+func (s *QualityServiceImpl) RemoveDevice(roomID string, deviceID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, pair := range s.pairs {
+		if pair.RoomID == roomID && (pair.CameraID == deviceID || pair.MonitorID == deviceID) {
+			delete(s.pairs, key)
+		}
+	}
+}
+
+// evaluateQuality 根据双方最近的上报评估质量等级，取较差一方
+func evaluateQuality(pair *model.PairQuality) model.QualityLevel {
+	level := model.QualityLevelUnknown
+	for _, report := range []*model.StatsReport{pair.Camera, pair.Monitor} {
+		if report == nil {
+			continue
+		}
+
+		current := model.QualityLevelGood
+		switch {
+		case report.PacketLoss > poorPacketLoss || report.RTT > poorRTT:
+			current = model.QualityLevelPoor
+		case report.PacketLoss > fairPacketLoss || report.RTT > fairRTT:
+			current = model.QualityLevelFair
+		}
+
+		if qualityRank(current) > qualityRank(level) {
+			level = current
+		}
+	}
+
+	return level
+}
+
+// qualityRank 质量等级的严重程度，数值越大越差
+func qualityRank(level model.QualityLevel) int {
+	switch level {
+	case model.QualityLevelGood:
+		return 1
+	case model.QualityLevelFair:
+		return 2
+	case model.QualityLevelPoor:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// copyPairQuality 复制连接质量，withHistory为false时不包含历史记录
+func copyPairQuality(pair *model.PairQuality, withHistory bool) *model.PairQuality {
+	copied := *pair
+	copied.History = nil
+	if withHistory {
+		copied.History = make([]*model.StatsReport, len(pair.History))
+		copy(copied.History, pair.History)
+	}
+	return &copied
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+
+	"monitor/model"
+)
+
+func TestQualityLevelUsesWorseReport(t *testing.T) {
+	quality := NewQualityService()
+
+	pair := quality.Report("room", "camera-1", "monitor-1", &model.StatsReport{ReporterID: "camera-1", PacketLoss: 0.01, RTT: 50})
+	if pair.Level != model.QualityLevelGood {
+		t.Fatalf("level after a good camera report = %s, want good", pair.Level)
+	}
+
+	pair = quality.Report("room", "camera-1", "monitor-1", &model.StatsReport{ReporterID: "monitor-1", PacketLoss: 0.03, RTT: 50})
+	if pair.Level != model.QualityLevelFair || pair.Camera == nil || pair.Monitor == nil {
+		t.Fatalf("pair after a fair monitor report = %+v, want fair with both reports", pair)
+	}
+
+	pair = quality.Report("room", "camera-1", "monitor-1", &model.StatsReport{ReporterID: "camera-1", RTT: 500})
+	if pair.Level != model.QualityLevelPoor {
+		t.Fatalf("level after a high RTT report = %s, want poor", pair.Level)
+	}
+	if pair.History != nil {
+		t.Fatal("Report returned the history")
+	}
+}
+
+func TestQualityHistoryIsBounded(t *testing.T) {
+	quality := NewQualityService()
+	for i := 0; i < qualityHistorySize+10; i++ {
+		quality.Report("room", "camera-1", "monitor-1", &model.StatsReport{ReporterID: "camera-1", Bitrate: int64(i)})
+	}
+	quality.Report("room", "camera-2", "monitor-1", &model.StatsReport{ReporterID: "monitor-1"})
+
+	pairs := quality.GetDeviceQuality("room", "camera-1")
+	if len(pairs) != 1 {
+		t.Fatalf("camera-1 pairs = %d, want 1", len(pairs))
+	}
+	history := pairs[0].History
+	if len(history) != qualityHistorySize || history[len(history)-1].Bitrate != int64(qualityHistorySize+9) {
+		t.Fatalf("history has %d reports ending with bitrate %d", len(history), history[len(history)-1].Bitrate)
+	}
+
+	if pairs := quality.GetDeviceQuality("room", "monitor-1"); len(pairs) != 2 || pairs[0].CameraID != "camera-1" {
+		t.Fatalf("monitor-1 pairs = %+v, want both cameras sorted", pairs)
+	}
+
+	quality.RemoveDevice("room", "camera-1")
+	if pairs := quality.GetDeviceQuality("room", "monitor-1"); len(pairs) != 1 || pairs[0].CameraID != "camera-2" {
+		t.Fatalf("monitor-1 pairs after camera-1 left = %+v", pairs)
+	}
+}
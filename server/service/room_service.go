@@ -1,11 +1,16 @@
 package service
 
 import (
+	"errors"
+
 	"monitor/model"
 
 	"github.com/gorilla/websocket"
 )
 
+// ErrRemoteDevice 设备连接在集群的其他节点上，需要通过ForwardEvent发送事件
+var ErrRemoteDevice = errors.New("设备连接在其他节点")
+
 // RoomService 房间服务接口
 type RoomService interface {
 	// CreateRoom 创建房间
@@ -18,8 +23,9 @@ type RoomService interface {
 	// JoinRoom 设备加入房间
 	JoinRoom(roomID string, device *model.Device, conn *websocket.Conn) error
 
-	// LeaveRoom 设备离开房间
-	LeaveRoom(roomID string, deviceID string) error
+	// LeaveRoom 设备离开房间，conn不为nil时只在设备仍使用该连接时移除，
+	// 同ID的设备已重新加入时返回model.ErrDeviceReplaced
+	LeaveRoom(roomID string, deviceID string, conn *websocket.Conn) error
 
 	// UpdateDeviceStatus 更新设备状态
 	UpdateDeviceStatus(roomID string, deviceID string, status model.DeviceStatus) error
@@ -36,6 +42,15 @@ type RoomService interface {
 	// GetDeviceById 根据设备ID获取设备信息
 	GetDeviceById(roomID string, deviceID string) (*model.Device, error)
 
-	// GetDeviceConnection 获取设备WebSocket连接
+	// GetDeviceConnection 获取设备WebSocket连接，设备连接在其他节点时返回ErrRemoteDevice
 	GetDeviceConnection(roomID string, deviceID string) (*model.SafeConn, error)
+
+	// ForwardEvent 将事件转发给连接在其他节点上的设备
+	ForwardEvent(roomID string, deviceID string, event *model.Event) error
+
+	// AddChatMessage 记录房间聊天消息
+	AddChatMessage(roomID string, message *model.ChatMessage) error
+
+	// GetChatMessages 获取对指定设备可见的房间聊天记录
+	GetChatMessages(roomID string, deviceID string) ([]*model.ChatMessage, error)
 }
@@ -15,7 +15,7 @@ import (
 
 // RoomServiceImpl 房间服务实现
 type RoomServiceImpl struct {
-	rooms sync.Map // 房间映射表，使用sync.Map减少锁的使用
+	rooms sync.Map // 房间映射表，key为roomID，value为*model.Room；房间内的设备由房间自身的锁保护
 }
 
 // NewRoomService 创建房间服务
@@ -32,16 +32,14 @@ func (s *RoomServiceImpl) CreateRoom(name string) (*model.Room, error) {
 	// 创建房间对象
 	now := time.Now().UnixNano() / int64(time.Millisecond)
 	roomID := generateRoomID()
-	// 检查ID是否已存在，如果存在则重新生成
-	for s.roomExists(roomID) {
+	// 保存房间，ID已存在时重新生成
+	for {
+		room := model.NewRoom(roomID, name, now)
+		if _, loaded := s.rooms.LoadOrStore(roomID, room); !loaded {
+			return room, nil
+		}
 		roomID = s.generateSixDigitRoomID()
 	}
-
-	room := model.NewRoom(roomID, name, now)
-	// 保存房间
-	s.rooms.Store(roomID, room)
-
-	return room, nil
 }
 
 func (s *RoomServiceImpl) GetRooms() ([]*model.Room, error) {
@@ -73,42 +71,82 @@ func (s *RoomServiceImpl) GetRoom(roomID string) (*model.Room, error) {
 	return room, nil
 }
 
-// JoinRoom 设备加入房间
+// JoinRoom 设备加入房间，房间不存在时创建
+// Monitor唯一性检查和加入由房间原子完成；房间恰好因最后一个设备离开而关闭时重新创建
 func (s *RoomServiceImpl) JoinRoom(roomID string, device *model.Device, conn *websocket.Conn) error {
-	// 检查房间是否存在
-	roomObj, exists := s.rooms.Load(roomID)
-	var room *model.Room
-
-	if !exists {
-		// 如果房间不存在，则创建房间
+	for {
 		now := time.Now().UnixNano() / int64(time.Millisecond)
-		room = model.NewRoom(roomID, "Room "+roomID, now)
-		s.rooms.Store(roomID, room)
-	} else {
-		room = roomObj.(*model.Room)
+		roomObj, exists := s.rooms.Load(roomID)
+		if !exists {
+			roomObj, _ = s.rooms.LoadOrStore(roomID, model.NewRoom(roomID, "Room "+roomID, now))
+		}
+		room := roomObj.(*model.Room)
+
+		err := room.JoinDevice(device, conn, now)
+		if errors.Is(err, model.ErrRoomClosed) {
+			// 关闭的房间可能还未从映射表删除
+			s.rooms.CompareAndDelete(roomID, room)
+			continue
+		}
+		return err
 	}
+}
 
-	// 如果是Monitor设备，检查房间是否已有Monitor设备
-	if device.Type == model.DeviceTypeMonitor && room.HasMonitor() {
-		return errors.New("房间已有Monitor设备")
+// resumeDevice 为交接后等待恢复的设备绑定新的连接
+func (s *RoomServiceImpl) resumeDevice(roomID string, deviceID string, conn *websocket.Conn) (*model.Device, error) {
+	roomObj, exists := s.rooms.Load(roomID)
+	if !exists {
+		return nil, model.ErrDeviceNotPending
 	}
+	return roomObj.(*model.Room).ResumeDevice(deviceID, conn, time.Now().UnixNano()/int64(time.Millisecond))
+}
 
-	// 设置设备信息
-	now := time.Now().UnixNano() / int64(time.Millisecond)
-	device.Status = model.DeviceStatusConnected
-	device.RoomID = roomID
-	device.CreateTime = now
-	device.UpdateTime = now
+// snapshot 导出所有未关闭的房间
+func (s *RoomServiceImpl) snapshot() []*model.RoomSnapshot {
+	snapshots := make([]*model.RoomSnapshot, 0)
+	s.rooms.Range(func(key, value interface{}) bool {
+		room := value.(*model.Room)
+		if !room.IsClosed() {
+			snapshots = append(snapshots, room.Snapshot())
+		}
+		return true
+	})
+	return snapshots
+}
 
-	// 将设备添加到房间
-	room.AddDevice(device, conn)
-	room.UpdateTime = now
+// restoreRoom 按快照恢复房间，设备在重新连接前处于等待恢复状态
+func (s *RoomServiceImpl) restoreRoom(snapshot *model.RoomSnapshot) {
+	room := model.NewRoom(snapshot.ID, snapshot.Name, snapshot.CreateTime)
+	room.UpdateTime = snapshot.UpdateTime
+	for _, device := range snapshot.Devices {
+		room.RestoreDevice(device)
+	}
+	for _, message := range snapshot.Messages {
+		room.AddChatMessage(message)
+	}
+	s.rooms.Store(snapshot.ID, room)
+}
 
-	return nil
+// removePendingDevices 移除所有仍在等待恢复的设备，房间因此变空时删除房间
+func (s *RoomServiceImpl) removePendingDevices() map[string][]*model.Device {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	removed := make(map[string][]*model.Device)
+	s.rooms.Range(func(key, value interface{}) bool {
+		room := value.(*model.Room)
+		devices, closed := room.RemovePendingDevices(now)
+		if len(devices) > 0 {
+			removed[room.ID] = devices
+		}
+		if closed {
+			s.rooms.CompareAndDelete(key, room)
+		}
+		return true
+	})
+	return removed
 }
 
-// LeaveRoom 设备离开房间
-func (s *RoomServiceImpl) LeaveRoom(roomID string, deviceID string) error {
+// LeaveRoom 设备离开房间，conn不为nil时只在设备仍使用该连接时移除
+func (s *RoomServiceImpl) LeaveRoom(roomID string, deviceID string, conn *websocket.Conn) error {
 	// 检查房间是否存在
 	roomObj, exists := s.rooms.Load(roomID)
 	if !exists {
@@ -117,15 +155,13 @@ func (s *RoomServiceImpl) LeaveRoom(roomID string, deviceID string) error {
 
 	room := roomObj.(*model.Room)
 
-	// 从房间中移除设备
-	room.RemoveDevice(deviceID)
-
-	// 更新房间信息
-	room.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
-
-	// 如果房间内没有设备，则删除房间
-	if len(room.GetAllDevices()) == 0 {
-		s.rooms.Delete(roomID)
+	// 从房间中移除设备，房间内没有设备时房间关闭并删除
+	closed, err := room.RemoveDevice(deviceID, conn, time.Now().UnixNano()/int64(time.Millisecond))
+	if err != nil {
+		return err
+	}
+	if closed {
+		s.rooms.CompareAndDelete(roomID, room)
 	}
 
 	return nil
@@ -141,21 +177,11 @@ func (s *RoomServiceImpl) UpdateDeviceStatus(roomID string, deviceID string, sta
 
 	room := roomObj.(*model.Room)
 
-	// 检查设备是否存在
-	device, exists := room.GetDevice(deviceID)
-	if !exists {
+	// 更新设备状态，同时维护房间的状态索引
+	if _, exists := room.SetDeviceStatus(deviceID, status, time.Now().UnixNano()/int64(time.Millisecond)); !exists {
 		return errors.New("设备不存在")
 	}
 
-	// 检查设备是否在指定房间
-	if device.RoomID != roomID {
-		return errors.New("设备不在指定房间")
-	}
-
-	// 更新设备状态
-	device.Status = status
-	device.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
-
 	return nil
 }
 
@@ -234,6 +260,37 @@ func (s *RoomServiceImpl) GetDeviceConnection(roomID string, deviceID string) (*
 	return conn, nil
 }
 
+// ForwardEvent 单节点部署时所有设备都在本节点，不需要转发
+func (s *RoomServiceImpl) ForwardEvent(roomID string, deviceID string, event *model.Event) error {
+	return errors.New("未启用集群")
+}
+
+// AddChatMessage 记录房间聊天消息
+func (s *RoomServiceImpl) AddChatMessage(roomID string, message *model.ChatMessage) error {
+	// 检查房间是否存在
+	roomObj, exists := s.rooms.Load(roomID)
+	if !exists {
+		return errors.New("房间不存在")
+	}
+
+	room := roomObj.(*model.Room)
+	room.AddChatMessage(message)
+
+	return nil
+}
+
+// GetChatMessages 获取对指定设备可见的房间聊天记录
+func (s *RoomServiceImpl) GetChatMessages(roomID string, deviceID string) ([]*model.ChatMessage, error) {
+	// 检查房间是否存在
+	roomObj, exists := s.rooms.Load(roomID)
+	if !exists {
+		return nil, errors.New("房间不存在")
+	}
+
+	room := roomObj.(*model.Room)
+	return room.GetChatMessages(deviceID), nil
+}
+
 // generateSixDigitRoomID 生成六位数字的房间ID
 func (s *RoomServiceImpl) generateSixDigitRoomID() string {
 	// 生成100000-999999之间的随机数
@@ -243,12 +300,6 @@ func (s *RoomServiceImpl) generateSixDigitRoomID() string {
 	return strconv.Itoa(roomID)
 }
 
-// roomExists 检查房间ID是否已存在
-func (s *RoomServiceImpl) roomExists(roomID string) bool {
-	_, exists := s.rooms.Load(roomID)
-	return exists
-}
-
 func generateRoomID() string {
 	min := 100000
 	max := 999999
@@ -0,0 +1,14 @@
+package service
+
+import (
+	"monitor/model"
+)
+
+// StatusHistoryService 设备状态历史服务接口
+type StatusHistoryService interface {
+	// Record 记录设备状态变化，状态未变化时忽略
+	Record(roomID string, deviceID string, status model.DeviceStatus, cause model.EventType)
+
+	// GetHistory 获取设备在[from, to]内的状态时间线，from为0表示从第一条记录开始，to为0表示到当前时间
+	GetHistory(roomID string, deviceID string, from int64, to int64) (*model.StatusHistory, error)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"monitor/model"
+)
+
+const (
+	// statusHistorySize 每个设备保留的状态变化数量
+	statusHistorySize = 1000
+	// statusHistoryRetention 设备离开房间后状态历史的保留时间
+	statusHistoryRetention = 24 * time.Hour
+	// statusHistoryPruneInterval 清理过期状态历史的最小间隔
+	statusHistoryPruneInterval = time.Minute
+)
+
+// StatusHistoryServiceImpl 设备状态历史服务实现，数据只保存在内存中
+type StatusHistoryServiceImpl struct {
+	mutex     sync.Mutex
+	timelines map[string][]*model.StatusTransition // key为roomID/deviceID
+	lastPrune time.Time
+}
+
+// NewStatusHistoryService 创建设备状态历史服务
+func NewStatusHistoryService() StatusHistoryService {
+	return &StatusHistoryServiceImpl{
+		timelines: make(map[string][]*model.StatusTransition),
+	}
+}
+
+// Record 记录设备状态变化，状态未变化时忽略
+func (s *StatusHistoryServiceImpl) Record(roomID string, deviceID string, status model.DeviceStatus, cause model.EventType) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	key := roomID + "/" + deviceID
+	timeline := s.timelines[key]
+
+	// 首次加入房间时设备从初始化状态开始
+	from := model.DeviceStatusInit
+	if len(timeline) > 0 {
+		from = timeline[len(timeline)-1].To
+	}
+	if from == status {
+		return
+	}
+
+	if len(timeline) >= statusHistorySize {
+		timeline = append(timeline[:0], timeline[len(timeline)-statusHistorySize+1:]...)
+	}
+	s.timelines[key] = append(timeline, &model.StatusTransition{
+		From:  from,
+		To:    status,
+		Cause: cause,
+		Time:  now.UnixNano() / int64(time.Millisecond),
+	})
+}
+
+// GetHistory 获取设备在[from, to]内的状态时间线
+func (s *StatusHistoryServiceImpl) GetHistory(roomID string, deviceID string, from int64, to int64) (*model.StatusHistory, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	timeline, exists := s.timelines[roomID+"/"+deviceID]
+	if !exists || len(timeline) == 0 {
+		return nil, errors.New("设备没有状态记录")
+	}
+
+	if to <= 0 {
+		to = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	if from > to {
+		return nil, errors.New("开始时间不能晚于结束时间")
+	}
+	if to < timeline[0].Time {
+		return nil, errors.New("统计范围内没有状态记录")
+	}
+	if from < timeline[0].Time {
+		from = timeline[0].Time
+	}
+
+	history := &model.StatusHistory{
+		RoomID:      roomID,
+		DeviceID:    deviceID,
+		Status:      timeline[len(timeline)-1].To,
+		From:        from,
+		To:          to,
+		Transitions: make([]*model.StatusTransition, 0),
+		Durations:   make(map[model.DeviceStatus]int64),
+		Counts:      make(map[model.DeviceStatus]int),
+	}
+
+	for i, transition := range timeline {
+		// 每条记录的状态持续到下一条记录，最后一条持续到当前
+		end := to
+		if i+1 < len(timeline) {
+			end = timeline[i+1].Time
+		}
+
+		if transition.Time >= from && transition.Time <= to {
+			copied := *transition
+			history.Transitions = append(history.Transitions, &copied)
+			history.Counts[transition.To]++
+		}
+
+		start := transition.Time
+		if start < from {
+			start = from
+		}
+		if end > to {
+			end = to
+		}
+		if end > start {
+			history.Durations[transition.To] += end - start
+		}
+	}
+
+	return history, nil
+}
+
+// prune 清除离开房间超过保留时间的设备历史，调用方需持有锁
+func (s *StatusHistoryServiceImpl) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < statusHistoryPruneInterval {
+		return
+	}
+	s.lastPrune = now
+
+	cutoff := now.Add(-statusHistoryRetention).UnixNano() / int64(time.Millisecond)
+	for key, timeline := range s.timelines {
+		last := timeline[len(timeline)-1]
+		if last.To == model.DeviceStatusLeft && last.Time < cutoff {
+			delete(s.timelines, key)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"monitor/model"
+)
+
+func TestStatusHistoryRecordsTransitions(t *testing.T) {
+	history := NewStatusHistoryService()
+	history.Record("room", "camera-1", model.DeviceStatusConnected, model.EventTypeJoinRoom)
+	history.Record("room", "camera-1", model.DeviceStatusConnected, model.EventTypeJoinRoom)
+	history.Record("room", "camera-1", model.DeviceStatusReady, model.EventTypeCameraReady)
+	history.Record("room", "camera-1", model.DeviceStatusLeft, model.EventTypeLeaveRoom)
+
+	// 状态未变化的记录被忽略，离开房间后仍可查询
+	timeline, err := history.GetHistory("room", "camera-1", 0, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	want := []model.StatusTransition{
+		{From: model.DeviceStatusInit, To: model.DeviceStatusConnected, Cause: model.EventTypeJoinRoom},
+		{From: model.DeviceStatusConnected, To: model.DeviceStatusReady, Cause: model.EventTypeCameraReady},
+		{From: model.DeviceStatusReady, To: model.DeviceStatusLeft, Cause: model.EventTypeLeaveRoom},
+	}
+	got := make([]model.StatusTransition, 0, len(timeline.Transitions))
+	for _, transition := range timeline.Transitions {
+		got = append(got, model.StatusTransition{From: transition.From, To: transition.To, Cause: transition.Cause})
+	}
+	if !reflect.DeepEqual(got, want) || timeline.Status != model.DeviceStatusLeft {
+		t.Fatalf("transitions = %+v, status %s", got, timeline.Status)
+	}
+
+	if _, err := history.GetHistory("room", "camera-2", 0, 0); err == nil {
+		t.Fatal("GetHistory succeeded for a device without records")
+	}
+}
+
+func TestStatusHistoryDurations(t *testing.T) {
+	history := NewStatusHistoryService().(*StatusHistoryServiceImpl)
+	history.timelines["room/camera-1"] = []*model.StatusTransition{
+		{From: model.DeviceStatusInit, To: model.DeviceStatusConnected, Time: 1000},
+		{From: model.DeviceStatusConnected, To: model.DeviceStatusStreaming, Time: 3000},
+		{From: model.DeviceStatusStreaming, To: model.DeviceStatusError, Time: 7000},
+		{From: model.DeviceStatusError, To: model.DeviceStatusStreaming, Time: 7500},
+	}
+
+	// 范围开始前的状态从范围开始计算时长，最后一条持续到范围结束
+	timeline, err := history.GetHistory("room", "camera-1", 2000, 9000)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	wantDurations := map[model.DeviceStatus]int64{
+		model.DeviceStatusConnected: 1000,
+		model.DeviceStatusStreaming: 4000 + 1500,
+		model.DeviceStatusError:     500,
+	}
+	if !reflect.DeepEqual(timeline.Durations, wantDurations) {
+		t.Fatalf("durations = %v, want %v", timeline.Durations, wantDurations)
+	}
+	wantCounts := map[model.DeviceStatus]int{model.DeviceStatusStreaming: 2, model.DeviceStatusError: 1}
+	if len(timeline.Transitions) != 3 || !reflect.DeepEqual(timeline.Counts, wantCounts) {
+		t.Fatalf("transitions = %d, counts %v", len(timeline.Transitions), timeline.Counts)
+	}
+
+	if _, err := history.GetHistory("room", "camera-1", 5000, 4000); err == nil {
+		t.Fatal("GetHistory accepted from after to")
+	}
+	if _, err := history.GetHistory("room", "camera-1", 0, 500); err == nil {
+		t.Fatal("GetHistory succeeded for a range before the first record")
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"monitor/model"
+)
+
+// WebhookService 事件回调服务接口
+type WebhookService interface {
+	// CreateWebhook 创建回调订阅
+	CreateWebhook(webhook *model.Webhook) (*model.Webhook, error)
+
+	// GetWebhooks 获取所有回调订阅
+	GetWebhooks() []*model.Webhook
+
+	// GetWebhook 获取指定回调订阅
+	GetWebhook(webhookID string) (*model.Webhook, error)
+
+	// UpdateWebhook 更新指定回调订阅，secret为空时保留原密钥
+	UpdateWebhook(webhookID string, webhook *model.Webhook) (*model.Webhook, error)
+
+	// DeleteWebhook 删除指定回调订阅，未完成的投递不再重试
+	DeleteWebhook(webhookID string) (*model.Webhook, error)
+
+	// GetDeliveries 获取订阅最近的投递记录，按创建时间倒序
+	GetDeliveries(webhookID string) ([]*model.WebhookDelivery, error)
+
+	// Dispatch 将事件投递给匹配的订阅，只加入队列，不等待HTTP请求
+	Dispatch(event *model.Event)
+
+	// Close 停止投递并等待进行中的请求完成
+	Close()
+}
@@ -0,0 +1,525 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"monitor/logger"
+	"monitor/metrics"
+	"monitor/model"
+)
+
+const (
+	// webhooksFile 回调订阅文件名
+	webhooksFile = "webhooks.json"
+	// webhookDeliveryLogSize 每个订阅保留的投递记录数量
+	webhookDeliveryLogSize = 200
+	// webhookQueueSize 投递队列长度，队列满时丢弃新的投递
+	webhookQueueSize = 1024
+	// webhookWorkers 并发投递的worker数量
+	webhookWorkers = 4
+	// webhookRequestTimeout 单次投递请求的超时时间
+	webhookRequestTimeout = 10 * time.Second
+)
+
+// WebhookConfig 事件回调配置
+type WebhookConfig struct {
+	Dir            string        // 订阅持久化目录，为空时仅保存在内存中
+	MaxAttempts    int           // 每次投递的最大尝试次数
+	InitialBackoff time.Duration // 第一次重试前的等待时间，之后每次加倍
+	MaxBackoff     time.Duration // 重试等待时间上限
+}
+
+// webhookTask 投递任务
+type webhookTask struct {
+	delivery *model.WebhookDelivery
+	body     []byte
+}
+
+// WebhookServiceImpl 事件回调服务实现
+type WebhookServiceImpl struct {
+	config WebhookConfig
+	client *http.Client
+
+	mutex      sync.Mutex
+	webhooks   map[string]*model.Webhook           // key为webhookID
+	deliveries map[string][]*model.WebhookDelivery // 投递记录，key为webhookID
+
+	queue   chan *webhookTask
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+// NewWebhookService 创建事件回调服务，加载已保存的订阅并启动投递worker
+func NewWebhookService(config WebhookConfig) (WebhookService, error) {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 1
+	}
+
+	s := &WebhookServiceImpl{
+		config:     config,
+		client:     &http.Client{Timeout: webhookRequestTimeout},
+		webhooks:   make(map[string]*model.Webhook),
+		deliveries: make(map[string][]*model.WebhookDelivery),
+		queue:      make(chan *webhookTask, webhookQueueSize),
+		stop:       make(chan struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < webhookWorkers; i++ {
+		s.workers.Add(1)
+		go s.worker()
+	}
+
+	return s, nil
+}
+
+// CreateWebhook 创建回调订阅
+func (s *WebhookServiceImpl) CreateWebhook(webhook *model.Webhook) (*model.Webhook, error) {
+	if err := validateWebhook(webhook); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	created := &model.Webhook{
+		ID:         generateID(),
+		URL:        webhook.URL,
+		Events:     copyEventTypes(webhook.Events),
+		RoomIDs:    copyStrings(webhook.RoomIDs),
+		Secret:     webhook.Secret,
+		HasSecret:  webhook.Secret != "",
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	s.webhooks[created.ID] = created
+
+	if err := s.save(); err != nil {
+		delete(s.webhooks, created.ID)
+		return nil, err
+	}
+
+	return copyWebhook(created), nil
+}
+
+// GetWebhooks 获取所有回调订阅，按创建时间排序
+func (s *WebhookServiceImpl) GetWebhooks() []*model.Webhook {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	webhooks := make([]*model.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.sortedWebhooks() {
+		webhooks = append(webhooks, copyWebhook(webhook))
+	}
+	return webhooks
+}
+
+// GetWebhook 获取指定回调订阅
+func (s *WebhookServiceImpl) GetWebhook(webhookID string) (*model.Webhook, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	webhook, exists := s.webhooks[webhookID]
+	if !exists {
+		return nil, errors.New("回调订阅不存在")
+	}
+	return copyWebhook(webhook), nil
+}
+
+// UpdateWebhook 更新指定回调订阅，secret为空时保留原密钥
+func (s *WebhookServiceImpl) UpdateWebhook(webhookID string, webhook *model.Webhook) (*model.Webhook, error) {
+	if err := validateWebhook(webhook); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists := s.webhooks[webhookID]
+	if !exists {
+		return nil, errors.New("回调订阅不存在")
+	}
+
+	secret := webhook.Secret
+	if secret == "" {
+		secret = old.Secret
+	}
+
+	updated := &model.Webhook{
+		ID:         old.ID,
+		URL:        webhook.URL,
+		Events:     copyEventTypes(webhook.Events),
+		RoomIDs:    copyStrings(webhook.RoomIDs),
+		Secret:     secret,
+		HasSecret:  secret != "",
+		CreateTime: old.CreateTime,
+		UpdateTime: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	s.webhooks[webhookID] = updated
+
+	if err := s.save(); err != nil {
+		s.webhooks[webhookID] = old
+		return nil, err
+	}
+
+	return copyWebhook(updated), nil
+}
+
+// DeleteWebhook 删除指定回调订阅
+func (s *WebhookServiceImpl) DeleteWebhook(webhookID string) (*model.Webhook, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists := s.webhooks[webhookID]
+	if !exists {
+		return nil, errors.New("回调订阅不存在")
+	}
+	delete(s.webhooks, webhookID)
+
+	if err := s.save(); err != nil {
+		s.webhooks[webhookID] = old
+		return nil, err
+	}
+
+	delete(s.deliveries, webhookID)
+	return copyWebhook(old), nil
+}
+
+// GetDeliveries 获取订阅最近的投递记录，按创建时间倒序
+func (s *WebhookServiceImpl) GetDeliveries(webhookID string) ([]*model.WebhookDelivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.webhooks[webhookID]; !exists {
+		return nil, errors.New("回调订阅不存在")
+	}
+
+	log := s.deliveries[webhookID]
+	deliveries := make([]*model.WebhookDelivery, 0, len(log))
+	for i := len(log) - 1; i >= 0; i-- {
+		copied := *log[i]
+		deliveries = append(deliveries, &copied)
+	}
+	return deliveries, nil
+}
+
+// Dispatch 将事件投递给匹配的订阅，只加入队列，不等待HTTP请求
+func (s *WebhookServiceImpl) Dispatch(event *model.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.webhooks) == 0 {
+		return
+	}
+
+	// 追踪上下文只在服务内部使用，不发送给订阅方
+	sent := *event
+	sent.Trace = nil
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, webhook := range s.sortedWebhooks() {
+		if !webhook.Matches(event) {
+			continue
+		}
+
+		delivery := &model.WebhookDelivery{
+			ID:         generateID(),
+			WebhookID:  webhook.ID,
+			EventType:  event.Type,
+			RoomID:     event.RoomID,
+			DeviceID:   event.DeviceID,
+			Status:     model.WebhookDeliveryPending,
+			CreateTime: now,
+		}
+
+		body, err := json.Marshal(&model.WebhookPayload{
+			DeliveryID: delivery.ID,
+			WebhookID:  webhook.ID,
+			Event:      &sent,
+		})
+		if err != nil {
+			slog.Warn("marshal webhook payload failed", logger.KeyEventType, event.Type, logger.KeyError, err)
+			continue
+		}
+
+		s.appendDelivery(delivery)
+
+		select {
+		case s.queue <- &webhookTask{delivery: delivery, body: body}:
+		default:
+			delivery.Status = model.WebhookDeliveryFailed
+			delivery.Error = "投递队列已满"
+			metrics.WebhookDeliveries.WithLabelValues("dropped").Inc()
+			slog.Warn("webhook queue full, delivery dropped",
+				logger.KeyRoomID, event.RoomID, logger.KeyEventType, event.Type, "webhookId", webhook.ID)
+		}
+	}
+}
+
+// Close 停止投递并等待进行中的请求完成，等待重试的投递被放弃
+func (s *WebhookServiceImpl) Close() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.workers.Wait()
+}
+
+// worker 从队列中取出任务并投递
+func (s *WebhookServiceImpl) worker() {
+	defer s.workers.Done()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case task := <-s.queue:
+			s.attempt(task)
+		}
+	}
+}
+
+// attempt 执行一次投递，失败时按指数退避安排重试
+func (s *WebhookServiceImpl) attempt(task *webhookTask) {
+	s.mutex.Lock()
+	webhook, exists := s.webhooks[task.delivery.WebhookID]
+	if !exists {
+		s.mutex.Unlock()
+		return
+	}
+	target, secret := webhook.URL, webhook.Secret
+	s.mutex.Unlock()
+
+	statusCode, err := s.post(target, secret, task)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delivery := task.delivery
+	delivery.Attempts++
+	delivery.LastAttemptTime = time.Now().UnixNano() / int64(time.Millisecond)
+	delivery.StatusCode = statusCode
+	delivery.NextAttemptTime = 0
+
+	if err == nil {
+		delivery.Status = model.WebhookDeliverySucceeded
+		delivery.Error = ""
+		metrics.WebhookDeliveries.WithLabelValues("ok").Inc()
+		return
+	}
+
+	delivery.Error = err.Error()
+	if delivery.Attempts >= s.config.MaxAttempts {
+		delivery.Status = model.WebhookDeliveryFailed
+		metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+		slog.Warn("webhook delivery failed",
+			logger.KeyRoomID, delivery.RoomID, logger.KeyEventType, delivery.EventType,
+			"webhookId", delivery.WebhookID, "attempts", delivery.Attempts, logger.KeyError, err)
+		return
+	}
+
+	backoff := s.backoff(delivery.Attempts)
+	delivery.NextAttemptTime = delivery.LastAttemptTime + backoff.Milliseconds()
+	metrics.WebhookDeliveries.WithLabelValues("retry").Inc()
+
+	time.AfterFunc(backoff, func() {
+		select {
+		case <-s.stop:
+		case s.queue <- task:
+		}
+	})
+}
+
+// post 发送回调请求，返回响应状态码
+func (s *WebhookServiceImpl) post(target string, secret string, task *webhookTask) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(task.body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", task.delivery.WebhookID)
+	req.Header.Set("X-Webhook-Delivery", task.delivery.ID)
+	req.Header.Set("X-Webhook-Event", string(task.delivery.EventType))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if secret != "" {
+		req.Header.Set("X-Webhook-Signature", signWebhook(secret, timestamp, task.body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("回调返回状态码 %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff 第attempts次失败后的重试等待时间
+func (s *WebhookServiceImpl) backoff(attempts int) time.Duration {
+	backoff := s.config.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if s.config.MaxBackoff > 0 && backoff >= s.config.MaxBackoff {
+			return s.config.MaxBackoff
+		}
+	}
+	return backoff
+}
+
+// appendDelivery 追加投递记录，超出数量时丢弃最早的记录，调用方需持有锁
+func (s *WebhookServiceImpl) appendDelivery(delivery *model.WebhookDelivery) {
+	log := s.deliveries[delivery.WebhookID]
+	if len(log) >= webhookDeliveryLogSize {
+		log = append(log[:0], log[len(log)-webhookDeliveryLogSize+1:]...)
+	}
+	s.deliveries[delivery.WebhookID] = append(log, delivery)
+}
+
+// webhooksFile 回调订阅文件路径
+func (s *WebhookServiceImpl) webhooksFile() string {
+	return filepath.Join(s.config.Dir, webhooksFile)
+}
+
+// load 从磁盘加载回调订阅
+func (s *WebhookServiceImpl) load() error {
+	if s.config.Dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.webhooksFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取回调订阅文件失败: %w", err)
+	}
+
+	var webhooks []*model.Webhook
+	if err := json.Unmarshal(data, &webhooks); err != nil {
+		return fmt.Errorf("解析回调订阅文件失败: %w", err)
+	}
+
+	for _, webhook := range webhooks {
+		s.webhooks[webhook.ID] = webhook
+	}
+	return nil
+}
+
+// save 将回调订阅写入磁盘，文件中包含签名密钥，调用方需持有锁
+func (s *WebhookServiceImpl) save() error {
+	if s.config.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.config.Dir, 0o700); err != nil {
+		return fmt.Errorf("创建回调订阅目录失败: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s.sortedWebhooks(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致文件损坏
+	path := s.webhooksFile()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("写入回调订阅文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("写入回调订阅文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// sortedWebhooks 按创建时间排序的订阅列表，调用方需持有锁
+func (s *WebhookServiceImpl) sortedWebhooks() []*model.Webhook {
+	webhooks := make([]*model.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		if webhooks[i].CreateTime != webhooks[j].CreateTime {
+			return webhooks[i].CreateTime < webhooks[j].CreateTime
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks
+}
+
+// signWebhook 计算回调签名：HMAC-SHA256(secret, timestamp + "." + body)
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhook 校验回调订阅参数
+func validateWebhook(webhook *model.Webhook) error {
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return errors.New("无效的回调地址")
+	}
+
+	for _, roomID := range webhook.RoomIDs {
+		if !model.ValidRoomID(roomID) {
+			return fmt.Errorf("无效的房间ID: %s", roomID)
+		}
+	}
+
+	return nil
+}
+
+// copyWebhook 复制回调订阅，不包含签名密钥
+func copyWebhook(webhook *model.Webhook) *model.Webhook {
+	copied := *webhook
+	copied.Events = copyEventTypes(webhook.Events)
+	copied.RoomIDs = copyStrings(webhook.RoomIDs)
+	copied.Secret = ""
+	return &copied
+}
+
+// copyEventTypes 复制事件类型切片
+func copyEventTypes(values []model.EventType) []model.EventType {
+	if values == nil {
+		return nil
+	}
+	copied := make([]model.EventType, len(values))
+	copy(copied, values)
+	return copied
+}
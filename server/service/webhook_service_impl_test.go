@@ -0,0 +1,204 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"monitor/model"
+)
+
+// webhookRequest 回调接收方收到的请求
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+	time   time.Time
+}
+
+// webhookReceiver 记录收到的回调请求，前failures次返回500
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	failures int
+	requests []webhookRequest
+}
+
+// ServeHTTP 记录请求并返回状态码
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, webhookRequest{header: req.Header.Clone(), body: body, time: time.Now()})
+	if len(r.requests) <= r.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// received 已收到的请求
+func (r *webhookReceiver) received() []webhookRequest {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]webhookRequest(nil), r.requests...)
+}
+
+// newWebhookTestService 创建回调服务和接收方，返回订阅ID
+func newWebhookTestService(t *testing.T, config WebhookConfig, receiver *webhookReceiver, secret string) (WebhookService, string) {
+	t.Helper()
+
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	webhooks, err := NewWebhookService(config)
+	if err != nil {
+		t.Fatalf("NewWebhookService: %v", err)
+	}
+	t.Cleanup(webhooks.Close)
+
+	webhook, err := webhooks.CreateWebhook(&model.Webhook{
+		URL:     server.URL,
+		Events:  []model.EventType{model.EventTypeJoinRoom},
+		RoomIDs: []string{"room"},
+		Secret:  secret,
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	return webhooks, webhook.ID
+}
+
+// waitForDelivery 等待订阅最近一次投递结束，返回投递记录
+func waitForDelivery(t *testing.T, webhooks WebhookService, webhookID string) *model.WebhookDelivery {
+	t.Helper()
+
+	var delivery *model.WebhookDelivery
+	waitFor(t, "webhook delivery", func() bool {
+		deliveries, err := webhooks.GetDeliveries(webhookID)
+		if err != nil || len(deliveries) == 0 {
+			return false
+		}
+		delivery = deliveries[0]
+		return delivery.Status != model.WebhookDeliveryPending
+	})
+	return delivery
+}
+
+func TestWebhookDeliverySignedAndRetried(t *testing.T) {
+	receiver := &webhookReceiver{failures: 2}
+	config := WebhookConfig{MaxAttempts: 3, InitialBackoff: 50 * time.Millisecond, MaxBackoff: time.Second}
+	webhooks, webhookID := newWebhookTestService(t, config, receiver, "s3cret")
+
+	// 不符合事件类型或房间过滤条件的事件不投递
+	webhooks.Dispatch(testEvent(model.EventTypeLeaveRoom, "room", "camera-1", nil))
+	webhooks.Dispatch(testEvent(model.EventTypeJoinRoom, "other", "camera-1", nil))
+	event := testEvent(model.EventTypeJoinRoom, "room", "camera-1", nil)
+	event.Trace = map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	webhooks.Dispatch(event)
+
+	delivery := waitForDelivery(t, webhooks, webhookID)
+	if delivery.Status != model.WebhookDeliverySucceeded || delivery.Attempts != 3 || delivery.StatusCode != http.StatusNoContent {
+		t.Fatalf("delivery = %+v, want succeeded on the third attempt", delivery)
+	}
+	if deliveries, _ := webhooks.GetDeliveries(webhookID); len(deliveries) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(deliveries))
+	}
+
+	requests := receiver.received()
+	if len(requests) != 3 {
+		t.Fatalf("requests = %d, want 3", len(requests))
+	}
+	for i, request := range requests {
+		// 重试使用相同的投递ID，签名覆盖时间戳和请求体
+		if request.header.Get("X-Webhook-Delivery") != delivery.ID {
+			t.Fatalf("request %d delivery id = %s, want %s", i, request.header.Get("X-Webhook-Delivery"), delivery.ID)
+		}
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(request.header.Get("X-Webhook-Timestamp") + "."))
+		mac.Write(request.body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); request.header.Get("X-Webhook-Signature") != want {
+			t.Fatalf("request %d signature = %s, want %s", i, request.header.Get("X-Webhook-Signature"), want)
+		}
+	}
+
+	// 重试间隔按指数退避增长
+	if gap := requests[1].time.Sub(requests[0].time); gap < 50*time.Millisecond {
+		t.Fatalf("first retry after %s, want at least 50ms", gap)
+	}
+	if gap := requests[2].time.Sub(requests[1].time); gap < 100*time.Millisecond {
+		t.Fatalf("second retry after %s, want at least 100ms", gap)
+	}
+
+	var payload model.WebhookPayload
+	if err := json.Unmarshal(requests[0].body, &payload); err != nil {
+		t.Fatalf("parse payload: %v", err)
+	}
+	if payload.WebhookID != webhookID || payload.Event.DeviceID != "camera-1" || payload.Event.Trace != nil {
+		t.Fatalf("payload = %s", requests[0].body)
+	}
+}
+
+func TestWebhookDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	receiver := &webhookReceiver{failures: 10}
+	config := WebhookConfig{MaxAttempts: 2, InitialBackoff: 10 * time.Millisecond}
+	webhooks, webhookID := newWebhookTestService(t, config, receiver, "")
+
+	webhooks.Dispatch(testEvent(model.EventTypeJoinRoom, "room", "camera-1", nil))
+	delivery := waitForDelivery(t, webhooks, webhookID)
+	if delivery.Status != model.WebhookDeliveryFailed || delivery.Attempts != 2 || delivery.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("delivery = %+v, want failed after 2 attempts", delivery)
+	}
+	// 未配置密钥时不签名
+	if signature := receiver.received()[0].header.Get("X-Webhook-Signature"); signature != "" {
+		t.Fatalf("unsigned webhook sent signature %s", signature)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	webhooks := &WebhookServiceImpl{config: WebhookConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}}
+	want := map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second}
+	for attempts, backoff := range want {
+		if got := webhooks.backoff(attempts); got != backoff {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, backoff)
+		}
+	}
+}
+
+func TestWebhooksPersistWithoutExposingSecret(t *testing.T) {
+	dir := t.TempDir()
+	webhooks, err := NewWebhookService(WebhookConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewWebhookService: %v", err)
+	}
+	if _, err := webhooks.CreateWebhook(&model.Webhook{URL: "ftp://example.com"}); err == nil {
+		t.Fatal("CreateWebhook accepted a non-HTTP URL")
+	}
+	created, err := webhooks.CreateWebhook(&model.Webhook{URL: "https://example.com/hook", Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	webhooks.Close()
+	if created.Secret != "" || !created.HasSecret {
+		t.Fatalf("created webhook = %+v, want the secret hidden", created)
+	}
+
+	reloaded, err := NewWebhookService(WebhookConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	defer reloaded.Close()
+	webhook, err := reloaded.GetWebhook(created.ID)
+	if err != nil || webhook.URL != "https://example.com/hook" || !webhook.HasSecret || webhook.Secret != "" {
+		t.Fatalf("reloaded webhook = %+v, %v", webhook, err)
+	}
+	if secret := reloaded.(*WebhookServiceImpl).webhooks[created.ID].Secret; secret != "s3cret" {
+		t.Fatalf("reloaded secret = %q", secret)
+	}
+}
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName 创建Tracer时使用的名称
+const instrumentationName = "monitor"
+
+// 通用的span属性名称
+const (
+	AttrRoomID         = attribute.Key("monitor.room_id")
+	AttrDeviceID       = attribute.Key("monitor.device_id")
+	AttrDeviceType     = attribute.Key("monitor.device_type")
+	AttrEventType      = attribute.Key("monitor.event_type")
+	AttrTargetDeviceID = attribute.Key("monitor.target_device_id")
+	AttrForwarded      = attribute.Key("monitor.forwarded")
+)
+
+// Config 链路追踪配置
+type Config struct {
+	Exporter     string  // 导出方式：none、otlp、stdout
+	OTLPEndpoint string  // OTLP HTTP导出地址，如localhost:4318，为空时使用OTEL_EXPORTER_OTLP_*环境变量
+	OTLPInsecure bool    // OTLP是否使用明文HTTP
+	ServiceName  string  // 服务名称
+	SampleRatio  float64 // 采样比例，0-1
+}
+
+// Init 初始化全局TracerProvider，返回关闭函数；Exporter为none时不采集任何span
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch strings.ToLower(cfg.Exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+
+	case "otlp":
+		options := make([]otlptracehttp.Option, 0)
+		if cfg.OTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.OTLPEndpoint))
+		}
+		if cfg.OTLPInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s exporter: %w", cfg.Exporter, err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = instrumentationName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Tracer 获取全局Tracer
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Extract 从事件信封携带的追踪上下文中恢复父span
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// Inject 把当前span写入追踪上下文，未启用追踪时返回nil
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Sanitize 只保留W3C Trace Context字段，丢弃客户端附带的其他内容
+func Sanitize(carrier map[string]string) map[string]string {
+	if len(carrier) == 0 {
+		return nil
+	}
+
+	sanitized := make(map[string]string, 2)
+	for _, key := range []string{"traceparent", "tracestate"} {
+		if value, ok := carrier[key]; ok && len(value) <= 512 {
+			sanitized[key] = value
+		}
+	}
+	if len(sanitized) == 0 {
+		return nil
+	}
+	return sanitized
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	carrier := map[string]string{
+		"traceparent": traceparent,
+		"tracestate":  strings.Repeat("x", 513),
+		"baggage":     "user=alice",
+	}
+	if got := Sanitize(carrier); !reflect.DeepEqual(got, map[string]string{"traceparent": traceparent}) {
+		t.Fatalf("Sanitize = %v", got)
+	}
+	if got := Sanitize(map[string]string{"baggage": "user=alice"}); got != nil {
+		t.Fatalf("Sanitize without trace context fields = %v, want nil", got)
+	}
+}
+
+func TestInitExporters(t *testing.T) {
+	shutdown, err := Init(context.Background(), Config{Exporter: "none"})
+	if err != nil {
+		t.Fatalf("Init none: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	// 未启用追踪时不注入追踪上下文
+	if carrier := Inject(context.Background()); carrier != nil {
+		t.Fatalf("Inject without tracing = %v, want nil", carrier)
+	}
+
+	if _, err := Init(context.Background(), Config{Exporter: "zipkin"}); err == nil {
+		t.Fatal("Init accepted an unsupported exporter")
+	}
+}